@@ -0,0 +1,287 @@
+package buffer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memberSep separates an archive's path from the name of a file inside it, as in vim's zip
+// plugin: "logs.zip::app/main.log".
+const memberSep = "::"
+
+// IsArchive returns true if filename is a zip or tar archive, judged by its extension.
+func IsArchive(filename string) bool {
+	return archiveKind(filename) != ""
+}
+
+// archiveKind returns "zip", "tar" or "tgz" for a gzipped tar file, or "" for other files.
+func archiveKind(filename string) string {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".jar"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tgz"
+	}
+	return ""
+}
+
+// MemberPath returns the name used for member inside archive, which can be opened and written
+// like any other file.
+func MemberPath(archive, member string) string {
+	return archive + memberSep + member
+}
+
+// splitMember splits a path made by MemberPath, returning false for the path of a file.
+func splitMember(filename string) (string, string, bool) {
+	archive, member, ok := strings.Cut(filename, memberSep)
+	if !ok || member == "" || !IsArchive(archive) {
+		return "", "", false
+	}
+	return archive, member, true
+}
+
+// ListArchive returns the names of the files in archive, sorted. Directories aren't listed.
+func ListArchive(archive string) ([]string, error) {
+	var names []string
+	switch archiveKind(archive) {
+	case "zip":
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				names = append(names, f.Name)
+			}
+		}
+	default:
+		err := readTar(archive, func(hdr *tar.Header, r io.Reader) error {
+			if hdr.Typeflag == tar.TypeReg {
+				names = append(names, hdr.Name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readMember returns the contents of member in archive. A missing member is reported with an
+// error satisfying os.IsNotExist, so it can be created by writing it.
+func readMember(archive, member string) ([]byte, error) {
+	var data []byte
+	found := false
+	switch archiveKind(archive) {
+	case "zip":
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.Name != member {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			if data, err = io.ReadAll(rc); err != nil {
+				return nil, err
+			}
+			found = true
+			break
+		}
+	default:
+		err := readTar(archive, func(hdr *tar.Header, r io.Reader) error {
+			if hdr.Name != member || hdr.Typeflag != tar.TypeReg {
+				return nil
+			}
+			var err error
+			data, err = io.ReadAll(r)
+			found = true
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: MemberPath(archive, member), Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+// readTar calls fn with each entry of the tar archive, which may be gzipped.
+func readTar(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if archiveKind(archive) == "tgz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %v", archive, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", archive, err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeMember replaces the contents of member in archive with data, adding it if it's missing.
+// The archive is rewritten to a temporary file which then replaces it, so it isn't left half
+// written.
+func writeMember(archive, member string, data []byte) error {
+	fi, err := os.Stat(archive)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	switch archiveKind(archive) {
+	case "zip":
+		err = rewriteZip(&buf, archive, member, data)
+	default:
+		err = rewriteTar(&buf, archive, member, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(archive), "."+filepath.Base(archive)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), archive)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// rewriteZip writes the zip archive to w with member's contents replaced by data.
+func rewriteZip(w io.Writer, archive, member string, data []byte) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	zw := zip.NewWriter(w)
+	found := false
+	for _, f := range r.File {
+		if f.Name != member {
+			if err := zw.Copy(f); err != nil {
+				return err
+			}
+			continue
+		}
+		found = true
+		hdr := f.FileHeader
+		hdr.Modified = time.Now()
+		if err := writeZipFile(zw, &hdr, data); err != nil {
+			return err
+		}
+	}
+	if !found {
+		hdr := &zip.FileHeader{Name: member, Method: zip.Deflate, Modified: time.Now()}
+		if err := writeZipFile(zw, hdr, data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeZipFile adds a file with hdr and data to zw.
+func writeZipFile(zw *zip.Writer, hdr *zip.FileHeader, data []byte) error {
+	fw, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// rewriteTar writes the tar archive to w with member's contents replaced by data, gzipped if
+// the archive is.
+func rewriteTar(w io.Writer, archive, member string, data []byte) error {
+	var zw *gzip.Writer
+	if archiveKind(archive) == "tgz" {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	found := false
+	err := readTar(archive, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == member && hdr.Typeflag == tar.TypeReg {
+			found = true
+			hdr.Size, hdr.ModTime = int64(len(data)), time.Now()
+			r = bytes.NewReader(data)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		hdr := &tar.Header{Name: member, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
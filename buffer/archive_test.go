@@ -0,0 +1,115 @@
+package buffer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeArchive writes an archive of the kind named by filename's extension holding files.
+func makeArchive(t *testing.T, filename string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	switch archiveKind(filename) {
+	case "zip":
+		zw := zip.NewWriter(f)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(w, files[name])
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		var w io.Writer = f
+		var zw *gzip.Writer
+		if archiveKind(filename) == "tgz" {
+			zw = gzip.NewWriter(f)
+			w = zw
+		}
+		tw := tar.NewWriter(w)
+		for _, name := range names {
+			hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(tw, files[name])
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if zw != nil {
+			zw.Close()
+		}
+	}
+}
+
+func TestSplitMember(t *testing.T) {
+	tests := []struct {
+		filename        string
+		archive, member string
+		ok              bool
+	}{
+		{"logs.zip::app/main.log", "logs.zip", "app/main.log", true},
+		{"src.tar.gz::a::b", "src.tar.gz", "a::b", true},
+		{"logs.zip", "", "", false},
+		{"logs.zip::", "", "", false},
+		{"notes.txt::x", "", "", false},
+	}
+	for _, tt := range tests {
+		archive, member, ok := splitMember(tt.filename)
+		if archive != tt.archive || member != tt.member || ok != tt.ok {
+			t.Errorf("splitMember(%q) = %q, %q, %v, want %q, %q, %v",
+				tt.filename, archive, member, ok, tt.archive, tt.member, tt.ok)
+		}
+	}
+}
+
+func TestWriteMember(t *testing.T) {
+	for _, name := range []string{"a.zip", "a.tar", "a.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			archive := filepath.Join(t.TempDir(), name)
+			makeArchive(t, archive, map[string]string{"keep.txt": "kept\n", "dir/edit.txt": "old\n"})
+
+			if err := writeMember(archive, "dir/edit.txt", []byte("new\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeMember(archive, "added.txt", []byte("added\n")); err != nil {
+				t.Fatal(err)
+			}
+
+			names, err := ListArchive(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"added.txt", "dir/edit.txt", "keep.txt"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("ListArchive = %q, want %q", names, want)
+			}
+			for member, want := range map[string]string{"keep.txt": "kept\n", "dir/edit.txt": "new\n", "added.txt": "added\n"} {
+				data, err := readMember(archive, member)
+				if err != nil || string(data) != want {
+					t.Errorf("readMember(%s) = %q, %v, want %q", member, data, err, want)
+				}
+			}
+			if _, err := readMember(archive, "missing.txt"); !os.IsNotExist(err) {
+				t.Errorf("readMember of a missing file = %v, want not exist", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,643 @@
+// Package buffer holds the contents of files being edited, independently of how they're displayed.
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Line endings, as set with :set fileformat.
+const (
+	FormatUnix = "unix" // \n
+	FormatDOS  = "dos"  // \r\n
+	FormatMac  = "mac"  // \r, as used before OS X
+)
+
+// maxLineLength is the longest line that can be read.
+const maxLineLength = 1 << 30
+
+// formatSample is how much of a file is looked at to find its line ending.
+const formatSample = 64 << 10
+
+// Position is a 0-indexed location within a buffer.
+type Position struct {
+	Row, Col int
+}
+
+// Buffer holds the contents of a file loaded into the editor, and state tied to that file.
+type Buffer struct {
+	Num      int     // Unique buffer number, as used by :b
+	text     Storage // All contents of the file, one string per row
+	Filename string
+	NewFile  bool // true if filename didn't exist when opened and hasn't been written yet
+	// NotEdited is true if the buffer was renamed to a file which hasn't been read or written
+	// since, so writing would overwrite something the user hasn't seen. See Rename.
+	NotEdited bool
+	Modified  bool              // true if the text has changed since it was last read or written
+	BrowseDir string            // Absolute path of the directory or archive listed in the text, if browsing
+	Marks     map[byte]Position // Lowercase marks set with m, and ^ where insert mode was last left
+	LastPos   Position          // Cursor position when the buffer was last displayed
+	LargeFile bool              // true if features too slow for huge files are turned off
+	ReadOnly  bool              // Writing the file needs a '!', as after -R or :view
+	// Modifiable is false if changes to the text are refused, see CheckEditable.
+	Modifiable bool
+	Layout               // How the file is written
+	changes    int       // See Changes
+	history    history   // See EndUndoStep
+	disk       diskState // See RecordDiskState
+}
+
+// diskState is the modification time and size of a file, to tell when something else changes it.
+type diskState struct {
+	modTime time.Time
+	size    int64
+}
+
+// statDisk returns the current state of filename, the zero state if it doesn't exist or can't be
+// looked at.
+func statDisk(filename string) diskState {
+	if !IsLocal(filename) {
+		return diskState{}
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return diskState{}
+	}
+	return diskState{modTime: fi.ModTime(), size: fi.Size()}
+}
+
+// RecordDiskState notes the state of the buffer's file, after it's been read or written.
+func (b *Buffer) RecordDiskState() {
+	b.disk = statDisk(b.Filename)
+}
+
+// ChangedOnDisk reports whether the buffer's file has been changed, created or removed since
+// RecordDiskState. Only local files are checked.
+func (b *Buffer) ChangedOnDisk() bool {
+	return b.Filename != "" && b.BrowseDir == "" && !statDisk(b.Filename).equal(b.disk)
+}
+
+func (d diskState) equal(o diskState) bool {
+	return d.modTime.Equal(o.modTime) && d.size == o.size
+}
+
+// Layout is how a file's text is stored, kept so it's written back the same way.
+type Layout struct {
+	Format   string      // Line ending, one of the Format constants
+	Encoding string      // Character encoding, one of the Encoding constants
+	BOM      bool        // true if the file starts with a byte order mark
+	Binary   bool        // Read and written byte for byte, see OpenBinary
+	NoEOL    bool        // true if the last line has no line ending
+	Hex      bool        // The text is a hex dump of the file, see SetHex
+	cipher   *fileCipher // Encrypts the file, see SetKey
+}
+
+// New returns a buffer numbered num holding rows read from filename.
+func New(num int, filename string, rows []string) *Buffer {
+	return &Buffer{
+		Num:        num,
+		text:       newGapBuffer(rows),
+		Filename:   filename,
+		Marks:      make(map[byte]Position),
+		Layout:     Layout{Format: FormatUnix, Encoding: EncodingUTF8},
+		Modifiable: true,
+	}
+}
+
+// Rename changes the file the buffer is written to, without reading it. The buffer counts as
+// modified, and as a new file if nothing is there yet.
+func (b *Buffer) Rename(filename string) {
+	b.Filename = filename
+	b.MarkModified()
+	_, err := os.Stat(filename)
+	b.NewFile = IsLocal(filename) && os.IsNotExist(err)
+	b.NotEdited = !b.NewFile
+	b.RecordDiskState()
+}
+
+// Name is how the buffer is shown to the user.
+func (b *Buffer) Name() string {
+	if b.Filename == "" {
+		return "[No Name]"
+	}
+	return b.Filename
+}
+
+// IsPristine reports whether b is an empty, unnamed and unchanged buffer, like the one zi starts with.
+func (b *Buffer) IsPristine() bool {
+	return b.Filename == "" && !b.Modified && b.Len() == 0
+}
+
+// Len returns the number of lines in the buffer.
+func (b *Buffer) Len() int {
+	return b.text.Len()
+}
+
+// Line returns the 0-indexed line i, which must be in the buffer.
+func (b *Buffer) Line(i int) string {
+	return b.text.Line(i)
+}
+
+// SetLine replaces line i with s.
+func (b *Buffer) SetLine(i int, s string) {
+	if b.recording() {
+		b.record(undoOp{row: i, inserted: 1, deleted: []string{b.text.Line(i)}})
+	}
+	b.text.SetLine(i, s)
+	b.Modified = true
+	b.changes++
+}
+
+// InsertLines adds lines before line i, or at the end if i is Len().
+func (b *Buffer) InsertLines(i int, lines ...string) {
+	b.record(undoOp{row: i, inserted: len(lines)})
+	b.text.Insert(i, lines)
+	b.Modified = true
+	b.changes++
+}
+
+// DeleteLines removes lines start to end, end exclusive.
+func (b *Buffer) DeleteLines(start, end int) {
+	if b.recording() {
+		b.record(undoOp{row: start, deleted: b.Lines(start, end)})
+	}
+	b.text.Delete(start, end)
+	b.Modified = true
+	b.changes++
+}
+
+// Lines returns a copy of lines start to end, end exclusive.
+func (b *Buffer) Lines(start, end int) []string {
+	lines := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		lines = append(lines, b.text.Line(i))
+	}
+	return lines
+}
+
+// SetText replaces the whole contents of the buffer with rows, such as after reloading the
+// file. Unlike other edits it doesn't mark the buffer modified, and it can't be undone.
+func (b *Buffer) SetText(rows []string) {
+	b.SetStorage(newGapBuffer(rows))
+}
+
+// SetStorage replaces the whole contents of the buffer with text, as returned by OpenFile.
+func (b *Buffer) SetStorage(text Storage) {
+	b.Close()
+	b.text = text
+	b.changes++
+	b.clearHistory()
+}
+
+// Changes returns a count which goes up each time the text changes, to tell whether it has
+// changed since it was last looked at.
+func (b *Buffer) Changes() int {
+	return b.changes
+}
+
+// Close releases the file held open by chunked storage, if any. The buffer shouldn't be used
+// after, other than to replace its text.
+func (b *Buffer) Close() error {
+	if c, ok := b.text.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// loader is storage whose lines are found in the background, so a large file can be shown
+// before it has all been read.
+type loader interface {
+	loadingReady() <-chan struct{}
+	addIndexed() error
+	finishLoading() error
+	progress() int
+}
+
+// Loading returns a channel which receives when more of a large file being loaded in the
+// background can be added with AddLoaded, and is closed once it has all been read. It's nil if
+// nothing is being loaded.
+func (b *Buffer) Loading() <-chan struct{} {
+	if l, ok := b.text.(loader); ok {
+		return l.loadingReady()
+	}
+	return nil
+}
+
+// AddLoaded adds the lines loaded in the background so far to the end of the buffer, returning
+// an error if the file couldn't be read. Once Loading's channel is closed, use FinishLoading.
+func (b *Buffer) AddLoaded() error {
+	if l, ok := b.text.(loader); ok {
+		return l.addIndexed()
+	}
+	return nil
+}
+
+// FinishLoading waits until all of a file being loaded in the background has been added.
+func (b *Buffer) FinishLoading() error {
+	if l, ok := b.text.(loader); ok {
+		return l.finishLoading()
+	}
+	return nil
+}
+
+// LoadProgress returns how much of a file being loaded in the background has been read, as a
+// percentage, or false if it isn't being loaded.
+func (b *Buffer) LoadProgress() (int, bool) {
+	if l, ok := b.text.(loader); ok && l.loadingReady() != nil {
+		return l.progress(), true
+	}
+	return 0, false
+}
+
+// LineRange validates a range of 0-indexed lines, start inclusive and end exclusive. Negative
+// values count from the end, so -1 is after the last line.
+func (b *Buffer) LineRange(start, end int) (int, int, error) {
+	n := b.Len()
+	if start < 0 {
+		start += n + 1
+	}
+	if end < 0 {
+		end += n + 1
+	}
+	if start < 0 || end > n || start > end {
+		return 0, 0, fmt.Errorf("line range out of bounds")
+	}
+	return start, end, nil
+}
+
+// CheckEditable returns an error if the buffer's text can't be changed.
+func (b *Buffer) CheckEditable() error {
+	if b.BrowseDir != "" {
+		return fmt.Errorf("cannot edit a directory listing")
+	}
+	if _, ok := b.text.(*mappedStorage); ok {
+		return fmt.Errorf("cannot edit a file opened with --view")
+	}
+	if !b.Modifiable {
+		return fmt.Errorf("cannot make changes, 'modifiable' is off (:set ma to allow them)")
+	}
+	return nil
+}
+
+// SetLines replaces a range of lines, as given to LineRange, with lines.
+func (b *Buffer) SetLines(start, end int, lines []string) error {
+	if err := b.CheckEditable(); err != nil {
+		return err
+	}
+	start, end, err := b.LineRange(start, end)
+	if err != nil {
+		return err
+	}
+
+	b.DeleteLines(start, end)
+	b.InsertLines(start, lines...)
+	return nil
+}
+
+// WriteOptions control how WriteFile writes a file.
+type WriteOptions struct {
+	Fsync   bool   // Wait for the file to reach the disk before returning
+	Replace string // How an existing local file is replaced, one of the Replace constants, ReplaceAuto if empty
+	// ReplaceSymlinks replaces a symlink with the file written, rather than writing the file it
+	// points to.
+	ReplaceSymlinks bool
+	// Sudo writes a local file in place as root with sudo tee, for files that can't be written
+	// otherwise. sudo is never given the terminal: if it needs a password, ErrSudoPassword is
+	// returned and the write can be tried again with SudoPassword.
+	Sudo         bool
+	SudoPassword string
+	// Append adds the text to the end of a local file, which is created if it doesn't exist,
+	// rather than replacing it.
+	Append bool
+}
+
+// WriteFile writes the buffer to filename, returning the number of bytes written.
+func (b *Buffer) WriteFile(filename string, opts WriteOptions) (int, error) {
+	// Lines not yet read from a large file would be lost by overwriting it.
+	if c, ok := b.text.(*chunkedStorage); ok {
+		if err := c.finishLoading(); err != nil {
+			return 0, err
+		}
+		if fi, err := os.Stat(filename); err == nil && sameFile(c.f, fi) {
+			c.materialize()
+		}
+	}
+
+	// Check first, so the file isn't left half written.
+	var data []byte
+	if b.Hex {
+		var err error
+		if data, err = parseHex(b.Lines(0, b.Len())); err != nil {
+			return 0, err
+		}
+	} else if err := b.checkEncodable(); err != nil {
+		return 0, err
+	}
+	comp := compressorFor(filename)
+	archive, member, isMember := splitMember(filename)
+	remote := IsRemote(filename)
+	if opts.Append && (comp != "" || isMember || remote || b.cipher != nil) {
+		return 0, fmt.Errorf("cannot append to %s", filename)
+	}
+	raw := b.Hex || comp != "" || isMember || remote || b.cipher != nil // Written from data
+	if !b.Hex && raw {
+		var buf bytes.Buffer
+		b.encode(&buf)
+		data = buf.Bytes()
+	}
+	if comp != "" {
+		var err error
+		if data, err = compress(comp, data); err != nil {
+			return 0, err
+		}
+	}
+	if b.cipher != nil {
+		var err error
+		if data, err = b.cipher.seal(data); err != nil {
+			return 0, err
+		}
+	}
+	if isMember {
+		return len(data), writeMember(archive, member, data)
+	}
+	if remote {
+		return len(data), writeRemote(filename, data)
+	}
+
+	write := func(w io.Writer) (int, error) {
+		if raw {
+			return w.Write(data)
+		}
+		return b.encode(w)
+	}
+	switch {
+	case opts.Sudo:
+		return writeSudo(filename, opts.Append, opts.SudoPassword, write)
+	case opts.Append:
+		return appendLocal(filename, opts.Fsync, write)
+	}
+	return writeLocal(filename, opts, write)
+}
+
+// WriteRange writes lines start to end-1, as given to LineRange, to filename as WriteFile would.
+// The last line only goes without a line ending if it's the buffer's last line and that has none.
+func (b *Buffer) WriteRange(filename string, start, end int, opts WriteOptions) (int, error) {
+	start, end, err := b.LineRange(start, end)
+	if err != nil {
+		return 0, err
+	}
+	part := New(b.Num, filename, b.Lines(start, end))
+	part.Layout = b.Layout
+	part.NoEOL = b.NoEOL && end == b.Len()
+	if opts.Append || start > 0 {
+		part.BOM = false
+	}
+	return part.WriteFile(filename, opts)
+}
+
+// encode writes the text to w as it's stored in the file, returning the number of bytes written.
+func (b *Buffer) encode(w io.Writer) (int, error) {
+	eol := lineEnding(b.Format)
+	n := 0
+	if b.BOM {
+		n, _ = w.Write(byteOrderMark(b.Encoding))
+	}
+	var err error
+	for i := 0; i < b.Len() && err == nil; i++ {
+		line := b.Line(i)
+		if i < b.Len()-1 || !b.NoEOL {
+			line += eol
+		}
+		var m int
+		m, err = writeEncoded(w, line, b.Encoding)
+		n += m
+	}
+	return n, err
+}
+
+// lineEnding returns the bytes ending each line in format.
+func lineEnding(format string) string {
+	switch format {
+	case FormatDOS:
+		return "\r\n"
+	case FormatMac:
+		return "\r"
+	default:
+		return "\n"
+	}
+}
+
+// DetectFormat returns the line ending used by data, the start of a file. Files are only taken
+// as DOS if every line ends with \r\n, and as Mac if there are no \n at all.
+func DetectFormat(data []byte) string {
+	lf := bytes.Count(data, []byte{'\n'})
+	crlf := bytes.Count(data, []byte("\r\n"))
+	switch {
+	case lf > 0 && crlf == lf:
+		return FormatDOS
+	case lf == 0 && bytes.IndexByte(data, '\r') >= 0:
+		return FormatMac
+	default:
+		return FormatUnix
+	}
+}
+
+// IsLocal reports whether filename is a file on this machine, rather than a remote file or a
+// member of an archive.
+func IsLocal(filename string) bool {
+	_, _, member := splitMember(filename)
+	return !member && !IsRemote(filename)
+}
+
+// sameFile reports whether f is the file described by fi.
+func sameFile(f *os.File, fi os.FileInfo) bool {
+	ffi, err := f.Stat()
+	return err == nil && os.SameFile(ffi, fi)
+}
+
+// ReadLines reads all of r, returning one string per line without line endings, which may be
+// \n or \r\n.
+func ReadLines(r io.Reader) ([]string, error) {
+	rows, _, err := readLines(r, FormatDOS)
+	return rows, err
+}
+
+// readLines is ReadLines for a file in format, also returning true if the last line has no line
+// ending. Unix files are only split at \n, keeping any \r before it so it's written back, and
+// Mac files only at \r.
+func readLines(r io.Reader, format string) ([]string, bool, error) {
+	rows := make([]string, 0)
+	tr := &tailReader{r: r}
+	scanner := bufio.NewScanner(tr)
+	scanner.Buffer(nil, maxLineLength)
+	eol := byte('\n')
+	switch format {
+	case FormatUnix:
+		scanner.Split(scanLinesAt('\n'))
+	case FormatMac:
+		eol = '\r'
+		scanner.Split(scanLinesAt('\r'))
+	}
+	for scanner.Scan() {
+		rows = append(rows, scanner.Text())
+	}
+	return rows, len(rows) > 0 && tr.last != eol, scanner.Err()
+}
+
+// tailReader is a reader which remembers the last byte read through it.
+type tailReader struct {
+	r    io.Reader
+	last byte
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.last = p[n-1]
+	}
+	return n, err
+}
+
+// scanLinesAt returns a bufio.SplitFunc for lines ending in eol, which is dropped.
+func scanLinesAt(eol byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, eol); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// OpenFile returns storage holding the lines of the named file, converted to UTF-8, and how the
+// file was stored. Files of LargeFileSize or more are kept open and only read as lines are
+// needed. Their lines are found in the background, see Buffer.Loading. Compressed files are
+// decompressed, see compressors, archive members are read from their archive, see MemberPath, and
+// remote files are copied over SSH, see IsRemote. Encrypted files return ErrEncrypted.
+func OpenFile(filename string) (Storage, Layout, error) {
+	if _, _, ok := splitMember(filename); ok || IsRemote(filename) || compressorFor(filename) != "" {
+		data, err := readFileData(filename)
+		if err != nil {
+			return nil, Layout{}, err
+		}
+		return readText(bytes.NewReader(data), sampleOf(data))
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	sample := make([]byte, formatSample)
+	n, _ := io.ReadFull(f, sample)
+	sample = sample[:n]
+	if isEncrypted(sample) {
+		f.Close()
+		return nil, Layout{}, ErrEncrypted
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, Layout{}, err
+	}
+
+	if fi, err := f.Stat(); err == nil && fi.Size() >= LargeFileSize {
+		layout := largeLayout(sample)
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil {
+			layout.NoEOL = last[0] != '\n'
+		}
+		if layout.BOM {
+			f.Seek(utf8BOMLen, io.SeekStart)
+		}
+		return openChunked(f, fi.Size(), layout.Format), layout, nil
+	}
+	defer f.Close()
+	return readText(f, sample)
+}
+
+// readText returns storage holding the lines read from r, converted to UTF-8, and how they were
+// stored. sample is the start of what r will return.
+func readText(r io.Reader, sample []byte) (Storage, Layout, error) {
+	layout := Layout{Encoding: DetectEncoding(sample)}
+	// The byte order mark isn't part of the text, it's added back when writing.
+	if bom := byteOrderMark(layout.Encoding); len(bom) > 0 && bytes.HasPrefix(sample, bom) {
+		layout.BOM = true
+		sample = sample[len(bom):]
+		if _, err := io.CopyN(io.Discard, r, int64(len(bom))); err != nil {
+			return nil, Layout{}, err
+		}
+	}
+	if layout.Encoding != EncodingUTF8 {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, Layout{}, err
+		}
+		data = decode(data, layout.Encoding)
+		sample, r = sampleOf(data), bytes.NewReader(data)
+	}
+	layout.Format = DetectFormat(sample)
+
+	rows, noEOL, err := readLines(r, layout.Format)
+	layout.NoEOL = noEOL
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	return newGapBuffer(rows), layout, nil
+}
+
+// largeLayout is the layout used for a large file starting with sample. Large files are read as
+// they are, splitting lines at \n, so they're always taken as UTF-8, and Mac files are read as one
+// long line. A UTF-8 byte order mark is skipped by the caller.
+func largeLayout(sample []byte) Layout {
+	layout := Layout{
+		Format:   DetectFormat(sample),
+		Encoding: EncodingUTF8,
+		BOM:      bytes.HasPrefix(sample, byteOrderMark(EncodingUTF8)),
+	}
+	if layout.Format == FormatMac {
+		layout.Format = FormatUnix
+	}
+	return layout
+}
+
+// OpenBinary returns storage holding the exact bytes of the named file, split into lines at
+// each \n, for editing files which aren't text. Nothing is converted, and whether the last line
+// ended with \n is kept so the file is written back unchanged.
+func OpenBinary(filename string) (Storage, Layout, error) {
+	data, err := readFileData(filename)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	rows, noEOL := splitBinary(data)
+	layout := Layout{Format: FormatUnix, Encoding: EncodingUTF8, Binary: true, NoEOL: noEOL}
+	return newGapBuffer(rows), layout, nil
+}
+
+// splitBinary splits data into lines at each \n, also returning true if the last line has no \n.
+func splitBinary(data []byte) ([]string, bool) {
+	if len(data) == 0 {
+		return make([]string, 0), false
+	}
+	rows := strings.Split(string(data), "\n")
+	if data[len(data)-1] == '\n' {
+		return rows[:len(rows)-1], false
+	}
+	return rows, true
+}
+
+// ReadFile reads the named file, returning one string per line.
+func ReadFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadLines(f)
+}
@@ -0,0 +1,308 @@
+package buffer
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// LargeFileSize is the size from which files are opened with chunked storage, so only the parts
+// being viewed or edited are held in memory.
+const LargeFileSize = 64 << 20
+
+const (
+	// chunkLines is how many lines each chunk holds when a file is first indexed. Inserts can
+	// grow a chunk up to twice this before it's split.
+	chunkLines = 4096
+	// maxCleanChunks is how many unedited chunks are kept loaded, the oldest loaded are dropped
+	// first and read again from the file when next needed.
+	maxCleanChunks = 64
+	// indexBatch is how many chunks are indexed in the background before they're made available.
+	indexBatch = 16
+)
+
+// chunk is a run of lines. Until it's loaded or edited its lines are only in the file.
+type chunk struct {
+	n     int      // Number of lines
+	lines []string // nil until loaded
+	dirty bool     // true once edited, so the file no longer holds its lines
+	off   int64    // Byte offset of the chunk in the file
+	size  int64
+}
+
+// chunkedStorage is a list of chunks of lines, read from the file as they're needed. Edits only
+// copy lines within one chunk.
+type chunkedStorage struct {
+	f      *os.File
+	format string // Line ending, FormatUnix or FormatDOS, see readLines
+	chunks []*chunk
+	n      int
+	clean  []*chunk // Loaded chunks that may be dropped, oldest first
+
+	// The last chunk found and its first line, since lines are mostly read in order. Edits only
+	// change chunks from the one found onwards, so its first line stays the same.
+	hint      int
+	hintStart int
+
+	// The file is indexed in the background. Chunks are added to indexed, then moved to chunks
+	// by addIndexed, so the storage only changes when the editor asks.
+	loading  bool
+	ready    chan struct{} // Receives when there are more indexed chunks, closed when done
+	stop     chan struct{} // Closed to stop indexing early
+	size     int64         // Size of the file
+	mu       sync.Mutex    // Guards the fields below
+	indexed  []*chunk
+	indexOff int64 // How much of the file has been indexed
+	indexErr error
+}
+
+// openChunked starts indexing the lines in f in the background, without keeping them.
+func openChunked(f *os.File, size int64, format string) *chunkedStorage {
+	s := &chunkedStorage{
+		f:       f,
+		format:  format,
+		loading: true,
+		ready:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		size:    size,
+	}
+	go s.index()
+	return s
+}
+
+// index finds where each chunk of lines starts in the file, adding them to s.indexed a batch at
+// a time.
+func (s *chunkedStorage) index() {
+	defer close(s.ready)
+	// Indexing starts wherever f is, after any byte order mark.
+	off, _ := s.f.Seek(0, io.SeekCurrent)
+	r := bufio.NewReaderSize(s.f, 1<<20)
+	c := &chunk{off: off}
+	var batch []*chunk
+	flush := func(err error) {
+		s.mu.Lock()
+		s.indexed = append(s.indexed, batch...)
+		s.indexOff = off
+		s.indexErr = err
+		s.mu.Unlock()
+		batch = nil
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+	}
+	for {
+		line, err := r.ReadSlice('\n')
+		off += int64(len(line))
+		if len(line) > 0 {
+			c.n++
+		}
+		if err == bufio.ErrBufferFull {
+			// Part of a very long line, which continues in the next read.
+			c.n--
+			continue
+		}
+		if c.n == chunkLines || (err == io.EOF && c.n > 0) {
+			c.size = off - c.off
+			batch = append(batch, c)
+			c = &chunk{off: off}
+			if len(batch) == indexBatch {
+				flush(nil)
+			}
+		}
+		if err == io.EOF {
+			flush(nil)
+			return
+		}
+		if err != nil {
+			flush(err)
+			return
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// addIndexed adds the chunks indexed since it was last called, returning any error reading the
+// file.
+func (s *chunkedStorage) addIndexed() error {
+	s.mu.Lock()
+	indexed, err := s.indexed, s.indexErr
+	s.indexed = nil
+	s.mu.Unlock()
+	for _, c := range indexed {
+		s.chunks = append(s.chunks, c)
+		s.n += c.n
+	}
+	return err
+}
+
+// finishLoading waits for indexing to end and adds everything indexed.
+func (s *chunkedStorage) finishLoading() error {
+	if !s.loading {
+		return nil
+	}
+	for range s.ready {
+	}
+	s.loading = false
+	return s.addIndexed()
+}
+
+// loadingReady returns the channel told when more lines have been indexed, nil once loaded.
+func (s *chunkedStorage) loadingReady() <-chan struct{} {
+	if !s.loading {
+		return nil
+	}
+	return s.ready
+}
+
+// progress returns how much of the file has been indexed, as a percentage.
+func (s *chunkedStorage) progress() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size == 0 {
+		return 100
+	}
+	return int(s.indexOff * 100 / s.size)
+}
+
+func (s *chunkedStorage) Len() int {
+	return s.n
+}
+
+// find returns the index of the chunk holding line i and the line's index within it. Line n is
+// found at the end of the last chunk.
+func (s *chunkedStorage) find(i int) (int, int) {
+	ci, start := 0, 0
+	if s.hint < len(s.chunks) && i >= s.hintStart {
+		ci, start = s.hint, s.hintStart
+	}
+	for ci < len(s.chunks)-1 && i >= start+s.chunks[ci].n {
+		start += s.chunks[ci].n
+		ci++
+	}
+	s.hint, s.hintStart = ci, start
+	return ci, i - start
+}
+
+// load reads c's lines from the file if they aren't already in memory.
+func (s *chunkedStorage) load(c *chunk) []string {
+	if c.lines != nil {
+		return c.lines
+	}
+	lines, _, err := readLines(io.NewSectionReader(s.f, c.off, c.size), s.format)
+	if err != nil || len(lines) != c.n {
+		// The file changed or can't be read, there's nothing better to show than blank lines.
+		lines = make([]string, c.n)
+	}
+	c.lines = lines
+
+	s.clean = append(s.clean, c)
+	for len(s.clean) > maxCleanChunks {
+		old := s.clean[0]
+		s.clean = s.clean[1:]
+		if !old.dirty {
+			old.lines = nil
+		}
+	}
+	return lines
+}
+
+// edit loads chunk ci so its lines can be changed.
+func (s *chunkedStorage) edit(ci int) *chunk {
+	c := s.chunks[ci]
+	s.load(c)
+	c.dirty = true
+	return c
+}
+
+func (s *chunkedStorage) Line(i int) string {
+	if i < 0 || i >= s.n {
+		panic("buffer: line out of range")
+	}
+	ci, j := s.find(i)
+	return s.load(s.chunks[ci])[j]
+}
+
+func (s *chunkedStorage) SetLine(i int, line string) {
+	if i < 0 || i >= s.n {
+		panic("buffer: line out of range")
+	}
+	ci, j := s.find(i)
+	s.edit(ci).lines[j] = line
+}
+
+func (s *chunkedStorage) Insert(i int, lines []string) {
+	if i < 0 || i > s.n {
+		panic("buffer: insert out of range")
+	}
+	if len(lines) == 0 {
+		return
+	}
+	if len(s.chunks) == 0 {
+		s.chunks = []*chunk{{lines: []string{}, dirty: true}}
+	}
+	ci, j := s.find(i)
+	c := s.edit(ci)
+	rows := make([]string, 0, c.n+len(lines))
+	rows = append(rows, c.lines[:j]...)
+	rows = append(rows, lines...)
+	c.lines = append(rows, c.lines[j:]...)
+	c.n = len(c.lines)
+	s.n += len(lines)
+
+	// Split large chunks so later edits to them stay cheap.
+	var split []*chunk
+	for len(c.lines) > 2*chunkLines {
+		split = append(split, &chunk{n: chunkLines, lines: c.lines[:chunkLines:chunkLines], dirty: true})
+		c.lines = c.lines[chunkLines:]
+		c.n = len(c.lines)
+	}
+	if len(split) > 0 {
+		s.chunks = append(s.chunks[:ci], append(split, s.chunks[ci:]...)...)
+	}
+}
+
+func (s *chunkedStorage) Delete(start, end int) {
+	if start < 0 || end > s.n || start > end {
+		panic("buffer: delete out of range")
+	}
+	for end > start {
+		ci, j := s.find(start)
+		c := s.chunks[ci]
+		n := c.n - j
+		if end-start < n {
+			n = end - start
+		}
+		if n == c.n {
+			// Whole chunks are dropped without reading them.
+			s.chunks = append(s.chunks[:ci], s.chunks[ci+1:]...)
+		} else {
+			c = s.edit(ci)
+			c.lines = append(c.lines[:j:j], c.lines[j+n:]...)
+			c.n = len(c.lines)
+		}
+		s.n -= n
+		end -= n
+	}
+}
+
+// materialize loads every chunk, so the file can be overwritten.
+func (s *chunkedStorage) materialize() {
+	for _, c := range s.chunks {
+		s.load(c)
+		c.dirty = true
+	}
+}
+
+func (s *chunkedStorage) Close() error {
+	if s.loading {
+		close(s.stop)
+		s.finishLoading()
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,76 @@
+package buffer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openChunkedLines writes lines to a file, each ending with eol, and opens it with chunked
+// storage, waiting for it to be indexed.
+func openChunkedLines(t *testing.T, lines []string, eol, format string) *chunkedStorage {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "f.txt")
+	text := strings.Join(lines, eol) + eol
+	if err := os.WriteFile(filename, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := openChunked(f, int64(len(text)), format)
+	t.Cleanup(func() { s.Close() })
+	if err := s.finishLoading(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestChunkedStorage(t *testing.T) {
+	n := 3*chunkLines + 10
+	for _, tt := range storageEdits(n) {
+		t.Run(tt.name, func(t *testing.T) {
+			want := numberedLines(n)
+			s := openChunkedLines(t, want, "\n", FormatUnix)
+			checkStorage(t, s, want)
+			for _, e := range tt.edits {
+				want = applyEdit(s, want, e)
+				checkStorage(t, s, want)
+			}
+		})
+	}
+}
+
+func TestChunkedStorageLoading(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		eol    string
+		format string
+	}{
+		{"empty", 0, "\n", FormatUnix},
+		{"one chunk", 10, "\n", FormatUnix},
+		{"dos", chunkLines + 1, "\r\n", FormatDOS},
+		// More chunks than are kept loaded, so some are dropped and read again.
+		{"past maxCleanChunks", (maxCleanChunks + 2) * chunkLines, "\n", FormatUnix},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := numberedLines(tt.n)
+			var s *chunkedStorage
+			if tt.n == 0 {
+				s = openChunkedLines(t, nil, "", tt.format)
+			} else {
+				s = openChunkedLines(t, want, tt.eol, tt.format)
+			}
+			checkStorage(t, s, want)
+			if p := s.progress(); tt.n > 0 && p != 100 {
+				t.Errorf("progress() = %d after loading, want 100", p)
+			}
+			// Reading it all again finds dropped chunks in the file.
+			checkStorage(t, s, want)
+		})
+	}
+}
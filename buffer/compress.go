@@ -0,0 +1,105 @@
+package buffer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// compressors maps the extensions of compressed files to the program compressing them, which is
+// run with -c to compress stdin to stdout and -dc to decompress it. Compressed files are read
+// into memory whole, and compressed again when written. gzip is handled by compress/gzip, so it
+// works without the program installed.
+var compressors = map[string]string{
+	".gz":  "gzip",
+	".bz2": "bzip2",
+	".xz":  "xz",
+}
+
+// compressorFor returns the program compressing filename, judged by its extension, or "" if it
+// isn't a compressed file.
+func compressorFor(filename string) string {
+	return compressors[strings.ToLower(filepath.Ext(filename))]
+}
+
+// readFileData returns the contents of the named file, decompressed if it's compressed. Encrypted
+// files return ErrEncrypted.
+func readFileData(filename string) ([]byte, error) {
+	data, err := readRaw(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isEncrypted(data) {
+		return nil, ErrEncrypted
+	}
+	return decompress(filename, data)
+}
+
+// readRaw returns the contents of the named file, archive member as named by MemberPath, or
+// remote file, as it's stored.
+func readRaw(filename string) ([]byte, error) {
+	if archive, member, ok := splitMember(filename); ok {
+		return readMember(archive, member)
+	}
+	if IsRemote(filename) {
+		return readRemote(filename)
+	}
+	return os.ReadFile(filename)
+}
+
+// decompress returns data, read from filename, decompressed if it's a compressed file.
+func decompress(filename string, data []byte) ([]byte, error) {
+	comp := compressorFor(filename)
+	if comp == "" {
+		return data, nil
+	}
+	if comp == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		return data, nil
+	}
+	return runCompressor(comp, "-dc", data)
+}
+
+// compress returns data compressed by comp, as returned by compressorFor.
+func compress(comp string, data []byte) ([]byte, error) {
+	if comp == "gzip" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return runCompressor(comp, "-c", data)
+}
+
+// runCompressor runs comp with arg, passing data on stdin and returning its output. Errors are
+// what it printed, which starts with its name.
+func runCompressor(comp, arg string, data []byte) ([]byte, error) {
+	cmd := exec.Command(comp, arg)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return nil, fmt.Errorf("%s", strings.TrimSpace(string(ee.Stderr)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", comp, err)
+	}
+	return out, nil
+}
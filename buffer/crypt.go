@@ -0,0 +1,133 @@
+package buffer
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Encrypted files start with cryptMagic, then the salt the key was derived with, then the nonce
+// and the text sealed with AES-256-GCM.
+var cryptMagic = []byte("ZiCrypt1")
+
+const (
+	cryptSaltLen = 16
+	cryptIter    = 600000 // PBKDF2-SHA256 iterations
+)
+
+// ErrEncrypted is returned when opening an encrypted file without a key, see OpenEncrypted.
+var ErrEncrypted = errors.New("file is encrypted")
+
+// fileCipher encrypts a file with a key derived from a passphrase. Deriving it is deliberately
+// slow, so it's done once and the salt is kept for every write.
+type fileCipher struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// newFileCipher derives a cipher from passphrase and salt, choosing a new salt if it's nil.
+func newFileCipher(passphrase string, salt []byte) (*fileCipher, error) {
+	if salt == nil {
+		salt = make([]byte, cryptSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, cryptIter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fileCipher{salt: salt, aead: aead}, nil
+}
+
+// seal returns data encrypted, with a new nonce.
+func (c *fileCipher) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append(append([]byte{}, cryptMagic...), c.salt...), nonce...)
+	return c.aead.Seal(out, nonce, data, nil), nil
+}
+
+// isEncrypted returns true if data is the start of an encrypted file.
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, cryptMagic)
+}
+
+// decrypt returns the contents of an encrypted file, and the cipher to write it back with.
+func decrypt(data []byte, passphrase string) ([]byte, *fileCipher, error) {
+	data = data[len(cryptMagic):]
+	if len(data) < cryptSaltLen {
+		return nil, nil, fmt.Errorf("encrypted file is damaged")
+	}
+	c, err := newFileCipher(passphrase, data[:cryptSaltLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	data = data[cryptSaltLen:]
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return nil, nil, fmt.Errorf("encrypted file is damaged")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrong key, or the file is damaged")
+	}
+	return plain, c, nil
+}
+
+// OpenEncrypted is OpenFile for a file encrypted with passphrase, which is kept in the layout so
+// the file is encrypted again when written.
+func OpenEncrypted(filename, passphrase string) (Storage, Layout, error) {
+	data, err := readRaw(filename)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	if !isEncrypted(data) {
+		return nil, Layout{}, fmt.Errorf("%s: not an encrypted file", filename)
+	}
+	data, c, err := decrypt(data, passphrase)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	if data, err = decompress(filename, data); err != nil {
+		return nil, Layout{}, err
+	}
+	text, layout, err := readText(bytes.NewReader(data), sampleOf(data))
+	layout.cipher = c
+	return text, layout, err
+}
+
+// SetKey sets the passphrase the buffer is encrypted with when written, or turns encryption off
+// if it's empty.
+func (b *Buffer) SetKey(passphrase string) error {
+	if passphrase == "" {
+		b.cipher = nil
+		return nil
+	}
+	c, err := newFileCipher(passphrase, nil)
+	if err != nil {
+		return err
+	}
+	b.cipher = c
+	return nil
+}
+
+// Encrypted returns true if the buffer is encrypted when written.
+func (b *Buffer) Encrypted() bool {
+	return b.cipher != nil
+}
@@ -0,0 +1,93 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCryptRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		lines []string
+	}{
+		{"text", "secret.txt", []string{"the password is", "swordfish"}},
+		{"compressed", "secret.txt.gz", []string{"swordfish"}},
+		{"empty", "empty.txt", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), tt.file)
+			b := New(1, filename, append([]string(nil), tt.lines...))
+			b.Layout = Layout{Format: FormatUnix, Encoding: EncodingUTF8}
+			if err := b.SetKey("key"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.WriteFile(filename, WriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isEncrypted(data) || bytes.Contains(data, []byte("swordfish")) {
+				t.Fatalf("file written as %q, want it encrypted", data)
+			}
+			if _, _, err := OpenFile(filename); !errors.Is(err, ErrEncrypted) {
+				t.Errorf("OpenFile = %v, want ErrEncrypted", err)
+			}
+			if _, _, err := OpenEncrypted(filename, "wrong"); err == nil {
+				t.Error("OpenEncrypted with the wrong key succeeded")
+			}
+
+			text, layout, err := OpenEncrypted(filename, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, text.Len())
+			for i := range got {
+				got[i] = text.Line(i)
+			}
+			if !reflect.DeepEqual(got, tt.lines) {
+				t.Errorf("decrypted %q, want %q", got, tt.lines)
+			}
+			if layout.cipher == nil {
+				t.Error("the key wasn't kept to write the file with")
+			}
+		})
+	}
+}
+
+func TestDecryptDamaged(t *testing.T) {
+	c, err := newFileCipher("key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := c.seal([]byte("text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no salt", cryptMagic},
+		{"no nonce", sealed[:len(cryptMagic)+cryptSaltLen+2]},
+		{"changed", flipped},
+	}
+	for _, tt := range tests {
+		if _, _, err := decrypt(tt.data, "key"); err == nil {
+			t.Errorf("%s: decrypt succeeded", tt.name)
+		}
+	}
+	if plain, _, err := decrypt(sealed, "key"); err != nil || string(plain) != "text" {
+		t.Errorf("decrypt = %q, %v, want \"text\"", plain, err)
+	}
+}
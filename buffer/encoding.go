@@ -0,0 +1,152 @@
+package buffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings, as set with :set fileencoding. Text is always held as UTF-8, and converted
+// when reading and writing.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingLatin1  = "latin1"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// Encodings lists the supported character encodings.
+var Encodings = []string{EncodingUTF8, EncodingLatin1, EncodingUTF16LE, EncodingUTF16BE}
+
+// sampleOf returns the start of data used to detect how a file is stored.
+func sampleOf(data []byte) []byte {
+	if len(data) > formatSample {
+		return data[:formatSample]
+	}
+	return data
+}
+
+// DetectEncoding returns the encoding of data, the start of a file. UTF-16 is recognised by its
+// byte order mark, or by most of the high bytes of ASCII characters being zero. Anything else
+// that isn't valid UTF-8 is taken as Latin-1, which any bytes are valid in.
+func DetectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return EncodingUTF16BE
+	}
+	if len(data) >= 2 {
+		var even, odd int
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 {
+				even++
+			}
+			if data[i+1] == 0 {
+				odd++
+			}
+		}
+		pairs := len(data) / 2
+		switch {
+		case odd > pairs/2 && even == 0:
+			return EncodingUTF16LE
+		case even > pairs/2 && odd == 0:
+			return EncodingUTF16BE
+		}
+	}
+	// The sample may end part way through a character.
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	return EncodingLatin1
+}
+
+// decode converts data from encoding to UTF-8.
+func decode(data []byte, encoding string) []byte {
+	switch encoding {
+	case EncodingLatin1:
+		var b bytes.Buffer
+		for _, c := range data {
+			b.WriteRune(rune(c))
+		}
+		return b.Bytes()
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if encoding == EncodingUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return []byte(string(utf16.Decode(units)))
+	default:
+		return data
+	}
+}
+
+// writeEncoded writes s, which is UTF-8, to w in encoding, returning the number of bytes written.
+func writeEncoded(w io.Writer, s string, encoding string) (int, error) {
+	switch encoding {
+	case EncodingLatin1:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			b = append(b, byte(r))
+		}
+		return w.Write(b)
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			if encoding == EncodingUTF16LE {
+				b = append(b, byte(u), byte(u>>8))
+			} else {
+				b = append(b, byte(u>>8), byte(u))
+			}
+		}
+		return w.Write(b)
+	default:
+		return io.WriteString(w, s)
+	}
+}
+
+// utf8BOMLen is the length of the UTF-8 byte order mark.
+const utf8BOMLen = 3
+
+// byteOrderMark returns the byte order mark for encoding, if it has one.
+func byteOrderMark(encoding string) []byte {
+	switch encoding {
+	case EncodingUTF8:
+		return []byte{0xef, 0xbb, 0xbf}
+	case EncodingUTF16LE:
+		return []byte{0xff, 0xfe}
+	case EncodingUTF16BE:
+		return []byte{0xfe, 0xff}
+	}
+	return nil
+}
+
+// checkEncodable returns an error if the buffer has characters its encoding can't hold.
+func (b *Buffer) checkEncodable() error {
+	if b.Encoding != EncodingLatin1 {
+		return nil
+	}
+	for i := 0; i < b.Len(); i++ {
+		for _, r := range b.Line(i) {
+			if r > 0xff {
+				return fmt.Errorf("line %d: %q cannot be converted to %s", i+1, r, b.Encoding)
+			}
+		}
+	}
+	return nil
+}
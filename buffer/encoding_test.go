@@ -0,0 +1,84 @@
+package buffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"ascii", []byte("hello\n"), EncodingUTF8},
+		{"utf-8", []byte("caf\xc3\xa9\n"), EncodingUTF8},
+		{"utf-8 cut mid character", []byte("caf\xc3"), EncodingUTF8},
+		{"latin1", []byte("caf\xe9\n"), EncodingLatin1},
+		{"utf-16le bom", []byte{0xff, 0xfe, 'a', 0}, EncodingUTF16LE},
+		{"utf-16be bom", []byte{0xfe, 0xff, 0, 'a'}, EncodingUTF16BE},
+		{"utf-16le without bom", []byte{'a', 0, 'b', 0, '\n', 0}, EncodingUTF16LE},
+		{"utf-16be without bom", []byte{0, 'a', 0, 'b', 0, '\n'}, EncodingUTF16BE},
+		{"empty", nil, EncodingUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectEncoding(tt.in); got != tt.want {
+				t.Errorf("DetectEncoding(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       []byte
+		encoding string
+		bom      bool
+		line     string
+	}{
+		{"utf-8", []byte("caf\xc3\xa9\n"), EncodingUTF8, false, "café"},
+		{"utf-8 bom", []byte("\xef\xbb\xbfx\n"), EncodingUTF8, true, "x"},
+		{"latin1", []byte("caf\xe9\n"), EncodingLatin1, false, "café"},
+		{"utf-16le", []byte{0xff, 0xfe, 0xe9, 0, '\r', 0, '\n', 0}, EncodingUTF16LE, true, "é"},
+		{"utf-16be", []byte{0xfe, 0xff, 0xd8, 0x3d, 0xde, 0x00, 0, '\n'}, EncodingUTF16BE, true, "😀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, layout, err := readText(bytes.NewReader(tt.in), sampleOf(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout.Encoding != tt.encoding || layout.BOM != tt.bom {
+				t.Errorf("layout = %s, bom %v, want %s, %v", layout.Encoding, layout.BOM, tt.encoding, tt.bom)
+			}
+			if got := text.Line(0); got != tt.line {
+				t.Errorf("first line = %q, want %q", got, tt.line)
+			}
+			if _, out := roundTrip(t, tt.in); string(out) != string(tt.in) {
+				t.Errorf("written back as %q, want %q", out, tt.in)
+			}
+		})
+	}
+}
+
+func TestCheckEncodable(t *testing.T) {
+	tests := []struct {
+		encoding string
+		line     string
+		ok       bool
+	}{
+		{EncodingLatin1, "café", true},
+		{EncodingLatin1, "€", false},
+		{EncodingUTF8, "€", true},
+		{EncodingUTF16LE, "😀", true},
+	}
+	for _, tt := range tests {
+		b := New(1, "f.txt", []string{tt.line})
+		b.Encoding = tt.encoding
+		if err := b.checkEncodable(); (err == nil) != tt.ok {
+			t.Errorf("checkEncodable(%q in %s) = %v, want ok %v", tt.line, tt.encoding, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package buffer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		format string
+		want   []string
+		noEOL  bool
+	}{
+		{"unix", "a\nb\n", FormatUnix, []string{"a", "b"}, false},
+		{"unix without final newline", "a\nb", FormatUnix, []string{"a", "b"}, true},
+		{"unix keeps stray \\r", "a\r\nb\nc\r\n", FormatUnix, []string{"a\r", "b", "c\r"}, false},
+		{"dos", "a\r\nb\r\n", FormatDOS, []string{"a", "b"}, false},
+		{"dos with a bare \\n", "a\r\nb\n", FormatDOS, []string{"a", "b"}, false},
+		{"mac", "a\rb\r", FormatMac, []string{"a", "b"}, false},
+		{"mac without final \\r", "a\rb", FormatMac, []string{"a", "b"}, true},
+		{"empty", "", FormatUnix, []string{}, false},
+		{"blank lines", "\n\n", FormatUnix, []string{"", ""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, noEOL, err := readLines(strings.NewReader(tt.in), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || noEOL != tt.noEOL {
+				t.Errorf("readLines(%q, %s) = %q, %v, want %q, %v", tt.in, tt.format, got, noEOL, tt.want, tt.noEOL)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"a\nb\n", FormatUnix},
+		{"a\r\nb\r\n", FormatDOS},
+		{"a\r\nb", FormatDOS},
+		{"a\r\nb\n", FormatUnix},
+		{"a\rb\r", FormatMac},
+		{"one line", FormatUnix},
+		{"", FormatUnix},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.in)); got != tt.want {
+			t.Errorf("DetectFormat(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// roundTrip reads data as a file and writes it back out.
+func roundTrip(t *testing.T, data []byte) (Layout, []byte) {
+	t.Helper()
+	text, layout, err := readText(bytes.NewReader(data), sampleOf(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(1, "f.txt", nil)
+	b.SetStorage(text)
+	b.Layout = layout
+	var out bytes.Buffer
+	if _, err := b.encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return layout, out.Bytes()
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		format string
+		noEOL  bool
+	}{
+		{"unix", "a\nb\n", FormatUnix, false},
+		{"dos", "a\r\nb\r\n", FormatDOS, false},
+		{"mac", "a\rb\r", FormatMac, false},
+		{"unix with a \r\n line", "a\r\nb\n", FormatUnix, false},
+		{"no final newline", "a\r\nb", FormatDOS, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, out := roundTrip(t, []byte(tt.in))
+			if layout.Format != tt.format || layout.NoEOL != tt.noEOL {
+				t.Errorf("layout = %s, noeol %v, want %s, %v", layout.Format, layout.NoEOL, tt.format, tt.noEOL)
+			}
+			if string(out) != tt.in {
+				t.Errorf("written back as %q, want %q", out, tt.in)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package buffer
+
+// Storage holds the lines of a buffer. Indexes are 0-based, and like a slice, out of range
+// indexes panic.
+type Storage interface {
+	Len() int
+	Line(i int) string
+	SetLine(i int, s string)
+	// Insert adds lines before line i, or at the end if i is Len().
+	Insert(i int, lines []string)
+	// Delete removes lines start to end, end exclusive.
+	Delete(start, end int)
+}
+
+// minGap is the least room left for inserts each time a gapBuffer grows.
+const minGap = 64
+
+// gapBuffer stores lines with an unused gap at the last edit point, so typing on one line or
+// inserting lines close together only moves the lines between edits, not the whole file.
+type gapBuffer struct {
+	lines    []string // lines[gapStart:gapEnd] are unused
+	gapStart int
+	gapEnd   int
+}
+
+// newGapBuffer returns storage holding lines, which it takes ownership of.
+func newGapBuffer(lines []string) *gapBuffer {
+	return &gapBuffer{
+		lines:    lines[:cap(lines)],
+		gapStart: len(lines),
+		gapEnd:   cap(lines),
+	}
+}
+
+func (g *gapBuffer) Len() int {
+	return len(g.lines) - (g.gapEnd - g.gapStart)
+}
+
+// index maps line i to where it's stored, skipping over the gap.
+func (g *gapBuffer) index(i int) int {
+	if i < g.gapStart {
+		return i
+	}
+	return i + g.gapEnd - g.gapStart
+}
+
+func (g *gapBuffer) Line(i int) string {
+	return g.lines[g.index(i)]
+}
+
+func (g *gapBuffer) SetLine(i int, s string) {
+	g.lines[g.index(i)] = s
+}
+
+func (g *gapBuffer) Insert(i int, lines []string) {
+	if i < 0 || i > g.Len() {
+		panic("buffer: insert out of range")
+	}
+	g.moveGap(i)
+	g.grow(len(lines))
+	g.gapStart += copy(g.lines[g.gapStart:g.gapEnd], lines)
+}
+
+func (g *gapBuffer) Delete(start, end int) {
+	if start < 0 || end > g.Len() || start > end {
+		panic("buffer: delete out of range")
+	}
+	g.moveGap(start)
+	for n := end - start; n > 0; n-- {
+		// Drop the reference so the line can be garbage collected.
+		g.lines[g.gapEnd] = ""
+		g.gapEnd++
+	}
+}
+
+// moveGap moves the start of the gap to line i.
+func (g *gapBuffer) moveGap(i int) {
+	switch {
+	case i < g.gapStart:
+		n := g.gapStart - i
+		copy(g.lines[g.gapEnd-n:g.gapEnd], g.lines[i:g.gapStart])
+		g.gapStart -= n
+		g.gapEnd -= n
+	case i > g.gapStart:
+		n := i - g.gapStart
+		copy(g.lines[g.gapStart:], g.lines[g.gapEnd:g.gapEnd+n])
+		g.gapStart += n
+		g.gapEnd += n
+	}
+}
+
+// grow makes sure the gap has room for at least n more lines.
+func (g *gapBuffer) grow(n int) {
+	if g.gapEnd-g.gapStart >= n {
+		return
+	}
+	size := g.Len() + n
+	lines := make([]string, 2*size+minGap)
+	copy(lines, g.lines[:g.gapStart])
+	after := len(g.lines) - g.gapEnd
+	copy(lines[len(lines)-after:], g.lines[g.gapEnd:])
+	g.gapEnd = len(lines) - after
+	g.lines = lines
+}
@@ -0,0 +1,121 @@
+package buffer
+
+import (
+	"fmt"
+	"testing"
+)
+
+// storageEdit is an edit made to a Storage in tests: SetLine, Insert or Delete.
+type storageEdit struct {
+	op    byte // 's', 'i' or 'd'
+	i, j  int
+	lines []string
+}
+
+// applyEdit makes e to s and to want, a slice holding the lines s should have.
+func applyEdit(s Storage, want []string, e storageEdit) []string {
+	switch e.op {
+	case 's':
+		s.SetLine(e.i, e.lines[0])
+		want[e.i] = e.lines[0]
+	case 'i':
+		s.Insert(e.i, e.lines)
+		want = append(want[:e.i], append(append([]string(nil), e.lines...), want[e.i:]...)...)
+	case 'd':
+		s.Delete(e.i, e.j)
+		want = append(want[:e.i], want[e.j:]...)
+	}
+	return want
+}
+
+// checkStorage fails t if s doesn't hold exactly want.
+func checkStorage(t *testing.T, s Storage, want []string) {
+	t.Helper()
+	if s.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", s.Len(), len(want))
+	}
+	for i := range want {
+		if got := s.Line(i); got != want[i] {
+			t.Fatalf("Line(%d) = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+// numberedLines returns n lines, "0" to n-1.
+func numberedLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprint(i)
+	}
+	return lines
+}
+
+// storageEdits are edit sequences for storage holding numberedLines(n), for any n from 10.
+func storageEdits(n int) []struct {
+	name  string
+	edits []storageEdit
+} {
+	return []struct {
+		name  string
+		edits []storageEdit
+	}{
+		{"set", []storageEdit{{op: 's', i: 0, lines: []string{"a"}}, {op: 's', i: n - 1, lines: []string{"z"}}}},
+		{"insert at start", []storageEdit{{op: 'i', i: 0, lines: []string{"a", "b"}}}},
+		{"insert at end", []storageEdit{{op: 'i', i: n, lines: []string{"z"}}}},
+		{"insert in order", []storageEdit{
+			{op: 'i', i: 3, lines: []string{"a"}},
+			{op: 'i', i: 4, lines: []string{"b"}},
+			{op: 'i', i: 5, lines: []string{"c"}},
+		}},
+		{"insert back and forth", []storageEdit{
+			{op: 'i', i: n - 2, lines: []string{"a"}},
+			{op: 'i', i: 1, lines: []string{"b"}},
+			{op: 'i', i: n / 2, lines: []string{"c"}},
+		}},
+		{"insert many", []storageEdit{{op: 'i', i: 5, lines: numberedLines(3 * chunkLines)}}},
+		{"delete", []storageEdit{{op: 'd', i: 2, j: 5}, {op: 'd', i: 0, j: 1}}},
+		{"delete nothing", []storageEdit{{op: 'd', i: 4, j: 4}}},
+		{"delete all", []storageEdit{{op: 'd', i: 0, j: n}, {op: 'i', i: 0, lines: []string{"new"}}}},
+		{"mixed", []storageEdit{
+			{op: 'd', i: 1, j: n - 1},
+			{op: 'i', i: 1, lines: []string{"x", "y"}},
+			{op: 's', i: 2, lines: []string{"Y"}},
+			{op: 'd', i: 0, j: 1},
+		}},
+	}
+}
+
+func TestGapBuffer(t *testing.T) {
+	const n = 100
+	for _, tt := range storageEdits(n) {
+		t.Run(tt.name, func(t *testing.T) {
+			want := numberedLines(n)
+			s := newGapBuffer(numberedLines(n))
+			for _, e := range tt.edits {
+				want = applyEdit(s, want, e)
+				checkStorage(t, s, want)
+			}
+		})
+	}
+}
+
+func TestGapBufferOutOfRange(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(s Storage)
+	}{
+		{"insert past the end", func(s Storage) { s.Insert(4, []string{"x"}) }},
+		{"delete past the end", func(s Storage) { s.Delete(1, 4) }},
+		{"delete backwards", func(s Storage) { s.Delete(2, 1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("didn't panic")
+				}
+			}()
+			tt.fn(newGapBuffer(numberedLines(3)))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// hexWidth is the number of bytes shown on each line of a hex dump.
+const hexWidth = 16
+
+// HexDump returns data as the lines of a hex dump in the format of xxd: the offset, the bytes in
+// hex in groups of two, then the bytes as ASCII with a '.' for anything unprintable.
+func HexDump(data []byte) []string {
+	rows := make([]string, 0, (len(data)+hexWidth-1)/hexWidth)
+	for off := 0; off < len(data); off += hexWidth {
+		end := off + hexWidth
+		if end > len(data) {
+			end = len(data)
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%08x: ", off)
+		for i := off; i < off+hexWidth; i++ {
+			if i < end {
+				fmt.Fprintf(&sb, "%02x", data[i])
+			} else {
+				sb.WriteString("  ")
+			}
+			if i%2 == 1 {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteByte(' ')
+		for _, c := range data[off:end] {
+			if c < ' ' || c > '~' {
+				c = '.'
+			}
+			sb.WriteByte(c)
+		}
+		rows = append(rows, sb.String())
+	}
+	return rows
+}
+
+// parseHex returns the bytes in the lines of a hex dump made by HexDump. Only the hex columns are
+// read, so the offsets and the ASCII column are ignored, and lines may hold any number of bytes.
+func parseHex(rows []string) ([]byte, error) {
+	var data []byte
+	for i, row := range rows {
+		// The hex columns run from after the offset to the two spaces before the ASCII column.
+		if j := strings.Index(row, ": "); j >= 0 {
+			row = row[j+2:]
+		}
+		if j := strings.Index(row, "  "); j >= 0 {
+			row = row[:j]
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(row, " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: not pairs of hex digits", i+1)
+		}
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+// SetHex switches the text between the file's lines and a hex dump of the bytes they're stored
+// as, see HexDump. Hex digits changed in the dump are written back as bytes, and the lines are
+// read back from them when switching out of hex. Turning hex on again redraws the dump from its
+// hex digits, updating the offsets and ASCII column after edits.
+func (b *Buffer) SetHex(on bool) error {
+	if b.Hex && on {
+		data, err := parseHex(b.Lines(0, b.Len()))
+		if err != nil {
+			return err
+		}
+		b.SetText(HexDump(data))
+		return nil
+	}
+	if !b.Hex && !on {
+		return nil
+	}
+	if err := b.CheckEditable(); err != nil {
+		return err
+	}
+	if b.LargeFile {
+		return fmt.Errorf("cannot show a large file in hex")
+	}
+
+	if on {
+		if err := b.checkEncodable(); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if _, err := b.encode(&buf); err != nil {
+			return err
+		}
+		b.SetText(HexDump(buf.Bytes()))
+		b.Hex = true
+		return nil
+	}
+
+	data, err := parseHex(b.Lines(0, b.Len()))
+	if err != nil {
+		return err
+	}
+	var rows []string
+	if b.Binary {
+		rows, b.NoEOL = splitBinary(data)
+	} else {
+		if bom := byteOrderMark(b.Encoding); b.BOM && bytes.HasPrefix(data, bom) {
+			data = data[len(bom):]
+		}
+		if rows, b.NoEOL, err = readLines(bytes.NewReader(decode(data, b.Encoding)), b.Format); err != nil {
+			return err
+		}
+	}
+	b.SetText(rows)
+	b.Hex = false
+	return nil
+}
@@ -0,0 +1,82 @@
+package buffer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHexDump(t *testing.T) {
+	got := HexDump([]byte("Hello, world!\n\x00\xffmore"))
+	want := []string{
+		"00000000: 4865 6c6c 6f2c 2077 6f72 6c64 210a 00ff  Hello, world!...",
+		"00000010: 6d6f 7265                                more",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HexDump = %q, want %q", got, want)
+	}
+}
+
+func TestParseHex(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want []byte
+		err  bool
+	}{
+		{"dump", []string{"00000000: 6869 0a                                  hi."}, []byte("hi\n"), false},
+		{"ascii column ignored", []string{"00000000: 4142  XYZ  "}, []byte("AB"), false},
+		{"changed digits", []string{"00000000: 6869  hi", "00000002: ff  ."}, []byte("hi\xff"), false},
+		{"without offsets", []string{"0102 03"}, []byte{1, 2, 3}, false},
+		{"empty", nil, nil, false},
+		{"odd digits", []string{"00000000: 686  h"}, nil, true},
+		{"not hex", []string{"00000000: zz  ."}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHex(tt.rows)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseHex error = %v, want error %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("parseHex = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetHex(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		lines  []string
+	}{
+		{"unix", Layout{Format: FormatUnix, Encoding: EncodingUTF8}, []string{"a", "b"}},
+		{"dos without final newline", Layout{Format: FormatDOS, Encoding: EncodingUTF8, NoEOL: true}, []string{"a", "b"}},
+		{"utf-16 with bom", Layout{Format: FormatUnix, Encoding: EncodingUTF16LE, BOM: true}, []string{"é"}},
+		{"binary", Layout{Format: FormatUnix, Encoding: EncodingUTF8, Binary: true}, []string{"\x00\x01", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(1, "f.bin", append([]string(nil), tt.lines...))
+			b.Layout = tt.layout
+			if err := b.SetHex(true); err != nil {
+				t.Fatal(err)
+			}
+			// Redrawing the dump leaves it as it was.
+			dump := b.Lines(0, b.Len())
+			if err := b.SetHex(true); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.Lines(0, b.Len()); !reflect.DeepEqual(got, dump) {
+				t.Errorf("redrawn dump = %q, want %q", got, dump)
+			}
+			if err := b.SetHex(false); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.Lines(0, b.Len()); !reflect.DeepEqual(got, tt.lines) || b.NoEOL != tt.layout.NoEOL {
+				t.Errorf("after hex = %q, noeol %v, want %q, %v", got, b.NoEOL, tt.lines, tt.layout.NoEOL)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package buffer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// checkpointLines is how often mappedStorage remembers where a line starts. Lines in between are
+// found by scanning from the checkpoint before them.
+const checkpointLines = 1024
+
+// indexBlock is how many bytes of a mapped file are indexed before the lines found are made
+// available.
+const indexBlock = 16 << 20
+
+// mappedStorage is a read-only view of a memory-mapped file. Lines are found by scanning for
+// newlines in the background, so opening a file doesn't wait for it to be read, and memory use is a
+// small index rather than the file's contents.
+type mappedStorage struct {
+	f           *os.File
+	mapping     []byte // The whole file
+	data        []byte // The text, after any byte order mark
+	checkpoints []int  // Offset of every checkpointLines'th line indexed so far
+	n           int    // Number of lines indexed so far
+	crlf        bool   // Lines end in \r\n, which isn't part of the line
+
+	// The last line found and its offset, since lines are mostly read in order.
+	hint    int
+	hintOff int
+
+	// The file is indexed in the background, see chunkedStorage. Checkpoints are added to indexed,
+	// then moved to checkpoints by addIndexed, so the storage only changes when the editor asks.
+	loading  bool
+	ready    chan struct{} // Receives when more has been indexed, closed when done
+	stop     chan struct{} // Closed to stop indexing early
+	mu       sync.Mutex    // Guards the fields below
+	indexed  []int
+	indexedN int // Lines found so far
+	indexOff int // How much of data has been indexed
+	indexErr error
+}
+
+// OpenMapped returns read-only storage for the named file, which is mapped into memory rather
+// than read, and how the file is stored. Buffers using it can't be edited. Compressed and
+// remote files, and archive members, can't be mapped; they're read by OpenFile instead.
+func OpenMapped(filename string) (Storage, Layout, error) {
+	if _, _, ok := splitMember(filename); ok || IsRemote(filename) || compressorFor(filename) != "" {
+		return OpenFile(filename)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, Layout{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Layout{}, err
+	}
+	var data []byte
+	if fi.Size() > 0 {
+		if data, err = mmap(f, fi.Size()); err != nil {
+			f.Close()
+			return nil, Layout{}, err
+		}
+	}
+	s := &mappedStorage{f: f, mapping: data, data: data, checkpoints: []int{0}}
+	if isEncrypted(data) {
+		s.Close()
+		return nil, Layout{}, ErrEncrypted
+	}
+	layout := largeLayout(sampleOf(data))
+	if layout.BOM {
+		s.data = data[utf8BOMLen:]
+	}
+	s.crlf = layout.Format == FormatDOS
+	s.loading, s.ready, s.stop = true, make(chan struct{}, 1), make(chan struct{})
+	go s.index()
+	return s, layout, nil
+}
+
+// index counts the lines in the file a block at a time, adding a checkpoint every
+// checkpointLines lines to s.indexed.
+func (s *mappedStorage) index() {
+	defer close(s.ready)
+	off, n := 0, 0
+	var found []int
+	publish := func(err error) {
+		s.mu.Lock()
+		s.indexed = append(s.indexed, found...)
+		s.indexedN, s.indexOff, s.indexErr = n, off, err
+		s.mu.Unlock()
+		found = nil
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if !isFault(r) {
+				panic(r)
+			}
+			publish(errTruncated)
+		}
+	}()
+	debug.SetPanicOnFault(true)
+
+	for off < len(s.data) {
+		end := off + indexBlock
+		if end > len(s.data) {
+			end = len(s.data)
+		}
+		for {
+			i := bytes.IndexByte(s.data[off:end], '\n')
+			if i < 0 {
+				break
+			}
+			off += i + 1
+			n++
+			if n%checkpointLines == 0 {
+				found = append(found, off)
+			}
+		}
+		off = end
+		if off == len(s.data) && s.data[off-1] != '\n' {
+			n++
+		}
+		publish(nil)
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// errTruncated is returned when a mapped file is found to have been truncated, such as by
+// logrotate's copytruncate. Reading the part of the mapping past the end of the file faults.
+var errTruncated = errors.New("file was truncated while open, reopen it to see what's left")
+
+// isFault reports whether r, recovered from a panic, is a memory fault turned into a panic by
+// debug.SetPanicOnFault.
+func isFault(r interface{}) bool {
+	_, ok := r.(interface{ Addr() uintptr })
+	return ok
+}
+
+// addIndexed adds the lines indexed since it was last called, returning any error reading the
+// file.
+func (s *mappedStorage) addIndexed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints = append(s.checkpoints, s.indexed...)
+	s.indexed = nil
+	s.n = s.indexedN
+	return s.indexErr
+}
+
+// finishLoading waits for indexing to end and adds everything indexed.
+func (s *mappedStorage) finishLoading() error {
+	if !s.loading {
+		return nil
+	}
+	for range s.ready {
+	}
+	s.loading = false
+	return s.addIndexed()
+}
+
+// loadingReady returns the channel told when more lines have been indexed, nil once loaded.
+func (s *mappedStorage) loadingReady() <-chan struct{} {
+	if !s.loading {
+		return nil
+	}
+	return s.ready
+}
+
+// progress returns how much of the file has been indexed, as a percentage.
+func (s *mappedStorage) progress() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.data) == 0 {
+		return 100
+	}
+	return int(int64(s.indexOff) * 100 / int64(len(s.data)))
+}
+
+func (s *mappedStorage) Len() int {
+	return s.n
+}
+
+// lineStart returns the offset of line i, which has been indexed.
+func (s *mappedStorage) lineStart(i int) int {
+	cp := i / checkpointLines
+	if cp >= len(s.checkpoints) {
+		cp = len(s.checkpoints) - 1
+	}
+	start, off := cp*checkpointLines, s.checkpoints[cp]
+	if s.hint <= i && s.hint > start {
+		start, off = s.hint, s.hintOff
+	}
+	for line := start; line < i; line++ {
+		off += bytes.IndexByte(s.data[off:], '\n') + 1
+	}
+	s.hint, s.hintOff = i, off
+	return off
+}
+
+// Line returns line i. If the file has been truncated, lines which are no longer there are blank
+// rather than crashing the editor.
+func (s *mappedStorage) Line(i int) (line string) {
+	if i < 0 || i >= s.Len() {
+		panic("buffer: line out of range")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if !isFault(r) {
+				panic(r)
+			}
+			line = ""
+		}
+	}()
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+
+	start := s.lineStart(i)
+	end := bytes.IndexByte(s.data[start:], '\n')
+	if end < 0 {
+		end = len(s.data) - start
+	}
+	text := s.data[start : start+end]
+	// As with readLines, only DOS files have the \r of \r\n dropped.
+	if s.crlf && len(text) > 0 && text[len(text)-1] == '\r' {
+		text = text[:len(text)-1]
+	}
+	return string(text)
+}
+
+func (s *mappedStorage) SetLine(i int, line string) {
+	panic("buffer: read-only")
+}
+
+func (s *mappedStorage) Insert(i int, lines []string) {
+	panic("buffer: read-only")
+}
+
+func (s *mappedStorage) Delete(start, end int) {
+	panic("buffer: read-only")
+}
+
+func (s *mappedStorage) Close() error {
+	// Indexing has to stop before the mapping goes.
+	if s.loading {
+		close(s.stop)
+		s.finishLoading()
+	}
+	if s.mapping != nil {
+		munmap(s.mapping)
+		s.mapping, s.data = nil, nil
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,75 @@
+package buffer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMapped(t *testing.T) {
+	var long []string
+	for i := 0; i < 3*checkpointLines+10; i++ {
+		long = append(long, fmt.Sprint("line ", i))
+	}
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"unix", "a\nb\n", []string{"a", "b"}},
+		{"no final newline", "a\nb", []string{"a", "b"}},
+		{"dos", "a\r\nb\r\n", []string{"a", "b"}},
+		{"blank lines", "\n\n", []string{"", ""}},
+		{"past checkpoints", strings.Join(long, "\n") + "\n", long},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "f.txt")
+			if err := os.WriteFile(filename, []byte(tt.text), 0600); err != nil {
+				t.Fatal(err)
+			}
+			text, _, err := OpenMapped(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := text.(*mappedStorage)
+			defer s.Close()
+			if err := s.finishLoading(); err != nil {
+				t.Fatal(err)
+			}
+			if s.Len() != len(tt.want) {
+				t.Fatalf("Len() = %d, want %d", s.Len(), len(tt.want))
+			}
+			// Backwards, so lines aren't all found from the hint.
+			for i := len(tt.want) - 1; i >= 0; i-- {
+				if got := s.Line(i); got != tt.want[i] {
+					t.Fatalf("Line(%d) = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMappedTruncated(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "f.txt")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("some text\n", 10000)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	text, _, err := OpenMapped(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := text.(*mappedStorage)
+	defer s.Close()
+	if err := s.finishLoading(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Line(9999); got != "" {
+		t.Errorf("Line past the end of a truncated file = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,29 @@
+package buffer
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// mmap maps the first size bytes of f read-only.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	h, err := windows.CreateFileMapping(windows.Handle(f.Fd()), nil, windows.PAGE_READONLY,
+		uint32(size>>32), uint32(size), nil)
+	if err != nil {
+		return nil, err
+	}
+	// The view keeps the mapping alive once it's made.
+	defer windows.CloseHandle(h)
+	addr, err := windows.MapViewOfFile(h, windows.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, err
+	}
+	// The view is outside the Go heap, so the address can't be moved by the garbage collector.
+	return unsafe.Slice((*byte)(unsafe.Add(nil, addr)), size), nil
+}
+
+func munmap(data []byte) error {
+	return windows.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0])))
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package buffer
+
+import (
+	"os"
+	"syscall"
+)
+
+// keepsIdentity reports whether a file like fi can be replaced by a new one without losing
+// anything: it has no other hardlinks, and the new file can be given its owner.
+func keepsIdentity(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	euid := os.Geteuid()
+	return st.Nlink == 1 && (int(st.Uid) == euid || euid == 0)
+}
+
+// copyOwner gives f the owner and group of fi.
+func copyOwner(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	nfi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if nst, ok := nfi.Sys().(*syscall.Stat_t); ok && nst.Uid == st.Uid && nst.Gid == st.Gid {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,14 @@
+package buffer
+
+import "os"
+
+// keepsIdentity reports whether a file like fi can be replaced by a new one without losing
+// anything. Windows files have no owner to keep, and hardlinks are rare.
+func keepsIdentity(fi os.FileInfo) bool {
+	return true
+}
+
+// copyOwner would give f the owner of fi, which Windows files don't have in the same way.
+func copyOwner(f *os.File, fi os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,154 @@
+package buffer
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// remoteFile is a file on another host, named by a URL like scp://user@host:port//abs/path, as
+// in vim's netrw. A single slash before the path makes it relative to the home directory.
+type remoteFile struct {
+	scheme string // "scp" or "sftp", the program used to copy the file
+	host   string // Including any user@
+	port   string
+	path   string
+}
+
+// IsRemote returns true if filename is the URL of a file on another host, see remoteFile.
+func IsRemote(filename string) bool {
+	_, err := parseRemote(filename)
+	return err == nil
+}
+
+// parseRemote returns the remote file named by filename, or an error if it isn't a remote URL.
+func parseRemote(filename string) (remoteFile, error) {
+	scheme, _, ok := strings.Cut(filename, "://")
+	if !ok || (scheme != "scp" && scheme != "sftp") {
+		return remoteFile{}, fmt.Errorf("not a remote file: %s", filename)
+	}
+	u, err := url.Parse(filename)
+	if err != nil {
+		return remoteFile{}, err
+	}
+	rf := remoteFile{scheme: scheme, host: u.Hostname(), port: u.Port(), path: strings.TrimPrefix(u.Path, "/")}
+	if u.User != nil {
+		rf.host = u.User.Username() + "@" + rf.host
+	}
+	if rf.host == "" || rf.path == "" {
+		return remoteFile{}, fmt.Errorf("%s: expected %s://host/path", filename, scheme)
+	}
+	// scp and sftp would take a host starting with '-' as an option, such as -oProxyCommand.
+	if strings.HasPrefix(rf.host, "-") {
+		return remoteFile{}, fmt.Errorf("%s: invalid host: %s", filename, rf.host)
+	}
+	return rf, nil
+}
+
+// sshOptions are passed to scp and sftp so that a connection to each host is made once and then
+// shared, rather than logging in again every time a file is read or written.
+func sshOptions() []string {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return []string{
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath=" + filepath.Join(os.TempDir(), fmt.Sprintf("zi-ssh-%d-%%C", os.Getuid())),
+		"-o", "ControlPersist=10m",
+	}
+}
+
+// readRemote returns the contents of the remote file. A missing file is reported with an error
+// satisfying os.IsNotExist, so it can be created by writing it.
+func readRemote(filename string) ([]byte, error) {
+	rf, err := parseRemote(filename)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "zi-remote-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := rf.copy(tmp.Name(), false); err != nil {
+		if strings.Contains(err.Error(), "No such file") {
+			return nil, &fs.PathError{Op: "open", Path: filename, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	return os.ReadFile(tmp.Name())
+}
+
+// writeRemote replaces the contents of the remote file with data.
+func writeRemote(filename string, data []byte) error {
+	rf, err := parseRemote(filename)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "zi-remote-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return rf.copy(tmp.Name(), true)
+}
+
+// copy copies the remote file to the local file, or the other way if upload is true.
+func (rf remoteFile) copy(local string, upload bool) error {
+	args := []string{"-q"}
+	if rf.port != "" {
+		args = append(args, "-P", rf.port)
+	}
+	args = append(args, sshOptions()...)
+
+	// The operands follow --, so none of them can be taken as an option.
+	cmd := exec.Command(rf.scheme)
+	if rf.scheme == "scp" {
+		remote := rf.host + ":" + rf.path
+		if upload {
+			args = append(args, "--", local, remote)
+		} else {
+			args = append(args, "--", remote, local)
+		}
+	} else {
+		// sftp reads commands from stdin, stopping at the first that fails.
+		batch := fmt.Sprintf("get %s %s\n", sftpQuote(rf.path), sftpQuote(local))
+		if upload {
+			batch = fmt.Sprintf("put %s %s\n", sftpQuote(local), sftpQuote(rf.path))
+		}
+		args = append(args, "-b", "-", "--", rf.host)
+		cmd.Stdin = strings.NewReader(batch)
+	}
+	cmd.Args = append(cmd.Args, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", rf.scheme, msg)
+		}
+		return fmt.Errorf("%s: %v", rf.scheme, err)
+	}
+	return nil
+}
+
+// sftpQuote quotes a path for an sftp batch command.
+func sftpQuote(path string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(path) + `"`
+}
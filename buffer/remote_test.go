@@ -0,0 +1,25 @@
+package buffer
+
+import "testing"
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		name string
+		want remoteFile
+		ok   bool
+	}{
+		{"scp://host/notes.txt", remoteFile{scheme: "scp", host: "host", path: "notes.txt"}, true},
+		{"sftp://me@host:2222//etc/hosts", remoteFile{scheme: "sftp", host: "me@host", port: "2222", path: "/etc/hosts"}, true},
+		{"http://host/notes.txt", remoteFile{}, false},
+		{"scp://host", remoteFile{}, false},
+		{"scp:///notes.txt", remoteFile{}, false},
+		{"sftp://-oProxyCommand=true//x", remoteFile{}, false},
+		{"scp://-oProxyCommand=true@host/x", remoteFile{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseRemote(tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseRemote(%q) = %+v, %v, want %+v, ok %v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
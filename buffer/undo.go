@@ -0,0 +1,202 @@
+package buffer
+
+import "fmt"
+
+// undoOpSize is roughly the memory taken by an undoOp besides the text of its lines.
+const undoOpSize = 48
+
+// UndoLimits bound how much undo history a buffer keeps.
+type UndoLimits struct {
+	Levels int // Most changes kept, 0 to keep none
+	Memory int // Most bytes kept, 0 for no limit
+}
+
+// undoOp reverses one SetLine, InsertLines or DeleteLines: inserted lines are removed from row,
+// then deleted lines are put back there.
+type undoOp struct {
+	row      int
+	inserted int
+	deleted  []string
+}
+
+func (op undoOp) size() int {
+	n := undoOpSize
+	for _, line := range op.deleted {
+		n += len(line)
+	}
+	return n
+}
+
+// undoStep is everything changed by one command, which is undone in one go.
+type undoStep struct {
+	ops  []undoOp
+	size int
+	seq  int // Numbers the text as it is after the step, kept when the step is undone and redone
+}
+
+// history is a buffer's undo and redo steps. Changes are added to cur until EndUndoStep.
+type history struct {
+	undo, redo []*undoStep
+	cur        *undoStep
+	size       int // Bytes held by undo, redo and cur
+	limits     UndoLimits
+	dropped    int  // Steps dropped for the memory limit since EndUndoStep
+	lost       bool // cur grew past the memory limit by itself and is no longer recorded
+
+	seq   int // The last step's seq
+	base  int // The seq of the text before the oldest undo step
+	saved int // The seq of the text when the file was last read or written, -1 if unknown
+}
+
+// state returns the seq of the text as it is, not counting any changes in cur.
+func (h *history) state() int {
+	if len(h.undo) == 0 {
+		return h.base
+	}
+	return h.undo[len(h.undo)-1].seq
+}
+
+// endStep adds cur to the undo steps.
+func (h *history) endStep() {
+	if h.cur != nil {
+		h.seq++
+		h.cur.seq = h.seq
+		h.undo = append(h.undo, h.cur)
+		h.cur = nil
+	}
+}
+
+// MarkUnmodified records that the text is the same as the file's, once it's been read or written.
+// Undoing or redoing changes back to this point then leaves the buffer unmodified.
+func (b *Buffer) MarkUnmodified() {
+	b.history.endStep()
+	b.history.saved = b.history.state()
+	b.Modified = false
+}
+
+// MarkModified records a change which undo can't reverse, such as to how the file is written, so
+// the buffer stays modified until it's written.
+func (b *Buffer) MarkModified() {
+	b.history.saved = -1
+	b.Modified = true
+}
+
+// recording reports whether changes are being added to the undo history.
+func (b *Buffer) recording() bool {
+	return b.history.limits.Levels > 0 && !b.history.lost
+}
+
+// record adds op, which reverses a change just made, to the current step. Any redo steps are
+// discarded, as they no longer apply.
+func (b *Buffer) record(op undoOp) {
+	h := &b.history
+	if !b.recording() {
+		return
+	}
+	for _, s := range h.redo {
+		h.size -= s.size
+	}
+	h.redo = nil
+	if h.cur == nil {
+		h.cur = &undoStep{}
+	}
+	h.cur.ops = append(h.cur.ops, op)
+	h.cur.size += op.size()
+	h.size += op.size()
+
+	for h.limits.Memory > 0 && h.size > h.limits.Memory && len(h.undo) > 0 {
+		h.dropOldest()
+		h.dropped++
+	}
+	if h.limits.Memory > 0 && h.size > h.limits.Memory {
+		// The text can no longer be undone back to how it was saved.
+		h.size -= h.cur.size
+		h.cur, h.lost, h.saved = nil, true, -1
+	}
+}
+
+// dropOldest forgets the oldest undo step.
+func (h *history) dropOldest() {
+	h.size -= h.undo[0].size
+	h.base = h.undo[0].seq
+	h.undo[0] = nil
+	h.undo = h.undo[1:]
+}
+
+// EndUndoStep finishes the changes made since it was last called, so they're undone together,
+// and applies limits to the history. It returns how many of the oldest steps were dropped to
+// stay within limits.Memory, and true if the last step was too big to keep at all.
+func (b *Buffer) EndUndoStep(limits UndoLimits) (dropped int, lost bool) {
+	h := &b.history
+	h.limits = limits
+	h.endStep()
+	for len(h.undo) > 0 && len(h.undo) > limits.Levels {
+		h.dropOldest()
+	}
+	for limits.Memory > 0 && h.size > limits.Memory && len(h.undo) > 0 {
+		h.dropOldest()
+		h.dropped++
+	}
+	dropped, lost = h.dropped, h.lost
+	h.dropped, h.lost = 0, false
+	return dropped, lost
+}
+
+// Undo reverses the last step, returning the first row it changed.
+func (b *Buffer) Undo() (int, error) {
+	b.EndUndoStep(b.history.limits)
+	h := &b.history
+	if len(h.undo) == 0 {
+		return 0, fmt.Errorf("already at oldest change")
+	}
+	s := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	redo := b.apply(s)
+	redo.seq = s.seq
+	h.size += redo.size - s.size
+	h.redo = append(h.redo, redo)
+	b.Modified = h.state() != h.saved
+	return redo.ops[len(redo.ops)-1].row, nil
+}
+
+// Redo repeats the last undone step, returning the first row it changed.
+func (b *Buffer) Redo() (int, error) {
+	h := &b.history
+	if len(h.redo) == 0 {
+		return 0, fmt.Errorf("already at newest change")
+	}
+	s := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	undo := b.apply(s)
+	undo.seq = s.seq
+	h.size += undo.size - s.size
+	h.undo = append(h.undo, undo)
+	b.Modified = h.state() != h.saved
+	return undo.ops[len(undo.ops)-1].row, nil
+}
+
+// apply reverses the ops of s, last first, returning the step which reverses that in turn.
+func (b *Buffer) apply(s *undoStep) *undoStep {
+	rev := &undoStep{}
+	for i := len(s.ops) - 1; i >= 0; i-- {
+		op := s.ops[i]
+		back := undoOp{row: op.row, inserted: len(op.deleted)}
+		if op.inserted > 0 {
+			back.deleted = b.Lines(op.row, op.row+op.inserted)
+			b.text.Delete(op.row, op.row+op.inserted)
+		}
+		if len(op.deleted) > 0 {
+			b.text.Insert(op.row, op.deleted)
+		}
+		rev.ops = append(rev.ops, back)
+		rev.size += back.size()
+	}
+	b.changes++
+	return rev
+}
+
+// clearHistory forgets all undo and redo steps, when the text is replaced in a way they can't
+// reverse. Whether the new text matches the file isn't known until MarkUnmodified.
+func (b *Buffer) clearHistory() {
+	b.history = history{limits: b.history.limits, saved: -1}
+}
@@ -0,0 +1,128 @@
+package buffer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	limits := UndoLimits{Levels: 100}
+	tests := []struct {
+		name     string
+		steps    []func(b *Buffer)
+		want     []string
+		modified bool
+	}{
+		{
+			name: "undo one change",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetLine(0, "A") },
+				func(b *Buffer) { b.Undo() },
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "undo and redo",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.InsertLines(1, "x", "y") },
+				func(b *Buffer) { b.Undo() },
+				func(b *Buffer) { b.Redo() },
+			},
+			want:     []string{"a", "x", "y", "b"},
+			modified: true,
+		},
+		{
+			name: "a step is undone together",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetLine(0, "A"); b.DeleteLines(1, 2) },
+				func(b *Buffer) { b.Undo() },
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "undo back to the written text",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetLine(0, "A") },
+				func(b *Buffer) { b.MarkUnmodified() },
+				func(b *Buffer) { b.SetLine(1, "B") },
+				func(b *Buffer) { b.Undo() },
+			},
+			want: []string{"A", "b"},
+		},
+		{
+			name: "undo past the written text",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetLine(0, "A") },
+				func(b *Buffer) { b.MarkUnmodified() },
+				func(b *Buffer) { b.Undo() },
+			},
+			want:     []string{"a", "b"},
+			modified: true,
+		},
+		{
+			name: "a change undo can't reverse",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetLine(0, "A") },
+				func(b *Buffer) { b.MarkModified() },
+				func(b *Buffer) { b.Undo() },
+			},
+			want:     []string{"a", "b"},
+			modified: true,
+		},
+		{
+			name: "new text replacing the old",
+			steps: []func(b *Buffer){
+				func(b *Buffer) { b.SetText([]string{"c"}) },
+				func(b *Buffer) { b.SetLine(0, "C") },
+				func(b *Buffer) { b.Undo() },
+			},
+			want:     []string{"c"},
+			modified: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(1, "f.txt", []string{"a", "b"})
+			b.EndUndoStep(limits)
+			for _, step := range tt.steps {
+				step(b)
+				b.EndUndoStep(limits)
+			}
+			if got := b.Lines(0, b.Len()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if b.Modified != tt.modified {
+				t.Errorf("Modified = %v, want %v", b.Modified, tt.modified)
+			}
+		})
+	}
+}
+
+func TestUndoLimits(t *testing.T) {
+	b := New(1, "f.txt", []string{"a"})
+	b.EndUndoStep(UndoLimits{Levels: 2})
+	for _, s := range []string{"b", "c", "d"} {
+		b.SetLine(0, s)
+		b.EndUndoStep(UndoLimits{Levels: 2})
+	}
+	if _, err := b.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Undo(); err == nil {
+		t.Error("undid a change beyond undolevels")
+	}
+	// The oldest change was dropped, so this isn't the text the buffer started with.
+	if got := b.Line(0); got != "b" || !b.Modified {
+		t.Errorf("after undoing all kept changes: %q, modified %v, want \"b\", true", got, b.Modified)
+	}
+
+	b = New(1, "f.txt", []string{"a"})
+	b.EndUndoStep(UndoLimits{Levels: 10, Memory: 1})
+	b.SetLine(0, "a long line")
+	if dropped, lost := b.EndUndoStep(UndoLimits{Levels: 10, Memory: 1}); dropped != 0 || !lost {
+		t.Errorf("EndUndoStep over undomem = %d, %v, want 0, true", dropped, lost)
+	}
+}
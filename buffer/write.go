@@ -0,0 +1,180 @@
+package buffer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Ways WriteFile replaces an existing file, named as the values of vim's backupcopy option.
+const (
+	// ReplaceAuto renames a new file over the old one, unless that would lose something which
+	// belongs to the old file, and then writes in place.
+	ReplaceAuto = "auto"
+	// ReplaceInPlace overwrites the existing file, so it keeps its owner, hardlinks and any
+	// other identity, but is left half written if writing fails.
+	ReplaceInPlace = "yes"
+	// ReplaceRename writes a new file, with the old one's permissions and owner where
+	// possible, and renames it over the old one. The file is never left half written, but any
+	// other hardlinks to it keep the old contents.
+	ReplaceRename = "no"
+)
+
+// writeLocal writes a local file with write, replacing any existing file as set by opts.
+func writeLocal(filename string, opts WriteOptions, write func(w io.Writer) (int, error)) (int, error) {
+	fi, err := os.Lstat(filename)
+	if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if opts.ReplaceSymlinks {
+			return replaceSymlink(filename, opts.Fsync, write)
+		}
+		// Write the file linked to, so the link is kept. A link to a missing file is written
+		// through below, creating it.
+		if target, terr := filepath.EvalSymlinks(filename); terr == nil {
+			filename = target
+			fi, err = os.Lstat(filename)
+		}
+	}
+	if err == nil && opts.Replace != ReplaceInPlace {
+		rename := opts.Replace == ReplaceRename || (fi.Mode().IsRegular() && keepsIdentity(fi))
+		if rename {
+			tmp, err := createReplacement(filename, fi)
+			if err == nil {
+				return writeRenamed(tmp, filename, opts.Fsync, write)
+			}
+			if opts.Replace == ReplaceRename {
+				return 0, err
+			}
+		}
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	return writeAndClose(f, opts.Fsync, write)
+}
+
+// replaceSymlink replaces the symlink filename with a file written with write, with the
+// permissions of the file it linked to if there was one.
+func replaceSymlink(filename string, fsync bool, write func(w io.Writer) (int, error)) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".zi*")
+	if err != nil {
+		return 0, err
+	}
+	if fi, err := os.Stat(filename); err == nil {
+		tmp.Chmod(fi.Mode().Perm())
+	} else {
+		tmp.Chmod(0644)
+	}
+	return writeRenamed(tmp, filename, fsync, write)
+}
+
+// createReplacement creates an empty file next to filename to be renamed over it, with the
+// permissions and owner of fi, the existing file. It fails if the owner can't be kept.
+func createReplacement(filename string, fi os.FileInfo) (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".zi*")
+	if err != nil {
+		return nil, err
+	}
+	err = tmp.Chmod(fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky))
+	if err == nil {
+		err = copyOwner(tmp, fi)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// writeRenamed writes tmp, from createReplacement, then renames it to filename.
+func writeRenamed(tmp *os.File, filename string, fsync bool, write func(w io.Writer) (int, error)) (int, error) {
+	n, err := writeAndClose(tmp, fsync, write)
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return n, err
+}
+
+// writeAndClose writes f with write through a buffer, then closes it.
+func writeAndClose(f *os.File, fsync bool, write func(w io.Writer) (int, error)) (int, error) {
+	w := bufio.NewWriter(f)
+	n, err := write(w)
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if fsync && err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// appendLocal adds what write writes to the end of filename, creating it if it doesn't exist.
+func appendLocal(filename string, fsync bool, write func(w io.Writer) (int, error)) (int, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	return writeAndClose(f, fsync, write)
+}
+
+// ErrSudoPassword is returned by a sudo write when sudo needs a password, see WriteOptions.
+var ErrSudoPassword = errors.New("sudo: a password is required")
+
+// writeSudo overwrites filename, or appends to it, as root by piping the text to sudo tee. sudo
+// is run with -n so it never reads the terminal. A password is checked first with sudo -v, which
+// reads it from stdin, so it's never sent to tee along with the text.
+func writeSudo(filename string, appendTo bool, password string, write func(w io.Writer) (int, error)) (int, error) {
+	var buf bytes.Buffer
+	n, err := write(&buf)
+	if err != nil {
+		return 0, err
+	}
+	if password != "" {
+		validate := exec.Command("sudo", "-S", "-p", "", "-v")
+		validate.Stdin = strings.NewReader(password + "\n")
+		if err := runSudo(validate); err != nil {
+			return 0, err
+		}
+	}
+	args := []string{"-n", "tee", "--", filename}
+	if appendTo {
+		args = []string{"-n", "tee", "-a", "--", filename}
+	}
+	cmd := exec.Command("sudo", args...)
+	cmd.Stdin = &buf
+	if err := runSudo(cmd); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// runSudo runs a sudo command, returning its error message if it fails.
+func runSudo(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		switch {
+		case strings.Contains(msg, "password is required"):
+			return ErrSudoPassword
+		case msg != "":
+			return fmt.Errorf("sudo: %s", strings.TrimPrefix(msg, "sudo: "))
+		}
+		return fmt.Errorf("sudo: %v", err)
+	}
+	return nil
+}
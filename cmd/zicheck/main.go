@@ -0,0 +1,166 @@
+//go:build linux || darwin || freebsd
+
+// zicheck runs end-to-end screen tests against a zi binary. Each NAME.keys file in the test
+// directory is a key script, as for zi --script, typed into zi running on an 80x24 pseudo-terminal.
+// A "# args: ..." line gives zi's arguments. Once the screen settles it is compared with
+// NAME.screen. Every other file in the directory is copied to a temporary directory zi runs in.
+//
+// Usage:
+//
+//	zicheck [-zi ./zi] [-update] [-run pattern] testdata/screens
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/keyan/zi/harness"
+)
+
+const (
+	screenRows = 24
+	screenCols = 80
+)
+
+func main() {
+	bin := flag.String("zi", "./zi", "zi binary to test")
+	update := flag.Bool("update", false, "write the screens seen instead of comparing them")
+	run := flag.String("run", "", "only run tests whose name matches this regexp")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: zicheck [-zi ./zi] [-update] [-run pattern] dir")
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+	ziPath, err := filepath.Abs(*bin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	match, err := regexp.Compile(*run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	scripts, err := filepath.Glob(filepath.Join(dir, "*.keys"))
+	if err != nil || len(scripts) == 0 {
+		fmt.Fprintf(os.Stderr, "no tests in %s\n", dir)
+		os.Exit(2)
+	}
+	failed := 0
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".keys")
+		if !match.MatchString(name) {
+			continue
+		}
+		if err := runTest(ziPath, dir, name, *update); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+	if failed > 0 {
+		fmt.Printf("%d failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+// runTest runs a single NAME.keys script, comparing or updating NAME.screen.
+func runTest(zi, dir, name string, update bool) error {
+	src, err := os.ReadFile(filepath.Join(dir, name+".keys"))
+	if err != nil {
+		return err
+	}
+	args := []string{"--clean"}
+	for _, line := range strings.Split(string(src), "\n") {
+		if a, ok := strings.CutPrefix(line, "# args:"); ok {
+			args = append(args, strings.Fields(a)...)
+		}
+	}
+
+	work, err := os.MkdirTemp("", "zicheck-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	if err := copyFixtures(dir, work); err != nil {
+		return err
+	}
+
+	s, err := harness.Start(zi, args, work, screenRows, screenCols)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.WaitIdle(100*time.Millisecond, 5*time.Second); err != nil {
+		return err
+	}
+	if err := s.SendScript(string(src)); err != nil {
+		return err
+	}
+	if err := s.WaitIdle(200*time.Millisecond, 5*time.Second); err != nil {
+		return err
+	}
+	got := strings.Join(s.Screen(), "\n") + "\n"
+
+	want := filepath.Join(dir, name+".screen")
+	if update {
+		return os.WriteFile(want, []byte(got), 0644)
+	}
+	b, err := os.ReadFile(want)
+	if err != nil {
+		return err
+	}
+	if got != string(b) {
+		return fmt.Errorf("screen differs:\n%s", diff(string(b), got))
+	}
+	return nil
+}
+
+// copyFixtures copies the files tests may open from dir to work.
+func copyFixtures(dir, work string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || ext == ".keys" || ext == ".screen" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(work, e.Name()), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diff shows the rows which differ between two screens.
+func diff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "row %d\n  want: %q\n  got:  %q\n", i+1, wl, gl)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxAutocmdDepth limits autocommands triggering further autocommands, e.g. a BufEnter which
+// switches buffers.
+const maxAutocmdDepth = 10
+
+// autocmdEvents are the events autocommands can be registered for.
+var autocmdEvents = map[string]string{
+	"BufNewFile":   "starting to edit a file that doesn't exist",
+	"BufReadPost":  "after reading a file into a new buffer",
+	"BufEnter":     "after switching to a buffer",
+	"BufWritePre":  "before writing a buffer",
+	"BufWritePost": "after writing a buffer",
+	"BufFilePost":  "after renaming a buffer with :file or :saveas",
+	"VimEnter":     "after startup, once files are opened",
+	"VimLeave":     "before exiting",
+	"FocusGained":  "when the terminal window gains focus",
+	"FocusLost":    "when the terminal window loses focus",
+}
+
+// autocmd runs an ex command, or a function registered by a plugin, when an event happens to a file
+// matching pattern.
+type autocmd struct {
+	event   string
+	pattern string // Glob matched against the file's name and path, see autocmdMatches
+	command string // Shown by :autocmd, and run if fn is nil
+	fn      func(event, file string)
+}
+
+// autocmdMatches reports whether pattern matches file, either by its base name or by its
+// absolute path, so "*.go" and "/src/*/main.go" both work.
+func autocmdMatches(pattern, file string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if ok, _ := filepath.Match(pattern, filepath.Base(file)); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, absPath(file))
+	return ok
+}
+
+// addAutocmd registers fn to be called for event on files matching pattern.
+func (ts *TermState) addAutocmd(event, pattern, desc string, fn func(event, file string)) error {
+	if _, ok := autocmdEvents[event]; !ok {
+		return fmt.Errorf("no such event: %s", event)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %v", pattern, err)
+	}
+	ts.autocmds = append(ts.autocmds, autocmd{event: event, pattern: pattern, command: desc, fn: fn})
+	return nil
+}
+
+// doAutocmd runs the autocommands for event on file, in the order they were added. Errors are
+// shown in the status bar.
+func (ts *TermState) doAutocmd(event, file string) {
+	if ts.autocmdDepth >= maxAutocmdDepth {
+		ts.statusMsg = "autocommands nested too deeply"
+		return
+	}
+	ts.autocmdDepth++
+	defer func() { ts.autocmdDepth-- }()
+
+	// Copy, as autocommands may add or remove others.
+	for _, au := range append([]autocmd(nil), ts.autocmds...) {
+		if au.event != event || !autocmdMatches(au.pattern, file) {
+			continue
+		}
+		if au.fn != nil {
+			au.fn(event, file)
+			continue
+		}
+		if err := ts.runCommand(au.command); err != nil {
+			ts.statusMsg = fmt.Sprintf("%s autocommand: %v", event, err)
+		}
+	}
+}
+
+// cmdAutocmd adds an autocommand with :autocmd {event} {pattern} {command}, where event can be a
+// comma separated list. With no arguments the autocommands are listed, :autocmd! [event] removes
+// those added this way, for all events or just one.
+func cmdAutocmd(ts *TermState, a exArgs) error {
+	fields := strings.SplitN(a.arg, " ", 3)
+	if a.bang {
+		if len(fields) > 1 {
+			return fmt.Errorf("usage: autocmd! [event]")
+		}
+		kept := ts.autocmds[:0]
+		for _, au := range ts.autocmds {
+			if au.fn != nil || (a.arg != "" && au.event != a.arg) {
+				kept = append(kept, au)
+			}
+		}
+		ts.autocmds = kept
+		return nil
+	}
+	if a.arg == "" {
+		return ts.listAutocmds()
+	}
+	if len(fields) < 3 || strings.TrimSpace(fields[2]) == "" {
+		return fmt.Errorf("usage: autocmd {event} {pattern} {command}")
+	}
+
+	command := strings.TrimSpace(fields[2])
+	for _, event := range strings.Split(fields[0], ",") {
+		if err := ts.addAutocmd(event, fields[1], command, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listAutocmds shows every autocommand, grouped by event.
+func (ts *TermState) listAutocmds() error {
+	if len(ts.autocmds) == 0 {
+		return fmt.Errorf("no autocommands")
+	}
+	events := make([]string, 0, len(autocmdEvents))
+	for event := range autocmdEvents {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	var lines []string
+	for _, event := range events {
+		header := false
+		for _, au := range ts.autocmds {
+			if au.event != event {
+				continue
+			}
+			if !header {
+				lines = append(lines, event)
+				header = true
+			}
+			lines = append(lines, fmt.Sprintf("    %-12s %s", au.pattern, au.command))
+		}
+	}
+	ts.msgLines = lines
+	return nil
+}
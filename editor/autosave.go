@@ -0,0 +1,54 @@
+package editor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// canAutosave reports whether b is written by autosave: it must have a file of its own to write
+// to, which it's allowed to change.
+func (ts *TermState) canAutosave(b *buffer.Buffer) bool {
+	return ts.opts.autosave > 0 && !b.ReadOnly && b.Filename != "" && b.BrowseDir == "" &&
+		b.CheckEditable() == nil && !b.Hex
+}
+
+// autosavePending reports whether any buffer has changes for autosave to write.
+func (ts *TermState) autosavePending() bool {
+	for _, b := range ts.buffers {
+		if b.Modified && ts.canAutosave(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// autosaveIdle returns a channel which fires once the editor has been idle for the autosave
+// option's seconds with changes to write, or nil if autosave is off or there are none.
+func (ts *TermState) autosaveIdle() <-chan time.Time {
+	if !ts.autosavePending() {
+		return nil
+	}
+	return time.After(time.Duration(ts.opts.autosave) * time.Second)
+}
+
+// autosave writes every modified buffer which canAutosave, as after being idle or when the
+// terminal loses focus. Unlike :w no autocommands are run, so nothing changes the text as
+// it's being typed.
+func (ts *TermState) autosave() {
+	var saved int
+	for _, b := range ts.buffers {
+		if !b.Modified || !ts.canAutosave(b) {
+			continue
+		}
+		if _, err := ts.writeBuffer(b, b.Filename, false); err != nil {
+			ts.statusMsg = fmt.Sprintf("autosave %s: %v", b.Filename, err)
+			return
+		}
+		saved++
+	}
+	if saved > 0 {
+		ts.statusMsg = fmt.Sprintf("autosaved %d buffer(s) at %s", saved, time.Now().Format("15:04:05"))
+	}
+}
@@ -0,0 +1,67 @@
+package editor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// backupPath returns where the backup of filename is made, see makeBackup.
+func (ts *TermState) backupPath(filename string) string {
+	if ts.opts.backupdir == "" {
+		return filename + "~"
+	}
+	return filepath.Join(ts.opts.backupdir, filepath.Base(filename)+"~")
+}
+
+// makeBackup copies filename before it's overwritten, if the backup or writebackup options are
+// set, returning the path of the copy. Nothing is copied for new files, or files which aren't
+// local, as they aren't overwritten in place.
+func (ts *TermState) makeBackup(filename string) (string, error) {
+	if !ts.opts.backup && !ts.opts.writebackup {
+		return "", nil
+	}
+	if !buffer.IsLocal(filename) {
+		return "", nil
+	}
+	src, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", nil
+	}
+
+	path := ts.backupPath(filename)
+	if ts.opts.backupdir != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return "", err
+		}
+	}
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if ts.opts.fsync && err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
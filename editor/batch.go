@@ -0,0 +1,135 @@
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/terminal"
+)
+
+// errQuit is returned by :q when running a script, ending the script for the current file.
+var errQuit = errors.New("quit")
+
+// runBatch implements zi -es. The ex commands given with -c, followed by any piped to stdin, are
+// run against each file in turn, or once against an empty buffer if there are none. Output from
+// commands such as :p is written to stdout. A script stops at :q or the first failing command,
+// and must write its changes, as reaching the end is the same as :q. It returns the exit status,
+// 1 if any command failed.
+func runBatch(opts *cliOptions) int {
+	commands := opts.commands
+	// A file of "-" is read from stdin, so then only -c commands are run.
+	if !terminal.IsTerminal(os.Stdin) && (len(opts.files) == 0 || opts.files[0] != "-") {
+		lines, err := buffer.ReadLines(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zi: reading commands: %v\n", err)
+			return 1
+		}
+		commands = append(commands, lines...)
+	}
+	// Reaching the end of the script quits, which fails if there are unwritten changes.
+	commands = append(commands, "q")
+
+	files := opts.files
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	status := 0
+	for _, file := range files {
+		if err := runScript(opts, file, commands); err != nil {
+			name := file
+			if name == "" {
+				name = "[No Name]"
+			}
+			fmt.Fprintf(os.Stderr, "zi: %s: %v\n", name, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// NewHeadless returns an editor with no terminal, editing the first of files, for other programs
+// to drive with RunCommand. No config is loaded.
+func NewHeadless(files ...string) (*TermState, error) {
+	return newHeadless(&cliOptions{files: files})
+}
+
+// newHeadless returns an editor with no terminal set up as opts asks.
+func newHeadless(opts *cliOptions) (*TermState, error) {
+	ts := newTermState(opts, log.New(io.Discard, "", 0))
+	ts.headless = true
+	ts.winSize = &terminal.Size{Row: dumpScreenRows - 1, Col: dumpScreenCols - 1}
+	ts.w = bufio.NewWriter(io.Discard)
+	ts.switchBuffer(ts.addBuffer("", make([]string, 0)))
+	ts.loadConfig(opts.configPath)
+	if len(ts.configErrors) > 0 {
+		return nil, ts.configErrors[0]
+	}
+	if err := ts.openEditor(); err != nil {
+		return nil, err
+	}
+	ts.gotoStartPosition(opts)
+	return ts, nil
+}
+
+// RunCommand runs an ex command, as if typed after ':'. Output such as from :p is returned. Each
+// command is its own undo step, and any job it starts, such as :make, is finished before it returns.
+func (ts *TermState) RunCommand(line string) ([]string, error) {
+	next := ts.lastJobID + 1
+	err := ts.runCommand(line)
+	ts.waitJobs(next)
+	ts.endUndoStep()
+	out := ts.msgLines
+	ts.msgLines = nil
+	return out, err
+}
+
+// Lines returns the contents of the current buffer.
+func (ts *TermState) Lines() []string {
+	return ts.buf.Lines(0, ts.buf.Len())
+}
+
+// Cursor returns the 0-indexed row and column of the cursor.
+func (ts *TermState) Cursor() (int, int) {
+	return ts.cursorY, ts.cursorX
+}
+
+// runScript runs commands against file in a new editor with no terminal.
+func runScript(opts *cliOptions, file string, commands []string) error {
+	fileOpts := *opts
+	fileOpts.files = nil
+	if file != "" {
+		fileOpts.files = []string{file}
+	}
+	ts, err := newHeadless(&fileOpts)
+	if err != nil {
+		return err
+	}
+	defer ts.stopAllJobs()
+
+	for _, command := range commands {
+		out, err := ts.RunCommand(command)
+		for _, line := range out {
+			fmt.Println(line)
+		}
+		if err == errQuit {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", command, err)
+		}
+	}
+	return nil
+}
+
+// endScreenDump prints the screen and exits, once a --dump-screen script has finished.
+func (ts *TermState) endScreenDump() {
+	// Keys handled since the last redraw may have changed the screen.
+	ts.refreshScreen()
+	ts.screen.Dump(os.Stdout)
+	ts.exit(nil)
+}
@@ -0,0 +1,97 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// openDir replaces the buffer with a listing of dir, one entry per row. Directories have a trailing
+// '/' and the first row is always "../" so the parent can be reached.
+func (ts *TermState) openDir(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var dirs, files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e.Name()+"/")
+		} else {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+
+	rows := append([]string{"../"}, dirs...)
+	ts.showListing(dir, append(rows, files...))
+	return nil
+}
+
+// openArchive replaces the buffer with a listing of the files in a zip or tar archive, which are
+// opened as buffers named by buffer.MemberPath. Writing them updates the archive.
+func (ts *TermState) openArchive(archive string) error {
+	archive, err := filepath.Abs(archive)
+	if err != nil {
+		return err
+	}
+	names, err := buffer.ListArchive(archive)
+	if err != nil {
+		return err
+	}
+	ts.showListing(archive, append([]string{"../"}, names...))
+	return nil
+}
+
+// showListing shows rows listing the contents of path, a directory or archive.
+func (ts *TermState) showListing(path string, rows []string) {
+	// Listings are browsed within a single buffer, rather than one per directory.
+	if ts.buf.BrowseDir == "" {
+		b := ts.addBuffer(path, nil)
+		b.BrowseDir = path
+		ts.switchBuffer(b)
+	}
+	ts.loadRows(path, rows)
+	ts.buf.BrowseDir = path
+}
+
+// browseOpen opens the listing entry under the cursor, descending into it if it is a directory.
+func (ts *TermState) browseOpen() {
+	if ts.cursorY >= ts.buf.Len() {
+		return
+	}
+	line := ts.buf.Line(ts.cursorY)
+	path := filepath.Join(ts.buf.BrowseDir, strings.TrimSuffix(line, "/"))
+	if buffer.IsArchive(ts.buf.BrowseDir) && line != "../" {
+		path = buffer.MemberPath(ts.buf.BrowseDir, line)
+	}
+	if err := ts.openFile(path); err != nil {
+		ts.statusMsg = fmt.Sprintf("cannot open %s: %v", line, err)
+	}
+}
+
+// browseUp lists the parent of the current directory or archive, leaving the cursor on the one
+// just left.
+func (ts *TermState) browseUp() {
+	child := filepath.Base(ts.buf.BrowseDir)
+	if err := ts.openDir(filepath.Dir(ts.buf.BrowseDir)); err != nil {
+		ts.statusMsg = err.Error()
+		return
+	}
+	for i := 0; i < ts.buf.Len(); i++ {
+		if strings.TrimSuffix(ts.buf.Line(i), "/") == child {
+			ts.setCursor(i, 0)
+			break
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// addBuffer creates a new buffer and adds it to the buffer list, it should be displayed straight
+// after with switchBuffer.
+func (ts *TermState) addBuffer(filename string, rows []string) *buffer.Buffer {
+	num := 1
+	if len(ts.buffers) > 0 {
+		num = ts.buffers[len(ts.buffers)-1].Num + 1
+	}
+	// The empty buffer zi starts with is replaced by the first file opened.
+	if cur := ts.buf; cur != nil && cur.IsPristine() {
+		num = cur.Num
+		ts.removeBuffer(cur)
+	}
+	b := buffer.New(num, filename, rows)
+	b.EndUndoStep(ts.undoLimits())
+	ts.buffers = append(ts.buffers, b)
+	return b
+}
+
+// absPath returns filename as an absolute path, or unchanged if that can't be determined or it's
+// a remote URL.
+func absPath(filename string) string {
+	if buffer.IsRemote(filename) {
+		return filename
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+	return abs
+}
+
+// findBuffer returns the open buffer for filename, or nil if there isn't one.
+func (ts *TermState) findBuffer(filename string) *buffer.Buffer {
+	abs := absPath(filename)
+	for _, b := range ts.buffers {
+		if b.Filename != "" && absPath(b.Filename) == abs {
+			return b
+		}
+	}
+	return nil
+}
+
+// switchBuffer displays b and runs BufEnter autocommands.
+func (ts *TermState) switchBuffer(b *buffer.Buffer) {
+	if b != ts.buf {
+		ts.pushJump()
+	}
+	ts.displayBuffer(b)
+	ts.doAutocmd("BufEnter", b.Filename)
+}
+
+// displayBuffer makes b the current buffer, restoring the cursor to where it was when b was last
+// displayed.
+func (ts *TermState) displayBuffer(b *buffer.Buffer) {
+	if cur := ts.buf; cur != nil && cur != b {
+		cur.LastPos = buffer.Position{Row: ts.cursorY, Col: ts.cursorX}
+		ts.altBuf = cur
+	}
+
+	ts.buf = b
+	ts.rowOffset = 0
+	ts.lineNumWidth = len(strconv.Itoa(b.Len()))
+	ts.setCursor(b.LastPos.Row, b.LastPos.Col)
+
+	if b.Filename != "" {
+		ts.welcomed = true
+		if b.BrowseDir == "" {
+			ts.addOldFile(b.Filename)
+		}
+	}
+}
+
+// removeBuffer drops b from the buffer list.
+func (ts *TermState) removeBuffer(b *buffer.Buffer) {
+	for i, other := range ts.buffers {
+		if other == b {
+			ts.buffers = append(ts.buffers[:i], ts.buffers[i+1:]...)
+			ts.removeSwap(b)
+			ts.dropJumps(b)
+			delete(ts.folds, b)
+			delete(ts.spell, b)
+			delete(ts.rainbow, b)
+			delete(ts.git, b)
+			delete(ts.merge, b)
+			delete(ts.changeLists, b)
+			if ts.altBuf == b {
+				ts.altBuf = nil
+			}
+			b.Close()
+			return
+		}
+	}
+}
+
+// closeBuffer removes b from the buffer list, switching to the last other buffer if it was being
+// displayed.
+func (ts *TermState) closeBuffer(b *buffer.Buffer) {
+	ts.releaseWaiters(b)
+	ts.removeBuffer(b)
+	if ts.buf != b {
+		return
+	}
+	if len(ts.buffers) == 0 {
+		ts.switchBuffer(ts.addBuffer("", make([]string, 0)))
+		return
+	}
+	ts.switchBuffer(ts.buffers[len(ts.buffers)-1])
+}
+
+// modifiedBuffer returns the first buffer with unwritten changes, or nil if there are none.
+func (ts *TermState) modifiedBuffer() *buffer.Buffer {
+	for _, b := range ts.buffers {
+		if b.Modified {
+			return b
+		}
+	}
+	return nil
+}
+
+// cmdEdit opens a file in a new buffer, or switches to it if it is already open.
+func cmdEdit(ts *TermState, a exArgs) error {
+	filename, err := ts.expandFile(a.arg)
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		return fmt.Errorf("no file name")
+	}
+	return ts.openFile(filename)
+}
+
+// setArgList makes the files in arg the argument list, as given on the command line, and edits
+// the first.
+func (ts *TermState) setArgList(arg string) error {
+	files, err := ts.expandFiles(arg)
+	if err != nil {
+		return err
+	}
+	ts.argList, ts.argIndex = files, 0
+	return ts.openFile(files[0])
+}
+
+// cmdArgs is :args [files], listing the argument list with the file being edited in brackets, or
+// replacing it with files.
+func cmdArgs(ts *TermState, a exArgs) error {
+	if a.arg != "" {
+		return ts.setArgList(a.arg)
+	}
+	names := make([]string, len(ts.argList))
+	for i, f := range ts.argList {
+		names[i] = f
+		if i == ts.argIndex {
+			names[i] = "[" + f + "]"
+		}
+	}
+	ts.statusMsg = strings.Join(names, " ")
+	return nil
+}
+
+// cmdNext is :next [files], editing the next file in the argument list, or replacing the list
+// with files.
+func cmdNext(ts *TermState, a exArgs) error {
+	if a.arg != "" {
+		return ts.setArgList(a.arg)
+	}
+	if ts.argIndex+1 >= len(ts.argList) {
+		return fmt.Errorf("cannot go beyond last file")
+	}
+	ts.argIndex++
+	return ts.openFile(ts.argList[ts.argIndex])
+}
+
+// cmdPrevious is :previous, editing the previous file in the argument list.
+func cmdPrevious(ts *TermState, a exArgs) error {
+	if ts.argIndex == 0 || len(ts.argList) == 0 {
+		return fmt.Errorf("cannot go before first file")
+	}
+	ts.argIndex--
+	return ts.openFile(ts.argList[ts.argIndex])
+}
+
+// cmdView is :view [file], which opens file like :edit but readonly and nomodifiable, so it
+// can't be changed by accident. Without a file the current buffer is made readonly.
+func cmdView(ts *TermState, a exArgs) error {
+	filename, err := ts.expandFile(a.arg)
+	if err != nil {
+		return err
+	}
+	a.arg = filename
+	if a.arg != "" {
+		if err := ts.openFile(a.arg); err != nil {
+			return err
+		}
+	}
+	b := ts.buf
+	if a.arg != "" {
+		// The file may not be open yet if a key has to be entered for it first.
+		if b = ts.findBuffer(a.arg); b == nil {
+			return nil
+		}
+	}
+	b.ReadOnly, b.Modifiable = true, false
+	return nil
+}
+
+// renameBuffer points b at filename without reading it, moving its swap file along. Autocommands
+// for the new name are run, as they would be for a buffer opened with it.
+func (ts *TermState) renameBuffer(b *buffer.Buffer, filename string) error {
+	if other := ts.findBuffer(filename); other != nil && other != b {
+		return fmt.Errorf("a buffer for %s is already open", filename)
+	}
+	if b.BrowseDir != "" {
+		return fmt.Errorf("cannot rename a directory listing")
+	}
+	ts.removeSwap(b)
+	b.Rename(filename)
+	ts.checkSwap(b)
+	ts.doAutocmd("BufFilePost", filename)
+	if b == ts.buf {
+		ts.doAutocmd("BufEnter", filename)
+	}
+	return nil
+}
+
+// cmdFile is :file [name]. With a name the buffer is renamed, so it's written there next, but
+// nothing is written now. Either way the buffer is then described as with Ctrl-G.
+func cmdFile(ts *TermState, a exArgs) error {
+	if a.arg != "" {
+		if err := ts.renameBuffer(ts.buf, a.arg); err != nil {
+			return err
+		}
+	}
+	ts.statusMsg = ts.fileInfo()
+	return nil
+}
+
+// cmdSaveas is :saveas name, writing the buffer to name and then editing that file instead of
+// the old one.
+func cmdSaveas(ts *TermState, a exArgs) error {
+	filename, err := ts.expandFile(a.arg)
+	if err != nil {
+		return err
+	}
+	a.arg = filename
+	if a.arg == "" {
+		return fmt.Errorf("no file name")
+	}
+	if other := ts.findBuffer(a.arg); other != nil && other != ts.buf {
+		return fmt.Errorf("a buffer for %s is already open", a.arg)
+	}
+	if _, err := os.Stat(a.arg); err == nil && !a.bang {
+		return fmt.Errorf("%s exists (add ! to overwrite)", a.arg)
+	}
+
+	ts.doAutocmd("BufWritePre", a.arg)
+	n, err := ts.writeBuffer(ts.buf, a.arg, a.bang)
+	if err != nil {
+		return err
+	}
+	if err := ts.renameBuffer(ts.buf, a.arg); err != nil {
+		return err
+	}
+	ts.written(ts.buf, a.arg)
+	ts.statusMsg = fmt.Sprintf("%q %dL, %dB written", a.arg, ts.buf.Len(), n)
+	ts.refreshHex()
+	ts.doAutocmd("BufWritePost", a.arg)
+	return nil
+}
+
+// cmdBuffer switches to a buffer given by number, or by a unique part of its name.
+func cmdBuffer(ts *TermState, a exArgs) error {
+	if n, err := strconv.Atoi(a.arg); err == nil {
+		for _, b := range ts.buffers {
+			if b.Num == n {
+				ts.switchBuffer(b)
+				return nil
+			}
+		}
+		return fmt.Errorf("buffer %d does not exist", n)
+	}
+
+	var match *buffer.Buffer
+	for _, b := range ts.buffers {
+		if strings.Contains(b.Filename, a.arg) {
+			if match != nil {
+				return fmt.Errorf("more than one match for %s", a.arg)
+			}
+			match = b
+		}
+	}
+	if match == nil {
+		return fmt.Errorf("no matching buffer for %s", a.arg)
+	}
+	ts.switchBuffer(match)
+	return nil
+}
+
+// cmdBufferDelete closes the current buffer, or the one given by number, refusing to discard
+// changes unless forced.
+func cmdBufferDelete(ts *TermState, a exArgs) error {
+	b := ts.buf
+	if a.arg != "" {
+		n, err := strconv.Atoi(a.arg)
+		if err != nil {
+			return fmt.Errorf("usage: bdelete[!] [N]")
+		}
+		b = nil
+		for _, other := range ts.buffers {
+			if other.Num == n {
+				b = other
+			}
+		}
+		if b == nil {
+			return fmt.Errorf("buffer %d does not exist", n)
+		}
+	}
+	if b.Modified && !a.bang {
+		return fmt.Errorf("no write since last change for buffer %d (add ! to override)", b.Num)
+	}
+	ts.closeBuffer(b)
+	return nil
+}
+
+// cmdListBuffers shows the buffer list, marking the current buffer with '%' and modified ones with '+'.
+func cmdListBuffers(ts *TermState, a exArgs) error {
+	lines := make([]string, 0, len(ts.buffers))
+	for _, b := range ts.buffers {
+		flags := " "
+		if b == ts.buf {
+			flags = "%"
+		}
+		if b.Modified {
+			flags += "+"
+		} else {
+			flags += " "
+		}
+		lines = append(lines, fmt.Sprintf("%3d %s %q", b.Num, flags, b.Name()))
+	}
+	ts.msgLines = lines
+	return nil
+}
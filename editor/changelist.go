@@ -0,0 +1,59 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// maxChanges is how many positions each buffer's changelist keeps.
+const maxChanges = 100
+
+// changeList is where a buffer was recently edited, for g; and g,.
+type changeList struct {
+	positions []buffer.Position // The oldest first
+	index     int               // The entry g; and g, move from, len(positions) if none
+}
+
+// recordChange adds the cursor position to the changelist of b if a key changed it from having
+// changes edits. Edits on the same line as the last one, such as typing in insert mode, update
+// that entry rather than adding one.
+func (ts *TermState) recordChange(b *buffer.Buffer, changes int) {
+	if ts.buf != b || b.Changes() == changes {
+		return
+	}
+	cl := ts.changeLists[b]
+	if cl == nil {
+		cl = &changeList{}
+		ts.changeLists[b] = cl
+	}
+	pos := buffer.Position{Row: ts.cursorY, Col: ts.cursorX}
+	if n := len(cl.positions); n > 0 && cl.positions[n-1].Row == pos.Row {
+		cl.positions[n-1] = pos
+	} else {
+		cl.positions = append(cl.positions, pos)
+		if len(cl.positions) > maxChanges {
+			cl.positions = cl.positions[1:]
+		}
+	}
+	cl.index = len(cl.positions)
+}
+
+// moveInChangelist is g;, going back count positions in the current buffer's changelist, and g,
+// going forward again.
+func (ts *TermState) moveInChangelist(count int) error {
+	cl := ts.changeLists[ts.buf]
+	if cl == nil || len(cl.positions) == 0 {
+		return fmt.Errorf("changelist is empty")
+	}
+	i := cl.index + count
+	if i < 0 {
+		return fmt.Errorf("at start of changelist")
+	}
+	if i >= len(cl.positions) {
+		return fmt.Errorf("at end of changelist")
+	}
+	cl.index = i
+	ts.setCursor(cl.positions[i].Row, cl.positions[i].Col)
+	return nil
+}
@@ -0,0 +1,89 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/keyan/zi/terminal"
+)
+
+var (
+	// clipboardProviders are the external tools zi knows how to copy/paste with, in preference order.
+	clipboardProviders = []string{"pbcopy", "wl-copy", "xclip", "xsel"}
+	// languageServers are the LSP servers checked for on PATH.
+	languageServers = []string{"gopls", "rust-analyzer", "clangd", "pylsp", "pyright-langserver",
+		"typescript-language-server"}
+)
+
+// findClipboardProvider returns the name and path of the first clipboard tool found on PATH.
+func findClipboardProvider() (string, string) {
+	for _, name := range clipboardProviders {
+		if path, err := exec.LookPath(name); err == nil {
+			return name, path
+		}
+	}
+	return "", ""
+}
+
+// cmdCheckHealth reports on the environment zi is running in, intended to be pasted in bug reports.
+func cmdCheckHealth(ts *TermState, a exArgs) error {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	lines := []string{
+		fmt.Sprintf("zi %s health report", ziVersion),
+		"",
+		"Terminal",
+		fmt.Sprintf("  TERM: %q", os.Getenv("TERM")),
+		fmt.Sprintf("  COLORTERM: %q", os.Getenv("COLORTERM")),
+		fmt.Sprintf("  size: %dx%d", ts.winSize.Col+1, ts.winSize.Row+1),
+		fmt.Sprintf("  stdin is a tty: %s, stdout is a tty: %s", yesNo(terminal.IsTerminal(os.Stdin)),
+			yesNo(terminal.IsTerminal(os.Stdout))),
+		fmt.Sprintf("  focus events: %s, synchronized output: %s", yesNo(ts.caps.FocusEvents),
+			yesNo(ts.caps.SyncOutput)),
+		"",
+		"Clipboard",
+	}
+
+	if name, path := findClipboardProvider(); name != "" {
+		lines = append(lines, fmt.Sprintf("  provider: %s (%s)", name, path))
+	} else {
+		lines = append(lines, fmt.Sprintf("  no provider found, tried: %v", clipboardProviders),
+			"  copying through the terminal with OSC 52")
+	}
+
+	lines = append(lines, "", "Language servers")
+	for _, name := range languageServers {
+		if path, err := exec.LookPath(name); err == nil {
+			lines = append(lines, fmt.Sprintf("  %s: %s", name, path))
+		} else {
+			lines = append(lines, fmt.Sprintf("  %s: not found", name))
+		}
+	}
+
+	lines = append(lines, "", "Config")
+	switch {
+	case ts.configPath == "":
+		lines = append(lines, "  no config file loaded (--clean, -u NONE, or no home directory)")
+	case ts.configLoaded:
+		lines = append(lines, fmt.Sprintf("  file: %s", ts.configPath))
+	default:
+		lines = append(lines, fmt.Sprintf("  file: %s (not found)", ts.configPath))
+	}
+	if len(ts.configErrors) == 0 {
+		lines = append(lines, "  errors: none")
+	}
+	for _, err := range ts.configErrors {
+		lines = append(lines, fmt.Sprintf("  error: %v", err))
+	}
+
+	lines = append(lines, "", "Log", fmt.Sprintf("  file: %s", ts.logPath))
+
+	ts.msgLines = lines
+	return nil
+}
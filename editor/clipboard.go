@@ -0,0 +1,39 @@
+package editor
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/keyan/zi/render"
+)
+
+// clipboardCopyArgs are the arguments each of clipboardProviders needs to copy its input.
+var clipboardCopyArgs = map[string][]string{
+	"pbcopy":  nil,
+	"wl-copy": nil,
+	"xclip":   {"-selection", "clipboard"},
+	"xsel":    {"--clipboard", "--input"},
+}
+
+// copyToClipboard puts text on the system clipboard. Without a working clipboard tool, such as in
+// an SSH session, the terminal is asked to copy it with OSC 52, which puts it on the clipboard of
+// the machine the terminal runs on.
+func (ts *TermState) copyToClipboard(text string) error {
+	name, path := findClipboardProvider()
+	if name != "" {
+		cmd := exec.Command(path, clipboardCopyArgs[name]...)
+		cmd.Stdin = strings.NewReader(text)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		// xclip and xsel are often installed where there's no display to copy to.
+		ts.logger.Printf("%s: %v: %s", name, err, out)
+	}
+	if ts.tty == nil {
+		return fmt.Errorf("no clipboard provider found")
+	}
+	render.CopyToClipboard(ts.w, text)
+	return nil
+}
@@ -0,0 +1,417 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+)
+
+// exArgs are the parsed arguments to a single ex command.
+type exArgs struct {
+	arg  string // Everything after the command name, with surrounding whitespace removed
+	bang bool   // true if the command name was followed by '!'
+
+	// line1 and line2 are the 0-indexed first and last rows of the range before the command name,
+	// both the cursor row if no range was given.
+	line1, line2 int
+	hasRange     bool
+}
+
+// exCommand is the handler for a single ex command.
+type exCommand func(ts *TermState, a exArgs) error
+
+// exCommands maps command names, as typed after ':', to their handlers. It is filled in by init,
+// as commands can run other commands.
+var exCommands map[string]exCommand
+
+// runCommand parses and executes a single command line, without the leading ':'.
+func (ts *TermState) runCommand(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	a := exArgs{}
+	line, err := ts.parseRange(line, &a)
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		// A range alone moves to its last line.
+		if a.hasRange {
+			ts.pushJump()
+			ts.setCursor(a.line2, 0)
+		}
+		return nil
+	}
+
+	// Command names are a run of letters, or &, optionally followed by a '!'.
+	i := 0
+	for i < len(line) && isLetter(line[i]) {
+		i++
+	}
+	if i == 0 && strings.HasPrefix(line, "&") {
+		i = 1
+	}
+	name, rest := line[:i], line[i:]
+	if strings.HasPrefix(rest, "!") {
+		a.bang, rest = true, rest[1:]
+	}
+	a.arg = strings.TrimSpace(rest)
+
+	cmd, ok := exCommands[name]
+	if !ok {
+		cmd, ok = ts.userCommands[name]
+	}
+	if !ok {
+		return fmt.Errorf("not an editor command: %s", line)
+	}
+	return cmd(ts, a)
+}
+
+func init() {
+	exCommands = map[string]exCommand{
+		"q":             cmdQuit,
+		"quit":          cmdQuit,
+		"w":             cmdWrite,
+		"write":         cmdWrite,
+		"wq":            cmdWriteQuit,
+		"x":             cmdWriteQuit,
+		"sus":           cmdSuspend,
+		"suspend":       cmdSuspend,
+		"st":            cmdSuspend,
+		"stop":          cmdSuspend,
+		"checkhealth":   cmdCheckHealth,
+		"Explorer":      cmdExplorer,
+		"e":             cmdEdit,
+		"edit":          cmdEdit,
+		"u":             cmdUndo,
+		"undo":          cmdUndo,
+		"red":           cmdRedo,
+		"redo":          cmdRedo,
+		"f":             cmdFile,
+		"file":          cmdFile,
+		"sav":           cmdSaveas,
+		"saveas":        cmdSaveas,
+		"vie":           cmdView,
+		"view":          cmdView,
+		"b":             cmdBuffer,
+		"buffer":        cmdBuffer,
+		"ls":            cmdListBuffers,
+		"buffers":       cmdListBuffers,
+		"bd":            cmdBufferDelete,
+		"bdelete":       cmdBufferDelete,
+		"Buffers":       cmdPickBuffers,
+		"History":       cmdPickHistory,
+		"Marks":         cmdPickMarks,
+		"Pick":          cmdPick,
+		"set":           cmdSet,
+		"compiler":      cmdCompiler,
+		"GoBuild":       cmdGoBuild,
+		"GoTest":        cmdGoTest,
+		"DapBreakpoint": cmdDapBreakpoint,
+		"DapLaunch":     cmdDapLaunch,
+		"DapTest":       cmdDapTest,
+		"DapAttach":     cmdDapAttach,
+		"DapContinue":   cmdDapContinue,
+		"DapNext":       cmdDapNext,
+		"DapStep":       cmdDapStep,
+		"DapStepOut":    cmdDapStepOut,
+		"DapStop":       cmdDapStop,
+		"DapVariables":  cmdDapVariables,
+		"DapOutput":     cmdDapOutput,
+		"jobs":          cmdJobs,
+		"jobstop":       cmdJobStop,
+		"timer":         cmdTimer,
+		"timers":        cmdTimers,
+		"timerstop":     cmdTimerStop,
+		"au":            cmdAutocmd,
+		"autocmd":       cmdAutocmd,
+		"plugin":        cmdPlugin,
+		"lua":           cmdLua,
+		"luafile":       cmdLuaFile,
+		"wasm":          cmdWasm,
+		"se":            cmdSet,
+		"d":             cmdDelete,
+		"delete":        cmdDelete,
+		"y":             cmdYank,
+		"yank":          cmdYank,
+		"p":             cmdPrint,
+		"print":         cmdPrint,
+		"s":             cmdSubstitute,
+		"substitute":    cmdSubstitute,
+		"g":             cmdGlobal,
+		"global":        cmdGlobal,
+		"v":             cmdVglobal,
+		"vglobal":       cmdVglobal,
+		"hex":           cmdHex,
+		"X":             cmdEncrypt,
+		"SudoWrite":     cmdSudoWrite,
+		"Thesaurus":     cmdThesaurus,
+		"Zen":           cmdZen,
+		"Gdiff":         cmdGdiff,
+		"StageHunk":     cmdStageHunk,
+		"RevertHunk":    cmdRevertHunk,
+		"Conflict":      cmdConflict,
+		"ar":            cmdArgs,
+		"args":          cmdArgs,
+		"n":             cmdNext,
+		"next":          cmdNext,
+		"N":             cmdPrevious,
+		"Next":          cmdPrevious,
+		"prev":          cmdPrevious,
+		"previous":      cmdPrevious,
+		"ta":            cmdTag,
+		"tag":           cmdTag,
+		"ts":            cmdTselect,
+		"tselect":       cmdTselect,
+		"checkt":        cmdChecktime,
+		"checktime":     cmdChecktime,
+		"&":             cmdRepeatSubstitute,
+		"pu":            cmdPut,
+		"put":           cmdPut,
+		"reg":           cmdRegisters,
+		"registers":     cmdRegisters,
+		"di":            cmdRegisters,
+		"display":       cmdRegisters,
+		"marks":         cmdMarks,
+		"let":           cmdLet,
+		"ret":           cmdRetab,
+		"retab":         cmdRetab,
+		"m":             cmdMove,
+		"mo":            cmdMove,
+		"move":          cmdMove,
+		"t":             cmdCopy,
+		"co":            cmdCopy,
+		"copy":          cmdCopy,
+	}
+	for _, local := range []bool{false, true} {
+		for name, cmd := range quickfixCommands(local) {
+			exCommands[name] = cmd
+		}
+	}
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// prompt switches to command mode to read a line of input, which is passed to fn once entered.
+// The prompt is abandoned if the user escapes out of it.
+func (ts *TermState) prompt(label, initial string, fn func(input string) error) {
+	ts.mode = commandMode
+	ts.commandBuf = initial
+	ts.promptLabel = label
+	ts.promptFn = fn
+	ts.promptSecret = false
+}
+
+// commandPrefix is the text displayed before the command line.
+func (ts *TermState) commandPrefix() string {
+	if ts.promptFn != nil {
+		return ts.promptLabel
+	}
+	return ":"
+}
+
+func processCommandModePress(ts *TermState, b byte) {
+	switch b {
+	case render.EscapeChar:
+		ts.mode = normalMode
+		ts.promptFn = nil
+	case '\r':
+		ts.mode = normalMode
+		fn := ts.promptFn
+		ts.promptFn = nil
+		var err error
+		if fn != nil {
+			err = fn(ts.commandBuf)
+		} else {
+			err = ts.runCommand(ts.commandBuf)
+		}
+		if err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 127, input.Ctrl('h'):
+		// Backspacing past the ':' leaves command mode, like vim.
+		if len(ts.commandBuf) == 0 {
+			ts.mode = normalMode
+			ts.promptFn = nil
+			return
+		}
+		ts.commandBuf = ts.commandBuf[:len(ts.commandBuf)-1]
+	case '\t':
+		if ts.promptFn == nil {
+			if err := ts.completeFileArg(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		}
+	default:
+		if b >= ' ' {
+			ts.commandBuf += string(b)
+		}
+	}
+}
+
+// cmdQuit exits the editor, refusing to discard changes unless forced. A buffer opened with
+// zi --remote-wait is closed instead, so the client can carry on.
+func cmdQuit(ts *TermState, a exArgs) error {
+	if len(ts.waiters[ts.buf]) > 0 {
+		return cmdBufferDelete(ts, exArgs{bang: a.bang})
+	}
+	if b := ts.modifiedBuffer(); b != nil && !a.bang {
+		return fmt.Errorf("no write since last change for buffer %d (add ! to override)", b.Num)
+	}
+	if ts.headless {
+		return errQuit
+	}
+	render.ClearScreen(ts.w)
+	ts.w.Flush()
+	ts.exit(nil)
+	return nil
+}
+
+// cmdWrite writes the buffer to its file, or to the filename argument if one is given.
+func cmdWrite(ts *TermState, a exArgs) error {
+	// :w!! is the usual mapping for writing with sudo, as :w !sudo tee % in vim.
+	if a.bang && strings.HasPrefix(a.arg, "!") {
+		a.bang, a.arg = false, strings.TrimSpace(a.arg[1:])
+		return cmdSudoWrite(ts, a)
+	}
+	filename, appending := a.arg, false
+	if strings.HasPrefix(filename, ">>") {
+		filename, appending = strings.TrimSpace(filename[2:]), true
+	}
+	filename, err := ts.expandFile(filename)
+	if err != nil {
+		return err
+	}
+	named := filename != ""
+	if filename == "" {
+		filename = ts.buf.Filename
+	}
+	if filename == "" {
+		return fmt.Errorf("no file name")
+	}
+	if ts.buf.BrowseDir != "" && !named {
+		return fmt.Errorf("cannot write a directory listing")
+	}
+	if ts.buf.ReadOnly && !a.bang && filename == ts.buf.Filename {
+		return fmt.Errorf("'readonly' option is set (add ! to override)")
+	}
+	if appending || (a.hasRange && (a.line1 > 0 || a.line2 < ts.buf.Len()-1)) {
+		return ts.writePart(filename, a, appending)
+	}
+
+	ts.doAutocmd("BufWritePre", filename)
+	n, err := ts.writeBuffer(ts.buf, filename, a.bang)
+	if errors.Is(err, fs.ErrPermission) && buffer.IsLocal(filename) {
+		return fmt.Errorf("%v (use :SudoWrite to write it as root)", err)
+	} else if err != nil {
+		return err
+	}
+	ts.statusMsg = fmt.Sprintf("%q %dL, %dB written", filename, ts.buf.Len(), n)
+	ts.refreshHex()
+	ts.doAutocmd("BufWritePost", filename)
+	return nil
+}
+
+// writePart is :[range]w [>>] file, writing only some lines or adding them to the end of the
+// file. The buffer is left as it was, still modified if it had been.
+func (ts *TermState) writePart(filename string, a exArgs, appending bool) error {
+	if filename == ts.buf.Filename && !appending && !a.bang {
+		return fmt.Errorf("use ! to write only part of the buffer")
+	}
+	start, end := 0, ts.buf.Len()
+	if a.hasRange {
+		start, end = a.line1, a.line2+1
+	}
+	if end > ts.buf.Len() {
+		end = ts.buf.Len()
+	}
+	n, err := ts.buf.WriteRange(filename, start, end, buffer.WriteOptions{
+		Fsync:  ts.opts.fsync,
+		Append: appending,
+	})
+	if err != nil {
+		return err
+	}
+	done := "written"
+	if appending {
+		done = "appended"
+	}
+	ts.statusMsg = fmt.Sprintf("%q %dL, %dB %s", filename, end-start, n, done)
+	return nil
+}
+
+// writeBuffer writes b to filename, backing up the file first as set by the backup options. If
+// force is set the file is written even if the backup can't be made.
+func (ts *TermState) writeBuffer(b *buffer.Buffer, filename string, force bool) (int, error) {
+	if filename == b.Filename && b.ChangedOnDisk() && !b.NewFile && !force {
+		return 0, fmt.Errorf("%s has changed since it was read (add ! to overwrite)", filename)
+	}
+	if filename == b.Filename && b.NotEdited && !force {
+		return 0, fmt.Errorf("%s exists and wasn't read (add ! to overwrite)", filename)
+	}
+	backup, err := ts.makeBackup(filename)
+	if err != nil && !force {
+		return 0, fmt.Errorf("cannot make backup: %v (add ! to write anyway)", err)
+	}
+	ts.fixEOL(b)
+	n, err := b.WriteFile(filename, buffer.WriteOptions{
+		Fsync:           ts.opts.fsync,
+		Replace:         ts.opts.backupcopy,
+		ReplaceSymlinks: !ts.opts.keepsymlinks,
+	})
+	if err != nil {
+		if backup != "" {
+			return 0, fmt.Errorf("%v, original kept in %s", err, backup)
+		}
+		return 0, err
+	}
+	if backup != "" && !ts.opts.backup {
+		os.Remove(backup)
+	}
+	ts.written(b, filename)
+	return n, nil
+}
+
+// fixEOL ends the last line of b when it's written, if the fixendofline option is set. Binary
+// files are always written as they were read.
+func (ts *TermState) fixEOL(b *buffer.Buffer) {
+	if ts.opts.fixeol && !b.Binary {
+		b.NoEOL = false
+	}
+}
+
+// written records that b has been written to filename.
+func (ts *TermState) written(b *buffer.Buffer, filename string) {
+	// Writing an unnamed buffer names it, as in vim.
+	if b.Filename == "" {
+		b.Filename = filename
+	}
+	if filename == b.Filename {
+		b.MarkUnmodified()
+		b.NewFile = false
+		b.NotEdited = false
+		b.RecordDiskState()
+		if err := ts.writeSwap(b); err != nil {
+			ts.logger.Printf("swap file: %v", err)
+		}
+	}
+}
+
+// cmdWriteQuit writes the buffer and then exits.
+func cmdWriteQuit(ts *TermState, a exArgs) error {
+	if err := cmdWrite(ts, a); err != nil {
+		return err
+	}
+	return cmdQuit(ts, exArgs{})
+}
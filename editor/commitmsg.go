@@ -0,0 +1,138 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+const (
+	commitSubjectWidth = 50 // Longest a commit subject line should be
+	commitBodyWidth    = 72 // Longest the other lines of a commit message should be
+)
+
+// commitScissors is the line git puts above the diff of a verbose commit, which is dropped from
+// the message with everything after it.
+const commitScissors = "# ------------------------ >8 ------------------------"
+
+// commitState is the highlighting of a commit message buffer.
+type commitState struct {
+	buf     *buffer.Buffer
+	spans   [][]textSpan // Highlighted parts of each row
+	changes int          // The buffer's Changes when they were found
+}
+
+// isCommitMessage reports whether filename is a message git asked for, as when zi is GIT_EDITOR.
+func isCommitMessage(filename string) bool {
+	switch filepath.Base(filename) {
+	case "COMMIT_EDITMSG", "MERGE_MSG", "TAG_EDITMSG":
+		return true
+	}
+	return false
+}
+
+// commitSubject returns the row of a commit message's subject line, its first line that isn't a
+// comment, or -1 if it has none.
+func commitSubject(lines []string) int {
+	for i, line := range lines {
+		if line == commitScissors {
+			break
+		}
+		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// overflow returns a span for the part of line past width columns, or false if it fits.
+func overflow(line string, width int) (textSpan, bool) {
+	if utf8.RuneCountInString(line) <= width {
+		return textSpan{}, false
+	}
+	start := 0
+	for i := 0; i < width; i++ {
+		_, n := utf8.DecodeRuneInString(line[start:])
+		start += n
+	}
+	return textSpan{start, len(line), render.ColorCode(render.FgRed)}, true
+}
+
+// commitSpans highlights a commit message: text past 50 columns in the subject or 72 in the body
+// is red, as is a line between them, comments are faint and the diff of a verbose commit is
+// colored.
+func commitSpans(lines []string) [][]textSpan {
+	spans := make([][]textSpan, len(lines))
+	line := func(row int, c render.Color) {
+		spans[row] = []textSpan{{0, len(lines[row]), render.ColorCode(c)}}
+	}
+	subject, inDiff := commitSubject(lines), false
+	for row, text := range lines {
+		switch {
+		case text == "":
+		case inDiff:
+			switch {
+			case strings.HasPrefix(text, "diff "), strings.HasPrefix(text, "index "),
+				strings.HasPrefix(text, "--- "), strings.HasPrefix(text, "+++ "):
+				line(row, render.Bold)
+			case strings.HasPrefix(text, "@@"):
+				line(row, render.FgCyan)
+			case text[0] == '+':
+				line(row, render.FgGreen)
+			case text[0] == '-':
+				line(row, render.FgRed)
+			}
+		case text[0] == '#':
+			line(row, render.Faint)
+			inDiff = text == commitScissors
+		case subject >= 0 && row == subject+1:
+			// The subject is followed by a blank line.
+			line(row, render.FgRed)
+		case row == subject:
+			if s, ok := overflow(text, commitSubjectWidth); ok {
+				spans[row] = []textSpan{s}
+			}
+		default:
+			if s, ok := overflow(text, commitBodyWidth); ok {
+				spans[row] = []textSpan{s}
+			}
+		}
+	}
+	return spans
+}
+
+// commitMessageSpans returns the highlighting of row if the current buffer is a commit message,
+// finding it again if the buffer has changed.
+func (ts *TermState) commitMessageSpans(row int) []textSpan {
+	if !isCommitMessage(ts.buf.Filename) || ts.buf.LargeFile {
+		return nil
+	}
+	cs := ts.commitMsg
+	if cs == nil || cs.buf != ts.buf || cs.changes != ts.buf.Changes() {
+		cs = &commitState{buf: ts.buf, spans: commitSpans(ts.buf.Lines(0, ts.buf.Len())),
+			changes: ts.buf.Changes()}
+		ts.commitMsg = cs
+	}
+	if row < len(cs.spans) {
+		return cs.spans[row]
+	}
+	return nil
+}
+
+// checkCommitSubject warns if the current buffer is a commit message with a subject line over 50
+// columns, as shown by git log --oneline and in email subjects.
+func (ts *TermState) checkCommitSubject() {
+	if !isCommitMessage(ts.buf.Filename) || ts.buf.LargeFile {
+		return
+	}
+	lines := ts.buf.Lines(0, ts.buf.Len())
+	if row := commitSubject(lines); row >= 0 {
+		if n := utf8.RuneCountInString(lines[row]); n > commitSubjectWidth {
+			ts.statusMsg = fmt.Sprintf("subject line is %d characters, over %d", n, commitSubjectWidth)
+		}
+	}
+}
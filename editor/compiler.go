@@ -0,0 +1,76 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goErrorFormat parses the output of go build, go vet and go test. Package headers and test
+// progress lines are dropped, vet prefixes its errors with "vet: " and test failures are
+// indented with the path relative to the package.
+const goErrorFormat = "%-G#%.%#,%-G=== %.%#,%-G--- %.%#,%-GFAIL%.%#,%-Gok %.%#,%-GPASS%.%#," +
+	"vet: %f:%l:%c: %m,%f:%l:%c: %m,%\\s%#%f:%l: %m,%\\s%#%f:%l +%m"
+
+// compilerPreset is a makeprg and errorformat pair, selected with :compiler.
+type compilerPreset struct {
+	makeprg     string
+	errorformat string
+}
+
+var compilerPresets = map[string]compilerPreset{
+	"go":     {"go build ./...", goErrorFormat},
+	"govet":  {"go vet ./...", goErrorFormat},
+	"gotest": {"go test ./...", goErrorFormat},
+}
+
+// cmdCompiler sets makeprg and errorformat from a named preset, or lists the presets.
+func cmdCompiler(ts *TermState, a exArgs) error {
+	if a.arg == "" {
+		names := make([]string, 0, len(compilerPresets))
+		for name := range compilerPresets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ts.statusMsg = "compilers: " + strings.Join(names, " ")
+		return nil
+	}
+
+	p, ok := compilerPresets[a.arg]
+	if !ok {
+		return fmt.Errorf("compiler not supported: %s", a.arg)
+	}
+	ts.opts.makeprg, ts.opts.errorformat = p.makeprg, p.errorformat
+	return nil
+}
+
+// detectCompiler selects the go preset when zi is started within a Go module without a Makefile,
+// as long as the config hasn't already set makeprg or errorformat.
+func (ts *TermState) detectCompiler() {
+	defaults := defaultOptions()
+	if ts.opts.makeprg != defaults.makeprg || ts.opts.errorformat != defaults.errorformat {
+		return
+	}
+	if _, err := os.Stat("Makefile"); err == nil {
+		return
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			p := compilerPresets["go"]
+			ts.opts.makeprg, ts.opts.errorformat = p.makeprg, p.errorformat
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,51 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGoErrorFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []qfEntry
+	}{
+		{
+			name:   "go build",
+			output: "# example.com/pkg\n./main.go:12:2: undefined: foo\n",
+			want:   []qfEntry{{filename: "./main.go", row: 11, col: 1, text: "undefined: foo"}},
+		},
+		{
+			name:   "go vet",
+			output: "# example.com/pkg\nvet: ./a.go:3:9: unreachable code\n",
+			want:   []qfEntry{{filename: "./a.go", row: 2, col: 8, text: "unreachable code"}},
+		},
+		{
+			name: "go test failure",
+			output: "=== RUN   TestX\n    x_test.go:20: got 1, want 2\n--- FAIL: TestX (0.00s)\n" +
+				"FAIL\nFAIL\texample.com/pkg\t0.002s\n",
+			want: []qfEntry{{filename: "x_test.go", row: 19, text: "got 1, want 2"}},
+		},
+		{
+			name:   "go test panic trace",
+			output: "\t/home/u/pkg/x.go:42 +0x1d\n",
+			want:   []qfEntry{{filename: "/home/u/pkg/x.go", row: 41, text: "0x1d"}},
+		},
+		{
+			name:   "passing packages",
+			output: "ok  \texample.com/pkg\t0.003s\nPASS\n",
+		},
+	}
+	formats, err := parseErrorFormats(goErrorFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseErrors(tt.output, formats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseErrors(%q) = %+v, want %+v", tt.output, got, tt.want)
+			}
+		})
+	}
+}
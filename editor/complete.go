@@ -0,0 +1,235 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// optionFiles splits an option listing files, separated by commas.
+func optionFiles(value string) []string {
+	var files []string
+	for _, f := range strings.Split(value, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// dictionaryWords returns the words to complete with Ctrl-X Ctrl-K: those in the files of the
+// dictionary option, any number to a line, and the spell checking dictionary if it lists
+// "spell" or is empty while spell is on.
+func (ts *TermState) dictionaryWords() ([]string, error) {
+	files := optionFiles(ts.opts.dictionary)
+	if len(files) == 0 {
+		if !ts.opts.spell {
+			return nil, fmt.Errorf("dictionary option is empty")
+		}
+		files = []string{"spell"}
+	}
+	var words []string
+	for _, f := range files {
+		if f == "spell" {
+			d, err := ts.spellDict()
+			if err != nil {
+				return nil, err
+			}
+			for w := range d.words {
+				if !d.bad[w] {
+					words = append(words, w)
+				}
+			}
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, strings.Fields(string(data))...)
+	}
+	return words, nil
+}
+
+// synonyms returns the words given for word in the thesaurus files. A file is either lines of
+// related words, separated by commas or else spaces, or a MyThes .dat file, where each entry is a
+// "word|count" line followed by count lines of "(part of speech)|synonym|synonym...".
+func synonyms(files []string, word string) ([]string, error) {
+	var found []string
+	add := func(words []string) {
+		for _, w := range words {
+			if w = strings.TrimSpace(w); w != "" && !strings.EqualFold(w, word) {
+				found = append(found, w)
+			}
+		}
+	}
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		entryLines := 0 // Lines left in a MyThes entry for word
+		for scanner.Scan() {
+			line := scanner.Text()
+			fields := strings.Split(line, "|")
+			switch {
+			case entryLines > 0:
+				entryLines--
+				add(fields[1:])
+			case len(fields) == 2:
+				if n, err := strconv.Atoi(fields[1]); err == nil && strings.EqualFold(fields[0], word) {
+					entryLines = n
+				}
+			case len(fields) == 1:
+				sep := strings.Fields
+				if strings.Contains(line, ",") {
+					sep = func(s string) []string { return strings.Split(s, ",") }
+				}
+				words := sep(line)
+				for _, w := range words {
+					if strings.EqualFold(strings.TrimSpace(w), word) {
+						add(words)
+						break
+					}
+				}
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// uniqueWords sorts words, dropping repeats and any that are skip.
+func uniqueWords(words []string, skip string) []string {
+	sort.Strings(words)
+	out := words[:0]
+	for i, w := range words {
+		if w != skip && (i == 0 || w != words[i-1]) {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// replaceWord replaces old, from start to end of row, with word. The cursor is left after it in
+// insert mode and on its start otherwise.
+func (ts *TermState) replaceWord(row, start, end int, old, word string) error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	line := ts.buf.Line(row)
+	if end > len(line) || line[start:end] != old {
+		return fmt.Errorf("%q has changed", old)
+	}
+	ts.buf.SetLine(row, line[:start]+word+line[end:])
+	if ts.mode == insertMode || ts.mode == replaceMode {
+		ts.cursorY, ts.cursorX = row, start+len(word)
+		return nil
+	}
+	ts.setCursor(row, start)
+	return nil
+}
+
+// pickReplacement opens a picker over choices for the text from start to end of the cursor row,
+// replacing it with the one chosen.
+func (ts *TermState) pickReplacement(title string, start, end int, choices []string) error {
+	row := ts.cursorY
+	old := ts.buf.Line(row)[start:end]
+	items := make([]pickerItem, 0, len(choices))
+	for _, c := range choices {
+		c := c
+		items = append(items, pickerItem{c, func() error {
+			return ts.replaceWord(row, start, end, old, c)
+		}})
+	}
+	return ts.openPicker(title, items)
+}
+
+// wordBeforeCursor returns where the word ending at the cursor starts, in insert mode.
+func (ts *TermState) wordBeforeCursor() (int, error) {
+	if ts.cursorY >= ts.buf.Len() {
+		return 0, fmt.Errorf("no word before cursor")
+	}
+	line := ts.buf.Line(ts.cursorY)[:ts.cursorX]
+	start, end := wordAround(line, ts.cursorX)
+	if start == end || end != ts.cursorX {
+		return 0, fmt.Errorf("no word before cursor")
+	}
+	return start, nil
+}
+
+// completeDictionary is Ctrl-X Ctrl-K in insert mode, completing the word before the cursor
+// from dictionaryWords.
+func (ts *TermState) completeDictionary() error {
+	start, err := ts.wordBeforeCursor()
+	if err != nil {
+		return err
+	}
+	prefix := ts.buf.Line(ts.cursorY)[start:ts.cursorX]
+	words, err := ts.dictionaryWords()
+	if err != nil {
+		return err
+	}
+	var matches []string
+	for _, w := range words {
+		if len(w) >= len(prefix) && strings.EqualFold(w[:len(prefix)], prefix) {
+			matches = append(matches, matchCase(prefix, w))
+		}
+	}
+	matches = uniqueWords(matches, prefix)
+	if len(matches) == 0 {
+		return fmt.Errorf("no dictionary words start with %q", prefix)
+	}
+	return ts.pickReplacement("Dictionary", start, ts.cursorX, matches)
+}
+
+// lookUpSynonyms offers the synonyms of the word from start to end of the cursor row in the
+// thesaurus option's files, replacing it with the one chosen.
+func (ts *TermState) lookUpSynonyms(start, end int) error {
+	files := optionFiles(ts.opts.thesaurus)
+	if len(files) == 0 {
+		return fmt.Errorf("thesaurus option is empty")
+	}
+	word := ts.buf.Line(ts.cursorY)[start:end]
+	found, err := synonyms(files, word)
+	if err != nil {
+		return err
+	}
+	for i, w := range found {
+		found[i] = matchCase(word, w)
+	}
+	found = uniqueWords(found, word)
+	if len(found) == 0 {
+		return fmt.Errorf("no synonyms for %q", word)
+	}
+	return ts.pickReplacement(fmt.Sprintf("Synonyms of %q", word), start, end, found)
+}
+
+// completeThesaurus is Ctrl-X Ctrl-T in insert mode, replacing the word before the cursor with a
+// synonym.
+func (ts *TermState) completeThesaurus() error {
+	start, err := ts.wordBeforeCursor()
+	if err != nil {
+		return err
+	}
+	return ts.lookUpSynonyms(start, ts.cursorX)
+}
+
+// cmdThesaurus is :Thesaurus, offering synonyms for the word under the cursor.
+func cmdThesaurus(ts *TermState, a exArgs) error {
+	if ts.cursorY >= ts.buf.Len() {
+		return fmt.Errorf("no word under cursor")
+	}
+	start, end := wordAround(ts.buf.Line(ts.cursorY), ts.cursorX)
+	if start == end {
+		return fmt.Errorf("no word under cursor")
+	}
+	return ts.lookUpSynonyms(start, end)
+}
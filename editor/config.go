@@ -0,0 +1,74 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultConfigPath returns where the user's zirc is expected to live, following XDG conventions.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "zi", "zirc")
+}
+
+// loadConfig runs the config file at path, a Lua file if it ends in .lua and otherwise a zirc. The
+// default zirc is followed by an init.lua next to it. Missing files are not an error, but any
+// failures are recorded in ts.configErrors so they can be reported later.
+func (ts *TermState) loadConfig(path string) {
+	ts.configPath = path
+	if path == "" {
+		return
+	}
+
+	if strings.HasSuffix(path, ".lua") {
+		ts.loadLuaConfig(path)
+	} else {
+		ts.loadZirc(path)
+		if path == defaultConfigPath() {
+			ts.loadLuaConfig(filepath.Join(filepath.Dir(path), "init.lua"))
+		}
+	}
+
+	if len(ts.configErrors) > 0 {
+		ts.statusMsg = fmt.Sprintf("%d error(s) in config, see :checkhealth", len(ts.configErrors))
+	}
+}
+
+// loadZirc runs each line of the zirc at path as an ex command.
+func (ts *TermState) loadZirc(path string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		ts.configErrors = append(ts.configErrors, err)
+		return
+	}
+	defer f.Close()
+	ts.configLoaded = true
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		// Lines starting with '"' are comments, as in vimrc files.
+		if line == "" || strings.HasPrefix(line, `"`) {
+			continue
+		}
+		if err := ts.runCommand(strings.TrimPrefix(line, ":")); err != nil {
+			ts.configErrors = append(ts.configErrors, fmt.Errorf("%s:%d: %v", path, n, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		ts.configErrors = append(ts.configErrors, err)
+	}
+}
@@ -0,0 +1,165 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/keyan/zi/render"
+)
+
+// conflict is a merge conflict left in a file by git, as the rows of its markers:
+//
+//	<<<<<<< ours
+//	|||||||  base, only with merge.conflictStyle diff3 or zdiff3
+//	=======
+//	>>>>>>> theirs
+type conflict struct {
+	start, base, middle, end int // base is -1 if the conflict has no base section
+}
+
+// mergeState is the merge conflicts in a buffer.
+type mergeState struct {
+	conflicts []conflict
+	changes   int // The buffer's Changes when they were found
+}
+
+// conflictMarker reports whether line is a conflict marker made of c, seven of them alone or
+// followed by a space and a label.
+func conflictMarker(line string, c byte) bool {
+	marker := strings.Repeat(string(c), 7)
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
+
+// findConflicts returns the complete merge conflicts in lines.
+func findConflicts(lines []string) []conflict {
+	var conflicts []conflict
+	c := conflict{start: -1}
+	for i, line := range lines {
+		switch {
+		case conflictMarker(line, '<'):
+			c = conflict{start: i, base: -1, middle: -1}
+		case c.start < 0:
+		case conflictMarker(line, '|') && c.middle < 0:
+			c.base = i
+		case conflictMarker(line, '=') && c.middle < 0:
+			c.middle = i
+		case conflictMarker(line, '>') && c.middle >= 0:
+			c.end = i
+			conflicts = append(conflicts, c)
+			c = conflict{start: -1}
+		}
+	}
+	return conflicts
+}
+
+// conflicts returns the merge conflicts in the current buffer, finding them again if it has
+// changed.
+func (ts *TermState) conflicts() []conflict {
+	if ts.buf.LargeFile {
+		return nil
+	}
+	cs := ts.merge[ts.buf]
+	if cs == nil || cs.changes != ts.buf.Changes() {
+		cs = &mergeState{conflicts: findConflicts(ts.buf.Lines(0, ts.buf.Len())),
+			changes: ts.buf.Changes()}
+		ts.merge[ts.buf] = cs
+	}
+	return cs.conflicts
+}
+
+// conflictAt returns the merge conflict containing row.
+func (ts *TermState) conflictAt(row int) (conflict, bool) {
+	for _, c := range ts.conflicts() {
+		if c.start <= row && row <= c.end {
+			return c, true
+		}
+	}
+	return conflict{}, false
+}
+
+// conflictSpans colors a row of a merge conflict: the markers red, our side green, the base faint
+// and their side blue.
+func (ts *TermState) conflictSpans(row int) []textSpan {
+	c, ok := ts.conflictAt(row)
+	if !ok {
+		return nil
+	}
+	var color render.Color
+	switch {
+	case row == c.start || row == c.base || row == c.middle || row == c.end:
+		color = render.FgRed
+	case c.base >= 0 && row > c.base && row < c.middle:
+		color = render.Faint
+	case row < c.middle:
+		color = render.FgGreen
+	default:
+		color = render.FgBlue
+	}
+	return []textSpan{{0, len(ts.buf.Line(row)), render.ColorCode(color)}}
+}
+
+// nextConflict is ]x and [x, moving the cursor to the start of the next or previous merge
+// conflict.
+func (ts *TermState) nextConflict(forward bool) error {
+	row := -1
+	for _, c := range ts.conflicts() {
+		if forward && c.start > ts.cursorY {
+			row = c.start
+			break
+		}
+		if !forward && c.start < ts.cursorY {
+			row = c.start
+		}
+	}
+	if row < 0 {
+		return fmt.Errorf("no more conflicts")
+	}
+	ts.setCursor(row, 0)
+	return nil
+}
+
+// cmdConflict is :Conflict ours|theirs|both|base|none, resolving the merge conflict under the
+// cursor by keeping our side, their side, both one after the other, the common ancestor or
+// neither.
+func cmdConflict(ts *TermState, a exArgs) error {
+	c, ok := ts.conflictAt(ts.cursorY)
+	if !ok {
+		return fmt.Errorf("no merge conflict under the cursor")
+	}
+	oursEnd := c.middle
+	if c.base >= 0 {
+		oursEnd = c.base
+	}
+	ours := ts.buf.Lines(c.start+1, oursEnd)
+	theirs := ts.buf.Lines(c.middle+1, c.end)
+	var lines []string
+	switch a.arg {
+	case "ours":
+		lines = ours
+	case "theirs":
+		lines = theirs
+	case "both":
+		lines = append(ours, theirs...)
+	case "base":
+		if c.base < 0 {
+			return fmt.Errorf("conflict has no base, set merge.conflictStyle to diff3 to include it")
+		}
+		lines = ts.buf.Lines(c.base+1, c.middle)
+	case "none":
+	default:
+		return fmt.Errorf("usage: :Conflict ours|theirs|both|base|none")
+	}
+	if err := ts.buf.SetLines(c.start, c.end+1, lines); err != nil {
+		return err
+	}
+	ts.setCursor(c.start, 0)
+	switch n := len(ts.conflicts()); n {
+	case 0:
+		ts.statusMsg = "all conflicts resolved"
+	case 1:
+		ts.statusMsg = "1 conflict left"
+	default:
+		ts.statusMsg = fmt.Sprintf("%d conflicts left", n)
+	}
+	return nil
+}
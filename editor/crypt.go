@@ -0,0 +1,51 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// promptKey asks for the key to an encrypted file, then opens it. The input isn't shown.
+func (ts *TermState) promptKey(filename string) {
+	ts.prompt("Enter encryption key: ", "", func(key string) error {
+		return ts.loadFile(filename, func(name string) (buffer.Storage, buffer.Layout, error) {
+			return buffer.OpenEncrypted(name, key)
+		})
+	})
+	ts.promptSecret = true
+}
+
+// promptNewKey asks twice for a key to encrypt b with when it's written. An empty key turns
+// encryption off.
+func (ts *TermState) promptNewKey(b *buffer.Buffer) {
+	ts.prompt("Enter encryption key: ", "", func(key string) error {
+		ts.prompt("Enter same key again: ", "", func(again string) error {
+			if again != key {
+				return fmt.Errorf("keys don't match")
+			}
+			if err := b.SetKey(key); err != nil {
+				return err
+			}
+			// The swap file holds the text unencrypted, so it goes now rather than at the next change.
+			if b.Encrypted() {
+				ts.removeSwap(b)
+			}
+			b.MarkModified()
+			return nil
+		})
+		ts.promptSecret = true
+		return nil
+	})
+	ts.promptSecret = true
+}
+
+// cmdEncrypt is :X, asking for a key to encrypt the buffer with when it's written. Only the
+// encrypted text is written, including when saving it for recovery.
+func cmdEncrypt(ts *TermState, a exArgs) error {
+	if ts.buf.BrowseDir != "" {
+		return fmt.Errorf("cannot encrypt a directory listing")
+	}
+	ts.promptNewKey(ts.buf)
+	return nil
+}
@@ -0,0 +1,29 @@
+package editor
+
+import "github.com/keyan/zi/render"
+
+// updateCursorShape shows the mode with the cursor: a bar while typing text, an underline when
+// replacing, and a block otherwise.
+func (ts *TermState) updateCursorShape() {
+	if ts.tty == nil {
+		return
+	}
+	shape := render.CursorBlock
+	switch {
+	case ts.mode == insertMode, ts.mode == commandMode, ts.picker != nil:
+		shape = render.CursorBar
+	case ts.mode == replaceMode:
+		shape = render.CursorUnderline
+	}
+	ts.setCursorShape(shape)
+}
+
+// setCursorShape changes the cursor if it isn't already shape. CursorDefault puts back the
+// terminal's own cursor.
+func (ts *TermState) setCursorShape(shape render.CursorShape) {
+	if shape == ts.cursorShape {
+		return
+	}
+	render.SetCursorShape(ts.w, shape)
+	ts.cursorShape = shape
+}
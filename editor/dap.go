@@ -0,0 +1,584 @@
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/keyan/zi/render"
+)
+
+const (
+	maxVariablesWidth = 40
+	maxDapOutputLines = 1000
+)
+
+// dapMessage is a Debug Adapter Protocol request, response or event. Only the fields zi uses are
+// included.
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  interface{}     `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    bool            `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// dapSession is a connection to a running `dlv dap` server. All fields are only used from the
+// main goroutine, messages are read in the background and passed over ts.events.
+type dapSession struct {
+	job       *job     // The dlv process
+	conn      net.Conn // nil until dlv is listening
+	seq       int
+	pending   map[int]func(body json.RawMessage) // Response handlers, by request seq
+	stopped   bool
+	threadID  int    // Thread which last stopped, used for stepping
+	frame     string // Name of the function the program stopped in
+	pcFile    string // Absolute path and 1-indexed line of where the program stopped
+	pcLine    int
+	variables []string // Lines shown in the variables panel
+	panel     bool     // true if the variables panel is shown
+}
+
+// status is shown in the status bar while debugging.
+func (s *dapSession) status() string {
+	switch {
+	case s.conn == nil:
+		return "[dlv starting]"
+	case s.stopped:
+		return "[dlv stopped]"
+	default:
+		return "[dlv running]"
+	}
+}
+
+// appendDapOutput records text printed by the program or debugger. It is kept after the session
+// ends, until the next one starts.
+func (ts *TermState) appendDapOutput(text string) {
+	ts.dapOutput = append(ts.dapOutput, strings.Split(strings.TrimRight(text, "\n"), "\n")...)
+	if len(ts.dapOutput) > maxDapOutputLines {
+		ts.dapOutput = ts.dapOutput[len(ts.dapOutput)-maxDapOutputLines:]
+	}
+}
+
+// readDapMessage reads a single Content-Length framed message from r.
+func readDapMessage(r *bufio.Reader) (*dapMessage, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if v := strings.TrimPrefix(line, "Content-Length:"); v != line {
+			if length, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("bad header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	msg := &dapMessage{}
+	return msg, json.Unmarshal(data, msg)
+}
+
+// startDap runs dlv in the background and sends it request, either "launch" or "attach", once
+// connected. Breakpoints are sent when dlv asks for them with the initialized event.
+func (ts *TermState) startDap(request string, args map[string]interface{}) error {
+	if ts.dap != nil {
+		return fmt.Errorf("already debugging, use :DapStop first")
+	}
+	if _, err := exec.LookPath("dlv"); err != nil {
+		return fmt.Errorf("dlv not found, install it with: go install github.com/go-delve/delve/cmd/dlv@latest")
+	}
+
+	s := &dapSession{pending: make(map[int]func(json.RawMessage)), panel: true}
+	// dlv prints the address it listens on, then anything else it or the program prints.
+	onOutput := func(line string) {
+		const prefix = "listening at:"
+		if i := strings.Index(line, prefix); i >= 0 && ts.dap == s && s.conn == nil {
+			ts.connectDap(strings.TrimSpace(line[i+len(prefix):]), request, args)
+			return
+		}
+		ts.appendDapOutput(line)
+	}
+	j, err := ts.startJob("dlv", exec.Command("dlv", "dap", "--listen=127.0.0.1:0"), jobCallbacks{
+		onStdout: onOutput,
+		onStderr: onOutput,
+		onExit: func(err error) {
+			if ts.dap != s {
+				return
+			}
+			if err != nil {
+				ts.stopDap("dlv exited: " + err.Error())
+			} else {
+				ts.stopDap("dlv exited")
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	j.service = true
+	s.job = j
+	ts.dap = s
+	ts.dapOutput = nil
+	return nil
+}
+
+// connectDap connects to dlv at addr and sends it request once initialized.
+func (ts *TermState) connectDap(addr, request string, args map[string]interface{}) {
+	s := ts.dap
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		ts.stopDap("dlv: " + err.Error())
+		return
+	}
+	s.conn = conn
+	go ts.readDapMessages(s)
+	ts.dapRequest("initialize", map[string]interface{}{
+		"clientID":        "zi",
+		"adapterID":       "go",
+		"linesStartAt1":   true,
+		"columnsStartAt1": true,
+		"pathFormat":      "path",
+	}, func(json.RawMessage) {
+		ts.dapRequest(request, args, nil)
+	})
+}
+
+// readDapMessages passes each message from dlv to the main loop until the connection closes.
+func (ts *TermState) readDapMessages(s *dapSession) {
+	r := bufio.NewReader(s.conn)
+	for {
+		msg, err := readDapMessage(r)
+		if err != nil {
+			ts.events <- func() {
+				if ts.dap == s {
+					ts.stopDap("debug session ended")
+				}
+			}
+			return
+		}
+		ts.events <- func() {
+			if ts.dap == s {
+				ts.handleDapMessage(msg)
+			}
+		}
+	}
+}
+
+// dapRequest sends a request to dlv, calling fn with the response body if it succeeds. Failures
+// are reported in the status bar.
+func (ts *TermState) dapRequest(command string, args interface{}, fn func(body json.RawMessage)) {
+	s := ts.dap
+	if s == nil {
+		return
+	}
+	s.seq++
+	data, err := json.Marshal(dapMessage{Seq: s.seq, Type: "request", Command: command, Arguments: args})
+	if err != nil {
+		ts.statusMsg = err.Error()
+		return
+	}
+	s.pending[s.seq] = fn
+	if _, err := fmt.Fprintf(s.conn, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		ts.stopDap("dlv: " + err.Error())
+	}
+}
+
+// handleDapMessage acts on a response or event from dlv.
+func (ts *TermState) handleDapMessage(msg *dapMessage) {
+	s := ts.dap
+	switch msg.Type {
+	case "response":
+		fn, ok := s.pending[msg.RequestSeq]
+		delete(s.pending, msg.RequestSeq)
+		if !msg.Success {
+			ts.statusMsg = fmt.Sprintf("%s: %s", msg.Command, msg.Message)
+			return
+		}
+		if ok && fn != nil {
+			fn(msg.Body)
+		}
+	case "event":
+		ts.handleDapEvent(msg.Event, msg.Body)
+	}
+}
+
+func (ts *TermState) handleDapEvent(event string, body json.RawMessage) {
+	s := ts.dap
+	switch event {
+	case "initialized":
+		for _, file := range ts.breakpointFiles() {
+			ts.dapSetBreakpoints(file)
+		}
+		ts.dapRequest("configurationDone", nil, nil)
+	case "stopped":
+		var stopped struct {
+			Reason   string `json:"reason"`
+			ThreadID int    `json:"threadId"`
+		}
+		json.Unmarshal(body, &stopped)
+		s.stopped, s.threadID = true, stopped.ThreadID
+		ts.statusMsg = "stopped: " + stopped.Reason
+		ts.dapShowFrame()
+	case "continued":
+		s.stopped, s.pcFile = false, ""
+	case "output":
+		var output struct {
+			Output string `json:"output"`
+		}
+		json.Unmarshal(body, &output)
+		ts.appendDapOutput(output.Output)
+	case "exited":
+		var exited struct {
+			ExitCode int `json:"exitCode"`
+		}
+		json.Unmarshal(body, &exited)
+		ts.appendDapOutput(fmt.Sprintf("exited with status %d", exited.ExitCode))
+	case "terminated":
+		ts.stopDap("program terminated, see :DapOutput")
+	}
+}
+
+// dapShowFrame moves the cursor to where the program stopped, and loads the variables of that
+// frame into the variables panel.
+func (ts *TermState) dapShowFrame() {
+	s := ts.dap
+	ts.dapRequest("stackTrace", map[string]interface{}{"threadId": s.threadID, "levels": 1},
+		func(body json.RawMessage) {
+			var trace struct {
+				StackFrames []struct {
+					ID     int    `json:"id"`
+					Name   string `json:"name"`
+					Line   int    `json:"line"`
+					Column int    `json:"column"`
+					Source struct {
+						Path string `json:"path"`
+					} `json:"source"`
+				} `json:"stackFrames"`
+			}
+			json.Unmarshal(body, &trace)
+			if len(trace.StackFrames) == 0 {
+				return
+			}
+			f := trace.StackFrames[0]
+			s.frame, s.pcFile, s.pcLine = f.Name, f.Source.Path, f.Line
+			if f.Source.Path != "" {
+				if err := ts.openFile(f.Source.Path); err != nil {
+					ts.statusMsg = err.Error()
+				} else {
+					ts.setCursor(f.Line-1, f.Column-1)
+				}
+			}
+
+			ts.dapRequest("scopes", map[string]interface{}{"frameId": f.ID}, func(body json.RawMessage) {
+				var scopes struct {
+					Scopes []dapScope `json:"scopes"`
+				}
+				json.Unmarshal(body, &scopes)
+				ts.dapLoadVariables(scopes.Scopes, nil)
+			})
+		})
+}
+
+// dapScope is a group of variables in a stack frame, such as its locals.
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// dapLoadVariables requests the variables of each scope in turn, so they're listed in order, and
+// shows them in the variables panel once all have arrived.
+func (ts *TermState) dapLoadVariables(scopes []dapScope, lines []string) {
+	if len(scopes) == 0 {
+		ts.dap.variables = lines
+		return
+	}
+	scope := scopes[0]
+	ts.dapRequest("variables", map[string]interface{}{"variablesReference": scope.VariablesReference},
+		func(body json.RawMessage) {
+			var vars struct {
+				Variables []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"variables"`
+			}
+			json.Unmarshal(body, &vars)
+			lines = append(lines, scope.Name+":")
+			for _, v := range vars.Variables {
+				value := strings.ReplaceAll(v.Value, "\n", " ")
+				lines = append(lines, fmt.Sprintf("  %s = %s", v.Name, value))
+			}
+			ts.dapLoadVariables(scopes[1:], lines)
+		})
+}
+
+// stopDap ends the debug session, killing dlv and the program being debugged.
+func (ts *TermState) stopDap(msg string) {
+	s := ts.dap
+	if s == nil {
+		return
+	}
+	ts.dap = nil
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	ts.stopJob(s.job)
+	ts.statusMsg = msg
+}
+
+// breakpointFiles returns the files with breakpoints set, sorted.
+func (ts *TermState) breakpointFiles() []string {
+	files := make([]string, 0, len(ts.breakpoints))
+	for file := range ts.breakpoints {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// dapSetBreakpoints sends every breakpoint in file to dlv, replacing those it had before.
+func (ts *TermState) dapSetBreakpoints(file string) {
+	lines := ts.breakpoints[file]
+	bps := make([]map[string]int, 0, len(lines))
+	for _, line := range lines {
+		bps = append(bps, map[string]int{"line": line})
+	}
+	args := map[string]interface{}{
+		"source":      map[string]string{"path": file},
+		"breakpoints": bps,
+	}
+	ts.dapRequest("setBreakpoints", args, func(body json.RawMessage) {
+		var resp struct {
+			Breakpoints []struct {
+				Verified bool   `json:"verified"`
+				Line     int    `json:"line"`
+				Message  string `json:"message"`
+			} `json:"breakpoints"`
+		}
+		json.Unmarshal(body, &resp)
+		for _, bp := range resp.Breakpoints {
+			if !bp.Verified {
+				ts.statusMsg = fmt.Sprintf("breakpoint at %s:%d not set: %s", filepath.Base(file),
+					bp.Line, bp.Message)
+			}
+		}
+	})
+}
+
+// sign is drawn in the sign column, to the left of the line numbers.
+type sign struct {
+	text string // Two columns wide
+	c    render.Color
+}
+
+// lineSigns returns the signs to draw for the current buffer, by 0-indexed row.
+func (ts *TermState) lineSigns() map[int]sign {
+	signs := make(map[int]sign)
+	if ts.buf.Filename == "" {
+		return signs
+	}
+	// Beside :Gdiff, signs show the changes it highlights.
+	if dv := ts.diffView(); dv != nil {
+		gitSigns(signs, dv.hunks)
+	} else {
+		hunks, _ := ts.gitHunks()
+		gitSigns(signs, hunks)
+	}
+	file := absPath(ts.buf.Filename)
+	for _, line := range ts.breakpoints[file] {
+		signs[line-1] = sign{"B ", render.FgRed}
+	}
+	if ts.dap != nil && ts.dap.stopped && ts.dap.pcFile == file {
+		signs[ts.dap.pcLine-1] = sign{"=>", render.Bold}
+	}
+	return signs
+}
+
+// variablesWidth is the number of columns taken by the variables panel and its separator.
+func (ts *TermState) variablesWidth() int {
+	if ts.dap == nil || !ts.dap.panel {
+		return 0
+	}
+	w := int(ts.winSize.Col) / 3
+	if w > maxVariablesWidth {
+		w = maxVariablesWidth
+	}
+	return w + 1
+}
+
+// drawVariablesRow writes screen row i of the variables panel, at the right edge of the screen.
+func (ts *TermState) drawVariablesRow(i int) {
+	width := ts.variablesWidth() - 1
+	s := ts.dap
+
+	text := ""
+	switch {
+	case i == 0:
+		text = "Variables"
+		if s.stopped && s.frame != "" {
+			text += " -- " + s.frame
+		}
+	case i-1 < len(s.variables) && s.stopped:
+		text = s.variables[i-1]
+	}
+	if len(text) > width {
+		text = text[:width]
+	}
+
+	fmt.Fprintf(ts.w, "%c%c%d;%dH", render.EscapeChar, render.EscapeSeqBegin, i+1, int(ts.winSize.Col)+1-width)
+	fmt.Fprintf(ts.w, "%s|%s", render.ColorCode(render.Faint), render.ColorCode(render.Reset))
+	if i == 0 {
+		fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(render.Bold), width, text, render.ColorCode(render.Reset))
+	} else {
+		fmt.Fprintf(ts.w, "%-*s", width, text)
+	}
+}
+
+// cmdDapBreakpoint toggles a breakpoint on the cursor line.
+func cmdDapBreakpoint(ts *TermState, a exArgs) error {
+	if ts.buf.Filename == "" || ts.buf.BrowseDir != "" {
+		return fmt.Errorf("breakpoints can only be set in a file")
+	}
+	file := absPath(ts.buf.Filename)
+	line := ts.cursorY + 1
+
+	lines := ts.breakpoints[file]
+	i := sort.SearchInts(lines, line)
+	if i < len(lines) && lines[i] == line {
+		lines = append(lines[:i], lines[i+1:]...)
+	} else {
+		lines = append(lines[:i], append([]int{line}, lines[i:]...)...)
+	}
+	if len(lines) == 0 {
+		delete(ts.breakpoints, file)
+	} else {
+		ts.breakpoints[file] = lines
+	}
+
+	if ts.dap != nil && ts.dap.conn != nil {
+		ts.dapSetBreakpoints(file)
+	}
+	return nil
+}
+
+// debugDir is the package directory to debug, the one containing the current file.
+func (ts *TermState) debugDir() string {
+	if ts.buf.Filename == "" {
+		return absPath(".")
+	}
+	if ts.buf.BrowseDir != "" {
+		return ts.buf.BrowseDir
+	}
+	return filepath.Dir(absPath(ts.buf.Filename))
+}
+
+// cmdDapLaunch debugs the package containing the current file, passing any arguments to the
+// program.
+func cmdDapLaunch(ts *TermState, a exArgs) error {
+	return ts.startDap("launch", map[string]interface{}{
+		"mode":    "debug",
+		"program": ts.debugDir(),
+		"args":    strings.Fields(a.arg),
+	})
+}
+
+// cmdDapTest debugs the tests of the package containing the current file, any arguments such as
+// -test.run are passed to the test binary.
+func cmdDapTest(ts *TermState, a exArgs) error {
+	return ts.startDap("launch", map[string]interface{}{
+		"mode":    "test",
+		"program": ts.debugDir(),
+		"args":    strings.Fields(a.arg),
+	})
+}
+
+// cmdDapAttach debugs a running process, given by its pid.
+func cmdDapAttach(ts *TermState, a exArgs) error {
+	pid, err := strconv.Atoi(a.arg)
+	if err != nil {
+		return fmt.Errorf("usage: :DapAttach {pid}")
+	}
+	return ts.startDap("attach", map[string]interface{}{"mode": "local", "processId": pid})
+}
+
+// dapResume sends command, such as "next", for the stopped thread.
+func (ts *TermState) dapResume(command string) error {
+	s := ts.dap
+	if s == nil || s.conn == nil {
+		return fmt.Errorf("not debugging, start with :DapLaunch")
+	}
+	if !s.stopped {
+		return fmt.Errorf("program is running")
+	}
+	s.stopped, s.pcFile = false, ""
+	ts.dapRequest(command, map[string]interface{}{"threadId": s.threadID}, nil)
+	return nil
+}
+
+func cmdDapContinue(ts *TermState, a exArgs) error {
+	return ts.dapResume("continue")
+}
+
+func cmdDapNext(ts *TermState, a exArgs) error {
+	return ts.dapResume("next")
+}
+
+func cmdDapStep(ts *TermState, a exArgs) error {
+	return ts.dapResume("stepIn")
+}
+
+func cmdDapStepOut(ts *TermState, a exArgs) error {
+	return ts.dapResume("stepOut")
+}
+
+// cmdDapStop ends the debug session.
+func cmdDapStop(ts *TermState, a exArgs) error {
+	if ts.dap == nil {
+		return fmt.Errorf("not debugging")
+	}
+	if ts.dap.conn != nil {
+		ts.dapRequest("disconnect", map[string]interface{}{"terminateDebuggee": true}, nil)
+	}
+	ts.stopDap("debug session stopped")
+	return nil
+}
+
+// cmdDapVariables toggles the variables panel.
+func cmdDapVariables(ts *TermState, a exArgs) error {
+	if ts.dap == nil {
+		return fmt.Errorf("not debugging")
+	}
+	ts.dap.panel = !ts.dap.panel
+	return nil
+}
+
+// cmdDapOutput shows what the program and dlv have printed.
+func cmdDapOutput(ts *TermState, a exArgs) error {
+	if len(ts.dapOutput) == 0 {
+		return fmt.Errorf("no debugger output")
+	}
+	ts.msgLines = append([]string(nil), ts.dapOutput...)
+	return nil
+}
@@ -0,0 +1,503 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// dictionary is the words of a language, for spell checking.
+type dictionary struct {
+	lang     string
+	words    map[string]bool
+	bad      map[string]bool // Words marked wrong with zw, whatever the dictionary says
+	userFile string          // Words added with zg and zw, see readUserWords
+}
+
+// spellDirs are where dictionaries are looked for, the user's own first.
+func spellDirs() []string {
+	var dirs []string
+	if path := defaultConfigPath(); path != "" {
+		dirs = append(dirs, filepath.Join(filepath.Dir(path), "spell"))
+	}
+	return append(dirs, "/usr/share/hunspell", "/usr/share/myspell", "/usr/share/myspell/dicts",
+		"/usr/local/share/hunspell", "/opt/homebrew/share/hunspell", "/Library/Spelling")
+}
+
+// loadDictionary reads the dictionary for lang, such as en_US. Hunspell dictionaries, lang.dic
+// with its lang.aff, are looked for in spellDirs, then a plain list of words, lang.txt. For
+// English the system word list is the last resort.
+func loadDictionary(lang string) (*dictionary, error) {
+	d := &dictionary{lang: lang, words: make(map[string]bool), bad: make(map[string]bool)}
+	for _, dir := range spellDirs() {
+		base := filepath.Join(dir, lang)
+		if _, err := os.Stat(base + ".dic"); err == nil {
+			return d, d.readHunspell(base)
+		}
+		if _, err := os.Stat(base + ".txt"); err == nil {
+			return d, d.readWordList(base + ".txt")
+		}
+	}
+	if strings.HasPrefix(lang, "en") {
+		if _, err := os.Stat("/usr/share/dict/words"); err == nil {
+			return d, d.readWordList("/usr/share/dict/words")
+		}
+	}
+	return nil, fmt.Errorf("no dictionary for %s, add %s.dic and %s.aff to %s", lang, lang, lang,
+		spellDirs()[0])
+}
+
+// readWordList adds the words in a file of one word per line.
+func (d *dictionary) readWordList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+			d.words[word] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// affix is one rule of a hunspell prefix or suffix class.
+type affix struct {
+	strip, add string
+	cond       *regexp.Regexp // Matched against the word the affix is added to
+}
+
+// affixClass is the rules for one affix flag.
+type affixClass struct {
+	prefix bool
+	cross  bool // Can be combined with affixes of the other kind
+	rules  []affix
+}
+
+// affixFile is what's used from a hunspell .aff file: the affix classes, and how flags and text
+// are written.
+type affixFile struct {
+	latin1    bool   // Text is ISO 8859-1 rather than UTF-8
+	flagType  string // "", "long", "num" or "UTF-8", see splitFlags
+	classes   map[string]*affixClass
+	needAffix string // Flag of stems which aren't words by themselves
+	forbidden string // Flag of words which are always wrong
+}
+
+// readHunspell adds the words of the hunspell dictionary base.dic, expanded with the affixes in
+// base.aff. Compounding and the other rules used for suggestions aren't supported.
+func (d *dictionary) readHunspell(base string) error {
+	aff, err := readAffixFile(base + ".aff")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.Open(base + ".dic")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	first := true
+	for scanner.Scan() {
+		line := aff.text(scanner.Text())
+		// The first line is the number of words.
+		if first {
+			first = false
+			if _, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+				continue
+			}
+		}
+		// Anything after whitespace is morphological data.
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			line = line[:i]
+		}
+		word, flags, _ := strings.Cut(line, "/")
+		if word == "" {
+			continue
+		}
+		d.addStem(aff, word, aff.splitFlags(flags))
+	}
+	return scanner.Err()
+}
+
+// addStem adds word and every form made from it with the affixes given by flags.
+func (d *dictionary) addStem(aff *affixFile, word string, flags []string) {
+	for _, flag := range flags {
+		if flag == aff.forbidden && flag != "" {
+			return
+		}
+	}
+	needAffix := false
+	for _, flag := range flags {
+		needAffix = needAffix || (flag == aff.needAffix && flag != "")
+	}
+	if !needAffix {
+		d.words[word] = true
+	}
+
+	var prefixes []*affixClass
+	for _, flag := range flags {
+		if c := aff.classes[flag]; c != nil && c.prefix {
+			prefixes = append(prefixes, c)
+		}
+	}
+	for _, p := range prefixes {
+		for _, form := range p.apply(word) {
+			d.words[form] = true
+		}
+	}
+	for _, flag := range flags {
+		c := aff.classes[flag]
+		if c == nil || c.prefix {
+			continue
+		}
+		for _, form := range c.apply(word) {
+			d.words[form] = true
+			if !c.cross {
+				continue
+			}
+			for _, p := range prefixes {
+				if p.cross {
+					for _, both := range p.apply(form) {
+						d.words[both] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// apply returns the forms made from word by each rule of c which matches it.
+func (c *affixClass) apply(word string) []string {
+	var forms []string
+	for _, r := range c.rules {
+		if !r.cond.MatchString(word) {
+			continue
+		}
+		if c.prefix {
+			if strings.HasPrefix(word, r.strip) {
+				forms = append(forms, r.add+word[len(r.strip):])
+			}
+		} else if strings.HasSuffix(word, r.strip) {
+			forms = append(forms, word[:len(word)-len(r.strip)]+r.add)
+		}
+	}
+	return forms
+}
+
+// readAffixFile reads the parts of a hunspell .aff file that readHunspell uses. A missing file
+// is returned as an empty affixFile along with the error.
+func readAffixFile(path string) (*affixFile, error) {
+	aff := &affixFile{classes: make(map[string]*affixClass)}
+	f, err := os.Open(path)
+	if err != nil {
+		return aff, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(aff.text(scanner.Text()))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "SET":
+			aff.latin1 = strings.EqualFold(fields[1], "ISO8859-1")
+		case "FLAG":
+			aff.flagType = fields[1]
+		case "NEEDAFFIX":
+			aff.needAffix = fields[1]
+		case "FORBIDDENWORD":
+			aff.forbidden = fields[1]
+		case "PFX", "SFX":
+			if len(fields) < 3 {
+				continue
+			}
+			prefix := fields[0] == "PFX"
+			c := aff.classes[fields[1]]
+			// The class header is "PFX flag cross count", each rule "PFX flag strip add cond".
+			if c == nil {
+				c = &affixClass{prefix: prefix, cross: fields[2] == "Y"}
+				aff.classes[fields[1]] = c
+				continue
+			}
+			if len(fields) < 4 {
+				continue
+			}
+			r := affix{strip: fields[2], add: fields[3]}
+			if r.strip == "0" {
+				r.strip = ""
+			}
+			// Flags on the affix itself, for affixes of affixes, aren't supported.
+			r.add, _, _ = strings.Cut(r.add, "/")
+			if r.add == "0" {
+				r.add = ""
+			}
+			cond := "."
+			if len(fields) > 4 {
+				cond = fields[4]
+			}
+			if prefix {
+				r.cond, err = regexp.Compile("^" + cond)
+			} else {
+				r.cond, err = regexp.Compile(cond + "$")
+			}
+			if err != nil {
+				continue
+			}
+			c.rules = append(c.rules, r)
+		}
+	}
+	return aff, scanner.Err()
+}
+
+// text converts a line of an affix or dictionary file to UTF-8.
+func (aff *affixFile) text(line string) string {
+	if !aff.latin1 {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		b.WriteRune(rune(line[i]))
+	}
+	return b.String()
+}
+
+// splitFlags splits the flags of a dictionary word, which are single characters by default, pairs
+// of characters with FLAG long, or comma separated numbers with FLAG num.
+func (aff *affixFile) splitFlags(flags string) []string {
+	var out []string
+	switch aff.flagType {
+	case "long":
+		for i := 0; i+1 < len(flags); i += 2 {
+			out = append(out, flags[i:i+2])
+		}
+	case "num":
+		out = strings.Split(flags, ",")
+	default:
+		for _, r := range flags {
+			out = append(out, string(r))
+		}
+	}
+	return out
+}
+
+// spelledRight reports whether word is in the dictionary. A capitalized or all capitals word is
+// also right if its lowercase form is, as at the start of a sentence or in a heading.
+func (d *dictionary) spelledRight(word string) bool {
+	if d.bad[word] || d.bad[strings.ToLower(word)] {
+		return false
+	}
+	if d.words[word] {
+		return true
+	}
+	lower := strings.ToLower(word)
+	first, n := utf8.DecodeRuneInString(word)
+	if unicode.IsUpper(first) && (word[n:] == strings.ToLower(word[n:]) || word == strings.ToUpper(word)) {
+		if d.words[lower] {
+			return true
+		}
+	}
+	if word == strings.ToUpper(word) {
+		title := strings.ToUpper(lower[:utf8.RuneLen(first)]) + lower[utf8.RuneLen(first):]
+		return d.words[title]
+	}
+	return false
+}
+
+// readUserWords adds the words in the user's spell file, one per line, as added by zg. Words
+// ending in /! were added by zw and are always taken as wrong. A missing file is no error.
+func (d *dictionary) readUserWords(path string) error {
+	d.userFile = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "/!") {
+			d.bad[strings.TrimSuffix(line, "/!")] = true
+		} else if line != "" && !strings.HasPrefix(line, "#") {
+			d.words[line] = true
+		}
+	}
+	return nil
+}
+
+// addUserWord adds word to the user's spell file, as a good word or with wrong as a bad one,
+// replacing any earlier entry for it.
+func (d *dictionary) addUserWord(word string, wrong bool) error {
+	entry := word
+	if wrong {
+		entry += "/!"
+	}
+	var lines []string
+	if data, err := os.ReadFile(d.userFile); err == nil {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if line != word && line != word+"/!" {
+				lines = append(lines, line)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.userFile), 0o755); err != nil {
+		return err
+	}
+	lines = append(lines, entry)
+	if err := os.WriteFile(d.userFile, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return err
+	}
+	if wrong {
+		d.bad[word] = true
+		delete(d.words, word)
+	} else {
+		d.words[word] = true
+		delete(d.bad, word)
+	}
+	return nil
+}
+
+// maxSuggestions is how many corrections are offered for a misspelled word.
+const maxSuggestions = 15
+
+// suggest returns the words in the dictionary closest to a misspelled word, best first. They're
+// ranked by edit distance, counting a swap of two letters as one edit, then by whether they
+// start with the same letter and by length. Splitting the word in two is also suggested. The
+// suggestions are capitalized as word is.
+func (d *dictionary) suggest(word string) []string {
+	type candidate struct {
+		word string
+		dist int
+	}
+	lower := []rune(strings.ToLower(word))
+	if len(lower) == 0 {
+		return nil
+	}
+	limit := 2
+	if len(lower) > 7 {
+		limit = 3
+	}
+	var found []candidate
+	for w := range d.words {
+		if d.bad[w] {
+			continue
+		}
+		n := utf8.RuneCountInString(w)
+		if n < len(lower)-limit || n > len(lower)+limit {
+			continue
+		}
+		if dist := editDistance(lower, []rune(strings.ToLower(w)), limit); dist <= limit {
+			found = append(found, candidate{w, dist})
+		}
+	}
+	for i := 1; i < len(lower); i++ {
+		first, second := string(lower[:i]), string(lower[i:])
+		if len(lower[:i]) > 1 && len(lower[i:]) > 1 && d.words[first] && d.words[second] {
+			found = append(found, candidate{first + " " + second, 1})
+		}
+	}
+
+	sameStart := func(w string) bool {
+		r, _ := utf8.DecodeRuneInString(w)
+		return unicode.ToLower(r) == lower[0]
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.dist != b.dist {
+			return a.dist < b.dist
+		}
+		if sameStart(a.word) != sameStart(b.word) {
+			return sameStart(a.word)
+		}
+		aLen, bLen := len(a.word)-len(word), len(b.word)-len(word)
+		if aLen*aLen != bLen*bLen {
+			return aLen*aLen < bLen*bLen
+		}
+		return a.word < b.word
+	})
+
+	var suggestions []string
+	seen := make(map[string]bool)
+	for _, c := range found {
+		s := matchCase(word, c.word)
+		if !seen[s] && s != word {
+			seen[s] = true
+			suggestions = append(suggestions, s)
+		}
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+	return suggestions
+}
+
+// matchCase capitalizes suggestion like word, all in capitals or with a capital first letter.
+// Words with capitals of their own in the dictionary, such as names, are left as they are.
+func matchCase(word, suggestion string) string {
+	first, _ := utf8.DecodeRuneInString(word)
+	switch {
+	case suggestion != strings.ToLower(suggestion):
+		return suggestion
+	case utf8.RuneCountInString(word) > 1 && word == strings.ToUpper(word):
+		return strings.ToUpper(suggestion)
+	case unicode.IsUpper(first):
+		r, size := utf8.DecodeRuneInString(suggestion)
+		return string(unicode.ToUpper(r)) + suggestion[size:]
+	}
+	return suggestion
+}
+
+// editDistance returns how many letters must be inserted, deleted, changed or swapped with the
+// next to turn a into b, giving up with limit+1 once it's sure to be more than limit.
+func editDistance(a, b []rune, limit int) int {
+	// Three rows of the distance table are kept, for swaps which look two rows back.
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := prev[j-1] + cost
+			if prev[j]+1 < d {
+				d = prev[j] + 1
+			}
+			if cur[j-1]+1 < d {
+				d = cur[j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && prev2[j-2]+1 < d {
+				d = prev2[j-2] + 1
+			}
+			cur[j] = d
+			if d < best {
+				best = d
+			}
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,114 @@
+package editor
+
+// maxDiffEdits limits how hard diffLines works. Beyond it, whatever differs between the first and
+// last common lines is taken as one change.
+const maxDiffEdits = 2000
+
+// hunk is a run of lines changed between two versions of a file, with 0-indexed starts.
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+}
+
+// diffLines returns the hunks changing a into b, found with Myers' algorithm.
+func diffLines(a, b []string) []hunk {
+	// Lines shared at the start and end are common to any diff, and usually most of the file.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	deleted, inserted := make([]bool, len(a)), make([]bool, len(b))
+	if !shortestEdit(a, b, deleted, inserted) {
+		for i := range deleted {
+			deleted[i] = true
+		}
+		for i := range inserted {
+			inserted[i] = true
+		}
+	}
+
+	var hunks []hunk
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		if i < len(a) && j < len(b) && !deleted[i] && !inserted[j] {
+			i, j = i+1, j+1
+			continue
+		}
+		h := hunk{oldStart: prefix + i, newStart: prefix + j}
+		for i < len(a) && deleted[i] || j < len(b) && inserted[j] {
+			for i < len(a) && deleted[i] {
+				i++
+			}
+			for j < len(b) && inserted[j] {
+				j++
+			}
+		}
+		h.oldLines, h.newLines = prefix+i-h.oldStart, prefix+j-h.newStart
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// shortestEdit marks the lines of a deleted and of b inserted by the fewest edits turning a into
+// b. It returns false if that takes more than maxDiffEdits.
+func shortestEdit(a, b []string, deleted, inserted []bool) bool {
+	// furthest[d][k+d] is how far along a the path with d edits on diagonal k = x-y gets.
+	var furthest [][]int
+	for d := 0; d <= len(a)+len(b); d++ {
+		if d > maxDiffEdits {
+			return false
+		}
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+			case k == -d || k != d && furthest[d-1][k-1+d-1] < furthest[d-1][k+1+d-1]:
+				x = furthest[d-1][k+1+d-1] // Down, inserting a line of b
+			default:
+				x = furthest[d-1][k-1+d-1] + 1 // Right, deleting a line of a
+			}
+			y := x - k
+			for x < len(a) && y < len(b) && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k+d] = x
+			if x >= len(a) && y >= len(b) {
+				furthest = append(furthest, v)
+				markEdits(furthest, len(a), len(b), deleted, inserted)
+				return true
+			}
+		}
+		furthest = append(furthest, v)
+	}
+	return true
+}
+
+// markEdits follows the path found by shortestEdit back from its end.
+func markEdits(furthest [][]int, x, y int, deleted, inserted []bool) {
+	for d := len(furthest) - 1; d > 0; d-- {
+		prev := furthest[d-1]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+		// The edit is followed by lines in common, which are skipped.
+		if prevK == k+1 {
+			inserted[prevY] = true
+		} else {
+			deleted[prevX] = true
+		}
+		x, y = prevX, prevY
+	}
+}
@@ -0,0 +1,61 @@
+package editor
+
+import "fmt"
+
+// diffContext is how many unchanged lines are left open around each change in diff mode.
+const diffContext = 6
+
+// startDiffMode is zi -d, comparing the files named old and new side by side with old in the
+// :Gdiff panel and new being edited. Unchanged lines away from the changes are folded.
+func (ts *TermState) startDiffMode(old, new string) error {
+	if err := ts.openFile(old); err != nil {
+		return err
+	}
+	from := ts.buf
+	if err := ts.openFile(new); err != nil {
+		return err
+	}
+	if ts.buf == from {
+		return fmt.Errorf("cannot diff %s with itself", old)
+	}
+	ts.gdiff = &diffView{buf: ts.buf, from: from, title: from.Name(), changes: -1, fromChanges: -1}
+	folds, err := ts.diffFolds()
+	if err != nil {
+		return err
+	}
+	for i := range folds {
+		folds[i].closed = true
+	}
+	ts.folds[ts.buf] = &foldState{folds: folds, changes: ts.buf.Changes(), find: ts.diffFolds}
+	return nil
+}
+
+// diffFolds returns a fold over each run of lines in the current buffer which are the same beside
+// :Gdiff, apart from diffContext lines next to a change.
+func (ts *TermState) diffFolds() ([]fold, error) {
+	dv := ts.diffView()
+	if dv == nil {
+		return nil, fmt.Errorf("not in diff mode")
+	}
+	var folds []fold
+	add := func(first, last int) {
+		if last > first {
+			folds = append(folds, fold{first: first, last: last})
+		}
+	}
+	unchanged := 0 // First row after the last change
+	for _, h := range dv.hunks {
+		first := unchanged
+		if first > 0 {
+			first += diffContext
+		}
+		add(first, h.newStart-1-diffContext)
+		unchanged = h.newStart + h.newLines
+	}
+	first := unchanged
+	if first > 0 {
+		first += diffContext
+	}
+	add(first, ts.buf.Len()-1)
+	return folds, nil
+}
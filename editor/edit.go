@@ -0,0 +1,152 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// insertByte inserts b at the cursor and advances past it.
+func (ts *TermState) insertByte(b byte) {
+	if ts.buf.Len() == 0 {
+		ts.buf.InsertLines(0, "")
+	}
+	row := ts.buf.Line(ts.cursorY)
+	ts.buf.SetLine(ts.cursorY, row[:ts.cursorX]+string(b)+row[ts.cursorX:])
+	ts.cursorX++
+}
+
+// insertText inserts text at the cursor and advances past it.
+func (ts *TermState) insertText(text string) {
+	if ts.buf.Len() == 0 {
+		ts.buf.InsertLines(0, "")
+	}
+	row := ts.buf.Line(ts.cursorY)
+	ts.buf.SetLine(ts.cursorY, row[:ts.cursorX]+text+row[ts.cursorX:])
+	ts.cursorX += len(text)
+}
+
+// codeEntry is how a character can be given by its code after Ctrl-V.
+type codeEntry struct {
+	base, digits int
+	max          rune
+}
+
+// codeEntries are the forms of code after Ctrl-V, by the key starting them. Decimal codes start
+// with their first digit.
+var codeEntries = map[byte]codeEntry{
+	'u': {16, 4, utf8.MaxRune},
+	'U': {16, 8, utf8.MaxRune},
+	'x': {16, 2, 0xff},
+	'X': {16, 2, 0xff},
+	'o': {8, 3, 0377},
+	'O': {8, 3, 0377},
+}
+
+// insertLiteral is Ctrl-V in insert mode, inserting the next key as it is, even a control
+// character, or the character with the code typed after it: u and four hex digits or U and eight
+// for any Unicode character, or up to 255 with x and two hex digits, o and three octal digits,
+// or three decimal digits. Fewer digits can be given, ended by any other key, which is then
+// handled as usual.
+func (ts *TermState) insertLiteral() error {
+	b := ts.readKey()
+	entry, ok := codeEntries[b]
+	digits := ""
+	if b >= '0' && b <= '9' {
+		entry, ok, digits = codeEntry{10, 3, 255}, true, string(b)
+	}
+	if !ok {
+		// A line can't hold a line break, so Ctrl-J is inserted as NUL, as Vim does.
+		if b == '\n' {
+			b = 0
+		}
+		ts.insertText(string([]byte{b}))
+		return nil
+	}
+
+	var next byte
+	for len(digits) < entry.digits {
+		next = ts.readKey()
+		if _, err := strconv.ParseUint(string(next), entry.base, 8); err != nil {
+			break
+		}
+		digits += string(next)
+		next = 0
+	}
+	if digits == "" {
+		ts.insertText(string([]byte{b}))
+	} else {
+		code, err := strconv.ParseUint(digits, entry.base, 32)
+		r := rune(code)
+		if err != nil || r > entry.max || (entry.max == utf8.MaxRune && !utf8.ValidRune(r)) {
+			return fmt.Errorf("invalid character code: %s", digits)
+		}
+		if ts.buf.Binary && r <= 0xff {
+			// Binary files are edited byte for byte.
+			ts.insertText(string([]byte{byte(r)}))
+		} else {
+			ts.insertText(string(r))
+		}
+	}
+	if next != 0 {
+		processInsertModePress(ts, next)
+	}
+	return nil
+}
+
+// replaceByte overwrites the byte under the cursor, or appends at the end of the row.
+func (ts *TermState) replaceByte(b byte) {
+	if ts.buf.Len() == 0 {
+		ts.buf.InsertLines(0, "")
+	}
+	row := ts.buf.Line(ts.cursorY)
+	if ts.cursorX >= len(row) {
+		ts.insertByte(b)
+		return
+	}
+	ts.buf.SetLine(ts.cursorY, row[:ts.cursorX]+string(b)+row[ts.cursorX+1:])
+	ts.cursorX++
+}
+
+// insertNewline splits the current row at the cursor, moving the cursor to the start of the new row.
+func (ts *TermState) insertNewline() {
+	if ts.buf.Len() == 0 {
+		ts.buf.InsertLines(0, "")
+	}
+	row := ts.buf.Line(ts.cursorY)
+
+	ts.buf.SetLine(ts.cursorY, row[:ts.cursorX])
+	ts.buf.InsertLines(ts.cursorY+1, row[ts.cursorX:])
+
+	ts.cursorY++
+	ts.cursorX = 0
+}
+
+// deleteBackward removes the byte before the cursor, joining with the previous row when the
+// cursor is at the start of a row.
+func (ts *TermState) deleteBackward() {
+	if ts.buf.Len() == 0 || (ts.cursorX == 0 && ts.cursorY == 0) {
+		return
+	}
+	row := ts.buf.Line(ts.cursorY)
+
+	if ts.cursorX > 0 {
+		ts.buf.SetLine(ts.cursorY, row[:ts.cursorX-1]+row[ts.cursorX:])
+		ts.cursorX--
+	} else {
+		prev := ts.buf.Line(ts.cursorY - 1)
+		ts.buf.SetLine(ts.cursorY-1, prev+row)
+		ts.buf.DeleteLines(ts.cursorY, ts.cursorY+1)
+		ts.cursorY--
+		ts.cursorX = len(prev)
+	}
+}
+
+// setLines replaces a range of lines, as given to buffer.LineRange, with lines.
+func (ts *TermState) setLines(start, end int, lines []string) error {
+	if err := ts.buf.SetLines(start, end, lines); err != nil {
+		return err
+	}
+	ts.setCursor(ts.cursorY, ts.cursorX)
+	return nil
+}
@@ -0,0 +1,1405 @@
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+	"github.com/keyan/zi/terminal"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const ziVersion = "0.0.1"
+
+// Size of the screen used with --dump-screen, fixed so dumps don't depend on the terminal.
+const (
+	dumpScreenRows = 24
+	dumpScreenCols = 80
+)
+
+// capsTimeout is how long to wait for the terminal to answer capability queries. Terminals that
+// don't answer, or a slow remote connection, leave only the features known from the environment.
+const capsTimeout = time.Second
+
+type editorMode int
+
+const (
+	_ editorMode = iota
+	normalMode
+	insertMode
+	commandMode
+	replaceMode
+)
+
+// TermState is a god-object containing the global editor state.
+type TermState struct {
+	tty          *os.File        // The terminal, usually Stdin unless a buffer was piped in
+	oldTerm      *terminal.State // The terminal settings at application startup, zi reverts back to this on exit
+	winSize      *terminal.Size  // The terminal window size, updated when it's resized
+	mode         editorMode      // Current editor modality (i.e. Normal/Insert/Command)
+	r            *bufio.Reader   // Reader from tty to get user input
+	keys         chan byte       // Keys read from r by readKeys
+	w            *bufio.Writer   // Writer to Stdout to modify view
+	logger       *log.Logger
+	welcomed     bool           // true if intro msg has already been displayed, or should not be displayed
+	cursorX      int            // Current 0 index cursor position, as a byte offset into the row
+	cursorY      int            // Current 0 index cursor position, as a row of the current buffer
+	buf          *buffer.Buffer // The buffer being displayed and edited
+	buffers      []*buffer.Buffer
+	oldFiles     []string          // Recently opened files, most recent first
+	fileMarks    map[byte]fileMark // Uppercase marks, which remember their file
+	statePath    string            // Where oldFiles and fileMarks persist between sessions
+	picker       *picker           // Non-nil while a picker is open
+	events       chan func()       // Functions from other goroutines, run by the main loop
+	jobs         map[int]*job      // Running background processes, by id
+	lastJobID    int
+	timers       map[int]*timer // Pending timers, by id
+	lastTimerID  int
+	autocmds     []autocmd
+	autocmdDepth int                  // How many autocommands are currently running, one inside another
+	keymaps      map[byte]func()      // Normal mode keys mapped by plugins
+	userCommands map[string]exCommand // Commands defined by plugins
+	plugins      []*plugin
+	lua          *lua.LState // Created when first needed, see luaState
+	wasmPlugins  []*wasmPlugin
+	listener     net.Listener                     // Accepting --remote requests, if started with --listen
+	waiters      map[*buffer.Buffer][]net.Conn    // zi --remote-wait clients to tell when each buffer is closed
+	swaps        map[*buffer.Buffer]*swapFile     // Swap files of open buffers
+	folds        map[*buffer.Buffer]*foldState    // Folds of buffers folding has been used in
+	spell        map[*buffer.Buffer]*spellState   // Misspelled words of buffers, while spell is on
+	rainbow      map[*buffer.Buffer]*rainbowState // Colored brackets of buffers, while rainbow is on
+	git          map[*buffer.Buffer]*gitState     // How buffers differ from the git index, see gitHunks
+	merge        map[*buffer.Buffer]*mergeState   // Merge conflicts in buffers, see conflicts
+	changeLists  map[*buffer.Buffer]*changeList   // Where buffers were last edited, see recordChange
+	registers    map[byte]register                // Text yanked and deleted, see setRegister
+	dict         *dictionary                      // Loaded for spell checking, see misspellings
+	parens       []buffer.Position                // Brackets highlighted in this frame, see matchParen
+	swapKeys     int                              // Keys typed since swap files were last written
+	keepSwaps    bool                             // Leave swap files on exit, for recovery
+	quickfix     quickfixList
+	loclist      quickfixList     // The location list of the editor window
+	build        *backgroundBuild // Running :GoBuild or :GoTest, if any
+	dap          *dapSession      // Running debug session, if any
+	dapOutput    []string         // Output from the last debug session
+	breakpoints  map[string][]int // Sorted 1-indexed breakpoint lines, by absolute filename
+	qfWin        quickfixWindow
+	opts         options
+	rowOffset    int // The current row position of the editor window
+	lineNumWidth int
+	signWidth    int            // Width of the sign column, 0 when there are no signs to show
+	argList      []string       // Filenames given on the command line, the first is opened at startup
+	argIndex     int            // The file of argList being edited, see :next
+	altBuf       *buffer.Buffer // The buffer edited before the current one, # in file names
+	wild         *wildState     // Completions of the command line, see completeFileArg
+	tagStack     []fileMark     // Where tags were jumped to from, the latest last
+	jumps        []jump         // Positions jumped from, the latest last, see pushJump
+	jumpIndex    int            // The entry of jumps Ctrl-O and Ctrl-I move from, len(jumps) if none
+	readonly     bool           // Files are opened readonly and nomodifiable with -R
+	view         bool           // Files are opened read-only with --view, see buffer.OpenMapped
+	binary       bool           // Files are opened byte for byte with -b, see buffer.OpenBinary
+	encrypt      bool           // Files are encrypted with -x, see promptNewKey
+	headless     bool           // Running a script with -es, there is no terminal
+	screen       *render.Screen // Drawn to instead of the terminal with --dump-screen
+	lastSub      *substitution  // The last :s, repeated by :s without a pattern and by &
+	lastExpr     string         // The last expression entered for "=
+	pendingReg   byte           // Register for the next key, after "=expr, or 0
+	recording    byte           // Register keys are being recorded into with q, or 0
+	recorded     []byte         // Keys typed since recording started
+	secretKeys   bool           // Some were typed in an encrypted buffer
+	macroKeys    []byte         // Keys of macros being played, still to be pressed
+	macroDepth   int            // How many macros are playing, one inside another
+	lastMacro    byte           // Register last played with @, for @@
+	gdiff        *diffView      // Opened by :Gdiff
+	commitMsg    *commitState   // Highlighting of the last commit message drawn
+	zen          *zenState      // Set in the distraction-free view of :Zen
+	grid         *render.Grid   // What's on the terminal, nil to redraw everything
+	caps         terminal.Caps  // Optional features the terminal supports
+	title        string         // Title last set on the terminal, "" if it's still the original
+	cursorShape  render.CursorShape
+	explorer     explorer
+	commandBuf   string // Text typed so far in command mode, without the leading ':'
+	promptLabel  string // Shown instead of ':' when command mode is prompting for input
+	promptFn     func(input string) error
+	promptSecret bool     // Input to the prompt is shown as '*', for passphrases
+	statusMsg    string   // One-line message shown in the status bar until the next keypress
+	msgLines     []string // Multi-line command output, shown over the buffer until dismissed
+	msgOffset    int      // Index of the first msgLines entry on screen, when output spans pages
+	logPath      string
+	configPath   string
+	configLoaded bool
+	configErrors []error
+}
+
+// readKeys sends every key read from ts.r to ts.keys, so the main loop can wait for keys and
+// other events together. Reads block until a key is pressed, and it returns once ts.r has ended,
+// such as at the end of a --dump-screen script.
+func (ts *TermState) readKeys() {
+	for {
+		b, err := ts.r.ReadByte()
+		if err != nil {
+			ts.logger.Printf("reading keys: %v", err)
+			return
+		}
+		if b == render.EscapeChar && ts.readFocusReport() {
+			continue
+		}
+		ts.keys <- b
+	}
+}
+
+// readKey waits for the next key, for commands such as m which read a second key. Events are
+// still run while waiting.
+func (ts *TermState) readKey() byte {
+	if len(ts.macroKeys) > 0 {
+		b := ts.macroKeys[0]
+		ts.macroKeys = ts.macroKeys[1:]
+		return b
+	}
+	for {
+		select {
+		case b := <-ts.keys:
+			ts.recordKey(b)
+			return b
+		case fn := <-ts.events:
+			fn()
+		}
+	}
+}
+
+// detectCaps asks the terminal which optional features it supports, waiting briefly for its
+// replies, and returns any keys typed in the meantime.
+func (ts *TermState) detectCaps() []byte {
+	ts.caps = terminal.Caps{}
+	if ts.tty == nil {
+		return nil
+	}
+	terminal.WriteCapsQuery(ts.w)
+	ts.w.Flush()
+
+	var data, rest []byte
+	timeout := time.After(capsTimeout)
+	for {
+		select {
+		case b := <-ts.keys:
+			data = append(data, b)
+			var done bool
+			if rest, done = terminal.ParseCapsReplies(data, &ts.caps); done {
+				return rest
+			}
+		case <-timeout:
+			// A reply cut short isn't keys, so only what was typed is kept.
+			ts.logger.Printf("no reply to terminal capability queries")
+			return rest
+		}
+	}
+}
+
+// run is the main loop. It waits for a key, an event from another goroutine, the window being
+// resized or a signal to exit, then handles everything else already waiting before redrawing the
+// screen. Nothing is redrawn while the editor is idle.
+func (ts *TermState) run() {
+	var resized <-chan struct{}
+	if ts.tty != nil {
+		resized = terminal.WatchResize(int(ts.tty.Fd()))
+	}
+	terminated := make(chan os.Signal, 1)
+	signal.Notify(terminated, syscall.SIGTERM, syscall.SIGHUP)
+	watchTicker := time.NewTicker(watchInterval)
+	defer watchTicker.Stop()
+	for {
+		var watch <-chan time.Time
+		if ts.opts.watchfiles {
+			watch = watchTicker.C
+		}
+		ts.refreshScreen()
+		select {
+		case b := <-ts.keys:
+			ts.processKeyPress(b)
+		case fn := <-ts.events:
+			fn()
+		case <-resized:
+			ts.updateWinSize()
+		case sig := <-terminated:
+			ts.terminate(sig)
+		case <-ts.swapIdle():
+			ts.syncSwaps()
+		case <-ts.autosaveIdle():
+			ts.autosave()
+		case <-watch:
+			ts.checkFiles()
+		}
+		ts.handlePending()
+		if ts.swapKeys >= swapKeys {
+			ts.syncSwaps()
+		}
+	}
+}
+
+// handlePending handles keys and events which are already waiting, such as a paste or a burst
+// of job output, so they're drawn together.
+func (ts *TermState) handlePending() {
+	for {
+		select {
+		case b := <-ts.keys:
+			ts.processKeyPress(b)
+		case fn := <-ts.events:
+			fn()
+		default:
+			return
+		}
+	}
+}
+
+// updateWinSize reads the size of the terminal again after it has been resized.
+func (ts *TermState) updateWinSize() {
+	if ts.tty == nil {
+		return
+	}
+	ws, err := terminal.GetSize(int(ts.tty.Fd()))
+	if err != nil || ws.Row == 0 || ws.Col == 0 {
+		return
+	}
+	ws.Row--
+	ws.Col--
+	ts.winSize = ws
+	// The terminal may have reflowed what was on screen.
+	ts.grid = nil
+}
+
+func processNormalModePress(ts *TermState, b byte) {
+	// A register given as "=expr only lasts for the next key.
+	defer func() { ts.pendingReg = 0 }()
+	if fn, ok := ts.keymaps[b]; ok {
+		fn()
+		return
+	}
+
+	switch b {
+	case input.Ctrl('q'):
+		render.ClearScreen(ts.w)
+		ts.w.Flush()
+		ts.exit(nil)
+	case input.Ctrl('z'):
+		ts.suspend()
+	case 'i':
+		if err := ts.buf.CheckEditable(); err != nil {
+			ts.statusMsg = err.Error()
+			return
+		}
+		ts.mode = insertMode
+	case 'R':
+		if err := ts.buf.CheckEditable(); err != nil {
+			ts.statusMsg = err.Error()
+			return
+		}
+		ts.mode = replaceMode
+	case '\r':
+		if ts.buf.BrowseDir != "" {
+			ts.browseOpen()
+		}
+	case '-':
+		if ts.buf.BrowseDir != "" {
+			ts.browseUp()
+		}
+	case ':':
+		ts.mode = commandMode
+		ts.commandBuf = ""
+	case input.Ctrl('n'):
+		ts.toggleExplorer()
+	case input.Ctrl('p'):
+		if err := cmdPick(ts, exArgs{}); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case '"':
+		reg := ts.readKey()
+		if reg == '=' {
+			// The expression is asked for first, and the key after it uses its value.
+			ts.promptExpression(func() error {
+				ts.pendingReg = '='
+				return nil
+			})
+			return
+		}
+		if err := ts.registerCommand(reg, ts.readKey()); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 'y', 'Y', 'p', 'P':
+		reg := byte('"')
+		if ts.pendingReg != 0 {
+			reg = ts.pendingReg
+		}
+		if err := ts.registerCommand(reg, b); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 'u', input.Ctrl('r'):
+		if err := ts.undo(b == input.Ctrl('r')); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('g'):
+		ts.statusMsg = ts.fileInfo()
+	case 'g':
+		switch key := ts.readKey(); key {
+		case input.Ctrl('g'):
+			ts.statusMsg = ts.wordCount()
+		case 'a':
+			ts.statusMsg = ts.charInfo()
+		case 'x':
+			if err := ts.openUnderCursor(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case 'f':
+			if err := ts.gotoFile(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case 'q':
+			if err := ts.formatCommand(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case 'i':
+			if err := ts.resumeInsert(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case '&':
+			// Repeats the last :s with its flags on every line, as :%&&.
+			if err := cmdRepeatSubstitute(ts, exArgs{arg: "&", line1: 0, line2: ts.buf.Len() - 1}); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case ';', ',':
+			count := 1
+			if key == ';' {
+				count = -1
+			}
+			if err := ts.moveInChangelist(count); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		}
+	case 'z':
+		switch key := ts.readKey(); key {
+		case 'o', 'c', 'a', 'R', 'M':
+			if err := ts.foldCommand(key); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case '=':
+			if err := ts.suggestSpelling(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case 'g', 'w':
+			if err := ts.addSpellWord(key == 'w'); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		}
+	case ']', '[':
+		var err error
+		switch ts.readKey() {
+		case 's':
+			err = ts.nextMisspelling(b == ']')
+		case 'c':
+			err = ts.nextHunk(b == ']')
+		case 'x':
+			err = ts.nextConflict(b == ']')
+		case 'e':
+			err = ts.bubbleLine(b == ']')
+		}
+		if err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case '&':
+		if err := cmdRepeatSubstitute(ts, exArgs{line1: ts.cursorY, line2: ts.cursorY}); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 'q':
+		if ts.recording != 0 {
+			ts.stopRecording()
+		} else if err := ts.startRecording(ts.readKey()); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case '@':
+		if err := ts.playMacro(ts.readKey()); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('k'):
+		if err := ts.duplicateLine(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 'K':
+		if err := ts.keywordLookup(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case 'm':
+		if err := ts.setMark(ts.readKey()); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case '\'', '`':
+		if err := ts.jumpToMark(ts.readKey(), b == '`'); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('o'), input.Ctrl('i'):
+		count := 1
+		if b == input.Ctrl('o') {
+			count = -1
+		}
+		if err := ts.moveInJumplist(count); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl(']'):
+		if err := ts.followTag(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('t'):
+		if err := ts.popTag(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('w'):
+		// Window commands, only switching focus to the explorer or quickfix window is supported.
+		switch ts.readKey() {
+		case 'f', input.Ctrl('f'):
+			if err := ts.gotoFile(); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		case 'w', 'h', input.Ctrl('w'), input.Ctrl('h'):
+			if ts.explorer.visible {
+				ts.explorer.focused = true
+			}
+		case 'j', input.Ctrl('j'):
+			if ts.qfWin.list != nil {
+				ts.qfWin.focused = true
+			}
+		}
+	case 'h', 'j', 'k', 'l':
+		moveCursor(ts, b)
+	case input.Ctrl('f'), input.Ctrl('b'):
+		ts.scrollPage(b == input.Ctrl('f'))
+	}
+}
+
+// scrollPage moves a screen forward or back, keeping two lines of the last screen in view.
+func (ts *TermState) scrollPage(forward bool) {
+	page := ts.textRows() - 2
+	if page < 1 {
+		page = 1
+	}
+	if !forward {
+		page = -page
+	}
+	last := ts.buf.Len() - 1
+	if last < 0 {
+		return
+	}
+	clampRow := func(row int) int {
+		if row < 0 {
+			return 0
+		}
+		if row > last {
+			return last
+		}
+		return row
+	}
+	ts.rowOffset = clampRow(ts.rowOffset + page)
+	ts.cursorY = clampRow(ts.cursorY + page)
+	if ts.cursorY < ts.rowOffset {
+		ts.cursorY = ts.rowOffset
+	}
+	ts.clampCursorX()
+}
+
+// moveCursor adjusts the cursor position based on the command issued.
+// Vim-style hjkl movement are the only supported commands.
+func moveCursor(ts *TermState, b byte) {
+	switch b {
+	case 'h':
+		if ts.cursorX > 0 {
+			ts.cursorX--
+		}
+	case 'j':
+		// Closed folds are stepped over as one row.
+		if next := ts.nextRow(ts.cursorY); next < ts.buf.Len() {
+			ts.cursorY = next
+		}
+	case 'k':
+		if ts.cursorY > 0 {
+			ts.cursorY = ts.visibleRow(ts.cursorY - 1)
+		}
+	case 'l':
+		if ts.cursorY < ts.buf.Len() && ts.cursorX < len(ts.buf.Line(ts.cursorY))-1 {
+			ts.cursorX++
+		}
+	}
+	ts.clampCursorX()
+}
+
+// clampCursorX keeps the cursor within the current row, which may have changed length.
+func (ts *TermState) clampCursorX() {
+	rowLen := 0
+	if ts.cursorY < ts.buf.Len() {
+		rowLen = len(ts.buf.Line(ts.cursorY))
+	}
+	// Outside of insert mode the cursor sits on a char, not after the last one.
+	if ts.mode != insertMode && ts.mode != replaceMode && rowLen > 0 {
+		rowLen--
+	}
+	if ts.cursorX > rowLen {
+		ts.cursorX = rowLen
+	}
+}
+
+// stopInsert returns to normal mode from insert or replace mode, remembering where as the ^ mark
+// for gi.
+func (ts *TermState) stopInsert() {
+	ts.buf.Marks['^'] = buffer.Position{Row: ts.cursorY, Col: ts.cursorX}
+	ts.mode = normalMode
+	if ts.cursorX > 0 {
+		ts.cursorX--
+	}
+	ts.checkCommitSubject()
+}
+
+func processInsertModePress(ts *TermState, b byte) {
+	switch b {
+	case render.EscapeChar:
+		ts.stopInsert()
+	case '\r':
+		ts.insertNewline()
+	case 127, input.Ctrl('h'):
+		ts.deleteBackward()
+	case input.Ctrl('v'):
+		if err := ts.insertLiteral(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('r'):
+		// Ctrl-R = asks for an expression and inserts its value.
+		name := ts.readKey()
+		if name == '=' {
+			ts.promptExpression(func() error {
+				ts.mode = insertMode
+				return ts.insertRegister('=')
+			})
+		} else if err := ts.insertRegister(name); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('x'):
+		// Only dictionary and thesaurus completion are supported.
+		var err error
+		switch ts.readKey() {
+		case input.Ctrl('k'):
+			err = ts.completeDictionary()
+		case input.Ctrl('t'):
+			err = ts.completeThesaurus()
+		}
+		if err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case '\t':
+		ts.insertTab()
+	default:
+		if b >= ' ' {
+			ts.insertByte(b)
+		}
+	}
+}
+
+// processReplaceModePress handles keys after R, where typing overwrites characters instead of
+// inserting them.
+func processReplaceModePress(ts *TermState, b byte) {
+	switch b {
+	case render.EscapeChar:
+		ts.stopInsert()
+	case '\r':
+		ts.insertNewline()
+	case 127, input.Ctrl('h'):
+		if ts.cursorX > 0 {
+			ts.cursorX--
+		}
+	default:
+		if b >= ' ' || b == '\t' {
+			ts.replaceByte(b)
+		}
+	}
+}
+
+// processKeyPress acts on a single keypress, according to the current mode.
+func (ts *TermState) processKeyPress(b byte) {
+	// Debugging code
+	// if unicode.IsControl(rune(b)) {
+	// 	fmt.Printf("%d\r\n", b)
+	// } else {
+	// 	fmt.Printf("%v (%c)\r\n", b, b)
+	// }
+
+	ts.swapKeys++
+	ts.recordKey(b)
+	defer ts.recordChange(ts.buf, ts.buf.Changes())
+	// Any key pages through, then dismisses, command output without being processed further.
+	if len(ts.msgLines) > 0 {
+		ts.msgOffset += int(ts.winSize.Row)
+		if ts.msgOffset >= len(ts.msgLines) {
+			ts.msgLines, ts.msgOffset = nil, 0
+		}
+		return
+	}
+	ts.statusMsg = ""
+
+	if ts.picker != nil {
+		processPickerPress(ts, b)
+		return
+	}
+
+	switch ts.mode {
+	case normalMode:
+		if ts.explorer.focused {
+			processExplorerPress(ts, b)
+			return
+		}
+		if ts.qfWin.focused {
+			processQuickfixPress(ts, b)
+			return
+		}
+		processNormalModePress(ts, b)
+	case insertMode:
+		processInsertModePress(ts, b)
+	case replaceMode:
+		processReplaceModePress(ts, b)
+	case commandMode:
+		processCommandModePress(ts, b)
+	}
+	if ts.mode == normalMode {
+		ts.endUndoStep()
+	}
+}
+
+// adjustScroll modifies the rowOffset and cursor positioning to handle window size and location
+// within the bufferRows.
+func (ts *TermState) adjustScroll() {
+	ts.scrollToFolds()
+	if ts.cursorY < ts.rowOffset {
+		ts.rowOffset = ts.cursorY
+	}
+	part, _ := ts.cursorPos()
+	if ts.screenRows(ts.rowOffset, ts.cursorY, ts.textRows())+part >= ts.textRows() {
+		// Count back a screen of rows from the cursor, as shown with any closed folds and wrapping.
+		ts.rowOffset = ts.cursorY
+		used := ts.rowHeight(ts.cursorY)
+		for ts.rowOffset > 0 {
+			prev := ts.visibleRow(ts.rowOffset - 1)
+			if used+ts.rowHeight(prev) > ts.textRows() {
+				break
+			}
+			used += ts.rowHeight(prev)
+			ts.rowOffset = prev
+		}
+	}
+}
+
+// textRows is the number of screen rows available for buffer text, those not taken by the status
+// bar or the quickfix window.
+func (ts *TermState) textRows() int {
+	return int(ts.winSize.Row) - ts.quickfixHeight()
+}
+
+// gutterWidth is the width of the sign column and line numbers drawn left of the buffer text, or
+// in zen mode of the margin.
+func (ts *TermState) gutterWidth() int {
+	if ts.zen != nil {
+		return ts.zenMargin()
+	}
+	return ts.signWidth + ts.lineNumWidth + 1
+}
+
+// textArea returns the screen column buffer text starts at, and how many columns it has.
+func (ts *TermState) textArea() (left, width int) {
+	left = ts.explorerWidth() + ts.diffWidth() + ts.gutterWidth()
+	width = int(ts.winSize.Col) + 1 - left - ts.variablesWidth()
+	if ts.zen != nil && width > ts.opts.zenwidth {
+		width = ts.opts.zenwidth
+	}
+	return left, width
+}
+
+// writeWelcomeMsg writes a one-time welcome message to the writer.
+func (ts *TermState) writeWelcomeMsg() {
+	ts.welcomed = true
+
+	var width int
+
+	msg := fmt.Sprintf("zi -- version %v", ziVersion)
+	if len(msg) > int(ts.winSize.Col)+1 {
+		msg = msg[:ts.winSize.Col+1]
+		width = len(msg)
+	} else {
+		width = (int(ts.winSize.Col) + 1 + len(msg)) / 2
+	}
+	fmt.Fprintf(ts.w, "%*s", width, msg)
+}
+
+// outputPrompt is shown in the status bar while command output is on screen, or is "".
+func (ts *TermState) outputPrompt() string {
+	switch {
+	case ts.msgOffset+int(ts.winSize.Row) < len(ts.msgLines):
+		return "-- More --"
+	case len(ts.msgLines) > 0:
+		return "Press any key to continue"
+	}
+	return ""
+}
+
+// writeStatusBar writes the status bar at the bottom of the editor screen.
+func (ts *TermState) writeStatusBar() {
+	var c render.Color
+	var mode string
+	switch ts.mode {
+	case normalMode:
+		c = render.Inverted
+		mode = "NORMAL"
+	case insertMode:
+		c = render.BgBlue
+		mode = "INSERT"
+	case replaceMode:
+		c = render.BgRed
+		mode = "REPLACE"
+	case commandMode:
+		prefix, text := ts.commandPrefix(), ts.commandBuf
+		if ts.promptFn != nil && ts.promptSecret {
+			text = strings.Repeat("*", len(text))
+		}
+		fmt.Fprintf(ts.w, "%s%-*s", prefix, int(ts.winSize.Col)+1-len(prefix), text)
+		return
+	}
+
+	if ts.picker != nil {
+		prompt := ts.picker.prompt()
+		fmt.Fprintf(ts.w, "%s%-*s", prompt, int(ts.winSize.Col)+1-len(prompt), ts.picker.query)
+		return
+	}
+
+	// Zen mode has no status bar, only messages are shown.
+	if ts.zen != nil {
+		msg := ts.statusMsg
+		if p := ts.outputPrompt(); p != "" {
+			msg = p
+		}
+		if len(msg) > int(ts.winSize.Col) {
+			msg = msg[:ts.winSize.Col]
+		}
+		fmt.Fprintf(ts.w, "%-*s", int(ts.winSize.Col)+1, msg)
+		return
+	}
+
+	msg := fmt.Sprintf("%s -- %s", mode, ts.buf.Filename)
+	if ts.buf.Modified {
+		msg += " [+]"
+	}
+	if ts.buf.Encoding != buffer.EncodingUTF8 {
+		msg += " [" + ts.buf.Encoding + "]"
+	}
+	if ts.buf.BOM {
+		msg += " [BOM]"
+	}
+	if ts.buf.Binary {
+		msg += " [bin]"
+	}
+	if ts.buf.NoEOL {
+		msg += " [noeol]"
+	}
+	if ts.buf.Hex {
+		msg += " [hex]"
+	}
+	if ts.buf.Encrypted() {
+		msg += " [crypt]"
+	}
+	if ts.canAutosave(ts.buf) {
+		msg += " [autosave]"
+	}
+	if ts.buf.Filename != "" {
+		msg += " [" + ts.buf.Format + "]"
+	}
+	if ts.buf.LargeFile {
+		msg += " [large]"
+	}
+	if ts.buf.NewFile {
+		msg += " [New File]"
+	}
+	if ts.buf.ReadOnly || !ts.buf.Modifiable {
+		msg += " [RO]"
+	}
+	if p, ok := ts.buf.LoadProgress(); ok {
+		msg += fmt.Sprintf(" [loading %d%%]", p)
+	}
+	if ts.build != nil {
+		msg += " " + ts.build.spinner()
+	}
+	if ts.dap != nil {
+		msg += " " + ts.dap.status()
+	}
+	if ts.recording != 0 {
+		msg += fmt.Sprintf(" [recording @%c]", ts.recording)
+	}
+	if p := ts.outputPrompt(); p != "" {
+		msg = p
+	} else if ts.statusMsg != "" {
+		msg += " -- " + ts.statusMsg
+	}
+	if len(msg) > int(ts.winSize.Col) {
+		msg = msg[:ts.winSize.Col]
+	}
+	fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(c), int(ts.winSize.Col), msg, render.ColorCode(render.Reset))
+}
+
+// drawRows draws every row of the screen, then writes out those that differ from the last frame.
+func (ts *TermState) drawRows() {
+	ts.writeFrame(ts.frameRows())
+}
+
+// frameRows returns the output for each row of the screen, including the status bar.
+func (ts *TermState) frameRows() []string {
+	out := ts.w
+	defer func() { ts.w = out }()
+	// Each row is drawn separately so it can be compared with the last frame.
+	var row bytes.Buffer
+	ts.w = bufio.NewWriter(&row)
+	lines := make([]string, 0, int(ts.winSize.Row)+1)
+	endRow := func() {
+		ts.w.Flush()
+		lines = append(lines, row.String())
+		row.Reset()
+	}
+
+	// Keep track of line numbers and how much space needed to display them.
+	ts.lineNumWidth = len(strconv.Itoa(ts.buf.Len()))
+	// The sign column is shown while debugging and for files in git, so it doesn't jump in and
+	// out as the program runs or the file is edited.
+	signs := ts.lineSigns()
+	_, tracked := ts.gitHunks()
+	ts.signWidth = 0
+	if len(signs) > 0 || ts.dap != nil || tracked {
+		ts.signWidth = 2
+	}
+
+	// Command output and pickers are drawn over the bottom rows of the buffer, a page at a time.
+	msgs, selected := ts.msgLines[ts.msgOffset:], -1
+	if ts.picker != nil {
+		msgs, selected = ts.picker.lines(int(ts.winSize.Row))
+	}
+	msgStart := int(ts.winSize.Row) - len(msgs)
+	if msgStart < 0 {
+		msgStart = 0
+	}
+
+	_, allowColChars := ts.textArea()
+	ts.parens = ts.matchParen()
+	// Each screen row shows a row of the buffer, or with wrap on, part of one.
+	fileRow, part := ts.rowOffset, 0
+	for i := 0; i < int(ts.winSize.Row); i++ {
+		if ts.explorer.visible && (len(msgs) == 0 || i < msgStart) && i < ts.textRows() {
+			ts.drawExplorerRow(i)
+		}
+		if ts.diffView() != nil && (len(msgs) == 0 || i < msgStart) && i < ts.textRows() {
+			ts.drawDiffRow(i, fileRow, part)
+		}
+
+		switch {
+		case len(msgs) > 0 && i >= msgStart:
+			line := msgs[i-msgStart]
+			if len(line) > int(ts.winSize.Col)+1 {
+				line = line[:ts.winSize.Col+1]
+			}
+			if i-msgStart == selected {
+				fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(render.Inverted), int(ts.winSize.Col)+1, line,
+					render.ColorCode(render.Reset))
+			} else {
+				ts.w.WriteString(line)
+			}
+		case i >= ts.textRows():
+			ts.drawQuickfixRow(i - ts.textRows())
+		// Are we drawing text from the edit buffer?
+		case fileRow >= ts.buf.Len():
+			if ts.zen == nil {
+				ts.w.WriteByte('~')
+			}
+			if !ts.welcomed && i == (int(ts.winSize.Row)/3) {
+				ts.writeWelcomeMsg()
+			}
+		default:
+			textPart, _ := ts.diffPart(fileRow, part)
+			switch {
+			// Zen mode has a blank margin, and rows wrapped onto more than one screen row are
+			// numbered on the first.
+			case ts.zen != nil || textPart != 0:
+				fmt.Fprintf(ts.w, "%*s", ts.gutterWidth(), "")
+			default:
+				if ts.signWidth > 0 {
+					s, ok := signs[fileRow]
+					if !ok {
+						s = sign{"  ", render.Reset}
+					}
+					fmt.Fprintf(ts.w, "%s%s%s", render.ColorCode(s.c), s.text, render.ColorCode(render.Reset))
+				}
+				fmt.Fprintf(ts.w, "%s%*d%s ", render.ColorCode(render.Faint), ts.lineNumWidth,
+					fileRow+1, render.ColorCode(render.Reset))
+			}
+
+			if f, ok := ts.closedFold(fileRow); ok {
+				ts.writeFoldRow(f, allowColChars)
+				break
+			}
+			if textPart < 0 {
+				ts.writeDiffFiller(allowColChars)
+				break
+			}
+			line := ts.buf.Line(fileRow)
+			start, cols := ts.wrapPart(line, textPart, allowColChars)
+			ts.writeText(line, start, cols, ts.rowSpans(fileRow))
+		}
+
+		if ts.variablesWidth() > 0 && (len(msgs) == 0 || i < msgStart) && i < ts.textRows() {
+			ts.drawVariablesRow(i)
+		}
+		endRow()
+		fileRow, part = ts.nextScreenRow(fileRow, part)
+	}
+
+	ts.writeStatusBar()
+	endRow()
+	return lines
+}
+
+// writeFrame draws lines to the grid and writes out the cells which changed since the last frame,
+// so moving the cursor or typing a character doesn't repaint the whole screen.
+func (ts *TermState) writeFrame(lines []string) {
+	rows, cols := int(ts.winSize.Row)+1, int(ts.winSize.Col)+1
+	if ts.grid == nil {
+		ts.grid = render.NewGrid(rows, cols)
+	}
+	w := bufio.NewWriter(ts.grid)
+	for i, line := range lines {
+		render.MoveCursor(w, i, 0)
+		w.WriteString(line)
+	}
+	w.Flush()
+	ts.grid.Flush(ts.w)
+}
+
+// refreshScreen redraws the rows that changed with the buffer content/placeholders/welcome message
+// and flushes everything to the terminal.
+func (ts *TermState) refreshScreen() {
+	// Do a single flush to term to improve perf.
+	defer ts.w.Flush()
+
+	ts.adjustScroll()
+
+	if ts.opts.termsync && ts.caps.SyncOutput {
+		render.BeginSync(ts.w)
+		defer render.EndSync(ts.w)
+	}
+	// Hide the cursor during updates to avoid flickering.
+	fmt.Fprintf(ts.w, "%c%c?25l", render.EscapeChar, render.EscapeSeqBegin)
+	// Unhide cursor after redraw.
+	defer fmt.Fprintf(ts.w, "%c%c?25h", render.EscapeChar, render.EscapeSeqBegin)
+
+	ts.drawRows()
+	ts.updateTitle()
+	ts.updateCursorShape()
+
+	// Escape sequence cursor positions are 1-indexed.
+	part, col := ts.cursorPos()
+	left, width := ts.textArea()
+	if col > width {
+		col = width
+	}
+	yPos := ts.screenRows(ts.rowOffset, ts.cursorY, ts.textRows()) + part + 1
+	xPos := left + col + 1
+	if xPos > int(ts.winSize.Col)+1 {
+		xPos = int(ts.winSize.Col) + 1
+	}
+	if ts.explorer.focused {
+		yPos, xPos = ts.explorer.cursor-ts.explorer.offset+1, 1
+	}
+	if ts.qfWin.focused {
+		yPos, xPos = ts.textRows()+2+ts.qfWin.cursor-ts.qfWin.offset, 1
+	}
+	// The command line and picker queries are typed into the status bar.
+	if ts.picker != nil {
+		yPos, xPos = int(ts.winSize.Row)+1, len(ts.picker.prompt())+len(ts.picker.query)+1
+	}
+	if ts.mode == commandMode {
+		yPos, xPos = int(ts.winSize.Row)+1, len(ts.commandPrefix())+len(ts.commandBuf)+1
+	}
+	// Move cursor to state pos.
+	fmt.Fprintf(ts.w, "%c%c%d;%dH", render.EscapeChar, render.EscapeSeqBegin, yPos, xPos)
+}
+
+// openEditor looks for a filename cmdline arg, if one was provided it is opened and its contents
+// are loaded into the TermState.
+func (ts *TermState) openEditor() error {
+	// TODO use TempFile to allow periodic writes when starting from blank file
+	// https://golang.org/pkg/io/ioutil/#TempFile
+
+	if len(ts.argList) == 0 {
+		return nil
+	}
+
+	filename := ts.argList[0]
+	if filename != "-" {
+		return ts.openFile(filename)
+	}
+
+	// Piped input, see terminal.TTY for how keypresses are still read.
+	if terminal.IsTerminal(os.Stdin) {
+		return fmt.Errorf("stdin is a terminal, pipe content into zi to use -")
+	}
+	rows, err := buffer.ReadLines(os.Stdin)
+	if err != nil {
+		return err
+	}
+	ts.loadRows("", rows)
+	return nil
+}
+
+// openFile switches to the buffer for filename, reading it into a new buffer if it isn't already
+// open. Directories and archives are opened as a listing.
+func (ts *TermState) openFile(filename string) error {
+	fi, err := os.Stat(filename)
+	if err == nil && fi.IsDir() {
+		return ts.openDir(filename)
+	}
+	if err == nil && buffer.IsArchive(filename) && !ts.binary {
+		return ts.openArchive(filename)
+	}
+	if b := ts.findBuffer(filename); b != nil {
+		ts.switchBuffer(b)
+		return nil
+	}
+
+	return ts.loadFile(filename, ts.opener())
+}
+
+// opener returns the function files are read with, as chosen by the command line flags.
+func (ts *TermState) opener() func(string) (buffer.Storage, buffer.Layout, error) {
+	switch {
+	case ts.view:
+		return buffer.OpenMapped
+	case ts.binary:
+		return buffer.OpenBinary
+	}
+	return buffer.OpenFile
+}
+
+// loadFile reads filename into a new buffer with open, asking for the key first if it's encrypted.
+func (ts *TermState) loadFile(filename string, open func(string) (buffer.Storage, buffer.Layout, error)) error {
+	text, layout, err := open(filename)
+	if errors.Is(err, buffer.ErrEncrypted) && !ts.headless {
+		ts.promptKey(filename)
+		return nil
+	}
+	// A missing file is created on the first write.
+	newFile := os.IsNotExist(err)
+	if err != nil && !newFile {
+		return err
+	}
+
+	b := ts.addBuffer(filename, make([]string, 0))
+	if !newFile {
+		b.SetStorage(text)
+		b.Layout = layout
+		b.MarkUnmodified()
+	}
+	b.NewFile = newFile
+	if ts.readonly {
+		b.ReadOnly, b.Modifiable = true, false
+	}
+	b.RecordDiskState()
+	ts.checkLargeFile(b)
+	ts.loadInBackground(b)
+	ts.pushJump()
+	ts.displayBuffer(b)
+	if newFile {
+		ts.doAutocmd("BufNewFile", filename)
+	} else {
+		ts.doAutocmd("BufReadPost", filename)
+	}
+	ts.doAutocmd("BufEnter", filename)
+	ts.checkSwap(b)
+	if ts.encrypt && !b.Encrypted() && !ts.headless {
+		ts.promptNewKey(b)
+	}
+	return nil
+}
+
+// loadInBackground adds the lines of a large file to b as they're read, redrawing each time.
+// Without a terminal to show progress on, it waits for the whole file instead.
+func (ts *TermState) loadInBackground(b *buffer.Buffer) {
+	ready := b.Loading()
+	if ready == nil {
+		return
+	}
+	report := func(err error) {
+		if err != nil {
+			ts.statusMsg = fmt.Sprintf("reading %s: %v", b.Filename, err)
+		}
+	}
+	if ts.headless {
+		report(b.FinishLoading())
+		return
+	}
+	go func() {
+		for range ready {
+			ts.events <- func() { report(b.AddLoaded()) }
+		}
+		ts.events <- func() { report(b.FinishLoading()) }
+	}()
+}
+
+// loadRows replaces the current buffer contents, resetting all state tied to the previous file.
+func (ts *TermState) loadRows(filename string, rows []string) {
+	ts.buf.Filename = filename
+	ts.buf.SetText(rows)
+	ts.buf.BrowseDir = ""
+	ts.buf.NewFile = false
+	ts.buf.MarkUnmodified()
+	ts.buf.Layout = buffer.Layout{Format: buffer.FormatUnix, Encoding: buffer.EncodingUTF8}
+	ts.buf.Marks = make(map[byte]buffer.Position)
+	ts.cursorX, ts.cursorY, ts.rowOffset = 0, 0, 0
+
+	// Don't display welcome when opening a file.
+	ts.welcomed = true
+	// Set number bar as width of largest line number.
+	ts.lineNumWidth = len(strconv.Itoa(ts.buf.Len()))
+}
+
+// setCursor moves the cursor to a 0-indexed buffer row and column, clamped to the buffer contents.
+func (ts *TermState) setCursor(row, col int) {
+	if row >= ts.buf.Len() {
+		row = ts.buf.Len() - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+	if col < 0 {
+		col = 0
+	}
+	ts.cursorY, ts.cursorX = row, col
+	ts.clampCursorX()
+}
+
+// exit should be called when program exiting/shutdown is initiated.
+func (ts *TermState) exit(err error) {
+	// Autocommands could panic again if exiting from a panic.
+	if err == nil {
+		ts.doAutocmd("VimLeave", ts.buf.Filename)
+	}
+	// Don't leave the terminal in raw mode on exit.
+	if ts.tty != nil {
+		ts.restoreTitle()
+		ts.setCursorShape(render.CursorDefault)
+		ts.reportFocus(false)
+		ts.w.Flush()
+		terminal.DisableRawMode(int(ts.tty.Fd()), ts.oldTerm)
+	}
+
+	if err := ts.saveState(); err != nil {
+		ts.logger.Printf("saving state: %v", err)
+	}
+	// Swap files are only kept if zi didn't exit normally, to recover from.
+	if err != nil {
+		ts.keepSwaps = true
+	}
+	if ts.keepSwaps {
+		ts.syncSwaps()
+	} else {
+		for b := range ts.swaps {
+			ts.removeSwap(b)
+		}
+	}
+	// Don't leave background processes, such as dlv, running.
+	ts.stopAllJobs()
+	ts.stopListening()
+
+	if err != nil {
+		fmt.Printf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// newTermState returns an editor for opts with no buffers, the caller must set up its terminal.
+func newTermState(opts *cliOptions, l *log.Logger) *TermState {
+	return &TermState{
+		mode:         normalMode,
+		logger:       l,
+		argList:      opts.files,
+		readonly:     opts.readonly || opts.view,
+		view:         opts.view,
+		binary:       opts.binary,
+		encrypt:      opts.encrypt,
+		fileMarks:    make(map[byte]fileMark),
+		breakpoints:  make(map[string][]int),
+		events:       make(chan func(), 64),
+		keys:         make(chan byte),
+		jobs:         make(map[int]*job),
+		timers:       make(map[int]*timer),
+		keymaps:      make(map[byte]func()),
+		userCommands: make(map[string]exCommand),
+		waiters:      make(map[*buffer.Buffer][]net.Conn),
+		swaps:        make(map[*buffer.Buffer]*swapFile),
+		folds:        make(map[*buffer.Buffer]*foldState),
+		spell:        make(map[*buffer.Buffer]*spellState),
+		rainbow:      make(map[*buffer.Buffer]*rainbowState),
+		git:          make(map[*buffer.Buffer]*gitState),
+		merge:        make(map[*buffer.Buffer]*mergeState),
+		changeLists:  make(map[*buffer.Buffer]*changeList),
+		registers:    make(map[byte]register),
+		opts:         defaultOptions(),
+	}
+}
+
+func Main(args []string) {
+	opts, err := parseArgs(args, os.Stderr)
+	if err != nil {
+		os.Exit(2)
+	}
+	if opts.help {
+		fmt.Print(usage)
+		return
+	}
+	if opts.version {
+		fmt.Printf("zi version %s\n", ziVersion)
+		return
+	}
+	if opts.batch {
+		os.Exit(runBatch(opts))
+	}
+	if opts.remote || opts.remoteWait {
+		path, err := serverPath(opts)
+		found := false
+		if err == nil {
+			found, err = sendRemote(path, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zi: %v\n", err)
+			os.Exit(1)
+		}
+		if found {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "zi: no server listening at %s, editing locally\n", path)
+	}
+
+	var script []input.Step
+	if opts.script != "" {
+		if script, err = input.LoadScript(opts.script); err != nil {
+			fmt.Fprintf(os.Stderr, "zi: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Log to a local file. Its hard to debug without this because the terminal is in raw mode.
+	// Use with: ts.logger.Printf(...)
+	logPath, err := filepath.Abs("zi.log")
+	if err != nil {
+		panic(err)
+	}
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	l := log.New(f, "", log.LstdFlags)
+
+	ts := newTermState(opts, l)
+	ts.logPath = logPath
+
+	if opts.dumpScreen {
+		// The terminal isn't used at all, so the output only depends on the script.
+		ts.screen = render.NewScreen(dumpScreenRows, dumpScreenCols)
+		ts.winSize = &terminal.Size{Row: dumpScreenRows - 1, Col: dumpScreenCols - 1}
+		ts.r = bufio.NewReader(&input.Script{
+			Steps: script,
+			End:   func() { ts.events <- ts.endScreenDump },
+		})
+		ts.w = bufio.NewWriter(ts.screen)
+	} else {
+		tty, err := terminal.TTY()
+		if err != nil {
+			panic(err)
+		}
+
+		oldTerm, err := terminal.EnableRawMode(int(tty.Fd()))
+		if err != nil {
+			panic(err)
+		}
+
+		ws, err := terminal.GetSize(int(tty.Fd()))
+		if err != nil || (ws.Row == 0 && ws.Col == 0) {
+			terminal.DisableRawMode(int(tty.Fd()), oldTerm)
+			panic(err)
+		}
+		// The terminal size uses 1-based indexing, this is annoying and I'd rather
+		// deal with this in fewer places and assume 0 indexing otherwise.
+		ws.Row--
+		ws.Col--
+
+		ts.tty = tty
+		ts.oldTerm = oldTerm
+		ts.winSize = ws
+		ts.r = bufio.NewReader(tty)
+		ts.w = bufio.NewWriter(os.Stdout)
+		if script != nil {
+			ts.r = bufio.NewReader(&input.Script{
+				Steps: script,
+				Then:  tty,
+				End:   func() { ts.events <- func() { ts.statusMsg = "script finished" } },
+			})
+		}
+	}
+
+	// Catch any unexpected panics. Normal exits should happen through ts.exit().
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("stacktrace: \n" + string(debug.Stack()))
+			ts.exit(fmt.Errorf("Runtime panic: %v", r))
+		}
+	}()
+
+	ts.switchBuffer(ts.addBuffer("", make([]string, 0)))
+	if !opts.clean {
+		ts.statePath = defaultStatePath()
+		ts.loadState()
+	}
+	ts.loadConfig(opts.configPath)
+	ts.detectCompiler()
+	if opts.listen != "" {
+		if err := ts.listen(opts.listen); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	}
+
+	err = ts.openEditor()
+	if err == nil && opts.diff {
+		err = ts.startDiffMode(opts.files[0], opts.files[1])
+	}
+	if err != nil {
+		ts.exit(err)
+	}
+	ts.gotoStartPosition(opts)
+	ts.doAutocmd("VimEnter", ts.buf.Filename)
+
+	go ts.readKeys()
+	for _, b := range ts.detectCaps() {
+		ts.processKeyPress(b)
+	}
+	ts.reportFocus(true)
+	ts.run()
+}
@@ -0,0 +1,141 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// errorFormat is a single compiled pattern from the errorformat option.
+type errorFormat struct {
+	re     *regexp.Regexp
+	fields []byte // The conversion char for each capture group, e.g. 'f' for the filename
+	ignore bool   // true for %-G patterns, lines matching them are dropped
+}
+
+// parseErrorFormats compiles a comma separated list of vim style errorformat patterns. Supported
+// conversions are %f (file), %l (line), %c (column), %m (message), %t (error type char), %s
+// (search text, treated as part of the message) and %% (a literal '%'). As in vim, %. matches
+// any char, %\ starts a regexp escape such as %\s and %# repeats the previous item any number of
+// times. A pattern starting with %-G ignores matching lines. Commas within a pattern are escaped
+// with a backslash.
+func parseErrorFormats(efm string) ([]errorFormat, error) {
+	var formats []errorFormat
+	for _, pattern := range splitUnescaped(efm, ',') {
+		if pattern == "" {
+			continue
+		}
+		ef := errorFormat{}
+		if strings.HasPrefix(pattern, "%-G") {
+			ef.ignore, pattern = true, pattern[3:]
+		}
+
+		var re strings.Builder
+		re.WriteByte('^')
+		for i := 0; i < len(pattern); i++ {
+			if pattern[i] != '%' || i+1 == len(pattern) {
+				re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+				continue
+			}
+			i++
+			switch c := pattern[i]; c {
+			case 'f':
+				re.WriteString(`(.+?)`)
+				ef.fields = append(ef.fields, c)
+			case 'l', 'c':
+				re.WriteString(`(\d+)`)
+				ef.fields = append(ef.fields, c)
+			case 'm', 's':
+				re.WriteString(`(.*)`)
+				ef.fields = append(ef.fields, 'm')
+			case 't':
+				re.WriteString(`(.)`)
+				ef.fields = append(ef.fields, c)
+			case '%':
+				re.WriteByte('%')
+			case '.':
+				re.WriteByte('.')
+			case '#':
+				re.WriteByte('*')
+			case '\\':
+				if i+1 < len(pattern) {
+					i++
+					re.WriteByte('\\')
+					re.WriteByte(pattern[i])
+				}
+			default:
+				return nil, fmt.Errorf("unsupported errorformat conversion %%%c in %q", c, pattern)
+			}
+		}
+		re.WriteByte('$')
+
+		var err error
+		if ef.re, err = regexp.Compile(re.String()); err != nil {
+			return nil, err
+		}
+		formats = append(formats, ef)
+	}
+	return formats, nil
+}
+
+// splitUnescaped splits s on sep, except where sep is preceded by a backslash.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == sep:
+			cur.WriteByte(sep)
+			i++
+		case s[i] == sep:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// parseErrors returns a quickfix entry for each line of output matching one of formats. The first
+// matching format is used for each line, lines without a filename are skipped.
+func parseErrors(output string, formats []errorFormat) []qfEntry {
+	var entries []qfEntry
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		for _, ef := range formats {
+			m := ef.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if ef.ignore {
+				break
+			}
+
+			e := qfEntry{}
+			for i, field := range ef.fields {
+				v := m[i+1]
+				switch field {
+				case 'f':
+					e.filename = v
+				case 'l':
+					n, _ := strconv.Atoi(v)
+					e.row = n - 1
+				case 'c':
+					n, _ := strconv.Atoi(v)
+					e.col = n - 1
+				case 'm':
+					e.text = v
+				case 't':
+					e.kind = v[0]
+				}
+			}
+			if e.filename != "" {
+				entries = append(entries, e)
+			}
+			break
+		}
+	}
+	return entries
+}
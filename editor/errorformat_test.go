@@ -0,0 +1,83 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		efm    string
+		output string
+		want   []qfEntry
+	}{
+		{
+			name:   "file line column message",
+			efm:    "%f:%l:%c: %m",
+			output: "main.go:3:7: undefined: x\n",
+			want:   []qfEntry{{filename: "main.go", row: 2, col: 6, text: "undefined: x"}},
+		},
+		{
+			name:   "first matching format wins",
+			efm:    "%f:%l:%c: %m,%f:%l: %m",
+			output: "a.c:1:2: first\nb.c:5: second",
+			want: []qfEntry{
+				{filename: "a.c", row: 0, col: 1, text: "first"},
+				{filename: "b.c", row: 4, text: "second"},
+			},
+		},
+		{
+			name:   "error type",
+			efm:    "%f:%l: %t%.%#: %m",
+			output: "x.py:9: warning: unused",
+			want:   []qfEntry{{filename: "x.py", row: 8, text: "unused", kind: 'w'}},
+		},
+		{
+			name:   "ignored lines",
+			efm:    "%-G#%.%#,%f:%l: %m",
+			output: "# pkg\nf.go:1: bad",
+			want:   []qfEntry{{filename: "f.go", row: 0, text: "bad"}},
+		},
+		{
+			name:   "regexp escapes and literal percent",
+			efm:    `%\s%#%f(%l): 100%% %m`,
+			output: "   lib.rs(12): 100% sure",
+			want:   []qfEntry{{filename: "lib.rs", row: 11, text: "sure"}},
+		},
+		{
+			name:   "escaped comma",
+			efm:    `%f\,%l: %m`,
+			output: "a.txt,4: here",
+			want:   []qfEntry{{filename: "a.txt", row: 3, text: "here"}},
+		},
+		{
+			name:   "CRLF output",
+			efm:    "%f:%l: %m",
+			output: "w.go:2: oops\r\n",
+			want:   []qfEntry{{filename: "w.go", row: 1, text: "oops"}},
+		},
+		{
+			name:   "lines matching nothing",
+			efm:    "%f:%l: %m",
+			output: "building...\ndone",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formats, err := parseErrorFormats(tt.efm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parseErrors(tt.output, formats); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseErrors(%q) with %q = %+v, want %+v", tt.output, tt.efm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorFormatsUnsupported(t *testing.T) {
+	if _, err := parseErrorFormats("%f:%l:%v"); err == nil {
+		t.Error("parseErrorFormats accepted an unknown conversion")
+	}
+}
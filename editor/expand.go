@@ -0,0 +1,275 @@
+package editor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fileCommands are the ex commands whose arguments are file names, expanded by expandFiles and
+// completed with Tab.
+var fileCommands = map[string]bool{
+	"e": true, "edit": true, "vie": true, "view": true, "w": true, "write": true, "sav": true,
+	"saveas": true, "ar": true, "args": true, "n": true, "next": true,
+}
+
+// splitFileArgs splits arg into words at spaces, except those escaped with a backslash.
+func splitFileArgs(arg string) []string {
+	var words []string
+	var word strings.Builder
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; {
+		case c == '\\' && i+1 < len(arg) && arg[i+1] == ' ':
+			word.WriteByte(' ')
+			i++
+		case c == ' ' || c == '\t':
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// escapeFileArg escapes the spaces in name, so splitFileArgs keeps it as one word.
+func escapeFileArg(name string) string {
+	return strings.ReplaceAll(name, " ", `\ `)
+}
+
+// expandSpecial replaces % in word with the current file name and # with the alternate one, the
+// file last edited. Either may be followed by modifiers: :p for the full path, :h for its
+// directory, :t for the last part, :r to remove the extension and :e for just the extension. A
+// backslash before % or # keeps it.
+func (ts *TermState) expandSpecial(word string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if c == '\\' && i+1 < len(word) && (word[i+1] == '%' || word[i+1] == '#') {
+			out.WriteByte(word[i+1])
+			i++
+			continue
+		}
+		if c != '%' && c != '#' {
+			out.WriteByte(c)
+			continue
+		}
+		name := ts.buf.Filename
+		if c == '#' {
+			if ts.altBuf == nil || ts.altBuf.Filename == "" {
+				return "", fmt.Errorf("no alternate file name to substitute for '#'")
+			}
+			name = ts.altBuf.Filename
+		} else if name == "" {
+			return "", fmt.Errorf("no file name to substitute for '%%'")
+		}
+		for i+2 < len(word) && word[i+1] == ':' && strings.IndexByte("phtre", word[i+2]) >= 0 {
+			switch word[i+2] {
+			case 'p':
+				name = absPath(name)
+			case 'h':
+				name = filepath.Dir(name)
+			case 't':
+				name = filepath.Base(name)
+			case 'r':
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			case 'e':
+				name = strings.TrimPrefix(filepath.Ext(name), ".")
+			}
+			i += 2
+		}
+		out.WriteString(name)
+	}
+	return out.String(), nil
+}
+
+// globFiles returns the files matching pattern, sorted. As well as the wildcards of
+// filepath.Match, ** matches any number of directories.
+func globFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	// Only the directory the pattern starts in has to be walked.
+	root := pattern[:strings.IndexAny(pattern, "*?[")]
+	root = root[:strings.LastIndex(root, "/")+1]
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, filepath.ErrBadPattern
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	match, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, filepath.ErrBadPattern
+	}
+
+	dir := root
+	if dir == "" {
+		dir = "."
+	}
+	var names []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if root == "" {
+			path = strings.TrimPrefix(path, "./")
+		}
+		if path != dir && match.MatchString(filepath.ToSlash(path)) {
+			names = append(names, path)
+		}
+		return nil
+	})
+	return names, err
+}
+
+// expandFiles returns the file names in arg, with % and # expanded by expandSpecial and any
+// wildcards matched against the file system.
+func (ts *TermState) expandFiles(arg string) ([]string, error) {
+	var names []string
+	for _, word := range splitFileArgs(arg) {
+		word, err := ts.expandSpecial(word)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.ContainsAny(word, "*?[") {
+			names = append(names, word)
+			continue
+		}
+		matches, err := globFiles(word)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern: %s", word)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no match: %s", word)
+		}
+		names = append(names, matches...)
+	}
+	return names, nil
+}
+
+// expandFile returns the one file name arg expands to, or "" if it's empty.
+func (ts *TermState) expandFile(arg string) (string, error) {
+	names, err := ts.expandFiles(arg)
+	switch {
+	case err != nil:
+		return "", err
+	case len(names) > 1:
+		return "", fmt.Errorf("too many file names")
+	case len(names) == 0:
+		return "", nil
+	}
+	return names[0], nil
+}
+
+// wildState is the completions cycled through by pressing Tab again on the command line.
+type wildState struct {
+	start   int // Where the word being completed starts in the command line
+	matches []string
+	index   int
+}
+
+// completeFileArg is Tab on the command line, completing the file name being typed as the
+// argument of one of fileCommands. Names with wildcards, % or # are expanded in place. Otherwise
+// the first file starting with the word is filled in, and pressing Tab again cycles through the
+// others.
+func (ts *TermState) completeFileArg() error {
+	line := ts.commandBuf
+	if w := ts.wild; w != nil && len(w.matches) > 1 && w.start <= len(line) &&
+		line[w.start:] == w.matches[w.index] {
+		w.index = (w.index + 1) % len(w.matches)
+		ts.commandBuf = line[:w.start] + w.matches[w.index]
+		return nil
+	}
+	ts.wild = nil
+
+	name := strings.TrimLeft(line, " :0123456789.,$'<>+-")
+	end := 0
+	for end < len(name) && isLetter(name[end]) {
+		end++
+	}
+	if !fileCommands[name[:end]] || !strings.ContainsAny(name[end:], " \t") {
+		return nil
+	}
+	start := len(line)
+	for start > 0 && (line[start-1] != ' ' || start > 1 && line[start-2] == '\\') {
+		start--
+	}
+	word := line[start:]
+
+	var matches []string
+	if strings.ContainsAny(word, "*?[%#") {
+		names, err := ts.expandFiles(word)
+		if err != nil {
+			return err
+		}
+		for i, n := range names {
+			names[i] = escapeFileArg(n)
+		}
+		matches = []string{strings.Join(names, " ")}
+	} else {
+		prefix := strings.ReplaceAll(word, `\ `, " ")
+		dir, base := filepath.Split(prefix)
+		readDir := dir
+		if readDir == "" {
+			readDir = "."
+		}
+		entries, err := os.ReadDir(readDir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			n := e.Name()
+			if !strings.HasPrefix(n, base) || strings.HasPrefix(n, ".") && !strings.HasPrefix(base, ".") {
+				continue
+			}
+			if e.IsDir() {
+				n += "/"
+			}
+			matches = append(matches, escapeFileArg(dir+n))
+		}
+		sort.Strings(matches)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no match: %s", word)
+	}
+	ts.wild = &wildState{start: start, matches: matches}
+	ts.commandBuf = line[:start] + matches[0]
+	return nil
+}
@@ -0,0 +1,311 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+)
+
+const maxExplorerWidth = 30
+
+// explorerNode is a single visible row of the explorer tree.
+type explorerNode struct {
+	path  string
+	depth int
+	isDir bool
+}
+
+// explorer is a tree view of the project directory, drawn in a panel to the left of the buffer.
+type explorer struct {
+	visible  bool
+	focused  bool            // true if keypresses go to the explorer instead of the buffer
+	root     string          // Absolute path of the directory at the top of the tree
+	expanded map[string]bool // Directories whose children are shown
+	nodes    []explorerNode  // Flattened tree, in display order
+	cursor   int             // Index into nodes of the selected row
+	offset   int             // Index into nodes of the first row on screen
+}
+
+// explorerWidth is the number of columns taken by the explorer panel and its separator.
+func (ts *TermState) explorerWidth() int {
+	if !ts.explorer.visible {
+		return 0
+	}
+	w := int(ts.winSize.Col) / 3
+	if w > maxExplorerWidth {
+		w = maxExplorerWidth
+	}
+	return w + 1
+}
+
+// toggleExplorer shows and focuses the explorer, or hides it if it already has focus.
+func (ts *TermState) toggleExplorer() {
+	e := &ts.explorer
+	if e.visible && e.focused {
+		e.visible, e.focused = false, false
+		return
+	}
+
+	if e.root == "" {
+		root, err := os.Getwd()
+		if err != nil {
+			ts.statusMsg = err.Error()
+			return
+		}
+		e.root = root
+		e.expanded = map[string]bool{root: true}
+	}
+	e.visible, e.focused = true, true
+	ts.refreshExplorer()
+}
+
+// cmdExplorer toggles the explorer panel.
+func cmdExplorer(ts *TermState, a exArgs) error {
+	ts.toggleExplorer()
+	return nil
+}
+
+// refreshExplorer rereads the tree from disk, keeping the selection on the same path if it still
+// exists.
+func (ts *TermState) refreshExplorer() {
+	e := &ts.explorer
+	selected := ""
+	if e.cursor < len(e.nodes) {
+		selected = e.nodes[e.cursor].path
+	}
+
+	e.nodes = e.nodes[:0]
+	e.appendChildren(e.root, 0)
+
+	e.cursor = 0
+	for i, n := range e.nodes {
+		if n.path == selected {
+			e.cursor = i
+		}
+	}
+}
+
+// appendChildren adds the entries of dir to the flattened tree, recursing into expanded dirs.
+func (e *explorer) appendChildren(dir string, depth int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	// Directories are listed before files, each sorted by name.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].IsDir() && !entries[j].IsDir()
+	})
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		e.nodes = append(e.nodes, explorerNode{path: path, depth: depth, isDir: entry.IsDir()})
+		if entry.IsDir() && e.expanded[path] {
+			e.appendChildren(path, depth+1)
+		}
+	}
+}
+
+// drawExplorerRow writes screen row i of the explorer panel, followed by its separator.
+func (ts *TermState) drawExplorerRow(i int) {
+	e := &ts.explorer
+	width := ts.explorerWidth() - 1
+
+	// Keep the selected node on screen.
+	if e.cursor < e.offset {
+		e.offset = e.cursor
+	}
+	if e.cursor >= e.offset+ts.textRows() {
+		e.offset = e.cursor - ts.textRows() + 1
+	}
+
+	text := ""
+	if idx := e.offset + i; idx < len(e.nodes) {
+		n := e.nodes[idx]
+		marker := "  "
+		if n.isDir && e.expanded[n.path] {
+			marker = "- "
+		} else if n.isDir {
+			marker = "+ "
+		}
+		text = strings.Repeat("  ", n.depth) + marker + filepath.Base(n.path)
+		if n.isDir {
+			text += "/"
+		}
+	}
+	if len(text) > width {
+		text = text[:width]
+	}
+
+	if e.focused && e.offset+i == e.cursor {
+		fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(render.Inverted), width, text, render.ColorCode(render.Reset))
+	} else {
+		fmt.Fprintf(ts.w, "%-*s", width, text)
+	}
+	fmt.Fprintf(ts.w, "%s|%s", render.ColorCode(render.Faint), render.ColorCode(render.Reset))
+}
+
+// processExplorerPress handles normal mode keys while the explorer has focus.
+func processExplorerPress(ts *TermState, b byte) {
+	e := &ts.explorer
+
+	var node *explorerNode
+	if e.cursor < len(e.nodes) {
+		node = &e.nodes[e.cursor]
+	}
+
+	switch b {
+	case 'j':
+		if e.cursor < len(e.nodes)-1 {
+			e.cursor++
+		}
+	case 'k':
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case 'q', input.Ctrl('n'):
+		ts.toggleExplorer()
+	case ':':
+		ts.mode = commandMode
+		ts.commandBuf = ""
+	case input.Ctrl('w'):
+		switch ts.readKey() {
+		case 'w', 'l', input.Ctrl('w'), input.Ctrl('l'):
+			e.focused = false
+		}
+	case 'R':
+		ts.refreshExplorer()
+	case '\r', 'o', 'l':
+		if node == nil {
+			return
+		}
+		if node.isDir {
+			e.expanded[node.path] = !e.expanded[node.path] || b == 'l'
+			ts.refreshExplorer()
+			return
+		}
+		if err := ts.openFile(node.path); err != nil {
+			ts.statusMsg = err.Error()
+			return
+		}
+		e.focused = false
+	case 'h':
+		// Collapse the selected directory, or the directory containing the selection.
+		if node == nil {
+			return
+		}
+		dir := node.path
+		if !node.isDir || !e.expanded[dir] {
+			dir = filepath.Dir(node.path)
+		}
+		if dir == e.root {
+			return
+		}
+		e.expanded[dir] = false
+		ts.refreshExplorer()
+		for i, n := range e.nodes {
+			if n.path == dir {
+				e.cursor = i
+			}
+		}
+	case 'a':
+		ts.explorerCreate(node)
+	case 'r':
+		if node != nil {
+			ts.explorerRename(node.path)
+		}
+	case 'd':
+		if node != nil {
+			ts.explorerDelete(node.path)
+		}
+	}
+}
+
+// explorerCreate prompts for a new file to create next to node, or inside it if node is an
+// expanded directory. Names ending in '/' create a directory.
+func (ts *TermState) explorerCreate(node *explorerNode) {
+	e := &ts.explorer
+	dir := e.root
+	if node != nil {
+		dir = filepath.Dir(node.path)
+		if node.isDir && e.expanded[node.path] {
+			dir = node.path
+		}
+	}
+
+	ts.prompt("Create: ", "", func(name string) error {
+		if name == "" {
+			return nil
+		}
+		path := filepath.Join(dir, name)
+		var err error
+		if strings.HasSuffix(name, "/") {
+			err = os.MkdirAll(path, 0755)
+		} else {
+			if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				var f *os.File
+				f, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+				if err == nil {
+					err = f.Close()
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		e.expanded[dir] = true
+		ts.refreshExplorer()
+		ts.explorerSelect(filepath.Clean(path))
+		return nil
+	})
+}
+
+// explorerRename prompts for a new name for path, relative to its directory.
+func (ts *TermState) explorerRename(path string) {
+	ts.prompt("Rename to: ", filepath.Base(path), func(name string) error {
+		if name == "" || name == filepath.Base(path) {
+			return nil
+		}
+		newPath := filepath.Join(filepath.Dir(path), name)
+		if _, err := os.Stat(newPath); err == nil {
+			return fmt.Errorf("%s already exists", name)
+		}
+		if err := os.Rename(path, newPath); err != nil {
+			return err
+		}
+		// Keep the open buffer pointed at the file it was read from.
+		if abs, _ := filepath.Abs(ts.buf.Filename); abs == path {
+			ts.buf.Filename = newPath
+		}
+		ts.refreshExplorer()
+		ts.explorerSelect(newPath)
+		return nil
+	})
+}
+
+// explorerDelete asks for confirmation and then deletes path. Directories must be empty.
+func (ts *TermState) explorerDelete(path string) {
+	ts.prompt(fmt.Sprintf("Delete %s? (y/n): ", filepath.Base(path)), "", func(answer string) error {
+		if answer != "y" && answer != "yes" {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		ts.refreshExplorer()
+		return nil
+	})
+}
+
+// explorerSelect moves the explorer cursor to path, if it is visible.
+func (ts *TermState) explorerSelect(path string) {
+	for i, n := range ts.explorer.nodes {
+		if n.path == path {
+			ts.explorer.cursor = i
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// exprTimeout stops an expression which loops forever, such as a typo in a while loop, from
+// freezing the editor.
+const exprTimeout = time.Second
+
+// evalExpression evaluates expr as Lua, for the expression register "=, so it can be arithmetic
+// such as 7*6, use the string and math libraries, or call functions from the Lua config. A list
+// of strings gives lines, anything else characterwise text.
+func (ts *TermState) evalExpression(expr string) (register, error) {
+	L := ts.luaState()
+	fn, err := L.LoadString("return " + expr)
+	if err != nil {
+		return register{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exprTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	L.Push(fn)
+	if err := L.PCall(0, 1, nil); err != nil {
+		if ctx.Err() != nil {
+			return register{}, fmt.Errorf("expression took longer than %v", exprTimeout)
+		}
+		return register{}, err
+	}
+	v := L.Get(-1)
+	L.Pop(1)
+	var text string
+	switch v := v.(type) {
+	case *lua.LTable:
+		return register{lines: luaStrings(v), linewise: true}, nil
+	case lua.LString, lua.LNumber:
+		text = lua.LVAsString(v)
+	case lua.LBool:
+		text = v.String()
+	case *lua.LNilType:
+	default:
+		return register{}, fmt.Errorf("expression gave a %s, not text", v.Type())
+	}
+	return register{lines: strings.Split(text, "\n")}, nil
+}
+
+// promptExpression asks for an expression and stores its value in the expression register, then
+// calls then. An empty expression uses the last one again.
+func (ts *TermState) promptExpression(then func() error) {
+	ts.prompt("=", "", func(expr string) error {
+		if expr == "" {
+			expr = ts.lastExpr
+		}
+		if expr == "" {
+			return fmt.Errorf("no previous expression")
+		}
+		r, err := ts.evalExpression(expr)
+		if err != nil {
+			return err
+		}
+		ts.lastExpr = expr
+		ts.registers['='] = r
+		return then()
+	})
+}
+
+// insertRegister is Ctrl-R {reg} in insert mode, inserting the text of register name as if it
+// were typed. Linewise text ends with a line break.
+func (ts *TermState) insertRegister(name byte) error {
+	r, err := ts.getRegister(name)
+	if err != nil {
+		return err
+	}
+	for i, line := range r.lines {
+		if i > 0 {
+			ts.insertNewline()
+		}
+		ts.insertText(line)
+	}
+	if r.linewise && len(r.lines) > 0 {
+		ts.insertNewline()
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEvalExpression(t *testing.T) {
+	tests := []struct {
+		expr     string
+		want     []string
+		linewise bool
+		err      bool
+	}{
+		{"7*6", []string{"42"}, false, false},
+		{`"a\nb"`, []string{"a", "b"}, false, false},
+		{`{"x", "y"}`, []string{"x", "y"}, true, false},
+		{"nil", []string{""}, false, false},
+		{"1 +", nil, false, true},
+		{"(function() while true do end end)()", nil, false, true},
+	}
+	ts := &TermState{}
+	for _, tt := range tests {
+		r, err := ts.evalExpression(tt.expr)
+		if (err != nil) != tt.err {
+			t.Errorf("evalExpression(%q) error = %v, want error %v", tt.expr, err, tt.err)
+			continue
+		}
+		if err == nil && (!reflect.DeepEqual(r.lines, tt.want) || r.linewise != tt.linewise) {
+			t.Errorf("evalExpression(%q) = %q, linewise %v, want %q, %v", tt.expr, r.lines, r.linewise, tt.want, tt.linewise)
+		}
+	}
+	// The state is still usable after an expression timed out.
+	if r, err := ts.evalExpression("1+1"); err != nil || r.lines[0] != "2" {
+		t.Errorf("evalExpression after a timeout = %q, %v", r.lines, err)
+	}
+}
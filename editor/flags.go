@@ -0,0 +1,193 @@
+package editor
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const usage = `Usage: zi [options] [+N | +/pattern] [file[:line[:col]] ...]
+       somecmd | zi [options] -
+
+Options:
+  +N           start at line N of the first file, a bare + starts at the last line
+  +/pattern    start at the first line matching pattern
+  -R           open files readonly, refusing changes until :set ma
+  -b           binary mode, edit files byte for byte without converting line endings or encodings
+  -x           encrypt files when writing, asking for a key
+  -d           diff mode, compare two files side by side
+  --view       open files read-only without reading them into memory, for huge logs
+  -u <zirc>    use <zirc> instead of the default config, "NONE" skips loading any config
+  --clean      start without loading the user config
+  -es          run ex commands from -c and stdin against each file, without a terminal,
+               exiting with status 1 if any fails
+  -c <command> run an ex command, may be repeated
+  --listen <socket>
+               accept --remote requests on a unix socket
+  --remote     open the files in an existing zi, or here if none is listening
+  --remote-wait
+               like --remote, but wait for the first file to be closed, e.g. for git commit
+  --server <socket>
+               the zi to use with --remote, defaults to $ZI_LISTEN_ADDRESS
+  --script <file>
+               type the keys in file, then carry on reading from the terminal
+  --dump-screen
+               with --script, draw to an 80x24 screen instead of the terminal and print it
+               once the script finishes
+  --version    print version information and exit
+  --help       print this help and exit
+`
+
+// cliOptions holds everything parsed from the command line.
+type cliOptions struct {
+	readonly   bool
+	view       bool
+	binary     bool
+	encrypt    bool
+	diff       bool
+	configPath string
+	clean      bool
+	version    bool
+	help       bool
+	files      []string
+
+	batch    bool     // Run commands non-interactively, see runBatch
+	commands []string // Ex commands given with -c, in order
+
+	script     string // File of keys to type, see input.Script
+	dumpScreen bool
+
+	listen     string // Socket to accept --remote requests on
+	remote     bool
+	remoteWait bool
+	server     string // Socket of the zi --remote talks to
+
+	startLine    int // 1-indexed line to start on, 0 if not given and -1 for the last line
+	startCol     int // 1-indexed column to start on, 0 if not given
+	startPattern string
+}
+
+// filePosSuffix matches the file:line[:col] form emitted by compilers and grep, and file:+line.
+var filePosSuffix = regexp.MustCompile(`^(.+?):\+?(\d+)(?::(\d+))?:?$`)
+
+// errUsage is returned by parseArgs when the arguments are invalid, usage has already been printed.
+var errUsage = errors.New("invalid arguments")
+
+// parseArgs parses args, not including the program name. Flags may be given with one or two
+// dashes and are only recognized before the first filename or a "--".
+func parseArgs(args []string, output io.Writer) (*cliOptions, error) {
+	opts := &cliOptions{}
+
+	fs := flag.NewFlagSet("zi", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() { fmt.Fprint(output, usage) }
+	fs.BoolVar(&opts.readonly, "R", false, "")
+	fs.BoolVar(&opts.view, "view", false, "")
+	fs.BoolVar(&opts.binary, "b", false, "")
+	fs.BoolVar(&opts.encrypt, "x", false, "")
+	fs.BoolVar(&opts.diff, "d", false, "")
+	fs.StringVar(&opts.configPath, "u", defaultConfigPath(), "")
+	fs.BoolVar(&opts.clean, "clean", false, "")
+	fs.BoolVar(&opts.version, "version", false, "")
+	fs.BoolVar(&opts.help, "help", false, "")
+	fs.StringVar(&opts.listen, "listen", "", "")
+	fs.BoolVar(&opts.remote, "remote", false, "")
+	fs.BoolVar(&opts.remoteWait, "remote-wait", false, "")
+	fs.StringVar(&opts.server, "server", "", "")
+	fs.BoolVar(&opts.batch, "es", false, "")
+	fs.StringVar(&opts.script, "script", "", "")
+	fs.BoolVar(&opts.dumpScreen, "dump-screen", false, "")
+	fs.Func("c", "", func(cmd string) error {
+		opts.commands = append(opts.commands, cmd)
+		return nil
+	})
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			opts.help = true
+			return opts, nil
+		}
+		return nil, errUsage
+	}
+
+	for _, arg := range fs.Args() {
+		switch {
+		case arg == "+":
+			opts.startLine = -1
+		case strings.HasPrefix(arg, "+/"):
+			opts.startPattern = arg[2:]
+		case strings.HasPrefix(arg, "+"):
+			n, err := strconv.Atoi(arg[1:])
+			if err != nil {
+				fmt.Fprintf(output, "invalid start position: %s\n", arg)
+				return nil, errUsage
+			}
+			opts.startLine = n
+		default:
+			opts.files = append(opts.files, parseFilePos(opts, arg))
+		}
+	}
+
+	if opts.diff && len(opts.files) != 2 {
+		fmt.Fprintln(output, "-d needs two files")
+		return nil, errUsage
+	}
+	if opts.dumpScreen && opts.script == "" {
+		fmt.Fprintln(output, "--dump-screen needs --script")
+		return nil, errUsage
+	}
+
+	// Like vim, scripts don't load the user config unless it's asked for with -u.
+	configGiven := false
+	fs.Visit(func(f *flag.Flag) { configGiven = configGiven || f.Name == "u" })
+	if opts.clean || opts.configPath == "NONE" || (opts.batch && !configGiven) {
+		opts.configPath = ""
+	}
+	return opts, nil
+}
+
+// parseFilePos strips a :line[:col] or :+line suffix from arg, recording the position in opts if
+// arg is the first file. Files which really exist with such a name are left alone.
+func parseFilePos(opts *cliOptions, arg string) string {
+	m := filePosSuffix.FindStringSubmatch(arg)
+	if m == nil {
+		return arg
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg
+	}
+
+	if len(opts.files) == 0 && opts.startLine == 0 {
+		opts.startLine, _ = strconv.Atoi(m[2])
+		opts.startCol, _ = strconv.Atoi(m[3])
+	}
+	return m[1]
+}
+
+// gotoStartPosition moves the cursor to the position requested on the command line, if any.
+func (ts *TermState) gotoStartPosition(opts *cliOptions) {
+	switch {
+	case opts.startPattern != "":
+		re, err := regexp.Compile(opts.startPattern)
+		if err != nil {
+			ts.statusMsg = fmt.Sprintf("invalid pattern: %v", err)
+			return
+		}
+		for i := 0; i < ts.buf.Len(); i++ {
+			if loc := re.FindStringIndex(ts.buf.Line(i)); loc != nil {
+				ts.setCursor(i, loc[0])
+				return
+			}
+		}
+		ts.statusMsg = fmt.Sprintf("pattern not found: %s", opts.startPattern)
+	case opts.startLine == -1:
+		ts.setCursor(ts.buf.Len()-1, 0)
+	case opts.startLine > 0:
+		ts.setCursor(opts.startLine-1, opts.startCol-1)
+	}
+}
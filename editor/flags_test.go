@@ -0,0 +1,36 @@
+package editor
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgsFilePos(t *testing.T) {
+	tests := []struct {
+		args      []string
+		files     []string
+		line, col int
+	}{
+		{[]string{"f.txt"}, []string{"f.txt"}, 0, 0},
+		{[]string{"f.txt:3"}, []string{"f.txt"}, 3, 0},
+		{[]string{"f.txt:3:7"}, []string{"f.txt"}, 3, 7},
+		{[]string{"f.txt:3:7:"}, []string{"f.txt"}, 3, 7},
+		{[]string{"f.txt:+3"}, []string{"f.txt"}, 3, 0},
+		{[]string{"--remote", "f.txt:+3"}, []string{"f.txt"}, 3, 0},
+		{[]string{"+5", "f.txt"}, []string{"f.txt"}, 5, 0},
+		{[]string{"a.txt:2", "b.txt:9"}, []string{"a.txt", "b.txt"}, 2, 0},
+		{[]string{"f.txt:x"}, []string{"f.txt:x"}, 0, 0},
+	}
+	for _, tt := range tests {
+		opts, err := parseArgs(tt.args, io.Discard)
+		if err != nil {
+			t.Errorf("parseArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(opts.files, tt.files) || opts.startLine != tt.line || opts.startCol != tt.col {
+			t.Errorf("parseArgs(%q) = %q at %d:%d, want %q at %d:%d", tt.args, opts.files, opts.startLine,
+				opts.startCol, tt.files, tt.line, tt.col)
+		}
+	}
+}
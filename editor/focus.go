@@ -0,0 +1,40 @@
+package editor
+
+import "github.com/keyan/zi/render"
+
+// reportFocus asks the terminal to report focus changes, if it can, or to stop.
+func (ts *TermState) reportFocus(on bool) {
+	if ts.tty == nil || !ts.caps.FocusEvents {
+		return
+	}
+	render.ReportFocus(ts.w, on)
+}
+
+// readFocusReport is called by readKeys after an Escape. If it starts a focus report, the report
+// is consumed and the FocusGained or FocusLost autocommands run instead of it being taken as
+// keys. Losing focus also autosaves, and regaining it checks for files changed meanwhile. Reports only arrive once reportFocus has turned them on, and terminals send each in one
+// write, so only bytes already read are looked at.
+func (ts *TermState) readFocusReport() bool {
+	if ts.r.Buffered() < 2 {
+		return false
+	}
+	next, err := ts.r.Peek(2)
+	if err != nil || next[0] != render.EscapeSeqBegin || (next[1] != 'I' && next[1] != 'O') {
+		return false
+	}
+	event := "FocusGained"
+	if next[1] == 'O' {
+		event = "FocusLost"
+	}
+	ts.r.Discard(2)
+	ts.events <- func() {
+		ts.doAutocmd(event, ts.buf.Filename)
+		if event == "FocusLost" && ts.opts.autosave > 0 {
+			ts.autosave()
+		}
+		if event == "FocusGained" {
+			ts.checkFiles()
+		}
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package editor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// fold is a range of rows, first to last inclusive, which can be closed to show as one row.
+type fold struct {
+	first, last int
+	closed      bool
+}
+
+// foldState is the folds of one buffer, found from the syntax of its text or in diff mode from
+// what's changed.
+type foldState struct {
+	folds   []fold // Sorted by first row, with folds before those nested in them
+	changes int    // The buffer's Changes when the folds were found
+	find    func() ([]fold, error)
+}
+
+// syntaxFolds returns the folds in b, one for each multi-line declaration, block, literal and
+// comment in its syntax tree. Only Go is understood; the syntax tree is taken as far as it can be
+// parsed, so folds still work while the file has errors.
+func syntaxFolds(b *buffer.Buffer) ([]fold, error) {
+	if b.LargeFile {
+		return nil, fmt.Errorf("cannot fold a large file")
+	}
+	if filepath.Ext(b.Filename) != ".go" {
+		return nil, fmt.Errorf("no syntax folding for %s, only Go is supported", b.Name())
+	}
+	fset := token.NewFileSet()
+	src := strings.Join(b.Lines(0, b.Len()), "\n")
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if f == nil {
+		return nil, err
+	}
+
+	var folds []fold
+	add := func(from, to token.Pos) {
+		if !from.IsValid() || !to.IsValid() {
+			return
+		}
+		first, last := fset.Position(from).Line-1, fset.Position(to).Line-1
+		if last > first {
+			folds = append(folds, fold{first: first, last: last})
+		}
+	}
+	for _, c := range f.Comments {
+		add(c.Pos(), c.End())
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			add(n.Pos(), n.End())
+		case *ast.GenDecl:
+			if n.Lparen.IsValid() {
+				add(n.Pos(), n.End())
+			}
+		case *ast.BlockStmt:
+			add(n.Lbrace, n.Rbrace)
+		case *ast.CaseClause:
+			add(n.Pos(), n.End())
+		case *ast.CommClause:
+			add(n.Pos(), n.End())
+		case *ast.CompositeLit:
+			add(n.Lbrace, n.Rbrace)
+		case *ast.CallExpr:
+			add(n.Lparen, n.Rparen)
+		case *ast.StructType:
+			add(n.Fields.Opening, n.Fields.Closing)
+		case *ast.InterfaceType:
+			add(n.Methods.Opening, n.Methods.Closing)
+		}
+		return true
+	})
+
+	sort.Slice(folds, func(i, j int) bool {
+		if folds[i].first != folds[j].first {
+			return folds[i].first < folds[j].first
+		}
+		return folds[i].last > folds[j].last
+	})
+	// A function and its body, say, often cover the same rows.
+	uniq := folds[:0]
+	for i, f := range folds {
+		if i == 0 || f != folds[i-1] {
+			uniq = append(uniq, f)
+		}
+	}
+	return uniq, nil
+}
+
+// bufFolds returns the folds of the current buffer, finding them again if it has changed, or
+// nil if folding hasn't been used in it.
+func (ts *TermState) bufFolds() *foldState {
+	fs := ts.folds[ts.buf]
+	if fs == nil || fs.changes == ts.buf.Changes() {
+		return fs
+	}
+	folds, err := fs.find()
+	if err != nil {
+		// Keep the old folds, such as while a line is being typed that breaks the parse.
+		return fs
+	}
+	// Folds stay closed if they still start on the same row.
+	closed := make(map[int]bool)
+	for _, f := range fs.folds {
+		if f.closed {
+			closed[f.first] = true
+		}
+	}
+	for i := range folds {
+		folds[i].closed = closed[folds[i].first]
+	}
+	fs.folds, fs.changes = folds, ts.buf.Changes()
+	return fs
+}
+
+// startFolding finds the folds of the current buffer the first time a fold command is used in it.
+func (ts *TermState) startFolding() (*foldState, error) {
+	if fs := ts.bufFolds(); fs != nil {
+		return fs, nil
+	}
+	b := ts.buf
+	find := func() ([]fold, error) { return syntaxFolds(b) }
+	folds, err := find()
+	if err != nil {
+		return nil, err
+	}
+	fs := &foldState{folds: folds, changes: ts.buf.Changes(), find: find}
+	ts.folds[ts.buf] = fs
+	return fs, nil
+}
+
+// closedFold returns the outermost closed fold containing row.
+func (ts *TermState) closedFold(row int) (fold, bool) {
+	if fs := ts.bufFolds(); fs != nil {
+		for _, f := range fs.folds {
+			if f.closed && f.first <= row && row <= f.last {
+				return f, true
+			}
+		}
+	}
+	return fold{}, false
+}
+
+// visibleRow returns the row shown for row, the first row of a closed fold it's in.
+func (ts *TermState) visibleRow(row int) int {
+	if f, ok := ts.closedFold(row); ok {
+		return f.first
+	}
+	return row
+}
+
+// nextRow returns the row shown below row, skipping the rest of a closed fold.
+func (ts *TermState) nextRow(row int) int {
+	if f, ok := ts.closedFold(row); ok {
+		return f.last + 1
+	}
+	return row + 1
+}
+
+// screenRows returns how many screen rows the rows from first up to last take, with closed folds
+// and wrapped lines, counting at most limit of them.
+func (ts *TermState) screenRows(first, last, limit int) int {
+	if ts.bufFolds() == nil && !ts.opts.wrap && ts.diffView() == nil {
+		return last - first
+	}
+	n := 0
+	for row := first; row < last && n < limit; row = ts.nextRow(row) {
+		n += ts.rowHeight(row)
+	}
+	return n
+}
+
+// scrollToFolds keeps the cursor and the top of the screen off the hidden rows of closed folds.
+// A cursor which jumped into the middle of a closed fold, or is about to change it, opens it.
+func (ts *TermState) scrollToFolds() {
+	fs := ts.bufFolds()
+	if fs == nil {
+		return
+	}
+	if f, ok := ts.closedFold(ts.cursorY); ok &&
+		(ts.cursorY != f.first || ts.mode == insertMode || ts.mode == replaceMode) {
+		for i := range fs.folds {
+			if fs.folds[i].first <= ts.cursorY && ts.cursorY <= fs.folds[i].last {
+				fs.folds[i].closed = false
+			}
+		}
+	}
+	ts.rowOffset = ts.visibleRow(ts.rowOffset)
+}
+
+// writeFoldRow draws the row shown for a closed fold, saying how many rows it hides.
+func (ts *TermState) writeFoldRow(f fold, width int) {
+	ts.writeFoldText(f.last-f.first+1, ts.buf.Line(f.first), width)
+}
+
+// writeFoldText draws a closed fold of n lines, the first of which is line.
+func (ts *TermState) writeFoldText(n int, line string, width int) {
+	text := fmt.Sprintf("+--%3d lines: %s", n, strings.TrimSpace(line))
+	ts.w.WriteString(render.ColorCode(render.Faint))
+	ts.writeText(text, 0, width, nil)
+	ts.w.WriteString(render.ColorCode(render.Reset))
+}
+
+// foldCommand handles the z fold commands: zo, zc and za open, close and toggle the fold under
+// the cursor, zR opens every fold and zM closes them all.
+func (ts *TermState) foldCommand(key byte) error {
+	fs, err := ts.startFolding()
+	if err != nil {
+		return err
+	}
+	// The innermost open fold and outermost closed fold under the cursor are the ones acted on.
+	open, closed := -1, -1
+	for i, f := range fs.folds {
+		if f.first > ts.cursorY || ts.cursorY > f.last {
+			continue
+		}
+		if f.closed && closed < 0 {
+			closed = i
+		}
+		if !f.closed && closed < 0 {
+			open = i
+		}
+	}
+
+	switch key {
+	case 'a':
+		if closed >= 0 {
+			return ts.foldCommand('o')
+		}
+		return ts.foldCommand('c')
+	case 'o':
+		if closed < 0 {
+			return fmt.Errorf("no closed fold under the cursor")
+		}
+		fs.folds[closed].closed = false
+	case 'c':
+		if open < 0 {
+			return fmt.Errorf("no fold under the cursor")
+		}
+		fs.folds[open].closed = true
+		ts.cursorY = ts.visibleRow(ts.cursorY)
+	case 'R', 'M':
+		for i := range fs.folds {
+			fs.folds[i].closed = key == 'M'
+		}
+		ts.cursorY = ts.visibleRow(ts.cursorY)
+	}
+	ts.clampCursorX()
+	return nil
+}
@@ -0,0 +1,116 @@
+package editor
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// formatWidth returns the width gq formats text to: textwidth, or if that's 0 72 columns for a
+// commit message and otherwise the width of the text area up to 79 columns.
+func (ts *TermState) formatWidth() int {
+	if ts.opts.textwidth > 0 {
+		return ts.opts.textwidth
+	}
+	if isCommitMessage(ts.buf.Filename) {
+		return commitBodyWidth
+	}
+	if _, width := ts.textArea(); width < 79 {
+		return width
+	}
+	return 79
+}
+
+// commentLeader returns the indent and any comment marker starting line, with the spaces after
+// them, such as "\t// ". Comment markers are known by the file's commentSyntaxes, and lines of
+// block comments may start with "*".
+func commentLeader(filename, line string) string {
+	rest := strings.TrimLeft(line, " \t")
+	n := len(line) - len(rest)
+	syntax, ok := commentSyntaxes[filepath.Ext(filename)]
+	if !ok {
+		syntax = commentSyntaxes[filepath.Base(filename)]
+	}
+	switch {
+	case syntax.line != "" && strings.HasPrefix(rest, syntax.line):
+		n += len(syntax.line)
+	case syntax.blockStart != "" && strings.HasPrefix(rest, "*") && !strings.HasPrefix(rest, syntax.block):
+		n++
+	default:
+		return line[:n]
+	}
+	return line[:len(line)-len(strings.TrimLeft(line[n:], " \t"))]
+}
+
+// formatLines rewraps the paragraphs in lines to fit in width columns where words allow. A
+// paragraph is a run of lines with the same comment leader, see commentLeader, and is refilled
+// with its first line's leader, and its second's for the rest of its lines, so hanging indents
+// are kept. Blank lines, and comment lines with nothing after the leader, separate paragraphs
+// and are kept as they are.
+func formatLines(filename string, lines []string, width int) []string {
+	var out []string
+	for i := 0; i < len(lines); {
+		lead := commentLeader(filename, lines[i])
+		if strings.TrimSpace(lines[i]) == strings.TrimSpace(lead) {
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		// Lines after the first continue the paragraph while they have the same comment marker.
+		marker := strings.TrimSpace(lead)
+		end := i + 1
+		for end < len(lines) {
+			next := commentLeader(filename, lines[end])
+			if strings.TrimSpace(next) != marker || strings.TrimSpace(lines[end]) == marker {
+				break
+			}
+			end++
+		}
+		restLead := lead
+		if end > i+1 {
+			restLead = commentLeader(filename, lines[i+1])
+		} else if marker == "" {
+			restLead = ""
+		}
+		if marker != "" && !strings.HasSuffix(lead, " ") {
+			lead, restLead = lead+" ", restLead+" "
+		}
+
+		var words []string
+		for _, line := range lines[i:end] {
+			words = append(words, strings.Fields(line[len(commentLeader(filename, line)):])...)
+		}
+		cur, curWords := lead, 0
+		for _, w := range words {
+			if curWords > 0 && utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(w) > width {
+				out = append(out, cur)
+				cur, curWords = restLead, 0
+			}
+			if curWords > 0 {
+				cur += " "
+			}
+			cur += w
+			curWords++
+		}
+		out = append(out, cur)
+		i = end
+	}
+	return out
+}
+
+// formatCommand is gq{motion}, rewrapping the lines the motion covers with formatLines. The
+// cursor is left at the start of the last line formatted.
+func (ts *TermState) formatCommand() error {
+	first, last, err := ts.lineMotion('q')
+	if err != nil {
+		return err
+	}
+	lines := formatLines(ts.buf.Filename, ts.buf.Lines(first, last+1), ts.formatWidth())
+	if err := ts.buf.SetLines(first, last+1, lines); err != nil {
+		return err
+	}
+	row := first + len(lines) - 1
+	line := ts.buf.Line(row)
+	ts.setCursor(row, len(line)-len(strings.TrimLeft(line, " \t")))
+	return nil
+}
@@ -0,0 +1,214 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// diffView is the panel opened by :Gdiff, showing an old version of a buffer's file beside it, or
+// in diff mode another buffer. Lines are aligned by adding filler rows to whichever side has none.
+type diffView struct {
+	buf         *buffer.Buffer
+	title       string         // Where the old text is from, as "HEAD:file"
+	from        *buffer.Buffer // In diff mode, the buffer old is read from
+	fromChanges int            // from's Changes when old was read
+	old         []string
+	changes     int // The buffer's Changes when the rows were aligned
+	hunks       []hunk
+	above       []int   // Old rows drawn before the first row, which deleted them
+	beside      []int   // The old row drawn beside each row, -1 if it was added
+	after       [][]int // Old rows drawn below each row, which deleted them
+	kind        []byte  // For each old row, 0 if it's unchanged, 'c' if changed or 'd' if deleted
+}
+
+// align diffs the buffer with the old text and lines them up.
+func (dv *diffView) align() {
+	lines := dv.buf.Lines(0, dv.buf.Len())
+	dv.hunks = diffLines(dv.old, lines)
+	dv.changes = dv.buf.Changes()
+	dv.above, dv.beside, dv.after = nil, make([]int, len(lines)), make([][]int, len(lines))
+	dv.kind = make([]byte, len(dv.old))
+	o, r := 0, 0
+	for _, h := range dv.hunks {
+		for ; r < h.newStart; r, o = r+1, o+1 {
+			dv.beside[r] = o
+		}
+		for i := 0; i < h.newLines; i, r = i+1, r+1 {
+			dv.beside[r] = -1
+			if i < h.oldLines {
+				dv.beside[r], dv.kind[o] = o, 'c'
+				o++
+			}
+		}
+		for i := h.newLines; i < h.oldLines; i, o = i+1, o+1 {
+			dv.kind[o] = 'd'
+			if r == 0 {
+				dv.above = append(dv.above, o)
+			} else {
+				dv.after[r-1] = append(dv.after[r-1], o)
+			}
+		}
+	}
+	for ; r < len(lines); r, o = r+1, o+1 {
+		dv.beside[r] = o
+	}
+}
+
+// diffView returns the :Gdiff panel if it's open on the current buffer, aligned with its text.
+func (ts *TermState) diffView() *diffView {
+	dv := ts.gdiff
+	if dv == nil || dv.buf != ts.buf {
+		return nil
+	}
+	if dv.from != nil && dv.fromChanges != dv.from.Changes() {
+		dv.old, dv.fromChanges, dv.changes = dv.from.Lines(0, dv.from.Len()), dv.from.Changes(), -1
+	}
+	if dv.changes != ts.buf.Changes() {
+		dv.align()
+	}
+	return dv
+}
+
+// diffWidth is the number of columns taken by the :Gdiff panel and its separator, half of those
+// beside the explorer and variables panel.
+func (ts *TermState) diffWidth() int {
+	if ts.diffView() == nil {
+		return 0
+	}
+	return (int(ts.winSize.Col) + 1 - ts.explorerWidth() - ts.variablesWidth()) / 2
+}
+
+// diffFillers returns how many filler rows are drawn above and below row, for old lines deleted
+// there.
+func (ts *TermState) diffFillers(row int) (above, below int) {
+	dv := ts.diffView()
+	if dv == nil || row >= len(dv.after) {
+		return 0, 0
+	}
+	if _, ok := ts.closedFold(row); ok {
+		return 0, 0
+	}
+	if row == 0 {
+		above = len(dv.above)
+	}
+	return above, len(dv.after[row])
+}
+
+// diffPart returns which wrapped part of row's text is drawn on its screen row part, -1 on a
+// filler row, and the old row drawn beside it in the :Gdiff panel, -1 if there's none.
+func (ts *TermState) diffPart(row, part int) (int, int) {
+	dv := ts.diffView()
+	if dv == nil || row >= len(dv.beside) {
+		return part, -1
+	}
+	above, _ := ts.diffFillers(row)
+	if part < above {
+		return -1, dv.above[part]
+	}
+	part -= above
+	height := ts.rowHeight(row) - above - len(dv.after[row])
+	switch {
+	case part == 0:
+		return 0, dv.beside[row]
+	case part < height:
+		return part, -1
+	default:
+		return -1, dv.after[row][part-height]
+	}
+}
+
+// drawDiffRow writes screen row i of the :Gdiff panel, with the old line beside part of row.
+func (ts *TermState) drawDiffRow(i, row, part int) {
+	dv := ts.diffView()
+	width := ts.diffWidth() - 1
+	numWidth := len(strconv.Itoa(len(dv.old)))
+	f, folded := ts.closedFold(row)
+	if row < ts.buf.Len() {
+		switch textPart, old := ts.diffPart(row, part); {
+		case folded:
+			if first, n := dv.oldRows(f); n > 0 {
+				fmt.Fprintf(ts.w, "%s%*d%s ", render.ColorCode(render.Faint), numWidth, first+1,
+					render.ColorCode(render.Reset))
+				ts.writeFoldText(n, dv.old[first], width-numWidth-1)
+			} else {
+				ts.writeDiffFiller(width)
+			}
+		case old >= 0:
+			fmt.Fprintf(ts.w, "%s%*d%s ", render.ColorCode(render.Faint), numWidth, old+1,
+				render.ColorCode(render.Reset))
+			var spans []textSpan
+			switch dv.kind[old] {
+			case 'c':
+				spans = []textSpan{{0, len(dv.old[old]), render.ColorCode(render.FgYellow)}}
+			case 'd':
+				spans = []textSpan{{0, len(dv.old[old]), render.ColorCode(render.FgRed)}}
+			}
+			ts.writeText(dv.old[old], 0, width-numWidth-1, spans)
+		case textPart == 0:
+			// The row was added.
+			ts.writeDiffFiller(width)
+		}
+	}
+	fmt.Fprintf(ts.w, "%c%c%d;%dH", render.EscapeChar, render.EscapeSeqBegin, i+1,
+		ts.explorerWidth()+width+1)
+	fmt.Fprintf(ts.w, "%s|%s", render.ColorCode(render.Faint), render.ColorCode(render.Reset))
+}
+
+// oldRows returns the first of the old rows beside the rows of fold f, and how many there are.
+func (dv *diffView) oldRows(f fold) (first, n int) {
+	add := func(row int) {
+		if n == 0 {
+			first = row
+		}
+		n++
+	}
+	for row := f.first; row <= f.last; row++ {
+		if row == 0 {
+			for _, o := range dv.above {
+				add(o)
+			}
+		}
+		if dv.beside[row] >= 0 {
+			add(dv.beside[row])
+		}
+		for _, o := range dv.after[row] {
+			add(o)
+		}
+	}
+	return first, n
+}
+
+// writeDiffFiller fills width columns of a row with nothing beside it in the other version.
+func (ts *TermState) writeDiffFiller(width int) {
+	fmt.Fprintf(ts.w, "%s%s%s", render.ColorCode(render.Faint), strings.Repeat("-", width),
+		render.ColorCode(render.Reset))
+}
+
+// cmdGdiff is :Gdiff [revision], showing the file as of revision, HEAD by default, beside the
+// buffer to review changes, or closing it if it's open.
+func cmdGdiff(ts *TermState, a exArgs) error {
+	if ts.gdiff != nil && a.arg == "" {
+		ts.gdiff = nil
+		return nil
+	}
+	dir, file, ok := gitFile(ts.buf)
+	if !ok {
+		return fmt.Errorf("%s can't be diffed with git", ts.buf.Name())
+	}
+	rev := a.arg
+	if rev == "" {
+		rev = "HEAD"
+	}
+	old, err := gitShow(dir, rev+":"+file, ts.buf.Format)
+	if err != nil {
+		return err
+	}
+	ts.gdiff = &diffView{buf: ts.buf, title: rev + ":" + filepath.Base(file), old: old, changes: -1}
+	ts.statusMsg = ts.gdiff.title
+	return nil
+}
@@ -0,0 +1,251 @@
+package editor
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// gitInterval is how long git signs are kept before the index is read again, in case it has been
+// changed outside the editor.
+const gitInterval = 5 * time.Second
+
+// gitState is how a buffer differs from its file in the git index.
+type gitState struct {
+	hunks   []hunk
+	tracked bool      // The file is in the index
+	changes int       // The buffer's Changes when hunks were found
+	updated time.Time // When hunks were found
+	running bool      // The index is being read and diffed in the background
+}
+
+// gitFile returns the directory to run git in for b and the path of its file there, or false if
+// it can't be in a git repository. Only UTF-8 text can be compared with what git stores.
+func gitFile(b *buffer.Buffer) (string, string, bool) {
+	if b.Filename == "" || buffer.IsRemote(b.Filename) || b.BrowseDir != "" || b.Hex || b.LargeFile ||
+		b.Encoding != buffer.EncodingUTF8 || b.BOM {
+		return "", "", false
+	}
+	if _, loading := b.LoadProgress(); loading {
+		return "", "", false
+	}
+	path := absPath(b.Filename)
+	return filepath.Dir(path), "./" + filepath.Base(path), true
+}
+
+// gitHunks returns how the current buffer differs from the git index, as last found, and whether
+// its file is tracked. If the buffer has changed since, or the signs are old, they're found again
+// in the background and drawn when ready.
+func (ts *TermState) gitHunks() ([]hunk, bool) {
+	dir, file, ok := gitFile(ts.buf)
+	if !ts.opts.gitsigns || !ok {
+		return nil, false
+	}
+	gs := ts.git[ts.buf]
+	if gs == nil {
+		gs = &gitState{changes: -1}
+		ts.git[ts.buf] = gs
+	}
+	if !gs.running && (gs.changes != ts.buf.Changes() || time.Since(gs.updated) > gitInterval) {
+		gs.running = true
+		b, lines, changes := ts.buf, ts.buf.Lines(0, ts.buf.Len()), ts.buf.Changes()
+		go func() {
+			index, err := gitShow(dir, ":"+file, b.Format)
+			var hunks []hunk
+			if err == nil {
+				hunks = diffLines(index, lines)
+			}
+			ts.events <- func() {
+				gs.hunks, gs.tracked, gs.changes, gs.updated = hunks, err == nil, changes, time.Now()
+				gs.running = false
+			}
+		}()
+	}
+	if gs.changes != ts.buf.Changes() {
+		// Signs for an older version would be on the wrong rows.
+		return nil, gs.tracked
+	}
+	return gs.hunks, gs.tracked
+}
+
+// gitRun runs git with args in dir, with input on its stdin, and returns what it prints. If it
+// fails the error is what it printed to stderr, on one line.
+func gitRun(dir, input string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		msg := strings.TrimSpace(string(ee.Stderr))
+		return "", fmt.Errorf("%s", strings.ReplaceAll(msg, "\n", "; "))
+	}
+	return string(out), err
+}
+
+// gitShow returns the lines of a git object, such as ":./file" for a file in the index, reading
+// lines ending as format does.
+func gitShow(dir, object, format string) ([]string, error) {
+	text, err := gitRun(dir, "", "show", object)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case buffer.FormatDOS:
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	case buffer.FormatMac:
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n"), nil
+}
+
+// gitSigns adds signs for lines added (+), changed (~) and removed (_) since the git index. A
+// removed line's sign is on the line above it.
+func gitSigns(signs map[int]sign, hunks []hunk) {
+	for _, h := range hunks {
+		if h.newLines == 0 {
+			row := h.newStart - 1
+			if row < 0 {
+				row = 0
+			}
+			signs[row] = sign{"_ ", render.FgRed}
+			continue
+		}
+		for i := 0; i < h.newLines; i++ {
+			if i < h.oldLines {
+				signs[h.newStart+i] = sign{"~ ", render.FgYellow}
+			} else {
+				signs[h.newStart+i] = sign{"+ ", render.FgGreen}
+			}
+		}
+	}
+}
+
+// hunkAt returns the hunk with its sign on row, as placed by gitSigns.
+func hunkAt(hunks []hunk, row int) (hunk, bool) {
+	for _, h := range hunks {
+		first, last := h.newStart, h.newStart+h.newLines-1
+		if h.newLines == 0 {
+			first--
+			if first < 0 {
+				first = 0
+			}
+			last = first
+		}
+		if row >= first && row <= last {
+			return h, true
+		}
+	}
+	return hunk{}, false
+}
+
+// cursorHunk returns the git version of the current buffer's file in object, such as ":" for the
+// index or "HEAD:", and the change from it on the cursor row.
+func (ts *TermState) cursorHunk(object string) ([]string, hunk, error) {
+	dir, file, ok := gitFile(ts.buf)
+	if !ok {
+		return nil, hunk{}, fmt.Errorf("%s can't be diffed with git", ts.buf.Name())
+	}
+	old, err := gitShow(dir, object+file, ts.buf.Format)
+	if err != nil {
+		return nil, hunk{}, err
+	}
+	h, ok := hunkAt(diffLines(old, ts.buf.Lines(0, ts.buf.Len())), ts.cursorY)
+	if !ok {
+		return nil, hunk{}, fmt.Errorf("no change on this line")
+	}
+	return old, h, nil
+}
+
+// cmdStageHunk is :StageHunk, adding the change on the cursor row to the git index, so it's in
+// the next commit without the rest of the file's changes.
+func cmdStageHunk(ts *TermState, a exArgs) error {
+	index, h, err := ts.cursorHunk(":")
+	if err != nil {
+		return err
+	}
+	lines := append([]string{}, index[:h.oldStart]...)
+	lines = append(lines, ts.buf.Lines(h.newStart, h.newStart+h.newLines)...)
+	lines = append(lines, index[h.oldStart+h.oldLines:]...)
+	eol := "\n"
+	switch ts.buf.Format {
+	case buffer.FormatDOS:
+		eol = "\r\n"
+	case buffer.FormatMac:
+		eol = "\r"
+	}
+	text := strings.Join(lines, eol)
+	if !ts.buf.NoEOL {
+		text += eol
+	}
+
+	dir, file, _ := gitFile(ts.buf)
+	entry, err := gitRun(dir, "", "ls-files", "--stage", "--", file)
+	if err != nil {
+		return err
+	}
+	mode := strings.Fields(entry)[0]
+	blob, err := gitRun(dir, text, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return err
+	}
+	// update-index takes paths without a leading ./
+	_, err = gitRun(dir, "", "update-index", "--cacheinfo",
+		mode+","+strings.TrimSpace(blob)+","+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	// The signs are found again against the new index.
+	delete(ts.git, ts.buf)
+	ts.statusMsg = "Hunk staged"
+	return nil
+}
+
+// cmdRevertHunk is :RevertHunk, putting back the lines on the cursor row as they were in HEAD.
+func cmdRevertHunk(ts *TermState, a exArgs) error {
+	head, h, err := ts.cursorHunk("HEAD:")
+	if err != nil {
+		return err
+	}
+	old := head[h.oldStart : h.oldStart+h.oldLines]
+	if err := ts.buf.SetLines(h.newStart, h.newStart+h.newLines, old); err != nil {
+		return err
+	}
+	ts.setCursor(h.newStart, 0)
+	return nil
+}
+
+// nextHunk is ]c and [c, moving the cursor to the start of the next or previous changed lines.
+func (ts *TermState) nextHunk(forward bool) error {
+	hunks, tracked := ts.gitHunks()
+	if dv := ts.diffView(); dv != nil {
+		// The changes shown beside the buffer, in diff mode or :Gdiff.
+		hunks, tracked = dv.hunks, true
+	}
+	if !tracked {
+		return fmt.Errorf("%s is not in a git repository", ts.buf.Name())
+	}
+	row := -1
+	for _, h := range hunks {
+		start := h.newStart
+		if h.newLines == 0 && start > 0 {
+			start--
+		}
+		if forward && start > ts.cursorY {
+			row = start
+			break
+		}
+		if !forward && start < ts.cursorY {
+			row = start
+		}
+	}
+	if row < 0 {
+		return fmt.Errorf("no more changes")
+	}
+	ts.setCursor(row, 0)
+	return nil
+}
@@ -0,0 +1,134 @@
+package editor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// isFileNameByte reports whether c can be part of a file name found under the cursor by gf.
+func isFileNameByte(c byte) bool {
+	return isKeywordByte(c) || strings.IndexByte("/.-+#$%~=@\\", c) >= 0
+}
+
+// fileNameAt returns the file name at or after column x of line, without a full stop ending it.
+func fileNameAt(line string, x int) string {
+	for x < len(line) && !isFileNameByte(line[x]) {
+		x++
+	}
+	start, end := x, x
+	for start > 0 && isFileNameByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isFileNameByte(line[end]) {
+		end++
+	}
+	return strings.TrimRight(line[start:end], ".")
+}
+
+// findInPath returns the file name refers to, looked for in the directories of the path option:
+// "." is the current file's directory, an empty entry the current directory, and a directory
+// ending in /** is searched with all those below it. Absolute names and those starting ./ or ../
+// are only looked for from the current file's directory.
+func (ts *TermState) findInPath(name string) (string, bool) {
+	if strings.HasPrefix(name, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			name = filepath.Join(home, name[2:])
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	fileDir := "."
+	if ts.buf.Filename != "" {
+		fileDir = filepath.Dir(ts.buf.Filename)
+	}
+	if filepath.IsAbs(name) {
+		return name, exists(name)
+	}
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		path := filepath.Join(fileDir, name)
+		return path, exists(path)
+	}
+
+	for _, dir := range strings.Split(ts.opts.path, ",") {
+		dir = strings.TrimSpace(dir)
+		switch {
+		case dir == ".":
+			dir = fileDir
+		case dir == "":
+			dir = "."
+		case strings.HasSuffix(dir, "/**"):
+			if path, ok := findBelow(strings.TrimSuffix(dir, "/**"), name); ok {
+				return path, true
+			}
+			continue
+		}
+		if path := filepath.Join(dir, name); exists(path) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// findBelow returns the first file called name, which may include directories, in dir or any
+// directory below it. Hidden directories, such as .git, aren't searched.
+func findBelow(dir, name string) (string, bool) {
+	found := ""
+	suffix := string(filepath.Separator) + filepath.Clean(name)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || found != "" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if strings.HasSuffix(string(filepath.Separator)+path, suffix) {
+			found = path
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, found != ""
+}
+
+// goPackageDir returns the directory of the Go package with import path name, as go list finds
+// it from the current file's module, so standard library, dependency and vendored packages are
+// all found.
+func (ts *TermState) goPackageDir(name string) (string, bool) {
+	if filepath.Ext(ts.buf.Filename) != ".go" || strings.HasPrefix(name, "-") {
+		return "", false
+	}
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", name)
+	cmd.Dir = filepath.Dir(ts.buf.Filename)
+	out, err := cmd.Output()
+	dir := strings.TrimSpace(string(out))
+	if err != nil || dir == "" {
+		return "", false
+	}
+	return dir, true
+}
+
+// gotoFile is gf, and Ctrl-W f as zi has only one window, opening the file named under the
+// cursor. Go import paths open a listing of the package's directory.
+func (ts *TermState) gotoFile() error {
+	if ts.cursorY >= ts.buf.Len() {
+		return fmt.Errorf("no file name under cursor")
+	}
+	name := fileNameAt(ts.buf.Line(ts.cursorY), ts.cursorX)
+	if name == "" {
+		return fmt.Errorf("no file name under cursor")
+	}
+	path, ok := ts.findInPath(name)
+	if !ok {
+		path, ok = ts.goPackageDir(name)
+	}
+	if !ok {
+		return fmt.Errorf("can't find file %q in path", name)
+	}
+	return ts.openFile(path)
+}
@@ -0,0 +1,111 @@
+package editor
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// spinnerFrames animate the status bar while a background build runs.
+const spinnerFrames = `|/-\`
+
+// backgroundBuild is a go command running without blocking the editor.
+type backgroundBuild struct {
+	name    string
+	cmd     *exec.Cmd
+	started time.Time
+}
+
+// spinner returns the status bar indicator for a running build.
+func (b *backgroundBuild) spinner() string {
+	frame := int(time.Since(b.started)/(100*time.Millisecond)) % len(spinnerFrames)
+	return fmt.Sprintf("[%s %c]", b.name, spinnerFrames[frame])
+}
+
+// runGoCommand runs go with args in dir in the background, filling the quickfix list with any
+// errors when it finishes. Only one build runs at a time.
+func (ts *TermState) runGoCommand(name, dir string, args ...string) error {
+	if ts.build != nil {
+		return fmt.Errorf("%s is still running", ts.build.name)
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	b := &backgroundBuild{name: name, cmd: cmd, started: time.Now()}
+
+	var out strings.Builder
+	collect := func(line string) {
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	var spin *timer
+	_, err := ts.startJob(name, cmd, jobCallbacks{
+		onStdout: collect,
+		onStderr: collect,
+		onExit: func(err error) {
+			ts.stopTimer(spin)
+			ts.finishGoCommand(b, out.String(), err)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ts.build = b
+	// Redraw regularly so the spinner moves, timers have nothing to do as the main loop redraws
+	// after running them.
+	spin = ts.startTimer(100*time.Millisecond, true, name+" spinner", func() {})
+	return nil
+}
+
+// finishGoCommand reports the result of a background build, listing its errors in the quickfix
+// window without moving the cursor.
+func (ts *TermState) finishGoCommand(b *backgroundBuild, out string, err error) {
+	ts.build = nil
+
+	formats, efmErr := parseErrorFormats(goErrorFormat)
+	if efmErr != nil {
+		ts.statusMsg = efmErr.Error()
+		return
+	}
+	qf := &ts.quickfix
+	ts.resetList(qf, fmt.Sprintf("%s (%s)", b.name, strings.Join(b.cmd.Args, " ")))
+	for _, e := range parseErrors(out, formats) {
+		// Paths are relative to where go ran.
+		if !filepath.IsAbs(e.filename) {
+			e.filename = filepath.Join(b.cmd.Dir, e.filename)
+		}
+		qf.entries = append(qf.entries, e)
+	}
+
+	elapsed := time.Since(b.started).Round(100 * time.Millisecond)
+	switch {
+	case len(qf.entries) > 0:
+		ts.statusMsg = fmt.Sprintf("%s: %d errors in %v", b.name, len(qf.entries), elapsed)
+		if ts.qfWin.list != qf {
+			ts.qfWin = quickfixWindow{list: qf}
+		}
+	case err != nil:
+		ts.statusMsg = fmt.Sprintf("%s failed: %v", b.name, err)
+	default:
+		ts.statusMsg = fmt.Sprintf("%s: ok in %v", b.name, elapsed)
+	}
+}
+
+// cmdGoBuild builds every package in the module in the background.
+func cmdGoBuild(ts *TermState, a exArgs) error {
+	args := append([]string{"build"}, strings.Fields(a.arg)...)
+	return ts.runGoCommand("GoBuild", ".", append(args, "./...")...)
+}
+
+// cmdGoTest tests the package containing the current file in the background, or every package
+// in the module with a bang. Any arguments, such as -run, are passed to go test.
+func cmdGoTest(ts *TermState, a exArgs) error {
+	dir, pkg := ".", "./..."
+	if !a.bang && ts.buf.Filename != "" && ts.buf.BrowseDir == "" {
+		dir, pkg = filepath.Dir(ts.buf.Filename), "."
+	}
+	args := append([]string{"test"}, strings.Fields(a.arg)...)
+	return ts.runGoCommand("GoTest", dir, append(args, pkg)...)
+}
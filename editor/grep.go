@@ -0,0 +1,108 @@
+package editor
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// grepCommand returns the search command to run for :Grep, preferring ripgrep, and whether its
+// output includes a column number.
+func grepCommand(pattern string, paths []string) (*exec.Cmd, bool) {
+	if _, err := exec.LookPath("rg"); err == nil {
+		args := append([]string{"--vimgrep", "--no-heading", "--", pattern}, paths...)
+		return exec.Command("rg", args...), true
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	args := append([]string{"-rnHI", "--", pattern}, paths...)
+	return exec.Command("grep", args...), false
+}
+
+// parseGrepLine parses a file:line[:col]:text match, as output by grep -n or rg --vimgrep.
+func parseGrepLine(line string, hasCol bool) (qfEntry, bool) {
+	n := 3
+	if hasCol {
+		n = 4
+	}
+	parts := strings.SplitN(line, ":", n)
+	if len(parts) < n {
+		return qfEntry{}, false
+	}
+
+	e := qfEntry{filename: parts[0], text: parts[n-1]}
+	row, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return qfEntry{}, false
+	}
+	e.row = row - 1
+	if hasCol {
+		col, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return qfEntry{}, false
+		}
+		e.col = col - 1
+	}
+	return e, true
+}
+
+// grep searches for a pattern in the background, filling qf with matches as they arrive. The
+// first argument is the pattern and any others are paths to search. With a bang the matches are
+// also shown in a picker, which updates as the search runs.
+func (ts *TermState) grep(qf *quickfixList, a exArgs) error {
+	fields := strings.Fields(a.arg)
+	if len(fields) == 0 {
+		return fmt.Errorf("usage: Grep {pattern} [path ...]")
+	}
+	pattern, paths := fields[0], fields[1:]
+
+	cmd, hasCol := grepCommand(pattern, paths)
+
+	// Only one job fills a list at a time, a new search replaces the old.
+	title := "Grep " + a.arg
+	ts.resetList(qf, title)
+	var p *picker
+
+	var j *job
+	add := func(line string) {
+		e, ok := parseGrepLine(line, hasCol)
+		// Results from an older search may still be arriving.
+		if !ok || qf.job != j {
+			return
+		}
+		qf.entries = append(qf.entries, e)
+		if p != nil {
+			i := len(qf.entries) - 1
+			label := fmt.Sprintf("%s:%d: %s", e.filename, e.row+1, strings.TrimSpace(e.text))
+			p.items = append(p.items, pickerItem{label, func() error { return ts.jumpToEntry(qf, i) }})
+			selected := p.selected
+			p.filter()
+			p.selected = selected
+		}
+		ts.statusMsg = fmt.Sprintf("%s: %d matches so far", title, len(qf.entries))
+	}
+	finish := func(err error) {
+		if qf.job != j {
+			return
+		}
+		qf.job = nil
+		ts.statusMsg = fmt.Sprintf("%s: %d matches", title, len(qf.entries))
+		// grep and rg exit 1 when nothing matches, which isn't worth reporting as an error.
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 1 {
+			ts.statusMsg = fmt.Sprintf("%s: %v", title, err)
+		}
+	}
+
+	j, err := ts.startJob("grep", cmd, jobCallbacks{onStdout: add, onExit: finish})
+	if err != nil {
+		return err
+	}
+	qf.job = j
+	if a.bang {
+		p = &picker{title: title}
+		ts.picker = p
+	}
+	return nil
+}
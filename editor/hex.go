@@ -0,0 +1,36 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// cmdHex is :hex, switching the buffer to and from a hex dump of the file's bytes. Bytes are
+// edited by changing the hex digits, R replaces them in place; the ASCII column is only for
+// reading, and is redrawn when the buffer is written.
+func cmdHex(ts *TermState, a exArgs) error {
+	if err := ts.buf.SetHex(!ts.buf.Hex); err != nil {
+		return err
+	}
+	ts.hexChanged()
+	return nil
+}
+
+// hexChanged updates the view after the buffer's text was replaced by switching hex on or off.
+func (ts *TermState) hexChanged() {
+	ts.lineNumWidth = len(strconv.Itoa(ts.buf.Len()))
+	ts.setCursor(ts.cursorY, ts.cursorX)
+}
+
+// refreshHex redraws a hex dump from its hex digits after it's written, so the offsets and ASCII
+// column match the bytes in the file.
+func (ts *TermState) refreshHex() {
+	if !ts.buf.Hex {
+		return
+	}
+	if err := ts.buf.SetHex(true); err != nil {
+		ts.statusMsg = fmt.Sprintf("hex: %v", err)
+		return
+	}
+	ts.hexChanged()
+}
@@ -0,0 +1,129 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// fileInfo is the message shown by Ctrl-G and :file, describing the buffer and how far through
+// it the cursor is.
+func (ts *TermState) fileInfo() string {
+	b := ts.buf
+	msg := fmt.Sprintf("%q", b.Name())
+	if b.NotEdited {
+		msg += " [Not edited]"
+	}
+	if b.NewFile {
+		msg += " [New]"
+	}
+	if b.ReadOnly {
+		msg += " [readonly]"
+	}
+	if b.Modified {
+		msg += " [Modified]"
+	}
+	n := b.Len()
+	switch n {
+	case 0:
+		return msg + " --No lines in buffer--"
+	case 1:
+		return msg + " 1 line --100%--"
+	}
+	return msg + fmt.Sprintf(" %d lines --%d%%--", n, (ts.cursorY+1)*100/n)
+}
+
+// wordCount is the message shown by g Ctrl-G, counting the columns, lines, words, characters and
+// bytes in the buffer and how many of each come before the cursor, as vim does. Bytes include
+// line endings.
+func (ts *TermState) wordCount() string {
+	b := ts.buf
+	if b.Len() == 0 {
+		return "--No lines in buffer--"
+	}
+	eol := 1
+	if b.Format == buffer.FormatDOS {
+		eol = 2
+	}
+
+	var words, chars, bytes int
+	var curWord, curChar, curByte int
+	for row := 0; row < b.Len(); row++ {
+		line := b.Line(row)
+		inWord := false
+		for i, r := range line {
+			if row == ts.cursorY && i == ts.cursorX {
+				curWord, curChar, curByte = words, chars+1, bytes+i+1
+				if !unicode.IsSpace(r) && !inWord {
+					curWord++
+				}
+			}
+			if unicode.IsSpace(r) {
+				inWord = false
+			} else if !inWord {
+				inWord = true
+				words++
+			}
+			chars++
+		}
+		if row == ts.cursorY && ts.cursorX >= len(line) {
+			curWord, curChar, curByte = words, chars, bytes+len(line)
+		}
+		bytes += len(line)
+		if row < b.Len()-1 || !b.NoEOL {
+			chars++
+			bytes += eol
+		}
+	}
+
+	line := b.Line(ts.cursorY)
+	col := utf8.RuneCountInString(line[:ts.cursorX]) + 1
+	return fmt.Sprintf("Col %d of %d; Line %d of %d; Word %d of %d; Char %d of %d; Byte %d of %d",
+		col, utf8.RuneCountInString(line), ts.cursorY+1, b.Len(), curWord, words,
+		curChar, chars, curByte, bytes)
+}
+
+// charInfo is the message shown by ga, giving the character under the cursor in decimal, hex and
+// octal and the bytes of its UTF-8 encoding, followed by any combining characters on it.
+func (ts *TermState) charInfo() string {
+	if ts.cursorY >= ts.buf.Len() || ts.cursorX >= len(ts.buf.Line(ts.cursorY)) {
+		return "NUL"
+	}
+	line := ts.buf.Line(ts.cursorY)
+	x := ts.cursorX
+	for x > 0 && !utf8.RuneStart(line[x]) {
+		x--
+	}
+	r, n := utf8.DecodeRuneInString(line[x:])
+	if r == utf8.RuneError && n == 1 {
+		return fmt.Sprintf("<%02x> %d, Hex %02x, Oct %03o, invalid UTF-8", line[x], line[x], line[x], line[x])
+	}
+	infos := []string{ts.runeInfo(line[x:], r, n)}
+	for x += n; x < len(line); x += n {
+		if r, n = utf8.DecodeRuneInString(line[x:]); !unicode.Is(unicode.Mn, r) {
+			break
+		}
+		infos = append(infos, ts.runeInfo(line[x:], r, n))
+	}
+	return strings.Join(infos, " ")
+}
+
+// runeInfo describes the character r, n bytes at the start of text, for charInfo.
+func (ts *TermState) runeInfo(text string, r rune, n int) string {
+	hex := "%02x"
+	switch {
+	case r > 0xffff:
+		hex = "%08x"
+	case r > 0xff:
+		hex = "%04x"
+	}
+	shown := ts.displayChar(text, r, n)
+	// Combining characters are shown on a space, as they have nothing to combine with.
+	if unicode.Is(unicode.Mn, r) {
+		shown = " " + shown
+	}
+	return fmt.Sprintf("<%s> %d, Hex "+hex+", Oct %o, UTF-8 % x", shown, r, r, r, text[:n])
+}
@@ -0,0 +1,155 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// job is an external process running in the background. Its output is passed to the main loop a
+// line at a time, so callbacks can update editor state without locking.
+type job struct {
+	id      int
+	name    string
+	cmd     *exec.Cmd
+	started time.Time
+	service bool // Runs alongside the editor, like a plugin, rather than finishing a command
+}
+
+// jobCallbacks are called on the main goroutine as a job runs. Any of them may be nil.
+type jobCallbacks struct {
+	onStdout func(line string)
+	onStderr func(line string)
+	onExit   func(err error) // err is as returned by exec.Cmd.Wait, nil if the job succeeded
+}
+
+// startJob starts cmd, which must not have been started or had its output set, and calls back
+// with each line it writes and when it exits. The job is listed by :jobs until it exits.
+func (ts *TermState) startJob(name string, cmd *exec.Cmd, cb jobCallbacks) (*job, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	ts.lastJobID++
+	j := &job{id: ts.lastJobID, name: name, cmd: cmd, started: time.Now()}
+	ts.jobs[j.id] = j
+
+	var wg sync.WaitGroup
+	readLines := func(r io.Reader, fn func(string)) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if fn != nil {
+				line := scanner.Text()
+				ts.events <- func() { fn(line) }
+			}
+		}
+		// Drain whatever is left, so the process isn't blocked writing to a full pipe.
+		io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go readLines(stdout, cb.onStdout)
+	go readLines(stderr, cb.onStderr)
+
+	go func() {
+		// All output must be read before Wait closes the pipes.
+		wg.Wait()
+		err := cmd.Wait()
+		ts.events <- func() {
+			delete(ts.jobs, j.id)
+			if cb.onExit != nil {
+				cb.onExit(err)
+			}
+		}
+	}()
+	return j, nil
+}
+
+// stopJob kills j if it is still running. Its exit callback is still called.
+func (ts *TermState) stopJob(j *job) {
+	if j == nil || ts.jobs[j.id] != j {
+		return
+	}
+	j.cmd.Process.Kill()
+}
+
+// stopAllJobs kills every running job, so none outlive the editor.
+func (ts *TermState) stopAllJobs() {
+	for _, j := range ts.jobs {
+		ts.stopJob(j)
+	}
+}
+
+// waitJobs runs events until the jobs from id on have exited, other than services. Headless
+// editors have no main loop, so this is what finishes a command such as :make.
+func (ts *TermState) waitJobs(id int) {
+	for {
+		running := false
+		for _, j := range ts.jobs {
+			running = running || j.id >= id && !j.service
+		}
+		if !running {
+			break
+		}
+		(<-ts.events)()
+	}
+	// Run anything else that's waiting, so services aren't blocked on a full channel.
+	for {
+		select {
+		case fn := <-ts.events:
+			fn()
+		default:
+			return
+		}
+	}
+}
+
+// cmdJobs lists the running jobs.
+func cmdJobs(ts *TermState, a exArgs) error {
+	if len(ts.jobs) == 0 {
+		return fmt.Errorf("no running jobs")
+	}
+	ids := make([]int, 0, len(ts.jobs))
+	for id := range ts.jobs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		j := ts.jobs[id]
+		elapsed := time.Since(j.started).Round(time.Second)
+		lines = append(lines, fmt.Sprintf("%3d %-10s %8v  %s", j.id, j.name, elapsed,
+			strings.Join(j.cmd.Args, " ")))
+	}
+	ts.msgLines = lines
+	return nil
+}
+
+// cmdJobStop kills the job with the given id.
+func cmdJobStop(ts *TermState, a exArgs) error {
+	id, err := strconv.Atoi(a.arg)
+	if err != nil {
+		return fmt.Errorf("usage: jobstop {id}")
+	}
+	j, ok := ts.jobs[id]
+	if !ok {
+		return fmt.Errorf("no job %d", id)
+	}
+	ts.stopJob(j)
+	return nil
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHeadlessMake(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("f.txt", []byte("one\ntwo\nthree\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// More output than fits in the events channel, so the job can't finish unless it's drained.
+	var errs strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&errs, "f.txt:%d:1: bad\n", 2+i%2)
+	}
+	if err := os.WriteFile("errors.txt", []byte(errs.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts, err := NewHeadless("f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.stopAllJobs()
+	for _, command := range []string{`set makeprg=cat\ errors.txt`, "make", "cn"} {
+		if _, err := ts.RunCommand(command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+	}
+	if row, _ := ts.Cursor(); row != 2 {
+		t.Errorf("cursor on row %d after :make and :cn, want 2", row)
+	}
+	if len(ts.jobs) != 0 {
+		t.Errorf("%d jobs still running", len(ts.jobs))
+	}
+}
@@ -0,0 +1,85 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// maxJumps is how many positions the jumplist keeps, the oldest are dropped first.
+const maxJumps = 100
+
+// jump is a position in the jumplist.
+type jump struct {
+	buf *buffer.Buffer
+	pos buffer.Position
+}
+
+// pushJump records the cursor position in the jumplist before a jump away from it: to a line
+// number, a mark, a tag, a quickfix entry or another buffer. An older entry for the same line is
+// replaced, and going back with Ctrl-O then starts from the newest entry.
+func (ts *TermState) pushJump() {
+	if ts.buf == nil || !ts.isListed(ts.buf) {
+		return
+	}
+	jumps := ts.jumps[:0]
+	for _, j := range ts.jumps {
+		if j.buf != ts.buf || j.pos.Row != ts.cursorY {
+			jumps = append(jumps, j)
+		}
+	}
+	jumps = append(jumps, jump{buf: ts.buf, pos: buffer.Position{Row: ts.cursorY, Col: ts.cursorX}})
+	if len(jumps) > maxJumps {
+		jumps = jumps[len(jumps)-maxJumps:]
+	}
+	ts.jumps, ts.jumpIndex = jumps, len(jumps)
+}
+
+// isListed reports whether b is still in the buffer list.
+func (ts *TermState) isListed(b *buffer.Buffer) bool {
+	for _, other := range ts.buffers {
+		if other == b {
+			return true
+		}
+	}
+	return false
+}
+
+// dropJumps removes the jumplist entries in b, when it's closed.
+func (ts *TermState) dropJumps(b *buffer.Buffer) {
+	jumps := ts.jumps[:0]
+	for i, j := range ts.jumps {
+		if j.buf != b {
+			jumps = append(jumps, j)
+		} else if i < ts.jumpIndex {
+			ts.jumpIndex--
+		}
+	}
+	ts.jumps = jumps
+}
+
+// moveInJumplist is Ctrl-O, going back count positions in the jumplist, and Ctrl-I, going
+// forward again, switching buffers if need be.
+func (ts *TermState) moveInJumplist(count int) error {
+	if ts.jumpIndex == len(ts.jumps) && count < 0 {
+		// Leaving the end of the list, so remember where to come back to with Ctrl-I.
+		ts.pushJump()
+		ts.jumpIndex--
+	}
+	i := ts.jumpIndex + count
+	if i < 0 {
+		return fmt.Errorf("at start of jumplist")
+	}
+	if i >= len(ts.jumps) {
+		return fmt.Errorf("at end of jumplist")
+	}
+	j := ts.jumps[i]
+	ts.jumpIndex = i
+	if j.buf != ts.buf {
+		// Not switchBuffer, which would record this as a new jump.
+		ts.displayBuffer(j.buf)
+		ts.doAutocmd("BufEnter", j.buf.Filename)
+	}
+	ts.setCursor(j.pos.Row, j.pos.Col)
+	return nil
+}
@@ -0,0 +1,23 @@
+package editor
+
+import (
+	"fmt"
+)
+
+// defineCommand adds a user command, which like in vim must start with a capital letter so it
+// can't clash with builtin commands added later.
+func (ts *TermState) defineCommand(name string, cmd exCommand) error {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return fmt.Errorf("user command must start with an uppercase letter: %s", name)
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLetter(name[i]) {
+			return fmt.Errorf("bad command name: %s", name)
+		}
+	}
+	if _, ok := exCommands[name]; ok {
+		return fmt.Errorf("%s is a builtin command", name)
+	}
+	ts.userCommands[name] = cmd
+	return nil
+}
@@ -0,0 +1,107 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// keywordPrograms look up words with K in files with these extensions, when keywordprg is
+// empty. Other files use man.
+var keywordPrograms = map[string]string{
+	".go": "go doc",
+	".py": "python3 -m pydoc",
+}
+
+// overstrike matches the backspaced characters man uses for bold and underlined text.
+var overstrike = regexp.MustCompile(".\b")
+
+// keywordProgram returns the command K runs, with the word looked up as its last argument.
+func (ts *TermState) keywordProgram() string {
+	if ts.opts.keywordprg != "" {
+		return ts.opts.keywordprg
+	}
+	if prog, ok := keywordPrograms[filepath.Ext(ts.buf.Filename)]; ok {
+		return prog
+	}
+	return "man"
+}
+
+// lookupWord returns the word under the cursor for K. Other than for man, dotted names such as
+// strings.Split are taken whole, as go doc and pydoc look them up that way.
+func (ts *TermState) lookupWord() (string, error) {
+	word, err := ts.keywordUnderCursor()
+	if err != nil {
+		return "", err
+	}
+	if ts.keywordProgram() == "man" {
+		return word, nil
+	}
+	line := ts.buf.Line(ts.cursorY)
+	start, end := keywordAt(line, ts.cursorX)
+	for start > 1 && line[start-1] == '.' && isKeywordByte(line[start-2]) {
+		start, _ = keywordAt(line, start-2)
+	}
+	return line[start:end], nil
+}
+
+// expandTabs replaces the tabs in line with spaces up to the next multiple of 8 columns.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	for _, r := range line {
+		if r == '\t' {
+			b.WriteString(strings.Repeat(" ", 8-b.Len()%8))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// keywordLookup is K, running keywordprg on the word under the cursor in the background and
+// showing what it prints over the buffer.
+func (ts *TermState) keywordLookup() error {
+	word, err := ts.lookupWord()
+	if err != nil {
+		return err
+	}
+	args := append(strings.Fields(ts.keywordProgram()), word)
+	cmd := exec.Command(args[0], args[1:]...)
+	if ts.buf.Filename != "" && !buffer.IsRemote(ts.buf.Filename) {
+		cmd.Dir = filepath.Dir(ts.buf.Filename)
+	}
+	// Pagers would wait for keys that never come, and man should fit the screen.
+	cmd.Env = append(os.Environ(), "PAGER=cat", "MANPAGER=cat", fmt.Sprintf("MANWIDTH=%d", ts.winSize.Col))
+
+	var lines []string
+	collect := func(line string) {
+		lines = append(lines, expandTabs(overstrike.ReplaceAllString(line, "")))
+	}
+	_, err = ts.startJob(args[0], cmd, jobCallbacks{
+		onStdout: collect,
+		onStderr: collect,
+		onExit: func(err error) {
+			switch {
+			case len(lines) > 0:
+				ts.msgLines, ts.msgOffset = lines, 0
+			case err != nil:
+				ts.statusMsg = fmt.Sprintf("%s: %v", strings.Join(args, " "), err)
+			default:
+				ts.statusMsg = "no documentation for " + word
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	ts.statusMsg = strings.Join(args, " ")
+	return nil
+}
@@ -0,0 +1,35 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// largeFileDisabled lists the features turned off in large-file mode, for the notice shown when
+// a file is opened in it.
+var largeFileDisabled = []string{"hyperlinks", "swap file", "spell checking", "rainbow brackets", "git signs"}
+
+// checkLargeFile puts b in large-file mode if its file is bigger than the largefile option, or
+// has a line longer than largeline. Line lengths are only checked for files read into memory,
+// chunked files are only read as they're viewed.
+func (ts *TermState) checkLargeFile(b *buffer.Buffer) {
+	large := false
+	if fi, err := os.Stat(b.Filename); err == nil && ts.opts.largefile > 0 {
+		large = fi.Size() >= int64(ts.opts.largefile)<<20
+	}
+	if !large && ts.opts.largeline > 0 && b.Loading() == nil {
+		for i := 0; i < b.Len(); i++ {
+			if len(b.Line(i)) >= ts.opts.largeline {
+				large = true
+				break
+			}
+		}
+	}
+	b.LargeFile = large
+	if large {
+		ts.statusMsg = fmt.Sprintf("large file, turned off: %s", strings.Join(largeFileDisabled, ", "))
+	}
+}
@@ -0,0 +1,99 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// urlPattern matches URLs in buffer text. Punctuation after them is trimmed by findURLs.
+var urlPattern = regexp.MustCompile(`\b(?:https?|ftp|file)://[^\s<>"'` + "`" + `]+`)
+
+// findURLs returns the start and end of each URL in line.
+func findURLs(line string) [][]int {
+	locs := urlPattern.FindAllStringIndex(line, -1)
+	for _, loc := range locs {
+		for loc[1] > loc[0] {
+			url := line[loc[0]:loc[1]]
+			last := url[len(url)-1]
+			// Closing brackets are kept when they're part of the URL, as in Wikipedia links.
+			if strings.IndexByte(".,;:!?", last) < 0 &&
+				!(last == ')' && strings.Count(url, "(") < strings.Count(url, ")")) &&
+				!(last == ']' && strings.Count(url, "[") < strings.Count(url, "]")) {
+				break
+			}
+			loc[1]--
+		}
+	}
+	return locs
+}
+
+// openUnderCursor is gx, opening the URL under the cursor, or the file named by the word under
+// it, with the system's opener.
+func (ts *TermState) openUnderCursor() error {
+	if ts.buf.Len() == 0 {
+		return fmt.Errorf("no URL or file under cursor")
+	}
+	line := ts.buf.Line(ts.cursorY)
+	target := ""
+	for _, loc := range findURLs(line) {
+		if ts.cursorX >= loc[0] && ts.cursorX < loc[1] {
+			target = line[loc[0]:loc[1]]
+		}
+	}
+	if target == "" {
+		word := wordAt(line, ts.cursorX)
+		if word == "" {
+			return fmt.Errorf("no URL or file under cursor")
+		}
+		// Relative paths are from the file being edited.
+		path := word
+		if !filepath.IsAbs(path) && ts.buf.Filename != "" {
+			path = filepath.Join(filepath.Dir(ts.buf.Filename), path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("no URL or file under cursor: %s", word)
+		}
+		target = path
+	}
+
+	cmd := openerCommand(target)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("opening %s: %v", target, err)
+	}
+	// The opener usually exits straight away, but don't leave a zombie either way.
+	go cmd.Wait()
+	ts.statusMsg = "opening " + target
+	return nil
+}
+
+// wordAt returns the run of non-space characters at i in line, without surrounding punctuation.
+func wordAt(line string, i int) string {
+	if i >= len(line) || line[i] == ' ' || line[i] == '\t' {
+		return ""
+	}
+	start, end := i, i
+	for start > 0 && line[start-1] != ' ' && line[start-1] != '\t' {
+		start--
+	}
+	for end < len(line) && line[end] != ' ' && line[end] != '\t' {
+		end++
+	}
+	return strings.Trim(line[start:end], `"'()[]{}<>,;:`)
+}
+
+// openerCommand returns the command that opens target with its default application.
+func openerCommand(target string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", target)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		return exec.Command("xdg-open", target)
+	}
+}
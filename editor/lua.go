@@ -0,0 +1,263 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/keyan/zi/input"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaState returns the Lua interpreter, creating it on first use with the zi module loaded. All
+// Lua runs on the main goroutine.
+func (ts *TermState) luaState() *lua.LState {
+	if ts.lua != nil {
+		return ts.lua
+	}
+	L := lua.NewState()
+	zi := L.NewTable()
+	L.SetFuncs(zi, map[string]lua.LGFunction{
+		"buf_info":      ts.luaBufInfo,
+		"buf_get_lines": ts.luaGetLines,
+		"buf_set_lines": ts.luaSetLines,
+		"get_cursor":    ts.luaGetCursor,
+		"set_cursor":    ts.luaSetCursor,
+		"win_size":      ts.luaWinSize,
+		"get_option":    ts.luaGetOption,
+		"set_option":    ts.luaSetOption,
+		"get_register":  ts.luaGetRegister,
+		"set_register":  ts.luaSetRegister,
+		"map":           ts.luaMap,
+		"autocmd":       ts.luaAutocmd,
+		"command":       ts.luaCommand,
+		"cmd":           ts.luaCmd,
+		"message":       ts.luaMessage,
+		"show":          ts.luaShow,
+	})
+	L.SetGlobal("zi", zi)
+	ts.lua = L
+	return L
+}
+
+// callLua calls a function registered from Lua, reporting any error in the status bar.
+func (ts *TermState) callLua(fn *lua.LFunction, args ...lua.LValue) {
+	err := ts.luaState().CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...)
+	if err != nil {
+		ts.statusMsg = "lua: " + err.Error()
+	}
+}
+
+// luaStrings converts a Lua list of strings.
+func luaStrings(t *lua.LTable) []string {
+	strs := make([]string, 0, t.Len())
+	for i := 1; i <= t.Len(); i++ {
+		strs = append(strs, lua.LVAsString(t.RawGetInt(i)))
+	}
+	return strs
+}
+
+// zi.buf_info() returns a table of the current buffer's name, number, modified and line_count.
+func (ts *TermState) luaBufInfo(L *lua.LState) int {
+	t := L.NewTable()
+	L.SetField(t, "name", lua.LString(ts.buf.Filename))
+	L.SetField(t, "number", lua.LNumber(ts.buf.Num))
+	L.SetField(t, "modified", lua.LBool(ts.buf.Modified))
+	L.SetField(t, "line_count", lua.LNumber(ts.buf.Len()))
+	L.Push(t)
+	return 1
+}
+
+// zi.buf_get_lines([start, end]) returns a list of lines, see buffer.LineRange for how they're numbered.
+func (ts *TermState) luaGetLines(L *lua.LState) int {
+	start, end, err := ts.buf.LineRange(L.OptInt(1, 0), L.OptInt(2, -1))
+	if err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
+	t := L.NewTable()
+	for _, row := range ts.buf.Lines(start, end) {
+		t.Append(lua.LString(row))
+	}
+	L.Push(t)
+	return 1
+}
+
+// zi.buf_set_lines(start, end, lines) replaces a range of lines.
+func (ts *TermState) luaSetLines(L *lua.LState) int {
+	if err := ts.setLines(L.CheckInt(1), L.CheckInt(2), luaStrings(L.CheckTable(3))); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// zi.get_cursor() returns the 0-indexed row and column of the cursor.
+func (ts *TermState) luaGetCursor(L *lua.LState) int {
+	L.Push(lua.LNumber(ts.cursorY))
+	L.Push(lua.LNumber(ts.cursorX))
+	return 2
+}
+
+// zi.set_cursor(row, col) moves the cursor, clamped to the buffer.
+func (ts *TermState) luaSetCursor(L *lua.LState) int {
+	ts.setCursor(L.CheckInt(1), L.CheckInt(2))
+	return 0
+}
+
+// zi.win_size() returns the number of text rows and columns in the window.
+func (ts *TermState) luaWinSize(L *lua.LState) int {
+	L.Push(lua.LNumber(ts.textRows()))
+	L.Push(lua.LNumber(int(ts.winSize.Col) + 1 - ts.explorerWidth() - ts.variablesWidth()))
+	return 2
+}
+
+// zi.get_option(name) returns an option's value, as a boolean, number or string.
+func (ts *TermState) luaGetOption(L *lua.LState) int {
+	name := L.CheckString(1)
+	d := findOption(name)
+	if d == nil {
+		L.RaiseError("unknown option: %s", name)
+		return 0
+	}
+	switch {
+	case d.boolp != nil:
+		L.Push(lua.LBool(*d.boolp(&ts.opts)))
+	case d.intp != nil:
+		L.Push(lua.LNumber(*d.intp(&ts.opts)))
+	default:
+		L.Push(lua.LString(*d.strp(&ts.opts)))
+	}
+	return 1
+}
+
+// zi.get_register(name) returns the text in a register, with lines joined by newlines and a
+// newline after linewise text.
+func (ts *TermState) luaGetRegister(L *lua.LState) int {
+	name := L.CheckString(1)
+	if len(name) != 1 {
+		L.ArgError(1, "register name must be one character")
+		return 0
+	}
+	r, err := ts.getRegister(name[0])
+	if err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
+	text := strings.Join(r.lines, "\n")
+	if r.linewise {
+		text += "\n"
+	}
+	L.Push(lua.LString(text))
+	return 1
+}
+
+// zi.set_register(name, text) sets a register, such as to define a macro in init.lua.
+func (ts *TermState) luaSetRegister(L *lua.LState) int {
+	name, text := L.CheckString(1), L.CheckString(2)
+	if len(name) != 1 || !isMacroRegister(name[0]) {
+		L.ArgError(1, "invalid register name")
+		return 0
+	}
+	// Text ending in a newline is linewise, the same as get_register returns it.
+	linewise := strings.HasSuffix(text, "\n")
+	ts.setMacro(name[0], register{lines: strings.Split(strings.TrimSuffix(text, "\n"), "\n"), linewise: linewise})
+	return 0
+}
+
+// zi.set_option(name, value) sets an option, as :set would.
+func (ts *TermState) luaSetOption(L *lua.LState) int {
+	name, value := L.CheckString(1), L.CheckAny(2)
+	arg := name + "=" + lua.LVAsString(value)
+	if b, ok := value.(lua.LBool); ok {
+		arg = name
+		if !b {
+			arg = "no" + name
+		}
+	}
+	if err := ts.setOption(arg); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// zi.map(key, fn) calls fn when key is pressed in normal mode, key is as for input.ParseKey.
+func (ts *TermState) luaMap(L *lua.LState) int {
+	key, err := input.ParseKey(L.CheckString(1))
+	if err != nil {
+		L.ArgError(1, err.Error())
+		return 0
+	}
+	fn := L.CheckFunction(2)
+	ts.keymaps[key] = func() { ts.callLua(fn) }
+	return 0
+}
+
+// zi.autocmd(event, pattern, fn) calls fn(event, file) when event happens to a matching file.
+func (ts *TermState) luaAutocmd(L *lua.LState) int {
+	event, pattern, fn := L.CheckString(1), L.CheckString(2), L.CheckFunction(3)
+	err := ts.addAutocmd(event, pattern, "lua function", func(event, file string) {
+		ts.callLua(fn, lua.LString(event), lua.LString(file))
+	})
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// zi.command(name, fn) defines :name, which calls fn(args, bang).
+func (ts *TermState) luaCommand(L *lua.LState) int {
+	name, fn := L.CheckString(1), L.CheckFunction(2)
+	err := ts.defineCommand(name, func(ts *TermState, a exArgs) error {
+		ts.callLua(fn, lua.LString(a.arg), lua.LBool(a.bang))
+		return nil
+	})
+	if err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// zi.cmd(command) runs an ex command.
+func (ts *TermState) luaCmd(L *lua.LState) int {
+	if err := ts.runCommand(L.CheckString(1)); err != nil {
+		L.RaiseError("%v", err)
+	}
+	return 0
+}
+
+// zi.message(text) shows text in the status bar.
+func (ts *TermState) luaMessage(L *lua.LState) int {
+	ts.statusMsg = L.CheckString(1)
+	return 0
+}
+
+// zi.show(lines) shows a list of lines over the buffer until a key is pressed.
+func (ts *TermState) luaShow(L *lua.LState) int {
+	ts.msgLines, ts.msgOffset = luaStrings(L.CheckTable(1)), 0
+	return 0
+}
+
+// cmdLua runs a line of Lua.
+func cmdLua(ts *TermState, a exArgs) error {
+	return ts.luaState().DoString(a.arg)
+}
+
+// cmdLuaFile runs a Lua file.
+func cmdLuaFile(ts *TermState, a exArgs) error {
+	if a.arg == "" {
+		return fmt.Errorf("usage: luafile {file}")
+	}
+	return ts.luaState().DoFile(a.arg)
+}
+
+// loadLuaConfig runs the Lua config at path, if it exists, recording any error like loadConfig.
+func (ts *TermState) loadLuaConfig(path string) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return
+	}
+	ts.configLoaded = true
+	// Errors from the interpreter already include the file name.
+	if err := ts.luaState().DoFile(path); err != nil {
+		ts.configErrors = append(ts.configErrors, err)
+	}
+}
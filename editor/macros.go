@@ -0,0 +1,109 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxMacroDepth is how deeply macros can play one another, which stops a macro playing itself
+// forever.
+const maxMacroDepth = 100
+
+// isMacroRegister reports whether keys can be recorded into register name.
+func isMacroRegister(name byte) bool {
+	return name == '"' || name >= '0' && name <= '9' || name >= 'a' && name <= 'z' || name >= 'A' && name <= 'Z'
+}
+
+// startRecording is q{reg}, recording the keys typed into register name until q is pressed again
+// in normal mode. Uppercase names append to the register.
+func (ts *TermState) startRecording(name byte) error {
+	if !isMacroRegister(name) {
+		return fmt.Errorf("invalid register: %c", name)
+	}
+	ts.recording, ts.recorded, ts.secretKeys = name, nil, false
+	return nil
+}
+
+// recordKey adds a typed key to the macro being recorded, if any. Keys played from a macro aren't
+// recorded, only the @ that played them.
+func (ts *TermState) recordKey(b byte) {
+	if ts.recording != 0 && ts.macroDepth == 0 {
+		ts.recorded = append(ts.recorded, b)
+		ts.secretKeys = ts.secretKeys || ts.buf.Encrypted()
+	}
+}
+
+// stopRecording is the q ending a recording, storing the keys typed before it in the register.
+func (ts *TermState) stopRecording() {
+	keys := ts.recorded
+	if n := len(keys); n > 0 && keys[n-1] == 'q' {
+		keys = keys[:n-1]
+	}
+	ts.setMacro(ts.recording, register{lines: strings.Split(string(keys), "\n"), secret: ts.secretKeys})
+	ts.recording, ts.recorded = 0, nil
+}
+
+// setMacro stores r in register name, appending to it for uppercase names. Unlike setRegister, the
+// unnamed register is left alone.
+func (ts *TermState) setMacro(name byte, r register) {
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+		if old, ok := ts.registers[name]; ok {
+			r = joinRegisters(old, r)
+		}
+	}
+	ts.registers[name] = r
+}
+
+// playMacro is @{reg}, typing the keys in register name again, with @@ playing the register last
+// played. Keys the macro's commands read with readKey come from it too.
+func (ts *TermState) playMacro(name byte) error {
+	if name == '@' {
+		if ts.lastMacro == 0 {
+			return fmt.Errorf("no previous macro")
+		}
+		name = ts.lastMacro
+	}
+	r, err := ts.getRegister(name)
+	if err != nil {
+		return err
+	}
+	if ts.macroDepth >= maxMacroDepth {
+		ts.macroKeys = nil
+		return fmt.Errorf("macro recursion too deep")
+	}
+	ts.lastMacro = name
+	keys := strings.Join(r.lines, "\n")
+	if r.linewise {
+		keys += "\n"
+	}
+	// Keys left from a macro playing this one run after it.
+	ts.macroKeys = append([]byte(keys), ts.macroKeys...)
+	ts.macroDepth++
+	defer func() { ts.macroDepth-- }()
+	for len(ts.macroKeys) > 0 {
+		b := ts.macroKeys[0]
+		ts.macroKeys = ts.macroKeys[1:]
+		ts.processKeyPress(b)
+	}
+	return nil
+}
+
+// cmdLet is :let @x = expr, setting register x to the value of a Lua expression, as for "=. This
+// is how macros are edited, as in :let @q = "i// \27j" with \27 for Esc and \r for Enter.
+func cmdLet(ts *TermState, a exArgs) error {
+	name, expr, ok := strings.Cut(a.arg, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || len(name) != 2 || name[0] != '@' || expr == "" {
+		return fmt.Errorf("usage: let @x = expr")
+	}
+	if !isMacroRegister(name[1]) {
+		return fmt.Errorf("invalid register: %c", name[1])
+	}
+	r, err := ts.evalExpression(expr)
+	if err != nil {
+		return err
+	}
+	ts.setMacro(name[1], r)
+	return nil
+}
@@ -0,0 +1,121 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+func isLowerMark(name byte) bool { return name >= 'a' && name <= 'z' }
+func isUpperMark(name byte) bool { return name >= 'A' && name <= 'Z' }
+
+// setMark records the cursor position as mark name. Lowercase marks belong to the current buffer,
+// uppercase marks remember the file too and so can be jumped to from any buffer.
+func (ts *TermState) setMark(name byte) error {
+	pos := buffer.Position{Row: ts.cursorY, Col: ts.cursorX}
+	switch {
+	case isLowerMark(name):
+		ts.buf.Marks[name] = pos
+	case isUpperMark(name):
+		if ts.buf.Filename == "" || ts.buf.BrowseDir != "" {
+			return fmt.Errorf("cannot set a file mark in a buffer without a file")
+		}
+		ts.fileMarks[name] = fileMark{Filename: absPath(ts.buf.Filename), Row: pos.Row, Col: pos.Col}
+	default:
+		return fmt.Errorf("invalid mark name: %q", name)
+	}
+	return nil
+}
+
+// jumpToMark moves the cursor to mark name, switching buffers for file marks, or where insert
+// mode was last left for ^. If exact is false only the row is used, with the cursor placed at the
+// start of the line as with vim's '.
+func (ts *TermState) jumpToMark(name byte, exact bool) error {
+	var pos buffer.Position
+	switch {
+	case isLowerMark(name) || name == '^':
+		p, ok := ts.buf.Marks[name]
+		if !ok {
+			return fmt.Errorf("mark not set: %c", name)
+		}
+		ts.pushJump()
+		pos = p
+	case isUpperMark(name):
+		m, ok := ts.fileMarks[name]
+		if !ok {
+			return fmt.Errorf("mark not set: %c", name)
+		}
+		ts.pushJump()
+		if err := ts.openFile(m.Filename); err != nil {
+			return err
+		}
+		pos = buffer.Position{Row: m.Row, Col: m.Col}
+	default:
+		return fmt.Errorf("invalid mark name: %q", name)
+	}
+
+	if !exact {
+		pos.Col = 0
+	}
+	ts.setCursor(pos.Row, pos.Col)
+	return nil
+}
+
+// resumeInsert is gi, entering insert mode where it was last left, the ^ mark, or at the cursor
+// if it hasn't been used in this buffer.
+func (ts *TermState) resumeInsert() error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	ts.mode = insertMode
+	if pos, ok := ts.buf.Marks['^']; ok {
+		ts.setCursor(pos.Row, pos.Col)
+	}
+	return nil
+}
+
+// sortMarkNames sorts mark names alphabetically, in place.
+func sortMarkNames(names []byte) []byte {
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// cmdMarks is :marks [names], listing where the current buffer's marks and the file marks are, or
+// only those named.
+func cmdMarks(ts *TermState, a exArgs) error {
+	lines := []string{"mark line  col file/text"}
+	listed := func(name byte) bool {
+		return a.arg == "" || strings.IndexByte(a.arg, name) >= 0
+	}
+	names := make([]byte, 0, len(ts.buf.Marks))
+	for name := range ts.buf.Marks {
+		names = append(names, name)
+	}
+	for _, name := range sortMarkNames(names) {
+		pos := ts.buf.Marks[name]
+		text := ""
+		if pos.Row < ts.buf.Len() {
+			text = strings.TrimSpace(ts.buf.Line(pos.Row))
+		}
+		if listed(name) {
+			lines = append(lines, fmt.Sprintf(" %c %6d %4d %s", name, pos.Row+1, pos.Col, printable(text)))
+		}
+	}
+	names = names[:0]
+	for name := range ts.fileMarks {
+		names = append(names, name)
+	}
+	for _, name := range sortMarkNames(names) {
+		m := ts.fileMarks[name]
+		if listed(name) {
+			lines = append(lines, fmt.Sprintf(" %c %6d %4d %s", name, m.Row+1, m.Col, m.Filename))
+		}
+	}
+	if len(lines) == 1 {
+		return fmt.Errorf("no marks set")
+	}
+	ts.msgLines = lines
+	return nil
+}
@@ -0,0 +1,87 @@
+package editor
+
+import (
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// brackets pairs each bracket with its match, and whether it opens.
+var brackets = map[byte]struct {
+	match byte
+	open  bool
+}{
+	'(': {')', true}, '[': {']', true}, '{': {'}', true},
+	')': {'(', false}, ']': {'[', false}, '}': {'{', false},
+}
+
+// matchParenStyle is how a bracket and its match are highlighted.
+var matchParenStyle = render.ColorCode(render.BgCyan)
+
+// lastVisibleRow returns the last buffer row shown on the screen.
+func (ts *TermState) lastVisibleRow() int {
+	row, part := ts.rowOffset, 0
+	for i := 1; i < ts.textRows(); i++ {
+		row, part = ts.nextScreenRow(row, part)
+	}
+	if row >= ts.buf.Len() {
+		return ts.buf.Len() - 1
+	}
+	return row
+}
+
+// matchParen returns the bracket under the cursor and the one matching it, when the matchparen
+// option is on and the match is on screen. In insert mode the bracket just before the cursor is
+// used if there's none under it. Brackets are counted without regard to strings or comments.
+func (ts *TermState) matchParen() []buffer.Position {
+	if !ts.opts.matchparen || ts.buf.LargeFile || ts.cursorY >= ts.buf.Len() {
+		return nil
+	}
+	line := ts.buf.Line(ts.cursorY)
+	x := ts.cursorX
+	if x >= len(line) || brackets[line[x]].match == 0 {
+		if ts.mode != insertMode && ts.mode != replaceMode || x == 0 || x > len(line) ||
+			brackets[line[x-1]].match == 0 {
+			return nil
+		}
+		x--
+	}
+	b := brackets[line[x]]
+	dir, first, last := 1, ts.rowOffset, ts.lastVisibleRow()
+	if !b.open {
+		dir = -1
+	}
+
+	depth := 0
+	for row, col := ts.cursorY, x; row >= first && row <= last; row += dir {
+		text := ts.buf.Line(row)
+		if row != ts.cursorY {
+			col = 0
+			if dir < 0 {
+				col = len(text) - 1
+			}
+		}
+		for ; col >= 0 && col < len(text); col += dir {
+			switch text[col] {
+			case line[x]:
+				depth++
+			case b.match:
+				depth--
+			}
+			if depth == 0 {
+				return []buffer.Position{{Row: ts.cursorY, Col: x}, {Row: row, Col: col}}
+			}
+		}
+	}
+	return nil
+}
+
+// parenSpans returns the highlighting of matched brackets on row, from ts.parens.
+func (ts *TermState) parenSpans(row int) []textSpan {
+	var spans []textSpan
+	for _, p := range ts.parens {
+		if p.Row == row {
+			spans = append(spans, textSpan{start: p.Col, end: p.Col + 1, style: matchParenStyle})
+		}
+	}
+	return spans
+}
@@ -0,0 +1,72 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// blankRow reports whether row of the current buffer is empty or only whitespace, as between
+// paragraphs.
+func (ts *TermState) blankRow(row int) bool {
+	return strings.TrimSpace(ts.buf.Line(row)) == ""
+}
+
+// paragraphEnd returns the last row of the paragraph, or run of blank lines, row is in, searching
+// down or with dir -1 up.
+func (ts *TermState) paragraphEnd(row, dir int) int {
+	blank := ts.blankRow(row)
+	for next := row + dir; next >= 0 && next < ts.buf.Len() && ts.blankRow(next) == blank; next += dir {
+		row = next
+	}
+	return row
+}
+
+// lineMotion reads the motion after a linewise operator, returning the first and last rows it
+// covers. Only a few motions are supported: the operator's last key again for the cursor row, as
+// in gqq, j and k, gg and G, { and } to the start and end of the paragraph, and the ip and ap
+// paragraph objects.
+func (ts *TermState) lineMotion(repeat byte) (int, int, error) {
+	if ts.buf.Len() == 0 {
+		return 0, 0, fmt.Errorf("buffer is empty")
+	}
+	row, last := ts.cursorY, ts.buf.Len()-1
+	switch key := ts.readKey(); key {
+	case repeat:
+		return row, row, nil
+	case 'j':
+		if row == last {
+			return 0, 0, fmt.Errorf("no line below")
+		}
+		return row, row + 1, nil
+	case 'k':
+		if row == 0 {
+			return 0, 0, fmt.Errorf("no line above")
+		}
+		return row - 1, row, nil
+	case 'G':
+		return row, last, nil
+	case 'g':
+		if ts.readKey() == 'g' {
+			return 0, row, nil
+		}
+	case '}':
+		return row, ts.paragraphEnd(row, 1), nil
+	case '{':
+		return ts.paragraphEnd(row, -1), row, nil
+	case 'i', 'a':
+		if ts.readKey() != 'p' {
+			break
+		}
+		first, end := ts.paragraphEnd(row, -1), ts.paragraphEnd(row, 1)
+		// ap takes the blank lines after the paragraph too, or those before it at the end.
+		if key == 'a' && !ts.blankRow(row) {
+			if end < last {
+				end = ts.paragraphEnd(end+1, 1)
+			} else if first > 0 {
+				first = ts.paragraphEnd(first-1, -1)
+			}
+		}
+		return first, end, nil
+	}
+	return 0, 0, fmt.Errorf("unsupported motion")
+}
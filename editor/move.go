@@ -0,0 +1,155 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cmdMove is :[range]move {address}, moving the lines in the range, the current line by default,
+// to below the line at address, or to the top of the buffer for 0.
+func cmdMove(ts *TermState, a exArgs) error {
+	if ts.buf.Len() == 0 || a.line2 < a.line1 {
+		return fmt.Errorf("buffer is empty")
+	}
+	dest, rest, found, err := ts.parseAddress(a.arg)
+	if err != nil {
+		return err
+	}
+	if !found || strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("usage: move {address}")
+	}
+	row, err := ts.moveLines(a.line1, a.line2, dest)
+	if err != nil {
+		return err
+	}
+	ts.setCursor(row+a.line2-a.line1, 0)
+	return nil
+}
+
+// cmdCopy is :[range]copy {address}, or :t, putting a copy of the lines in the range, the current
+// line by default, below the line at address, or at the top of the buffer for 0.
+func cmdCopy(ts *TermState, a exArgs) error {
+	if ts.buf.Len() == 0 || a.line2 < a.line1 {
+		return fmt.Errorf("buffer is empty")
+	}
+	dest, rest, found, err := ts.parseAddress(a.arg)
+	if err != nil {
+		return err
+	}
+	if !found || strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("usage: copy {address}")
+	}
+	if dest < -1 || dest >= ts.buf.Len() {
+		return fmt.Errorf("invalid range")
+	}
+	if err := ts.setLines(dest+1, dest+1, ts.buf.Lines(a.line1, a.line2+1)); err != nil {
+		return err
+	}
+	ts.setCursor(dest+1+a.line2-a.line1, 0)
+	return nil
+}
+
+// duplicateLine is Ctrl-K, putting a copy of the current line below it and moving the cursor to
+// the same column of the copy.
+func (ts *TermState) duplicateLine() error {
+	if ts.buf.Len() == 0 {
+		return nil
+	}
+	if err := ts.setLines(ts.cursorY+1, ts.cursorY+1, ts.buf.Lines(ts.cursorY, ts.cursorY+1)); err != nil {
+		return err
+	}
+	ts.setCursor(ts.cursorY+1, ts.cursorX)
+	return nil
+}
+
+// moveLines moves rows first to last to below row dest, which is -1 for the top of the buffer,
+// and returns where the first of them ends up.
+func (ts *TermState) moveLines(first, last, dest int) (int, error) {
+	if dest < -1 || dest >= ts.buf.Len() {
+		return 0, fmt.Errorf("invalid range")
+	}
+	if dest >= first && dest < last {
+		return 0, fmt.Errorf("cannot move a range of lines into itself")
+	}
+	if dest == last || dest == first-1 {
+		return first, nil
+	}
+	lines := ts.buf.Lines(first, last+1)
+	if err := ts.setLines(first, last+1, nil); err != nil {
+		return 0, err
+	}
+	if dest > last {
+		dest -= len(lines)
+	}
+	if err := ts.setLines(dest+1, dest+1, lines); err != nil {
+		return 0, err
+	}
+	return dest + 1, nil
+}
+
+// reindent shifts the indentation of rows first to last together so the first is indented like
+// the line above it, one tabstop further after a line ending with an opening bracket or ':' and
+// one less for a line starting with a closing bracket. It returns how many bytes longer the first
+// row became.
+func (ts *TermState) reindent(first, last int) int {
+	line := ts.buf.Line(first)
+	above := first - 1
+	for above >= 0 && strings.TrimSpace(ts.buf.Line(above)) == "" {
+		above--
+	}
+	if above < 0 || strings.TrimSpace(line) == "" {
+		return 0
+	}
+	tabstop := ts.tabStop()
+	_, cols := leadingSpace(ts.buf.Line(above), tabstop)
+	if prev := strings.TrimSpace(ts.buf.Line(above)); strings.ContainsAny(prev[len(prev)-1:], "{([:") {
+		cols += tabstop
+	}
+	if strings.ContainsAny(strings.TrimSpace(line)[:1], "})]") && cols >= tabstop {
+		cols -= tabstop
+	}
+	_, cur := leadingSpace(line, tabstop)
+	delta := cols - cur
+	if delta == 0 {
+		return 0
+	}
+
+	for row := first; row <= last; row++ {
+		text := ts.buf.Line(row)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		n, cols := leadingSpace(text, tabstop)
+		cols += delta
+		if cols < 0 {
+			cols = 0
+		}
+		ts.buf.SetLine(row, makeIndent(cols, tabstop, ts.opts.expandtab)+text[n:])
+	}
+	return len(ts.buf.Line(first)) - len(line)
+}
+
+// bubbleLine is ]e and [e, moving the current line below the next one or above the previous one
+// and reindenting it to suit where it lands. The cursor stays on the same character.
+func (ts *TermState) bubbleLine(down bool) error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	row, dest := ts.cursorY, ts.cursorY-2
+	if down {
+		dest = row + 1
+	}
+	if dest < -1 || dest >= ts.buf.Len() {
+		return nil
+	}
+	row, err := ts.moveLines(row, row, dest)
+	if err != nil {
+		return err
+	}
+	col := ts.cursorX + ts.reindent(row, row)
+	if col < 0 {
+		col = 0
+	}
+	ts.setCursor(row, col)
+	return nil
+}
@@ -0,0 +1,105 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMoveCommand(t *testing.T) {
+	lines := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		command string
+		want    []string
+		cursor  int
+		err     bool
+	}{
+		{"1m 3", []string{"b", "c", "a", "d"}, 2, false},
+		{"4m 0", []string{"d", "a", "b", "c"}, 0, false},
+		{"1,2m $", []string{"c", "d", "a", "b"}, 3, false},
+		{"3,4m 1", []string{"a", "c", "d", "b"}, 2, false},
+		{"2m 2", lines, 1, false},
+		{"2m 1", lines, 1, false},
+		{"1,3m 2", nil, 0, true},
+		{"1m 9", nil, 0, true},
+		{"1m", nil, 0, true},
+		{"2t 0", []string{"b", "a", "b", "c", "d"}, 0, false},
+		{"1,2copy $", []string{"a", "b", "c", "d", "a", "b"}, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.buf.SetText(append([]string(nil), lines...))
+			_, err = ts.RunCommand(tt.command)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if got := ts.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if ts.cursorY != tt.cursor {
+				t.Errorf("cursor on line %d, want %d", ts.cursorY+1, tt.cursor+1)
+			}
+		})
+	}
+}
+
+func TestMoveEmptyBuffer(t *testing.T) {
+	for _, command := range []string{"t 0", "copy $", "m 0", "1,$t $"} {
+		t.Run(command, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ts.RunCommand(command); err == nil {
+				t.Error("no error for an empty buffer")
+			}
+			if n := ts.buf.Len(); n != 0 {
+				t.Errorf("buffer has %d lines, want none", n)
+			}
+		})
+	}
+}
+
+func TestBubbleLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		row     int
+		down    bool
+		want    []string
+		cursorY int
+	}{
+		{"down", []string{"a", "b", "c"}, 0, true, []string{"b", "a", "c"}, 1},
+		{"up", []string{"a", "b", "c"}, 2, false, []string{"a", "c", "b"}, 1},
+		{"down from the last line", []string{"a", "b"}, 1, true, []string{"a", "b"}, 1},
+		{"up from the first line", []string{"a", "b"}, 0, false, []string{"a", "b"}, 0},
+		{"into a block", []string{"x", "if y {", "}"}, 0, true, []string{"if y {", "\tx", "}"}, 1},
+		{"out of a block", []string{"if y {", "\tx", "}"}, 1, true, []string{"if y {", "}", "x"}, 2},
+		{"before a closing bracket", []string{"f(", "\t\tx", ")"}, 1, false, []string{"\t\tx", "f(", ")"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.buf.SetText(append([]string(nil), tt.lines...))
+			ts.setCursor(tt.row, 0)
+			if err := ts.bubbleLine(tt.down); err != nil {
+				t.Fatal(err)
+			}
+			if got := ts.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if ts.cursorY != tt.cursorY {
+				t.Errorf("cursor on line %d, want %d", ts.cursorY+1, tt.cursorY+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// options are the settings changeable with :set.
+type options struct {
+	makeprg      string
+	errorformat  string
+	termsync     bool   // Draw each frame as a synchronized update
+	title        bool   // Show the buffer name in the terminal title
+	hyperlinks   bool   // Make URLs in the buffer clickable with OSC 8
+	largefile    int    // Size in MB from which files are opened in large-file mode, 0 for never
+	largeline    int    // Line length in bytes from which files are opened in large-file mode
+	backup       bool   // Keep a copy of each file from before it was last overwritten
+	writebackup  bool   // Copy each file before overwriting it, removing the copy afterwards
+	backupdir    string // Where backups are made, next to the file if empty
+	backupcopy   string // How files are replaced when written, see buffer.ReplaceAuto
+	keepsymlinks bool   // Write through symlinks to the file they point to, keeping the link
+	fsync        bool   // Wait for each written file to reach the disk
+	fixeol       bool   // Add a line ending to the last line of files without one when writing
+	swapfile     bool   // Keep unwritten changes in a swap file, see swapFile
+	updatetime   int    // Milliseconds idle before swap files are written
+	autosave     int    // Seconds idle before modified buffers are written, 0 for never
+	watchfiles   bool   // Check open files for changes by other programs, see checkFiles
+	autoread     bool   // Reload files changed by other programs if the buffer is unmodified
+	undolevels   int    // Most changes kept in each buffer's undo history, 0 to turn undo off
+	undomem      int    // Most MB of text kept in each buffer's undo history, 0 for no limit
+	spell        bool   // Underline misspelled words in comments and prose, see proseRegions
+	spelllang    string // Dictionary to check spelling with, see loadDictionary
+	spellfile    string // Where zg and zw add words, see spellFile
+	dictionary   string // Word lists for Ctrl-X Ctrl-K, see dictionaryWords
+	thesaurus    string // Files of synonyms for Ctrl-X Ctrl-T, see synonyms
+	wrap         bool   // Lines wider than the window continue on the next screen row
+	linebreak    bool   // Wrap lines between words rather than at the last column that fits
+	textwidth    int    // Width gq formats text to, see formatWidth
+	matchparen   bool   // Highlight the bracket under the cursor and its match, see matchParen
+	rainbow      bool   // Color brackets by how deeply they're nested, see rainbowBrackets
+	gitsigns     bool   // Mark lines changed since the git index in the sign column, see gitHunks
+	zenwidth     int    // Width of the column of text in zen mode, see cmdZen
+	tags         string // Tags files for Ctrl-], see tagFiles
+	path         string // Directories gf looks for files in, see findInPath
+	keywordprg   string // Program K looks words up with, "" to choose by file type
+	tabstop      int    // Columns between tab stops, see tabStop
+	expandtab    bool   // Indent with spaces rather than tabs, see insertTab and cmdRetab
+}
+
+func defaultOptions() options {
+	return options{
+		makeprg:      "make",
+		errorformat:  "%f:%l:%c: %m,%f:%l:%c:%m,%f:%l: %m,%f:%l:%m",
+		termsync:     true,
+		title:        true,
+		hyperlinks:   true,
+		largefile:    32,
+		largeline:    10000,
+		writebackup:  true,
+		backupcopy:   buffer.ReplaceAuto,
+		keepsymlinks: true,
+		swapfile:     true,
+		updatetime:   4000,
+		watchfiles:   true,
+		autoread:     true,
+		undolevels:   1000,
+		undomem:      100,
+		spelllang:    "en_US",
+		zenwidth:     80,
+		matchparen:   true,
+		gitsigns:     true,
+		tags:         "./tags;,tags",
+		path:         ".,,",
+		tabstop:      8,
+	}
+}
+
+// optionDef describes a single option, exactly one of the pointer funcs is set depending on
+// the option type.
+type optionDef struct {
+	name  string
+	short string
+	boolp func(o *options) *bool
+	intp  func(o *options) *int
+	strp  func(o *options) *string
+	// bufp and bufBoolp are for options which belong to the current buffer rather than being
+	// global.
+	bufp     func(b *buffer.Buffer) *string
+	bufBoolp func(b *buffer.Buffer) *bool
+	// unwritten is set for buffer options which don't change how the file is written, so
+	// setting them isn't a change to the buffer.
+	unwritten bool
+	values    []string // The values a string option can take, any if empty
+}
+
+var optionDefs = []optionDef{
+	{name: "makeprg", short: "mp", strp: func(o *options) *string { return &o.makeprg }},
+	{name: "errorformat", short: "efm", strp: func(o *options) *string { return &o.errorformat }},
+	{name: "termsync", boolp: func(o *options) *bool { return &o.termsync }},
+	{name: "title", boolp: func(o *options) *bool { return &o.title }},
+	{name: "hyperlinks", boolp: func(o *options) *bool { return &o.hyperlinks }},
+	{name: "largefile", intp: func(o *options) *int { return &o.largefile }},
+	{name: "largeline", intp: func(o *options) *int { return &o.largeline }},
+	{name: "backup", short: "bk", boolp: func(o *options) *bool { return &o.backup }},
+	{name: "writebackup", short: "wb", boolp: func(o *options) *bool { return &o.writebackup }},
+	{name: "backupdir", short: "bdir", strp: func(o *options) *string { return &o.backupdir }},
+	{name: "backupcopy", short: "bkc", strp: func(o *options) *string { return &o.backupcopy },
+		values: []string{buffer.ReplaceAuto, buffer.ReplaceInPlace, buffer.ReplaceRename}},
+	{name: "keepsymlinks", boolp: func(o *options) *bool { return &o.keepsymlinks }},
+	{name: "fsync", short: "fs", boolp: func(o *options) *bool { return &o.fsync }},
+	{name: "fixendofline", short: "fixeol", boolp: func(o *options) *bool { return &o.fixeol }},
+	{name: "swapfile", short: "swf", boolp: func(o *options) *bool { return &o.swapfile }},
+	{name: "updatetime", short: "ut", intp: func(o *options) *int { return &o.updatetime }},
+	{name: "autosave", short: "as", intp: func(o *options) *int { return &o.autosave }},
+	{name: "watchfiles", boolp: func(o *options) *bool { return &o.watchfiles }},
+	{name: "autoread", short: "ar", boolp: func(o *options) *bool { return &o.autoread }},
+	{name: "undolevels", short: "ul", intp: func(o *options) *int { return &o.undolevels }},
+	{name: "undomem", intp: func(o *options) *int { return &o.undomem }},
+	{name: "spell", boolp: func(o *options) *bool { return &o.spell }},
+	{name: "spelllang", short: "spl", strp: func(o *options) *string { return &o.spelllang }},
+	{name: "spellfile", short: "spf", strp: func(o *options) *string { return &o.spellfile }},
+	{name: "dictionary", short: "dict", strp: func(o *options) *string { return &o.dictionary }},
+	{name: "thesaurus", short: "tsr", strp: func(o *options) *string { return &o.thesaurus }},
+	{name: "wrap", boolp: func(o *options) *bool { return &o.wrap }},
+	{name: "linebreak", short: "lbr", boolp: func(o *options) *bool { return &o.linebreak }},
+	{name: "textwidth", short: "tw", intp: func(o *options) *int { return &o.textwidth }},
+	{name: "matchparen", boolp: func(o *options) *bool { return &o.matchparen }},
+	{name: "rainbow", boolp: func(o *options) *bool { return &o.rainbow }},
+	{name: "gitsigns", boolp: func(o *options) *bool { return &o.gitsigns }},
+	{name: "tags", short: "tag", strp: func(o *options) *string { return &o.tags }},
+	{name: "path", short: "pa", strp: func(o *options) *string { return &o.path }},
+	{name: "keywordprg", short: "kp", strp: func(o *options) *string { return &o.keywordprg }},
+	{name: "tabstop", short: "ts", intp: func(o *options) *int { return &o.tabstop }},
+	{name: "expandtab", short: "et", boolp: func(o *options) *bool { return &o.expandtab }},
+	{name: "zenwidth", intp: func(o *options) *int { return &o.zenwidth }},
+	{name: "fileformat", short: "ff", bufp: func(b *buffer.Buffer) *string { return &b.Format },
+		values: []string{buffer.FormatUnix, buffer.FormatDOS, buffer.FormatMac}},
+	{name: "fileencoding", short: "fenc", bufp: func(b *buffer.Buffer) *string { return &b.Encoding },
+		values: buffer.Encodings},
+	{name: "bomb", bufBoolp: func(b *buffer.Buffer) *bool { return &b.BOM }},
+	{name: "readonly", short: "ro", bufBoolp: func(b *buffer.Buffer) *bool { return &b.ReadOnly },
+		unwritten: true},
+	{name: "modifiable", short: "ma", bufBoolp: func(b *buffer.Buffer) *bool { return &b.Modifiable },
+		unwritten: true},
+}
+
+// findOption returns the definition for an option by its full or short name.
+func findOption(name string) *optionDef {
+	for i := range optionDefs {
+		if optionDefs[i].name == name || optionDefs[i].short == name {
+			return &optionDefs[i]
+		}
+	}
+	return nil
+}
+
+// boolPtr returns where a boolean option's value is kept, or nil for other options.
+func (d *optionDef) boolPtr(o *options, b *buffer.Buffer) *bool {
+	switch {
+	case d.boolp != nil:
+		return d.boolp(o)
+	case d.bufBoolp != nil:
+		return d.bufBoolp(b)
+	}
+	return nil
+}
+
+// format returns the option's current value as shown by :set.
+func (d *optionDef) format(o *options, b *buffer.Buffer) string {
+	switch {
+	case d.bufp != nil:
+		return fmt.Sprintf("%s=%s", d.name, *d.bufp(b))
+	case d.boolPtr(o, b) != nil:
+		if *d.boolPtr(o, b) {
+			return d.name
+		}
+		return "no" + d.name
+	case d.intp != nil:
+		return fmt.Sprintf("%s=%d", d.name, *d.intp(o))
+	default:
+		return fmt.Sprintf("%s=%s", d.name, *d.strp(o))
+	}
+}
+
+// allows reports whether value is one of the values the option can take.
+func (d *optionDef) allows(value string) bool {
+	for _, v := range d.values {
+		if v == value {
+			return true
+		}
+	}
+	return len(d.values) == 0
+}
+
+// setOption applies a single :set argument: "opt", "noopt", "invopt", "opt!", "opt?" or "opt=val".
+func (ts *TermState) setOption(arg string) error {
+	name, value, hasValue := arg, "", false
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		name, value, hasValue = arg[:i], arg[i+1:], true
+	}
+
+	query := strings.HasSuffix(name, "?")
+	name = strings.TrimSuffix(name, "?")
+	toggle := strings.HasSuffix(name, "!")
+	name = strings.TrimSuffix(name, "!")
+
+	d := findOption(name)
+	boolValue := true
+	if d == nil && strings.HasPrefix(name, "inv") {
+		if d = findOption(name[3:]); d != nil {
+			toggle = true
+		}
+	}
+	if d == nil && strings.HasPrefix(name, "no") {
+		d, boolValue = findOption(name[2:]), false
+	}
+	if d == nil {
+		return fmt.Errorf("unknown option: %s", name)
+	}
+
+	boolp := d.boolPtr(&ts.opts, ts.buf)
+	switch {
+	case query || (!hasValue && boolp == nil):
+		ts.statusMsg = d.format(&ts.opts, ts.buf)
+	case boolp != nil:
+		if hasValue {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}
+		old := *boolp
+		if toggle {
+			*boolp = !*boolp
+		} else {
+			*boolp = boolValue
+		}
+		if d.bufBoolp != nil && !d.unwritten && *boolp != old {
+			ts.buf.MarkModified()
+		}
+	case d.intp != nil:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("number required after =: %s", arg)
+		}
+		*d.intp(&ts.opts) = n
+	case !d.allows(value):
+		return fmt.Errorf("invalid argument: %s", arg)
+	case d.bufp != nil:
+		// Changing how the buffer is written is a change to it, as with bufBoolp above.
+		if p := d.bufp(ts.buf); *p != value {
+			*p = value
+			ts.buf.MarkModified()
+		}
+	default:
+		*d.strp(&ts.opts) = value
+	}
+	return nil
+}
+
+// cmdSet changes options, each argument is handled by setOption. A backslash escapes a space
+// within a value. With no arguments every option is listed.
+func cmdSet(ts *TermState, a exArgs) error {
+	if a.arg == "" {
+		lines := make([]string, 0, len(optionDefs))
+		for i := range optionDefs {
+			lines = append(lines, "  "+optionDefs[i].format(&ts.opts, ts.buf))
+		}
+		ts.msgLines = lines
+		return nil
+	}
+
+	for _, arg := range splitEscaped(a.arg) {
+		if err := ts.setOption(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitEscaped splits s on spaces which aren't preceded by a backslash.
+func splitEscaped(s string) []string {
+	var args []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ' ':
+			cur.WriteByte(' ')
+			i++
+		case s[i] == ' ':
+			if cur.Len() > 0 {
+				args = append(args, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	if cur.Len() > 0 {
+		args = append(args, cur.String())
+	}
+	return args
+}
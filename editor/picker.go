@@ -0,0 +1,240 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+)
+
+// maxPickerRows caps how much of the screen a picker takes.
+const maxPickerRows = 15
+
+// pickerItem is a single choice in a picker.
+type pickerItem struct {
+	label string
+	open  func() error // Called when the item is chosen
+}
+
+// picker is a fuzzy-filtered list of items drawn over the bottom of the screen.
+type picker struct {
+	title    string
+	items    []pickerItem
+	query    string
+	matches  []int // Indexes into items of those matching query, best match first
+	selected int   // Index into matches
+}
+
+// openPicker shows a picker over items, or reports that there's nothing to pick from.
+func (ts *TermState) openPicker(title string, items []pickerItem) error {
+	if len(items) == 0 {
+		return fmt.Errorf("nothing to pick from for %s", title)
+	}
+	ts.picker = &picker{title: title, items: items}
+	ts.picker.filter()
+	return nil
+}
+
+// filter recomputes the matching items for the current query.
+func (p *picker) filter() {
+	type match struct{ idx, score int }
+	var matches []match
+	for i, item := range p.items {
+		if score, ok := fuzzyScore(p.query, item.label); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	p.matches = p.matches[:0]
+	for _, m := range matches {
+		p.matches = append(p.matches, m.idx)
+	}
+	p.selected = 0
+}
+
+// fuzzyScore reports whether the runes of query appear in order within s, ignoring case, and how
+// good a match it is. Consecutive runes and runes at the start of words score higher.
+func fuzzyScore(query, s string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	score, qi := 0, 0
+	prevMatched := false
+	var prev rune
+	for i, r := range strings.ToLower(s) {
+		if qi < len(q) && r == q[qi] {
+			score++
+			if prevMatched {
+				score += 5
+			}
+			if i == 0 || !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 8
+			}
+			qi++
+			prevMatched = true
+		} else {
+			prevMatched = false
+		}
+		prev = r
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	// Prefer shorter labels when everything else is equal.
+	return score*100 - len(s), true
+}
+
+// lines returns at most max labels to draw, and which of them is selected. The visible window of
+// matches scrolls to keep the selection in view.
+func (p *picker) lines(max int) ([]string, int) {
+	if max > maxPickerRows {
+		max = maxPickerRows
+	}
+	start := 0
+	if p.selected >= max {
+		start = p.selected - max + 1
+	}
+	end := start + max
+	if end > len(p.matches) {
+		end = len(p.matches)
+	}
+
+	lines := make([]string, 0, end-start)
+	for _, idx := range p.matches[start:end] {
+		lines = append(lines, "  "+p.items[idx].label)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "  (no matches)")
+		return lines, -1
+	}
+	return lines, p.selected - start
+}
+
+// prompt is shown in the status bar while the picker is open.
+func (p *picker) prompt() string {
+	return fmt.Sprintf("%s (%d/%d)> ", p.title, len(p.matches), len(p.items))
+}
+
+func processPickerPress(ts *TermState, b byte) {
+	p := ts.picker
+	switch b {
+	case render.EscapeChar, input.Ctrl('c'):
+		ts.picker = nil
+	case '\r':
+		ts.picker = nil
+		if len(p.matches) == 0 {
+			return
+		}
+		if err := p.items[p.matches[p.selected]].open(); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	case input.Ctrl('n'), input.Ctrl('j'):
+		if p.selected < len(p.matches)-1 {
+			p.selected++
+		}
+	case input.Ctrl('p'), input.Ctrl('k'):
+		if p.selected > 0 {
+			p.selected--
+		}
+	case 127, input.Ctrl('h'):
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.filter()
+		}
+	default:
+		if b >= ' ' {
+			p.query += string(b)
+			p.filter()
+		}
+	}
+}
+
+// bufferItems lists the open buffers.
+func (ts *TermState) bufferItems() []pickerItem {
+	var items []pickerItem
+	for _, b := range ts.buffers {
+		b := b
+		label := fmt.Sprintf("buffer %d: %s", b.Num, b.Name())
+		if b.Modified {
+			label += " [+]"
+		}
+		items = append(items, pickerItem{label, func() error {
+			ts.switchBuffer(b)
+			return nil
+		}})
+	}
+	return items
+}
+
+// historyItems lists recently opened files, other than the current one.
+func (ts *TermState) historyItems() []pickerItem {
+	var items []pickerItem
+	current := absPath(ts.buf.Filename)
+	for _, f := range ts.oldFiles {
+		if f == current {
+			continue
+		}
+		f := f
+		items = append(items, pickerItem{"recent: " + f, func() error {
+			return ts.openFile(f)
+		}})
+	}
+	return items
+}
+
+// markItems lists the current buffer's marks, and all file marks.
+func (ts *TermState) markItems() []pickerItem {
+	var items []pickerItem
+	add := func(name byte, desc string) {
+		items = append(items, pickerItem{fmt.Sprintf("mark %c: %s", name, desc), func() error {
+			return ts.jumpToMark(name, true)
+		}})
+	}
+
+	names := make([]byte, 0, len(ts.buf.Marks))
+	for name := range ts.buf.Marks {
+		names = append(names, name)
+	}
+	for _, name := range sortMarkNames(names) {
+		pos := ts.buf.Marks[name]
+		text := ""
+		if pos.Row < ts.buf.Len() {
+			text = strings.TrimSpace(ts.buf.Line(pos.Row))
+		}
+		add(name, fmt.Sprintf("%d: %s", pos.Row+1, text))
+	}
+
+	names = names[:0]
+	for name := range ts.fileMarks {
+		names = append(names, name)
+	}
+	for _, name := range sortMarkNames(names) {
+		m := ts.fileMarks[name]
+		add(name, fmt.Sprintf("%s:%d", m.Filename, m.Row+1))
+	}
+	return items
+}
+
+// cmdPick opens a picker over open buffers, recent files and marks together.
+func cmdPick(ts *TermState, a exArgs) error {
+	items := append(ts.bufferItems(), ts.historyItems()...)
+	return ts.openPicker("Jump", append(items, ts.markItems()...))
+}
+
+func cmdPickBuffers(ts *TermState, a exArgs) error {
+	return ts.openPicker("Buffers", ts.bufferItems())
+}
+
+func cmdPickHistory(ts *TermState, a exArgs) error {
+	return ts.openPicker("History", ts.historyItems())
+}
+
+func cmdPickMarks(ts *TermState, a exArgs) error {
+	return ts.openPicker("Marks", ts.markItems())
+}
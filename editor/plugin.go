@@ -0,0 +1,367 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/keyan/zi/input"
+)
+
+// plugin is a running plugin process. Plugins speak JSON-RPC 2.0 over stdio, one message per
+// line, and are started from the config with :plugin {command}.
+//
+// Plugins call these methods on zi, all acting on the current buffer:
+//
+//	buffer.info        {}                   -> {name, number, modified, lineCount}
+//	buffer.getLines    {start, end}         -> [line, ...], 0-indexed and end exclusive, -1 is the end
+//	buffer.setLines    {start, end, lines}  -> null, replacing the given lines
+//	cursor.get         {}                   -> {row, col}, 0-indexed
+//	cursor.set         {row, col}           -> null
+//	ui.message         {text}               -> null, shown in the status bar
+//	ui.show            {lines}              -> null, shown over the buffer until a key is pressed
+//	command.run        {command}            -> null, runs an ex command
+//	command.define     {name}               -> null, adds :{name}, which must start with a capital
+//	keymap.set         {key}                -> null, maps a normal mode key, e.g. "K" or "<C-k>"
+//	autocmd.subscribe  {event, pattern}     -> null, see :autocmd for events and patterns
+//
+// zi sends these notifications to plugins in return:
+//
+//	command  {name, args, bang}  when a command it defined is run
+//	keymap   {key}               when a key it mapped is pressed
+//	autocmd  {event, file}       when an event it subscribed to happens
+type plugin struct {
+	command string
+	job     *job
+	exited  bool
+
+	// Messages waiting to be written to the plugin's stdin, see send.
+	mu    sync.Mutex
+	queue [][]byte
+	notes int           // How many of queue are notifications
+	wake  chan struct{} // Signalled when queue grows, closed once the plugin exits
+}
+
+// maxQueuedNotes is how many notifications can wait for a plugin to read them. Any more are
+// dropped rather than held for a plugin that has stopped reading.
+const maxQueuedNotes = 64
+
+// rpcRequest is a request or notification from a plugin, notifications have no id.
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// pluginMethod handles a single method call from a plugin. params has been checked to be valid
+// JSON, the method unmarshals what it needs.
+type pluginMethod func(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error)
+
+// pluginMethods is filled in by init, as some methods run ex commands.
+var pluginMethods map[string]pluginMethod
+
+func init() {
+	pluginMethods = map[string]pluginMethod{
+		"buffer.info":       rpcBufferInfo,
+		"buffer.getLines":   rpcGetLines,
+		"buffer.setLines":   rpcSetLines,
+		"cursor.get":        rpcGetCursor,
+		"cursor.set":        rpcSetCursor,
+		"ui.message":        rpcMessage,
+		"ui.show":           rpcShow,
+		"command.run":       rpcRunCommand,
+		"command.define":    rpcDefineCommand,
+		"keymap.set":        rpcSetKeymap,
+		"autocmd.subscribe": rpcSubscribe,
+	}
+}
+
+// startPlugin runs command with sh and starts handling its requests.
+func (ts *TermState) startPlugin(command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	p := &plugin{command: command, wake: make(chan struct{}, 1)}
+	p.job, err = ts.startJob("plugin", cmd, jobCallbacks{
+		onStdout: func(line string) { ts.handlePluginMessage(p, line) },
+		onStderr: func(line string) { ts.logger.Printf("plugin %s: %s", command, line) },
+		onExit: func(err error) {
+			p.exited = true
+			close(p.wake)
+			ts.removePlugin(p)
+			if err != nil {
+				ts.statusMsg = fmt.Sprintf("plugin %s exited: %v", command, err)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.job.service = true
+	ts.plugins = append(ts.plugins, p)
+
+	// Writes happen in the background, so a plugin that stops reading can't block the editor.
+	go func() {
+		defer stdin.Close()
+		for open := true; open; {
+			_, open = <-p.wake
+			for _, msg := range p.take() {
+				if _, err := stdin.Write(msg); err != nil {
+					for range p.wake {
+						p.take()
+					}
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// removePlugin drops p from the plugin list once it has exited.
+func (ts *TermState) removePlugin(p *plugin) {
+	for i, other := range ts.plugins {
+		if other == p {
+			ts.plugins = append(ts.plugins[:i], ts.plugins[i+1:]...)
+			return
+		}
+	}
+}
+
+// send queues a message for the plugin, dropping it if the plugin has exited. Replies are always
+// sent, as the plugin may be waiting for them, but a notification is dropped if the plugin isn't
+// keeping up.
+func (p *plugin) send(v interface{}) {
+	if p.exited {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	_, note := v.(rpcNotification)
+	p.mu.Lock()
+	if note && p.notes >= maxQueuedNotes {
+		p.mu.Unlock()
+		return
+	}
+	p.queue = append(p.queue, append(data, '\n'))
+	if note {
+		p.notes++
+	}
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+		// The writer hasn't woken for an earlier message yet, it'll take this one too.
+	}
+}
+
+// take returns the queued messages, emptying the queue.
+func (p *plugin) take() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	msgs := p.queue
+	p.queue, p.notes = nil, 0
+	return msgs
+}
+
+// notify sends a notification, which the plugin doesn't reply to.
+func (p *plugin) notify(method string, params interface{}) {
+	p.send(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handlePluginMessage runs a single request or notification from p, replying to requests.
+func (ts *TermState) handlePluginMessage(p *plugin, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	var req rpcRequest
+	if err := json.Unmarshal([]byte(line), &req); err != nil {
+		p.send(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &rpcError{rpcParseError, err.Error()}})
+		return
+	}
+
+	var result interface{}
+	var rpcErr *rpcError
+	if method, ok := pluginMethods[req.Method]; !ok {
+		rpcErr = &rpcError{rpcMethodNotFound, "no such method: " + req.Method}
+	} else {
+		if len(req.Params) == 0 {
+			req.Params = json.RawMessage("{}")
+		}
+		var err error
+		if result, err = method(ts, p, req.Params); err != nil {
+			rpcErr = &rpcError{rpcServerError, err.Error()}
+			if _, ok := err.(*json.UnmarshalTypeError); ok {
+				rpcErr.Code = rpcInvalidParams
+			}
+		}
+	}
+
+	if len(req.ID) == 0 {
+		// Notifications get no reply, so report their errors instead.
+		if rpcErr != nil {
+			ts.statusMsg = fmt.Sprintf("plugin %s: %s", p.command, rpcErr.Message)
+		}
+		return
+	}
+	p.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+}
+
+func rpcBufferInfo(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"name":      ts.buf.Filename,
+		"number":    ts.buf.Num,
+		"modified":  ts.buf.Modified,
+		"lineCount": ts.buf.Len(),
+	}, nil
+}
+
+func rpcGetLines(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	args := struct{ Start, End int }{0, -1}
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	start, end, err := ts.buf.LineRange(args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+	return ts.buf.Lines(start, end), nil
+}
+
+func rpcSetLines(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct {
+		Start, End int
+		Lines      []string
+	}
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	return nil, ts.setLines(args.Start, args.End, args.Lines)
+}
+
+func rpcGetCursor(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	return map[string]int{"row": ts.cursorY, "col": ts.cursorX}, nil
+}
+
+func rpcSetCursor(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Row, Col int }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	ts.setCursor(args.Row, args.Col)
+	return nil, nil
+}
+
+func rpcMessage(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Text string }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	ts.statusMsg = args.Text
+	return nil, nil
+}
+
+func rpcShow(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Lines []string }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	ts.msgLines, ts.msgOffset = args.Lines, 0
+	return nil, nil
+}
+
+func rpcRunCommand(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Command string }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	return nil, ts.runCommand(args.Command)
+}
+
+func rpcDefineCommand(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Name string }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	return nil, ts.defineCommand(args.Name, func(ts *TermState, a exArgs) error {
+		if p.exited {
+			return fmt.Errorf("plugin %s has exited", p.command)
+		}
+		p.notify("command", map[string]interface{}{"name": args.Name, "args": a.arg, "bang": a.bang})
+		return nil
+	})
+}
+
+func rpcSetKeymap(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	var args struct{ Key string }
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	key, err := input.ParseKey(args.Key)
+	if err != nil {
+		return nil, err
+	}
+	ts.keymaps[key] = func() {
+		p.notify("keymap", map[string]string{"key": args.Key})
+	}
+	return nil, nil
+}
+
+func rpcSubscribe(ts *TermState, p *plugin, params json.RawMessage) (interface{}, error) {
+	args := struct{ Event, Pattern string }{Pattern: "*"}
+	if err := json.Unmarshal(params, &args); err != nil {
+		return nil, err
+	}
+	return nil, ts.addAutocmd(args.Event, args.Pattern, "plugin "+p.command, func(event, file string) {
+		p.notify("autocmd", map[string]string{"event": event, "file": file})
+	})
+}
+
+// cmdPlugin starts a plugin, given the command to run it, or lists the running plugins.
+func cmdPlugin(ts *TermState, a exArgs) error {
+	if a.arg != "" {
+		return ts.startPlugin(a.arg)
+	}
+	if len(ts.plugins) == 0 {
+		return fmt.Errorf("no plugins running")
+	}
+	lines := make([]string, 0, len(ts.plugins))
+	for _, p := range ts.plugins {
+		lines = append(lines, fmt.Sprintf("%3d %s", p.job.id, p.command))
+	}
+	ts.msgLines = lines
+	return nil
+}
@@ -0,0 +1,29 @@
+package editor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPluginSendKeepsReplies(t *testing.T) {
+	p := &plugin{wake: make(chan struct{}, 1)}
+	for i := 0; i < maxQueuedNotes+10; i++ {
+		p.notify("keymap", map[string]string{"key": "K"})
+	}
+	p.send(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("1")})
+
+	msgs := p.take()
+	if len(msgs) != maxQueuedNotes+1 {
+		t.Fatalf("queued %d messages, want %d notifications and the reply", len(msgs), maxQueuedNotes)
+	}
+	var reply rpcRequest
+	if err := json.Unmarshal(msgs[len(msgs)-1], &reply); err != nil || string(reply.ID) != "1" {
+		t.Errorf("last message = %s, want the reply", msgs[len(msgs)-1])
+	}
+
+	// Taking the queue makes room for more notifications.
+	p.notify("keymap", map[string]string{"key": "K"})
+	if msgs := p.take(); len(msgs) != 1 {
+		t.Errorf("queued %d messages after the queue was taken, want 1", len(msgs))
+	}
+}
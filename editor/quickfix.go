@@ -0,0 +1,319 @@
+package editor
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+)
+
+// quickfixWindowRows is the most entries the quickfix window shows at once.
+const quickfixWindowRows = 10
+
+// qfEntry is a single location in the quickfix list.
+type qfEntry struct {
+	filename string
+	row, col int // 0-indexed
+	text     string
+	kind     byte // Error type from %t in errorformat, e.g. 'e' or 'w', 0 if unknown
+}
+
+// quickfixList is a list of locations, such as search matches or compiler errors, that can be
+// stepped through with :cn and :cp. The same type is used for the window's location list, which
+// is stepped through with :lne and :lp instead.
+type quickfixList struct {
+	title   string
+	entries []qfEntry
+	idx     int  // Index of the current entry, -1 before the first jump
+	job     *job // Running :grep or :make filling the list, if any
+}
+
+// quickfixWindow is a pane at the bottom of the screen listing the entries of a quickfix or
+// location list.
+type quickfixWindow struct {
+	list    *quickfixList // The list shown, nil when the window is closed
+	focused bool          // true if keypresses go to the quickfix window instead of the buffer
+	cursor  int           // Index of the selected entry
+	offset  int           // Index of the first entry on screen
+}
+
+// resetList empties qf ready to be refilled, stopping any job still adding to it.
+func (ts *TermState) resetList(qf *quickfixList, title string) {
+	ts.stopJob(qf.job)
+	*qf = quickfixList{title: title, idx: -1}
+	if ts.qfWin.list == qf {
+		ts.qfWin.cursor, ts.qfWin.offset = 0, 0
+	}
+}
+
+// jumpToEntry opens the file for entry i of qf and moves the cursor to it.
+func (ts *TermState) jumpToEntry(qf *quickfixList, i int) error {
+	if len(qf.entries) == 0 {
+		return fmt.Errorf("no errors")
+	}
+	if i < 0 || i >= len(qf.entries) {
+		return fmt.Errorf("no more items")
+	}
+
+	e := qf.entries[i]
+	ts.pushJump()
+	if err := ts.openFile(e.filename); err != nil {
+		return err
+	}
+	qf.idx = i
+	ts.setCursor(e.row, e.col)
+	ts.statusMsg = fmt.Sprintf("(%d of %d): %s", i+1, len(qf.entries), e.text)
+	return nil
+}
+
+// quickfixCommands returns the handlers for the :c* quickfix list commands, or the :l* location
+// list equivalents when local is true.
+func quickfixCommands(local bool) map[string]exCommand {
+	list := func(ts *TermState) *quickfixList {
+		if local {
+			return &ts.loclist
+		}
+		return &ts.quickfix
+	}
+
+	next := func(ts *TermState, a exArgs) error {
+		qf := list(ts)
+		return ts.jumpToEntry(qf, qf.idx+1)
+	}
+	prev := func(ts *TermState, a exArgs) error {
+		qf := list(ts)
+		return ts.jumpToEntry(qf, qf.idx-1)
+	}
+	// Jumps to the entry numbered by the argument, or redisplays the current one.
+	current := func(ts *TermState, a exArgs) error {
+		qf := list(ts)
+		i := qf.idx
+		if a.arg != "" {
+			n, err := strconv.Atoi(a.arg)
+			if err != nil {
+				return fmt.Errorf("invalid entry number: %s", a.arg)
+			}
+			i = n - 1
+		}
+		if i < 0 {
+			i = 0
+		}
+		return ts.jumpToEntry(qf, i)
+	}
+	open := func(ts *TermState, a exArgs) error {
+		ts.openQuickfixWindow(list(ts))
+		return nil
+	}
+	closeWin := func(ts *TermState, a exArgs) error {
+		if ts.qfWin.list == list(ts) {
+			ts.qfWin = quickfixWindow{}
+		}
+		return nil
+	}
+	// Opens the window if there are entries, otherwise closes it.
+	window := func(ts *TermState, a exArgs) error {
+		if len(list(ts).entries) == 0 {
+			return closeWin(ts, a)
+		}
+		return open(ts, a)
+	}
+	grep := func(ts *TermState, a exArgs) error {
+		return ts.grep(list(ts), a)
+	}
+	makeList := func(ts *TermState, a exArgs) error {
+		return ts.runMake(list(ts), a)
+	}
+
+	p := "c"
+	if local {
+		p = "l"
+	}
+	cmds := map[string]exCommand{
+		p + "n":        next,
+		p + "ne":       next,
+		p + "next":     next,
+		p + "p":        prev,
+		p + "prev":     prev,
+		p + "previous": prev,
+		p + "N":        prev,
+		p + "Next":     prev,
+		p + p:          current,
+		p + "open":     open,
+		p + "close":    closeWin,
+		p + "w":        window,
+		p + "window":   window,
+	}
+	if local {
+		cmds["lgrep"] = grep
+		cmds["lmake"] = makeList
+	} else {
+		cmds["grep"] = grep
+		cmds["Grep"] = grep
+		cmds["make"] = makeList
+	}
+	return cmds
+}
+
+// openQuickfixWindow shows qf in the quickfix window and gives it focus.
+func (ts *TermState) openQuickfixWindow(qf *quickfixList) {
+	if ts.qfWin.list != qf {
+		ts.qfWin = quickfixWindow{list: qf}
+	}
+	ts.qfWin.focused = true
+	if qf.idx >= 0 {
+		ts.qfWin.cursor = qf.idx
+	}
+}
+
+// quickfixHeight is the number of screen rows taken by the quickfix window, including its title.
+func (ts *TermState) quickfixHeight() int {
+	if ts.qfWin.list == nil {
+		return 0
+	}
+	n := len(ts.qfWin.list.entries)
+	if n > quickfixWindowRows {
+		n = quickfixWindowRows
+	}
+	if n < 1 {
+		n = 1
+	}
+	// Always leave at least half the screen for the buffer.
+	if max := int(ts.winSize.Row)/2 - 1; n > max {
+		n = max
+	}
+	return n + 1
+}
+
+// drawQuickfixRow writes row i of the quickfix window, row 0 being its title bar.
+func (ts *TermState) drawQuickfixRow(i int) {
+	qf, win := ts.qfWin.list, &ts.qfWin
+	width := int(ts.winSize.Col) + 1
+
+	if i == 0 {
+		kind := "Quickfix List"
+		if qf == &ts.loclist {
+			kind = "Location List"
+		}
+		title := fmt.Sprintf("[%s] %s", kind, qf.title)
+		if len(title) > width {
+			title = title[:width]
+		}
+		fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(render.Inverted), width, title, render.ColorCode(render.Reset))
+		return
+	}
+
+	rows := ts.quickfixHeight() - 1
+	if win.cursor < win.offset {
+		win.offset = win.cursor
+	}
+	if win.cursor >= win.offset+rows {
+		win.offset = win.cursor - rows + 1
+	}
+
+	idx := win.offset + i - 1
+	if idx >= len(qf.entries) {
+		return
+	}
+	e := qf.entries[idx]
+	line := fmt.Sprintf("%s|%d col %d| %s", e.filename, e.row+1, e.col+1, strings.TrimSpace(e.text))
+	if len(line) > width {
+		line = line[:width]
+	}
+
+	switch {
+	case win.focused && idx == win.cursor:
+		fmt.Fprintf(ts.w, "%s%-*s%s", render.ColorCode(render.Inverted), width, line, render.ColorCode(render.Reset))
+	case idx == qf.idx:
+		// The current entry is shown in bold, like vim's QuickFixLine highlight.
+		fmt.Fprintf(ts.w, "%s%s%s", render.ColorCode(render.Bold), line, render.ColorCode(render.Reset))
+	default:
+		ts.w.WriteString(line)
+	}
+}
+
+func processQuickfixPress(ts *TermState, b byte) {
+	win := &ts.qfWin
+	switch b {
+	case 'j':
+		if win.cursor < len(win.list.entries)-1 {
+			win.cursor++
+		}
+	case 'k':
+		if win.cursor > 0 {
+			win.cursor--
+		}
+	case 'q':
+		ts.qfWin = quickfixWindow{}
+	case ':':
+		ts.mode = commandMode
+		ts.commandBuf = ""
+	case input.Ctrl('w'):
+		switch ts.readKey() {
+		case 'k', 'w', input.Ctrl('k'), input.Ctrl('w'):
+			win.focused = false
+		}
+	case '\r':
+		win.focused = false
+		if err := ts.jumpToEntry(win.list, win.cursor); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	}
+}
+
+// runMake runs makeprg in the background, with any arguments appended, and fills qf with the
+// errors parsed from its output using errorformat. Unless a bang is given the cursor jumps to the
+// first once it finishes.
+func (ts *TermState) runMake(qf *quickfixList, a exArgs) error {
+	formats, err := parseErrorFormats(ts.opts.errorformat)
+	if err != nil {
+		return err
+	}
+
+	prg := ts.opts.makeprg
+	if a.arg != "" {
+		prg += " " + a.arg
+	}
+	ts.resetList(qf, ":"+prg)
+
+	var j *job
+	var out strings.Builder
+	collect := func(line string) {
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	finish := func(runErr error) {
+		if qf.job != j {
+			return
+		}
+		qf.job = nil
+		qf.entries = parseErrors(out.String(), formats)
+
+		n := len(qf.entries)
+		if n > 0 && !a.bang {
+			if err := ts.jumpToEntry(qf, 0); err != nil {
+				ts.statusMsg = err.Error()
+				return
+			}
+		}
+		switch {
+		case n > 0:
+			ts.statusMsg = fmt.Sprintf("%s: %d errors", prg, n)
+		case runErr != nil:
+			ts.statusMsg = fmt.Sprintf("%s: %v", prg, runErr)
+		default:
+			ts.statusMsg = fmt.Sprintf("%s: no errors", prg)
+		}
+	}
+
+	j, err = ts.startJob("make", exec.Command("sh", "-c", prg),
+		jobCallbacks{onStdout: collect, onStderr: collect, onExit: finish})
+	if err != nil {
+		return err
+	}
+	qf.job = j
+	ts.statusMsg = "running " + prg
+	return nil
+}
@@ -0,0 +1,99 @@
+package editor
+
+import (
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// rainbowColors are the colors of brackets by how deeply they're nested, repeating after the last.
+var rainbowColors = []render.Color{render.FgYellow, render.FgMagenta, render.FgCyan, render.FgBlue,
+	render.FgGreen}
+
+// rainbowState is the colored brackets of one buffer.
+type rainbowState struct {
+	spans   [][]textSpan // Brackets on each row
+	changes int          // The buffer's Changes when they were found
+}
+
+// rainbowBrackets returns a span for each bracket in b, colored by its depth. Closing brackets
+// with no match are red. Brackets in comments, and in strings and character literals on a single
+// line, aren't counted.
+func rainbowBrackets(b *buffer.Buffer) [][]textSpan {
+	lines := b.Lines(0, b.Len())
+	// In prose files everything is a comment, but brackets there are still worth matching.
+	var comments [][][2]int
+	if !proseFile(b.Filename) {
+		comments = proseRegions(b.Filename, lines)
+	}
+	spans := make([][]textSpan, len(lines))
+	var open []byte // Brackets not yet closed, innermost last
+	for row, line := range lines {
+		var skip [][2]int
+		if comments != nil {
+			skip = comments[row]
+		}
+		for col := 0; col < len(line); col++ {
+			for len(skip) > 0 && col >= skip[0][1] {
+				skip = skip[1:]
+			}
+			if len(skip) > 0 && col >= skip[0][0] {
+				col = skip[0][1] - 1
+				skip = skip[1:]
+				continue
+			}
+			c := line[col]
+			switch {
+			case c == '"':
+				col += closingQuote(line[col:])
+			case c == '\'':
+				// Only short quotes are skipped, as in Lisp a quote needn't be closed.
+				if end := closingQuote(line[col:]); end > 0 && end <= 4 {
+					col += end
+				}
+			case brackets[c].match == 0:
+			case brackets[c].open:
+				color := rainbowColors[len(open)%len(rainbowColors)]
+				spans[row] = append(spans[row], textSpan{col, col + 1, render.ColorCode(color)})
+				open = append(open, c)
+			case len(open) > 0 && open[len(open)-1] == brackets[c].match:
+				open = open[:len(open)-1]
+				color := rainbowColors[len(open)%len(rainbowColors)]
+				spans[row] = append(spans[row], textSpan{col, col + 1, render.ColorCode(color)})
+			default:
+				spans[row] = append(spans[row], textSpan{col, col + 1, render.ColorCode(render.FgRed)})
+			}
+		}
+	}
+	return spans
+}
+
+// closingQuote returns the offset in s of the quote closing the one s starts with, skipping
+// escaped quotes, or the end of s if it isn't closed.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// rainbowSpans returns the colored brackets on row when the rainbow option is on, finding them
+// again if the buffer has changed.
+func (ts *TermState) rainbowSpans(row int) []textSpan {
+	if !ts.opts.rainbow || ts.buf.LargeFile {
+		return nil
+	}
+	rs := ts.rainbow[ts.buf]
+	if rs == nil || rs.changes != ts.buf.Changes() {
+		rs = &rainbowState{spans: rainbowBrackets(ts.buf), changes: ts.buf.Changes()}
+		ts.rainbow[ts.buf] = rs
+	}
+	if row < len(rs.spans) {
+		return rs.spans[row]
+	}
+	return nil
+}
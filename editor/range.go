@@ -0,0 +1,360 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// substitution is a :s command, remembered so it can be repeated.
+type substitution struct {
+	re     *regexp.Regexp
+	repl   string
+	global bool // Replace every match on a line, not just the first
+}
+
+// parseAddress parses a single line address at the start of s: a number, '.', '$', 'x for a mark
+// or /pattern/, followed by any +N or -N offsets. It returns the 0-indexed row and the rest of s.
+func (ts *TermState) parseAddress(s string) (int, string, bool, error) {
+	row, found := ts.cursorY, true
+	switch {
+	case s == "":
+		return 0, s, false, nil
+	case s[0] == '.':
+		s = s[1:]
+	case s[0] == '$':
+		row, s = ts.buf.Len()-1, s[1:]
+	case s[0] >= '0' && s[0] <= '9':
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n, _ := strconv.Atoi(s[:i])
+		row, s = n-1, s[i:]
+	case s[0] == '\'' && len(s) > 1:
+		pos, ok := ts.buf.Marks[s[1]]
+		if !ok {
+			return 0, s, false, fmt.Errorf("mark not set: %c", s[1])
+		}
+		row, s = pos.Row, s[2:]
+	case s[0] == '/':
+		end := strings.IndexByte(s[1:], '/')
+		pattern := s[1:]
+		if end >= 0 {
+			pattern, s = s[1:end+1], s[end+2:]
+		} else {
+			s = ""
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return 0, s, false, err
+		}
+		if row, err = ts.searchForward(re); err != nil {
+			return 0, s, false, err
+		}
+	case s[0] == '+' || s[0] == '-':
+		// An offset alone is relative to the current line.
+	default:
+		found = false
+	}
+
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		i := 1
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n := 1
+		if i > 1 {
+			n, _ = strconv.Atoi(s[1:i])
+		}
+		row, s, found = row+sign*n, s[i:], true
+	}
+	return row, s, found, nil
+}
+
+// searchForward returns the first row after the cursor matching re, wrapping around the end of
+// the buffer.
+func (ts *TermState) searchForward(re *regexp.Regexp) (int, error) {
+	n := ts.buf.Len()
+	for i := 1; i <= n; i++ {
+		row := (ts.cursorY + i) % n
+		if re.MatchString(ts.buf.Line(row)) {
+			return row, nil
+		}
+	}
+	return 0, fmt.Errorf("pattern not found: %s", re)
+}
+
+// parseRange parses an optional line range at the start of a command line, such as "%", "3",
+// ".,$" or "'a,'b", into a. The rest of the line is returned.
+func (ts *TermState) parseRange(line string, a *exArgs) (string, error) {
+	if strings.HasPrefix(line, "%") {
+		a.hasRange, a.line1, a.line2 = true, 0, ts.buf.Len()-1
+		return line[1:], nil
+	}
+
+	first, rest, found, err := ts.parseAddress(line)
+	if err != nil {
+		return "", err
+	}
+	a.line1, a.line2 = ts.cursorY, ts.cursorY
+	if !found && !strings.HasPrefix(rest, ",") {
+		// An empty buffer has no current line, so the range is empty.
+		if ts.buf.Len() == 0 {
+			a.line1, a.line2 = 0, -1
+		}
+		return rest, nil
+	}
+	a.hasRange, a.line1, a.line2 = true, first, first
+
+	if strings.HasPrefix(rest, ",") {
+		second, r, found, err := ts.parseAddress(rest[1:])
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			// A missing address after the comma is the current line, as in vim.
+			second = ts.cursorY
+		}
+		a.line2, rest = second, r
+	}
+
+	if a.line1 > a.line2 {
+		a.line1, a.line2 = a.line2, a.line1
+	}
+	if a.line1 < 0 || a.line2 >= ts.buf.Len() {
+		if ts.buf.Len() == 0 {
+			a.line1, a.line2 = 0, -1
+			return rest, nil
+		}
+		return "", fmt.Errorf("invalid range")
+	}
+	return rest, nil
+}
+
+// cmdDelete is :[range]delete [x], deleting the lines in the range, the current line by default,
+// into register x or the numbered registers, see setRegister.
+func cmdDelete(ts *TermState, a exArgs) error {
+	if a.line2 < a.line1 {
+		return nil
+	}
+	reg, err := registerArg(a.arg, "delete [x]")
+	if err != nil {
+		return err
+	}
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	lines := register{lines: ts.buf.Lines(a.line1, a.line2+1), linewise: true, secret: ts.buf.Encrypted()}
+	if err := ts.setRegister(reg, lines, true); err != nil {
+		return err
+	}
+	if err := ts.setLines(a.line1, a.line2+1, nil); err != nil {
+		return err
+	}
+	ts.setCursor(a.line1, 0)
+	return nil
+}
+
+// cmdPrint shows the lines in the range, the current line by default.
+func cmdPrint(ts *TermState, a exArgs) error {
+	if a.line2 < a.line1 {
+		return fmt.Errorf("buffer is empty")
+	}
+	ts.msgLines = append(ts.msgLines, ts.buf.Lines(a.line1, a.line2+1)...)
+	ts.setCursor(a.line2, 0)
+	return nil
+}
+
+// cmdSubstitute replaces matches of a pattern in the range, :s/pattern/replacement/[g]. Any
+// character can be used instead of '/'. In the replacement & is the whole match, \1 to \9 are
+// submatches and \& a literal '&'. With no pattern the last substitution is repeated.
+func cmdSubstitute(ts *TermState, a exArgs) error {
+	sub := ts.lastSub
+	if a.arg != "" && !isLetter(a.arg[0]) {
+		parts := splitDelimited(a.arg)
+		if len(parts) < 2 {
+			return fmt.Errorf("usage: s/pattern/replacement/[g]")
+		}
+		re, err := regexp.Compile(parts[0])
+		if err != nil {
+			return err
+		}
+		sub = &substitution{re: re, repl: parts[1]}
+		if len(parts) > 2 {
+			sub.global = strings.Contains(parts[2], "g")
+		}
+		ts.lastSub = sub
+	} else if sub == nil {
+		return fmt.Errorf("no previous substitute regular expression")
+	}
+	return ts.substitute(sub, a.line1, a.line2)
+}
+
+// cmdRepeatSubstitute is :&[&][g], repeating the last :s on the range with the same pattern and
+// replacement. :&& keeps its flags, otherwise only those given are used.
+func cmdRepeatSubstitute(ts *TermState, a exArgs) error {
+	if ts.lastSub == nil {
+		return fmt.Errorf("no previous substitute regular expression")
+	}
+	sub := *ts.lastSub
+	flags := a.arg
+	if strings.HasPrefix(flags, "&") {
+		flags = flags[1:]
+	} else {
+		sub.global = false
+	}
+	if strings.Contains(flags, "g") {
+		sub.global = true
+	}
+	return ts.substitute(&sub, a.line1, a.line2)
+}
+
+// substitute applies sub to rows first to last, reporting how many lines changed.
+func (ts *TermState) substitute(sub *substitution, first, last int) error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	changed, subs := 0, 0
+	for row := first; row <= last && row < ts.buf.Len(); row++ {
+		line := ts.buf.Line(row)
+		matches := sub.re.FindAllStringSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		if !sub.global {
+			matches = matches[:1]
+		}
+
+		var b strings.Builder
+		prev := 0
+		for _, m := range matches {
+			b.WriteString(line[prev:m[0]])
+			b.WriteString(expandReplacement(sub.repl, line, m))
+			prev = m[1]
+		}
+		b.WriteString(line[prev:])
+		subs += len(matches)
+		ts.buf.SetLine(row, b.String())
+		ts.setCursor(row, 0)
+		changed++
+	}
+	if changed == 0 {
+		return fmt.Errorf("pattern not found: %s", sub.re)
+	}
+	if subs > 1 {
+		ts.statusMsg = fmt.Sprintf("%d substitutions on %d lines", subs, changed)
+	}
+	return nil
+}
+
+// expandReplacement builds the replacement for a single match, given as submatch indexes into line.
+func expandReplacement(repl, line string, m []int) string {
+	var b strings.Builder
+	for i := 0; i < len(repl); i++ {
+		c := repl[i]
+		switch {
+		case c == '&':
+			b.WriteString(line[m[0]:m[1]])
+		case c == '\\' && i+1 < len(repl):
+			i++
+			n := int(repl[i] - '0')
+			switch {
+			case repl[i] >= '0' && repl[i] <= '9':
+				if 2*n+1 < len(m) && m[2*n] >= 0 {
+					b.WriteString(line[m[2*n]:m[2*n+1]])
+				}
+			case repl[i] == 'n':
+				// Splitting lines isn't supported, so \n is left as is.
+				b.WriteString(`\n`)
+			case repl[i] == 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(repl[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// splitDelimited splits "/a/b/c" on its first character, which may be escaped with a backslash.
+func splitDelimited(s string) []string {
+	delim := s[0]
+	var parts []string
+	var cur strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case s[i] == delim:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// cmdGlobal runs a command on every line in the range matching a pattern, :g/pattern/command,
+// or on every line not matching with :g! or :v. The command defaults to p.
+func cmdGlobal(ts *TermState, a exArgs) error {
+	return ts.global(a, a.bang)
+}
+
+func cmdVglobal(ts *TermState, a exArgs) error {
+	return ts.global(a, true)
+}
+
+func (ts *TermState) global(a exArgs, invert bool) error {
+	if a.arg == "" {
+		return fmt.Errorf("usage: g/pattern/command")
+	}
+	parts := splitDelimited(a.arg)
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return err
+	}
+	command := "p"
+	if len(parts) > 1 && strings.TrimSpace(strings.Join(parts[1:], string(a.arg[0]))) != "" {
+		command = strings.Join(parts[1:], string(a.arg[0]))
+	}
+	if !a.hasRange {
+		a.line1, a.line2 = 0, ts.buf.Len()-1
+	}
+
+	var rows []int
+	for row := a.line1; row <= a.line2; row++ {
+		if re.MatchString(ts.buf.Line(row)) != invert {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("pattern not found: %s", parts[0])
+	}
+
+	// Rows are marked before running any command. Commands are assumed to only change lines from
+	// the one they run on, so later marks are shifted by however many lines were added or removed.
+	shift := 0
+	for _, row := range rows {
+		row += shift
+		if row < 0 || row >= ts.buf.Len() {
+			continue
+		}
+		before := ts.buf.Len()
+		ts.setCursor(row, 0)
+		if err := ts.runCommand(command); err != nil {
+			return err
+		}
+		shift += ts.buf.Len() - before
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package editor
+
+import "testing"
+
+func TestEmptyBufferRange(t *testing.T) {
+	tests := []struct {
+		command string
+		err     bool
+	}{
+		{"p", true},
+		{"%p", true},
+		{"d", false},
+		{"y", true},
+		{"s/a/b/", true},
+		{"put", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ts.RunCommand(tt.command); (err != nil) != tt.err {
+				t.Errorf("error = %v, want error %v", err, tt.err)
+			}
+			if n := ts.buf.Len(); n != 0 {
+				t.Errorf("buffer has %d lines, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// register is the text held in a register. Linewise text is put on lines of its own, other text
+// into the line at the cursor.
+type register struct {
+	lines    []string
+	linewise bool
+	secret   bool // Taken from an encrypted buffer, so it's never saved to disk
+}
+
+// setRegister stores r in register name after a yank or, if deleted, a delete. The unnamed
+// register " gets it too, unless name is the black hole register _, which keeps nothing. Yanks
+// without a register also go to 0, and deletes to 1, shifting the older ones along to 9.
+// Uppercase names append to the lowercase register.
+func (ts *TermState) setRegister(name byte, r register, deleted bool) error {
+	switch {
+	case name == '_':
+		return nil
+	case name == '"' && deleted:
+		for reg := byte('9'); reg > '1'; reg-- {
+			if prev, ok := ts.registers[reg-1]; ok {
+				ts.registers[reg] = prev
+			}
+		}
+		ts.registers['1'] = r
+	case name == '"':
+		ts.registers['0'] = r
+	case name == '+' || name == '*':
+		text := strings.Join(r.lines, "\n")
+		if r.linewise {
+			text += "\n"
+		}
+		if err := ts.copyToClipboard(text); err != nil {
+			return err
+		}
+	case name >= 'A' && name <= 'Z':
+		name += 'a' - 'A'
+		if old, ok := ts.registers[name]; ok {
+			r = joinRegisters(old, r)
+		}
+		ts.registers[name] = r
+	case name >= 'a' && name <= 'z', name >= '0' && name <= '9':
+		ts.registers[name] = r
+	default:
+		return fmt.Errorf("invalid register: %c", name)
+	}
+	ts.registers['"'] = r
+	return nil
+}
+
+// joinRegisters returns the text of r appended to old, on a line of its own if either is
+// linewise.
+func joinRegisters(old, r register) register {
+	lines := append([]string(nil), old.lines...)
+	if old.linewise || r.linewise || len(lines) == 0 {
+		lines = append(lines, r.lines...)
+	} else {
+		lines[len(lines)-1] += r.lines[0]
+		lines = append(lines, r.lines[1:]...)
+	}
+	return register{lines: lines, linewise: old.linewise || r.linewise, secret: old.secret || r.secret}
+}
+
+// getRegister returns the text in register name, to be put. The expression register = has the
+// value of the expression last entered, see promptExpression.
+func (ts *TermState) getRegister(name byte) (register, error) {
+	switch {
+	case name == '_':
+		return register{}, nil
+	case name == '+' || name == '*':
+		return register{}, fmt.Errorf("cannot read the clipboard, paste with the terminal instead")
+	case name >= 'A' && name <= 'Z':
+		name += 'a' - 'A'
+	case name == '"', name == '=', name >= 'a' && name <= 'z', name >= '0' && name <= '9':
+	default:
+		return register{}, fmt.Errorf("invalid register: %c", name)
+	}
+	r, ok := ts.registers[name]
+	if !ok {
+		return register{}, fmt.Errorf("nothing in register %c", name)
+	}
+	return r, nil
+}
+
+// yankLines copies lines to register name, see setRegister.
+func (ts *TermState) yankLines(name byte, lines []string) error {
+	r := register{lines: lines, linewise: true, secret: ts.buf.Encrypted()}
+	if err := ts.setRegister(name, r, false); err != nil {
+		return err
+	}
+	if len(lines) > 1 {
+		ts.statusMsg = fmt.Sprintf("%d lines yanked", len(lines))
+	}
+	return nil
+}
+
+// putLines inserts lines before row, leaving the cursor on the first non-blank of the first.
+func (ts *TermState) putLines(row int, lines []string) error {
+	if row < 0 {
+		row = 0
+	}
+	if row > ts.buf.Len() {
+		row = ts.buf.Len()
+	}
+	if err := ts.setLines(row, row, lines); err != nil {
+		return err
+	}
+	line := ts.buf.Line(row)
+	ts.setCursor(row, len(line)-len(strings.TrimLeft(line, " \t")))
+	return nil
+}
+
+// putRegister is p, or P if before, putting the text in register name after or before the
+// cursor: below or above the current line if it's linewise.
+func (ts *TermState) putRegister(name byte, before bool) error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	r, err := ts.getRegister(name)
+	if err != nil || len(r.lines) == 0 {
+		return err
+	}
+	if r.linewise {
+		row := ts.cursorY
+		if !before && ts.buf.Len() > 0 {
+			row++
+		}
+		return ts.putLines(row, r.lines)
+	}
+
+	line := ""
+	if ts.cursorY < ts.buf.Len() {
+		line = ts.buf.Line(ts.cursorY)
+	}
+	col := ts.cursorX
+	if !before && col < len(line) {
+		_, n := utf8.DecodeRuneInString(line[col:])
+		col += n
+	}
+	lines := append([]string(nil), r.lines...)
+	last := len(lines) - 1
+	// The cursor ends on the last character put, or the first if more than one line was.
+	cursor := col + len(lines[0]) - 1
+	if last > 0 || cursor < col {
+		cursor = col
+	}
+	lines[0] = line[:col] + lines[0]
+	lines[last] += line[col:]
+	end := ts.cursorY + 1
+	if ts.buf.Len() == 0 {
+		end = 0
+	}
+	if err := ts.setLines(ts.cursorY, end, lines); err != nil {
+		return err
+	}
+	ts.setCursor(ts.cursorY, cursor)
+	return nil
+}
+
+// registerCommand handles a normal mode key using register reg, given with "{reg} or the unnamed
+// register. Only yanking whole lines, yy or Y, and putting, p or P, are supported.
+func (ts *TermState) registerCommand(reg, key byte) error {
+	switch key {
+	case 'y':
+		if ts.readKey() != 'y' {
+			return nil
+		}
+		fallthrough
+	case 'Y':
+		if ts.buf.Len() == 0 {
+			return nil
+		}
+		return ts.yankLines(reg, []string{ts.buf.Line(ts.cursorY)})
+	case 'p', 'P':
+		return ts.putRegister(reg, key == 'P')
+	}
+	return nil
+}
+
+// registerArg returns the register named by the argument of :yank, :delete or :put, " if none.
+func registerArg(arg, usage string) (byte, error) {
+	switch len(arg) {
+	case 0:
+		return '"', nil
+	case 1:
+		return arg[0], nil
+	}
+	return 0, fmt.Errorf("usage: %s", usage)
+}
+
+// cmdYank is :[range]yank [x], copying the lines in the range, the current line by default.
+func cmdYank(ts *TermState, a exArgs) error {
+	if a.line2 < a.line1 {
+		return fmt.Errorf("buffer is empty")
+	}
+	reg, err := registerArg(a.arg, "yank [x]")
+	if err != nil {
+		return err
+	}
+	return ts.yankLines(reg, ts.buf.Lines(a.line1, a.line2+1))
+}
+
+// cmdPut is :[line]put[!] [x], putting the text in a register on lines of their own below the
+// line, or above it with !.
+func cmdPut(ts *TermState, a exArgs) error {
+	reg, err := registerArg(a.arg, "put[!] [x]")
+	if err != nil {
+		return err
+	}
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	r, err := ts.getRegister(reg)
+	if err != nil || len(r.lines) == 0 {
+		return err
+	}
+	row := a.line2 + 1
+	if a.bang || ts.buf.Len() == 0 {
+		row = a.line2
+	}
+	return ts.putLines(row, r.lines)
+}
+
+// registerNames are the registers :registers lists, in order.
+const registerNames = `"0123456789abcdefghijklmnopqrstuvwxyz=`
+
+// printable shows the control characters in s as ^X, like the line breaks between lines.
+func printable(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < ' ':
+			b.WriteByte('^')
+			b.WriteByte(c + '@')
+		case c == 0x7f:
+			b.WriteString("^?")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// cmdRegisters is :registers [names], listing what's in each register, or only those named.
+func cmdRegisters(ts *TermState, a exArgs) error {
+	lines := []string{"Type Name Content"}
+	for i := 0; i < len(registerNames); i++ {
+		name := registerNames[i]
+		r, ok := ts.registers[name]
+		if !ok || a.arg != "" && !strings.ContainsRune(a.arg, rune(name)) {
+			continue
+		}
+		kind, text := "c", strings.Join(r.lines, "\n")
+		if r.linewise {
+			kind, text = "l", text+"\n"
+		}
+		lines = append(lines, fmt.Sprintf("  %s  \"%c   %s", kind, name, printable(text)))
+	}
+	if len(lines) == 1 {
+		return fmt.Errorf("registers are empty")
+	}
+	ts.msgLines = lines
+	return nil
+}
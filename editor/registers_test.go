@@ -0,0 +1,104 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetRegister(t *testing.T) {
+	lines := func(s ...string) register { return register{lines: s, linewise: true} }
+	chars := func(s ...string) register { return register{lines: s} }
+	type set struct {
+		name    byte
+		r       register
+		deleted bool
+	}
+	tests := []struct {
+		name string
+		sets []set
+		want map[byte]register
+	}{
+		{
+			name: "yank",
+			sets: []set{{'"', lines("a"), false}},
+			want: map[byte]register{'"': lines("a"), '0': lines("a")},
+		},
+		{
+			name: "deletes shift along",
+			sets: []set{{'"', lines("a"), true}, {'"', lines("b"), true}, {'"', lines("c"), true}},
+			want: map[byte]register{'"': lines("c"), '1': lines("c"), '2': lines("b"), '3': lines("a")},
+		},
+		{
+			name: "yank keeps deletes",
+			sets: []set{{'"', lines("a"), true}, {'"', lines("b"), false}},
+			want: map[byte]register{'"': lines("b"), '0': lines("b"), '1': lines("a")},
+		},
+		{
+			name: "named register",
+			sets: []set{{'a', chars("x"), false}},
+			want: map[byte]register{'"': chars("x"), 'a': chars("x")},
+		},
+		{
+			name: "append characterwise",
+			sets: []set{{'a', chars("x"), false}, {'A', chars("y"), false}},
+			want: map[byte]register{'"': chars("xy"), 'a': chars("xy")},
+		},
+		{
+			name: "append linewise",
+			sets: []set{{'a', chars("x"), false}, {'A', lines("y"), false}},
+			want: map[byte]register{'"': lines("x", "y"), 'a': lines("x", "y")},
+		},
+		{
+			name: "black hole",
+			sets: []set{{'"', lines("a"), false}, {'_', lines("b"), true}},
+			want: map[byte]register{'"': lines("a"), '0': lines("a")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &TermState{registers: make(map[byte]register)}
+			for _, s := range tt.sets {
+				if err := ts.setRegister(s.name, s.r, s.deleted); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(ts.registers, tt.want) {
+				t.Errorf("registers = %+v, want %+v", ts.registers, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteRegisters(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+		unnamed  []string
+	}{
+		{"delete then put", []string{"1d", "$put"}, []string{"b", "c", "a"}, []string{"a"}},
+		{"black hole keeps the yank", []string{"1y", "2d _", "$put"}, []string{"a", "c", "a"}, []string{"a"}},
+		{"older delete", []string{"1d", "1d", "$put 2"}, []string{"c", "a"}, []string{"b"}},
+		{"named register", []string{"2y x", "3d", "1put! x"}, []string{"b", "a", "b"}, []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.buf.SetText([]string{"a", "b", "c"})
+			for _, c := range tt.commands {
+				if _, err := ts.RunCommand(c); err != nil {
+					t.Fatalf("%s: %v", c, err)
+				}
+			}
+			if got := ts.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if got := ts.registers['"'].lines; !reflect.DeepEqual(got, tt.unnamed) {
+				t.Errorf("unnamed register = %q, want %q", got, tt.unnamed)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package editor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// serverEnv is set by a listening zi to its socket path, so commands run from it, such as git,
+// can open files in it with --remote.
+const serverEnv = "ZI_LISTEN_ADDRESS"
+
+// remoteRequest is sent by zi --remote to a listening zi, as a single line of JSON. Files are
+// absolute, as the two may have different working directories.
+type remoteRequest struct {
+	Files        []string `json:"files"`
+	StartLine    int      `json:"startLine"`
+	StartCol     int      `json:"startCol"`
+	StartPattern string   `json:"startPattern"`
+	Wait         bool     `json:"wait"`
+}
+
+// The server replies with one of these lines. With --remote-wait, "done" is sent once the first
+// file's buffer is closed, instead of "ok" as soon as the files are open.
+const (
+	remoteOK   = "ok"
+	remoteDone = "done"
+)
+
+// defaultServerPath is where --remote looks for a server when neither --server nor
+// ZI_LISTEN_ADDRESS say otherwise. Without XDG_RUNTIME_DIR it's in a directory of the temporary
+// directory only the user can write to, so another user can't listen there to be sent file names.
+func defaultServerPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, fmt.Sprintf("zi-%d.sock", os.Getuid())), nil
+	}
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("zi-%d", os.Getuid()))
+	if err := privateDir(dir); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "zi.sock"), nil
+}
+
+// serverPath returns the socket --remote should connect to.
+func serverPath(opts *cliOptions) (string, error) {
+	if opts.server != "" {
+		return opts.server, nil
+	}
+	if path := os.Getenv(serverEnv); path != "" {
+		return path, nil
+	}
+	return defaultServerPath()
+}
+
+// sendRemote asks the zi listening at path to open the files in opts, waiting for the first to
+// be closed if requested. It reports whether a server was found, so the caller can fall back to
+// editing locally like vim does.
+func sendRemote(path string, opts *cliOptions) (bool, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return false, nil
+	}
+	defer conn.Close()
+
+	req := remoteRequest{
+		StartLine:    opts.startLine,
+		StartCol:     opts.startCol,
+		StartPattern: opts.startPattern,
+		Wait:         opts.remoteWait,
+	}
+	for _, f := range opts.files {
+		req.Files = append(req.Files, absPath(f))
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return true, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return true, err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		switch line := scanner.Text(); {
+		case line == remoteDone, line == remoteOK && !req.Wait:
+			return true, nil
+		case strings.HasPrefix(line, "error: "):
+			return true, fmt.Errorf("%s", strings.TrimPrefix(line, "error: "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, fmt.Errorf("server closed the connection")
+}
+
+// listen accepts --remote requests on a unix socket at path. A stale socket left by a zi which
+// didn't exit cleanly is replaced, but not one which is still being listened on.
+func (ts *TermState) listen(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("another zi is already listening at %s", path)
+	}
+	os.Remove(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	ts.listener = l
+	os.Setenv(serverEnv, path)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go ts.readRemoteRequest(conn)
+		}
+	}()
+	return nil
+}
+
+// readRemoteRequest reads a single request from conn and passes it to the main loop.
+func (ts *TermState) readRemoteRequest(conn net.Conn) {
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	var req remoteRequest
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err != nil {
+		fmt.Fprintf(conn, "error: bad request: %v\n", err)
+		conn.Close()
+		return
+	}
+	ts.events <- func() {
+		if err := ts.handleRemoteRequest(conn, req); err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+			conn.Close()
+		}
+	}
+}
+
+// handleRemoteRequest opens the requested files, the first becoming the current buffer. With
+// Wait, conn is kept open until that buffer is closed.
+func (ts *TermState) handleRemoteRequest(conn net.Conn, req remoteRequest) error {
+	if len(req.Files) == 0 {
+		return fmt.Errorf("no files given")
+	}
+	for i := len(req.Files) - 1; i >= 0; i-- {
+		if err := ts.openFile(req.Files[i]); err != nil {
+			return err
+		}
+	}
+	ts.gotoStartPosition(&cliOptions{
+		startLine:    req.StartLine,
+		startCol:     req.StartCol,
+		startPattern: req.StartPattern,
+	})
+
+	fmt.Fprintln(conn, remoteOK)
+	if !req.Wait {
+		conn.Close()
+		return nil
+	}
+	ts.waiters[ts.buf] = append(ts.waiters[ts.buf], conn)
+	ts.statusMsg = "editing for a remote client, :wq or :bd when done"
+	return nil
+}
+
+// releaseWaiters tells any --remote-wait clients for b that it has been closed.
+func (ts *TermState) releaseWaiters(b *buffer.Buffer) {
+	for _, conn := range ts.waiters[b] {
+		fmt.Fprintln(conn, remoteDone)
+		conn.Close()
+	}
+	delete(ts.waiters, b)
+}
+
+// stopListening releases every waiting client and removes the socket, as the editor exits.
+func (ts *TermState) stopListening() {
+	for _, b := range ts.buffers {
+		ts.releaseWaiters(b)
+	}
+	if ts.listener != nil {
+		ts.listener.Close()
+		ts.listener = nil
+	}
+}
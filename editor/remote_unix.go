@@ -0,0 +1,27 @@
+//go:build !windows
+
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// privateDir makes sure dir is a directory only the user can use, creating it if need be.
+func privateDir(dir string) error {
+	if err := os.Mkdir(dir, 0700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 || !ok || int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s isn't a directory private to this user", dir)
+	}
+	return nil
+}
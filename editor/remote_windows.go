@@ -0,0 +1,9 @@
+package editor
+
+import "os"
+
+// privateDir makes sure dir exists. The temporary directory on Windows is already private to the
+// user.
+func privateDir(dir string) error {
+	return os.MkdirAll(dir, 0700)
+}
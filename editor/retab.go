@@ -0,0 +1,101 @@
+package editor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tabStop returns the tabstop option, or 8 if it has been set to something unusable.
+func (ts *TermState) tabStop() int {
+	if ts.opts.tabstop <= 0 {
+		return 8
+	}
+	return ts.opts.tabstop
+}
+
+// leadingSpace returns how many bytes of whitespace line starts with, and how many columns they
+// take with tabs every tabstop columns.
+func leadingSpace(line string, tabstop int) (n, cols int) {
+	for ; n < len(line); n++ {
+		switch line[n] {
+		case ' ':
+			cols++
+		case '\t':
+			cols += tabstop - cols%tabstop
+		default:
+			return n, cols
+		}
+	}
+	return n, cols
+}
+
+// makeIndent returns whitespace taking cols columns, all spaces if spaces is set and otherwise as
+// many tabs as fit with spaces making up the rest.
+func makeIndent(cols, tabstop int, spaces bool) string {
+	if spaces {
+		return strings.Repeat(" ", cols)
+	}
+	return strings.Repeat("\t", cols/tabstop) + strings.Repeat(" ", cols%tabstop)
+}
+
+// insertTab is Tab in insert mode, which with expandtab inserts spaces up to the next tab stop
+// instead of a tab.
+func (ts *TermState) insertTab() {
+	if !ts.opts.expandtab {
+		ts.insertByte('\t')
+		return
+	}
+	tabstop, cols := ts.tabStop(), 0
+	if ts.buf.Len() > 0 {
+		for _, r := range ts.buf.Line(ts.cursorY)[:ts.cursorX] {
+			if r == '\t' {
+				cols += tabstop - cols%tabstop
+			} else {
+				cols++
+			}
+		}
+	}
+	ts.insertText(strings.Repeat(" ", tabstop-cols%tabstop))
+}
+
+// cmdRetab is :[range]retab[!] [N], redoing the indentation of the lines in the range, the whole
+// file by default, with spaces if expandtab is set and with tabs otherwise. Indentation without
+// tabs is only turned into tabs with !. N sets tabstop, with the old value used to work out how
+// wide the existing indentation is.
+func cmdRetab(ts *TermState, a exArgs) error {
+	old := ts.tabStop()
+	tabstop := old
+	if a.arg != "" {
+		n, err := strconv.Atoi(a.arg)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("usage: retab[!] [N]")
+		}
+		tabstop = n
+	}
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	first, last := a.line1, a.line2
+	if !a.hasRange {
+		first, last = 0, ts.buf.Len()-1
+	}
+
+	changed := 0
+	for row := first; row <= last && row < ts.buf.Len(); row++ {
+		line := ts.buf.Line(row)
+		n, cols := leadingSpace(line, old)
+		indent := line[:n]
+		if !ts.opts.expandtab && !a.bang && !strings.Contains(indent, "\t") {
+			continue
+		}
+		if repl := makeIndent(cols, tabstop, ts.opts.expandtab); repl != indent {
+			ts.buf.SetLine(row, repl+line[n:])
+			changed++
+		}
+	}
+	ts.opts.tabstop = tabstop
+	ts.setCursor(ts.cursorY, ts.cursorX)
+	ts.statusMsg = fmt.Sprintf("%d lines changed", changed)
+	return nil
+}
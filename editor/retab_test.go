@@ -0,0 +1,88 @@
+package editor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLeadingSpace(t *testing.T) {
+	tests := []struct {
+		line    string
+		n, cols int
+	}{
+		{"x", 0, 0},
+		{"    x", 4, 4},
+		{"\tx", 1, 8},
+		{"  \tx", 3, 8},
+		{"\t  x", 3, 10},
+		{"   ", 3, 3},
+	}
+	for _, tt := range tests {
+		if n, cols := leadingSpace(tt.line, 8); n != tt.n || cols != tt.cols {
+			t.Errorf("leadingSpace(%q, 8) = %d, %d, want %d, %d", tt.line, n, cols, tt.n, tt.cols)
+		}
+	}
+}
+
+func TestRetab(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		lines    []string
+		want     []string
+	}{
+		{
+			name:     "tabs to spaces",
+			commands: []string{"set ts=4 et", "retab"},
+			lines:    []string{"\tx", "\t\ty", "  \tz"},
+			want:     []string{"    x", "        y", "    z"},
+		},
+		{
+			name:     "spaces left alone without !",
+			commands: []string{"set ts=4 noet", "retab"},
+			lines:    []string{"        x", "    \ty"},
+			want:     []string{"        x", "\t\ty"},
+		},
+		{
+			name:     "spaces to tabs with !",
+			commands: []string{"set ts=4 noet", "retab!"},
+			lines:    []string{"        x", "      y"},
+			want:     []string{"\t\tx", "\t  y"},
+		},
+		{
+			name:     "new tabstop",
+			commands: []string{"set ts=8 noet", "retab 4"},
+			lines:    []string{"\tx", "\t  y"},
+			want:     []string{"\t\tx", "\t\t  y"},
+		},
+		{
+			name:     "range",
+			commands: []string{"set ts=4 et", "2retab"},
+			lines:    []string{"\tx", "\ty"},
+			want:     []string{"\tx", "    y"},
+		},
+		{
+			name:     "blank and unindented lines",
+			commands: []string{"set ts=4 et", "retab"},
+			lines:    []string{"", "x", "\t"},
+			want:     []string{"", "x", "    "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.buf.SetText(tt.lines)
+			for _, c := range tt.commands {
+				if _, err := ts.RunCommand(c); err != nil {
+					t.Fatalf("%s: %v", c, err)
+				}
+			}
+			if got := ts.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+	"github.com/keyan/zi/terminal"
+)
+
+// resume takes the terminal back after being suspended. It may have been resized or drawn over
+// in the meantime, so everything is redrawn.
+func (ts *TermState) resume() {
+	if _, err := terminal.EnableRawMode(int(ts.tty.Fd())); err != nil {
+		ts.logger.Printf("resuming: %v", err)
+	}
+	ts.updateWinSize()
+	ts.grid = nil
+	ts.reportFocus(true)
+	// Files are often changed while zi is suspended.
+	ts.checkFiles()
+}
+
+// cmdSuspend is :suspend, the same as Ctrl-Z in normal mode.
+func cmdSuspend(ts *TermState, a exArgs) error {
+	if ts.headless {
+		return fmt.Errorf("cannot suspend without a terminal")
+	}
+	ts.suspend()
+	return nil
+}
+
+// terminate exits on SIGTERM or SIGHUP. There's no one to ask about unwritten changes, and the
+// terminal may already be gone, so modified buffers are written to recovery files first.
+func (ts *TermState) terminate(sig os.Signal) {
+	ts.logger.Printf("exiting on %v", sig)
+	saved := ts.writeRecovery()
+	ts.keepSwaps = true
+	render.ClearScreen(ts.w)
+	for _, path := range saved {
+		fmt.Fprintf(ts.w, "unwritten changes saved to %s\r\n", path)
+	}
+	ts.w.Flush()
+	ts.exit(nil)
+}
+
+// recoveryDir returns where terminate saves modified buffers, next to the session state.
+func recoveryDir() string {
+	if path := defaultStatePath(); path != "" {
+		return filepath.Join(filepath.Dir(path), "recover")
+	}
+	return filepath.Join(os.TempDir(), "zi-recover")
+}
+
+// writeRecovery writes each modified buffer to its own file in recoveryDir, returning the paths
+// written.
+func (ts *TermState) writeRecovery() []string {
+	dir := recoveryDir()
+	stamp := time.Now().Format("20060102-150405")
+	var saved []string
+	for _, b := range ts.buffers {
+		if !b.Modified {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			ts.logger.Printf("recovery: %v", err)
+			return saved
+		}
+		name := "noname"
+		if b.Filename != "" {
+			name = filepath.Base(b.Filename)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d-%s", stamp, b.Num, name))
+		if _, err := b.WriteFile(path, buffer.WriteOptions{Fsync: true}); err != nil {
+			ts.logger.Printf("recovery: %v", err)
+			continue
+		}
+		ts.logger.Printf("saved buffer %d to %s", b.Num, path)
+		saved = append(saved, path)
+	}
+	return saved
+}
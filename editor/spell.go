@@ -0,0 +1,466 @@
+package editor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/keyan/zi/buffer"
+	"github.com/keyan/zi/render"
+)
+
+// spellState is the misspelled words of one buffer.
+type spellState struct {
+	bad     [][]textSpan // Misspellings on each row
+	changes int          // The buffer's Changes when they were found
+	dict    *dictionary  // The dictionary they were checked against
+}
+
+// commentSyntax is how comments are written in a language, to find the prose in its files.
+type commentSyntax struct {
+	line              string // Starts a comment running to the end of the line
+	blockStart, block string // Start and end a comment, which can span lines
+}
+
+var (
+	cComments    = commentSyntax{line: "//", blockStart: "/*", block: "*/"}
+	hashComments = commentSyntax{line: "#"}
+	dashComments = commentSyntax{line: "--"}
+)
+
+// commentSyntaxes are the languages whose comments are spell checked, by file extension, or by
+// name for files without one.
+var commentSyntaxes = map[string]commentSyntax{
+	".go": cComments, ".c": cComments, ".h": cComments, ".cc": cComments, ".cpp": cComments,
+	".hpp": cComments, ".java": cComments, ".js": cComments, ".ts": cComments, ".jsx": cComments,
+	".tsx": cComments, ".rs": cComments, ".swift": cComments, ".kt": cComments, ".cs": cComments,
+	".scala": cComments, ".dart": cComments, ".zig": cComments, ".proto": cComments,
+	".css": {blockStart: "/*", block: "*/"}, ".py": hashComments, ".sh": hashComments, ".bash": hashComments, ".zsh": hashComments,
+	".rb": hashComments, ".pl": hashComments, ".yaml": hashComments, ".yml": hashComments,
+	".toml": hashComments, ".conf": hashComments, ".cfg": hashComments, ".mk": hashComments,
+	"Makefile": hashComments, "Dockerfile": hashComments,
+	".lua": dashComments, ".sql": dashComments, ".hs": dashComments,
+}
+
+// proseFile reports whether all of a file is prose, such as Markdown or plain text.
+func proseFile(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".md", ".markdown", ".txt", ".rst", ".text":
+		return true
+	case "":
+		_, ok := commentSyntaxes[filepath.Base(filename)]
+		return !ok
+	}
+	return false
+}
+
+// proseRegions returns the parts of each line which are prose, to be spell checked: all of it
+// outside code blocks and inline code in prose files, or the comments in source files. Nothing
+// is returned for other files.
+func proseRegions(filename string, lines []string) [][][2]int {
+	regions := make([][][2]int, len(lines))
+	if proseFile(filename) {
+		fence := ""
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if fence != "" {
+				if strings.HasPrefix(trimmed, fence) {
+					fence = ""
+				}
+				continue
+			}
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+				continue
+			}
+			regions[i] = outsideInlineCode(line)
+		}
+		return regions
+	}
+
+	syntax, ok := commentSyntaxes[filepath.Ext(filename)]
+	if !ok {
+		syntax, ok = commentSyntaxes[filepath.Base(filename)]
+	}
+	if !ok {
+		return regions
+	}
+	inBlock := false
+	for i, line := range lines {
+		for pos := 0; pos < len(line); {
+			if inBlock {
+				end := strings.Index(line[pos:], syntax.block)
+				if end < 0 {
+					regions[i] = append(regions[i], [2]int{pos, len(line)})
+					break
+				}
+				regions[i] = append(regions[i], [2]int{pos, pos + end})
+				pos += end + len(syntax.block)
+				inBlock = false
+				continue
+			}
+			rest := line[pos:]
+			switch {
+			case syntax.line != "" && strings.HasPrefix(rest, syntax.line):
+				regions[i] = append(regions[i], [2]int{pos + len(syntax.line), len(line)})
+				pos = len(line)
+			case syntax.blockStart != "" && strings.HasPrefix(rest, syntax.blockStart):
+				pos += len(syntax.blockStart)
+				inBlock = true
+			case rest[0] == '"' || rest[0] == '`':
+				// Strings are skipped, so comment markers in them aren't taken as comments.
+				end := strings.IndexByte(rest[1:], rest[0])
+				for end > 0 && rest[end] == '\\' {
+					next := strings.IndexByte(rest[end+2:], rest[0])
+					if next < 0 {
+						end = -1
+						break
+					}
+					end += next + 1
+				}
+				if end < 0 {
+					pos = len(line)
+				} else {
+					pos += end + 2
+				}
+			default:
+				pos++
+			}
+		}
+	}
+	return regions
+}
+
+// outsideInlineCode returns the parts of a Markdown line outside `code` spans.
+func outsideInlineCode(line string) [][2]int {
+	var regions [][2]int
+	start := 0
+	for {
+		open := strings.IndexByte(line[start:], '`')
+		if open < 0 {
+			break
+		}
+		close := strings.IndexByte(line[start+open+1:], '`')
+		if close < 0 {
+			break
+		}
+		regions = append(regions, [2]int{start, start + open})
+		start += open + close + 2
+	}
+	return append(regions, [2]int{start, len(line)})
+}
+
+// spellWords returns the start and end of each word to be checked in line from start up to end.
+// Tokens with digits, underscores, dots or other symbols between letters are taken as code
+// rather than words, as are camelCase words, single letters and URLs.
+func spellWords(line string, start, end int, urls [][]int) [][2]int {
+	var words [][2]int
+	for pos := start; pos < end; {
+		// Tokens are separated by whitespace, with punctuation around them trimmed.
+		for pos < end && (line[pos] == ' ' || line[pos] == '\t') {
+			pos++
+		}
+		tokStart := pos
+		for pos < end && line[pos] != ' ' && line[pos] != '\t' {
+			pos++
+		}
+		tokEnd := pos
+		for tokStart < tokEnd {
+			r, n := utf8.DecodeRuneInString(line[tokStart:])
+			if unicode.IsLetter(r) {
+				break
+			}
+			tokStart += n
+		}
+		for tokStart < tokEnd {
+			r, n := utf8.DecodeLastRuneInString(line[tokStart:tokEnd])
+			if unicode.IsLetter(r) {
+				break
+			}
+			tokEnd -= n
+		}
+		if tokStart >= tokEnd || inURL(urls, tokStart) || !wordToken(line[tokStart:tokEnd]) {
+			continue
+		}
+		// Hyphenated words are checked one part at a time.
+		for wordStart := tokStart; wordStart < tokEnd; {
+			wordEnd := strings.IndexByte(line[wordStart:tokEnd], '-')
+			if wordEnd < 0 {
+				wordEnd = tokEnd
+			} else {
+				wordEnd += wordStart
+			}
+			word := line[wordStart:wordEnd]
+			if utf8.RuneCountInString(word) > 1 && !camelCase(word) {
+				words = append(words, [2]int{wordStart, wordEnd})
+			}
+			wordStart = wordEnd + 1
+		}
+	}
+	return words
+}
+
+// wordToken reports whether a token is made of letters, with apostrophes and hyphens between them.
+func wordToken(tok string) bool {
+	prev := ' '
+	for _, r := range tok {
+		switch {
+		case unicode.IsLetter(r):
+		case (r == '\'' || r == '’' || r == '-') && unicode.IsLetter(prev):
+		default:
+			return false
+		}
+		prev = r
+	}
+	return true
+}
+
+// camelCase reports whether word has an uppercase letter after a lowercase one, as identifiers do.
+func camelCase(word string) bool {
+	lower := false
+	for _, r := range word {
+		if unicode.IsUpper(r) && lower {
+			return true
+		}
+		lower = unicode.IsLower(r)
+	}
+	return false
+}
+
+// inURL reports whether the byte at pos is part of one of urls.
+func inURL(urls [][]int, pos int) bool {
+	for _, u := range urls {
+		if u[0] <= pos && pos < u[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// spellStyle is how misspelled words are drawn.
+var spellStyle = render.ColorCode(render.Underline) + render.ColorCode(render.FgRed)
+
+// misspell returns the misspelled words in each row of b.
+func misspell(b *buffer.Buffer, d *dictionary) [][]textSpan {
+	lines := b.Lines(0, b.Len())
+	regions := proseRegions(b.Filename, lines)
+	bad := make([][]textSpan, len(lines))
+	for i, line := range lines {
+		if len(regions[i]) == 0 {
+			continue
+		}
+		urls := findURLs(line)
+		for _, region := range regions[i] {
+			for _, w := range spellWords(line, region[0], region[1], urls) {
+				word := strings.ReplaceAll(line[w[0]:w[1]], "’", "'")
+				if !d.spelledRight(word) && !d.spelledRight(strings.TrimSuffix(word, "'s")) {
+					bad[i] = append(bad[i], textSpan{start: w[0], end: w[1], style: spellStyle})
+				}
+			}
+		}
+	}
+	return bad
+}
+
+// spellFile returns where words added with zg and zw are kept.
+func (ts *TermState) spellFile() string {
+	if ts.opts.spellfile != "" {
+		return ts.opts.spellfile
+	}
+	return filepath.Join(spellDirs()[0], ts.opts.spelllang+".add")
+}
+
+// spellDict returns the dictionary for spelllang, loading it when first needed. If it can't be
+// loaded, spell is turned off again.
+func (ts *TermState) spellDict() (*dictionary, error) {
+	if !ts.opts.spell {
+		return nil, fmt.Errorf("spell checking is not enabled")
+	}
+	if ts.buf.LargeFile {
+		return nil, fmt.Errorf("spell checking is off for large files")
+	}
+	if ts.dict != nil && ts.dict.lang == ts.opts.spelllang && ts.dict.userFile == ts.spellFile() {
+		return ts.dict, nil
+	}
+	d, err := loadDictionary(ts.opts.spelllang)
+	if err == nil {
+		err = d.readUserWords(ts.spellFile())
+	}
+	if err != nil {
+		ts.opts.spell = false
+		return nil, err
+	}
+	ts.dict = d
+	return d, nil
+}
+
+// misspellings returns the misspelled words of the current buffer, checking it again if it has
+// changed.
+func (ts *TermState) misspellings() (*spellState, error) {
+	d, err := ts.spellDict()
+	if err != nil {
+		return nil, err
+	}
+	ss := ts.spell[ts.buf]
+	if ss == nil || ss.changes != ts.buf.Changes() || ss.dict != d {
+		ss = &spellState{bad: misspell(ts.buf, d), changes: ts.buf.Changes(), dict: d}
+		ts.spell[ts.buf] = ss
+	}
+	return ss, nil
+}
+
+// spellSpans returns the misspelled words on row, to be drawn in spellStyle. A dictionary which
+// fails to load is reported here, as spell is drawn with.
+func (ts *TermState) spellSpans(row int) []textSpan {
+	if !ts.opts.spell {
+		return nil
+	}
+	ss, err := ts.misspellings()
+	if err != nil {
+		ts.statusMsg = err.Error()
+		return nil
+	}
+	if row < len(ss.bad) {
+		return ss.bad[row]
+	}
+	return nil
+}
+
+// nextMisspelling is ]s and [s, moving the cursor to the next or previous misspelled word,
+// wrapping around the end of the buffer.
+func (ts *TermState) nextMisspelling(forward bool) error {
+	ss, err := ts.misspellings()
+	if err != nil {
+		return err
+	}
+	n := len(ss.bad)
+	if n == 0 {
+		return fmt.Errorf("no misspelled words")
+	}
+	// Rows are searched from the cursor round to it again, checking its own row at both ends.
+	for step := 0; step <= n; step++ {
+		row := ts.cursorY + step
+		if !forward {
+			row = ts.cursorY - step
+		}
+		wrapped := row >= n || row < 0
+		row = ((row % n) + n) % n
+		spans := ss.bad[row]
+		for j := range spans {
+			s := spans[j]
+			if !forward {
+				s = spans[len(spans)-1-j]
+			}
+			switch {
+			case step == 0 && forward && s.start <= ts.cursorX,
+				step == 0 && !forward && s.start >= ts.cursorX,
+				step == n && forward && s.start > ts.cursorX,
+				step == n && !forward && s.start < ts.cursorX:
+				continue
+			}
+			ts.cursorY, ts.cursorX = row, s.start
+			if wrapped && forward {
+				ts.statusMsg = "search hit BOTTOM, continuing at TOP"
+			} else if wrapped {
+				ts.statusMsg = "search hit TOP, continuing at BOTTOM"
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no misspelled words")
+}
+
+// spellWordAt returns the start and end of the word under the cursor: the misspelled word there,
+// or failing that the run of letters and apostrophes around it.
+func (ts *TermState) spellWordAt(ss *spellState) (int, int, error) {
+	if ts.cursorY >= ts.buf.Len() {
+		return 0, 0, fmt.Errorf("no word under cursor")
+	}
+	if ts.cursorY < len(ss.bad) {
+		for _, s := range ss.bad[ts.cursorY] {
+			if s.start <= ts.cursorX && ts.cursorX < s.end {
+				return s.start, s.end, nil
+			}
+		}
+	}
+	start, end := wordAround(ts.buf.Line(ts.cursorY), ts.cursorX)
+	if start == end {
+		return 0, 0, fmt.Errorf("no word under cursor")
+	}
+	return start, end, nil
+}
+
+// wordAround returns the start and end of the word of letters around byte x of line, with any
+// apostrophes inside it. They're equal if there's no word there.
+func wordAround(line string, x int) (int, int) {
+	inWord := func(r rune) bool { return unicode.IsLetter(r) || r == '\'' || r == '’' }
+	start, end := x, x
+	for start > 0 {
+		r, n := utf8.DecodeLastRuneInString(line[:start])
+		if !inWord(r) {
+			break
+		}
+		start -= n
+	}
+	for end < len(line) {
+		r, n := utf8.DecodeRuneInString(line[end:])
+		if !inWord(r) {
+			break
+		}
+		end += n
+	}
+	word := strings.Trim(line[start:end], "'’")
+	if word == "" {
+		return x, x
+	}
+	start += strings.Index(line[start:end], word)
+	return start, start + len(word)
+}
+
+// suggestSpelling is z=, offering corrections for the word under the cursor in a picker and
+// replacing it with the one chosen.
+func (ts *TermState) suggestSpelling() error {
+	ss, err := ts.misspellings()
+	if err != nil {
+		return err
+	}
+	start, end, err := ts.spellWordAt(ss)
+	if err != nil {
+		return err
+	}
+	word := ts.buf.Line(ts.cursorY)[start:end]
+	suggestions := ss.dict.suggest(word)
+	if len(suggestions) == 0 {
+		return fmt.Errorf("sorry, no suggestions for %q", word)
+	}
+	return ts.pickReplacement(fmt.Sprintf("Change %q to", word), start, end, suggestions)
+}
+
+// addSpellWord is zg and zw, adding the word under the cursor to the user's spell file as a good
+// word, or with wrong as a bad one.
+func (ts *TermState) addSpellWord(wrong bool) error {
+	ss, err := ts.misspellings()
+	if err != nil {
+		return err
+	}
+	start, end, err := ts.spellWordAt(ss)
+	if err != nil {
+		return err
+	}
+	word := ts.buf.Line(ts.cursorY)[start:end]
+	if err := ss.dict.addUserWord(word, wrong); err != nil {
+		return err
+	}
+	// Every buffer is checked again with the word.
+	for b := range ts.spell {
+		delete(ts.spell, b)
+	}
+	if wrong {
+		ts.statusMsg = fmt.Sprintf("Word %q added to %s as a bad word", word, ss.dict.userFile)
+	} else {
+		ts.statusMsg = fmt.Sprintf("Word %q added to %s", word, ss.dict.userFile)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package editor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// maxOldFiles is how many recently opened files are remembered.
+const maxOldFiles = 100
+
+// fileMark is an uppercase mark, which unlike lowercase marks also remembers its file.
+type fileMark struct {
+	Filename string
+	Row      int
+	Col      int
+}
+
+// savedRegister is a named register, such as a recorded macro, kept between sessions.
+type savedRegister struct {
+	Lines    []string
+	Linewise bool `json:",omitempty"`
+}
+
+// sessionState is the editor state persisted between sessions, similar to vim's viminfo.
+type sessionState struct {
+	OldFiles  []string
+	FileMarks map[string]fileMark
+	Registers map[string]savedRegister
+}
+
+// defaultStatePath returns where session state is kept, following XDG conventions.
+func defaultStatePath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "zi", "state.json")
+}
+
+// loadState reads session state from ts.statePath. Missing or unreadable state is ignored, it
+// only makes for a less convenient start.
+func (ts *TermState) loadState() {
+	if ts.statePath == "" {
+		return
+	}
+	data, err := os.ReadFile(ts.statePath)
+	if err != nil {
+		return
+	}
+	var st sessionState
+	if err := json.Unmarshal(data, &st); err != nil {
+		ts.logger.Printf("reading %s: %v", ts.statePath, err)
+		return
+	}
+
+	ts.oldFiles = st.OldFiles
+	for name, m := range st.FileMarks {
+		if len(name) == 1 {
+			ts.fileMarks[name[0]] = m
+		}
+	}
+	for name, r := range st.Registers {
+		if len(name) == 1 && name[0] >= 'a' && name[0] <= 'z' {
+			ts.registers[name[0]] = register{lines: r.Lines, linewise: r.Linewise}
+		}
+	}
+}
+
+// saveState writes session state to ts.statePath.
+func (ts *TermState) saveState() error {
+	if ts.statePath == "" {
+		return nil
+	}
+
+	st := sessionState{
+		OldFiles:  ts.oldFiles,
+		FileMarks: make(map[string]fileMark),
+		Registers: make(map[string]savedRegister),
+	}
+	for name, m := range ts.fileMarks {
+		st.FileMarks[string(name)] = m
+	}
+	// Only the named registers are kept, the others change too often to be worth it. Text from
+	// encrypted buffers isn't written unencrypted, as with swap files.
+	for name, r := range ts.registers {
+		if name >= 'a' && name <= 'z' && !r.secret {
+			st.Registers[string(name)] = savedRegister{Lines: r.lines, Linewise: r.linewise}
+		}
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ts.statePath), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(ts.statePath, data, 0600)
+}
+
+// addOldFile moves filename to the front of the recently opened files.
+func (ts *TermState) addOldFile(filename string) {
+	abs := absPath(filename)
+	files := []string{abs}
+	for _, f := range ts.oldFiles {
+		if f != abs && len(files) < maxOldFiles {
+			files = append(files, f)
+		}
+	}
+	ts.oldFiles = files
+}
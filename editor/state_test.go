@@ -0,0 +1,78 @@
+package editor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSaveStateRegisters(t *testing.T) {
+	run := func(command string) func(ts *TermState) error {
+		return func(ts *TermState) error {
+			_, err := ts.RunCommand(command)
+			return err
+		}
+	}
+	record := func(ts *TermState) error {
+		if err := ts.startRecording('c'); err != nil {
+			return err
+		}
+		ts.recordKey('x')
+		ts.stopRecording()
+		return nil
+	}
+	tests := []struct {
+		name      string
+		encrypted bool
+		steps     []func(ts *TermState) error
+		want      []string
+	}{
+		{"plain", false, []func(ts *TermState) error{run("y a"), run("d b"), record}, []string{"a", "b", "c", "s"}},
+		{"encrypted", true, []func(ts *TermState) error{run("y a"), run("d b"), record}, []string{"s"}},
+		{"appended from encrypted", true, []func(ts *TermState) error{run("y S")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.statePath = filepath.Join(t.TempDir(), "state.json")
+			ts.buf.SetText([]string{"secret", "text"})
+			ts.registers['s'] = register{lines: []string{"saved"}}
+			if tt.encrypted {
+				if err := ts.buf.SetKey("key"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, step := range tt.steps {
+				if err := step(ts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := ts.saveState(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(ts.statePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var st sessionState
+			if err := json.Unmarshal(data, &st); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for name := range st.Registers {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("saved registers %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// cmdSudoWrite is :SudoWrite [file], or :w!!, writing the buffer as root with sudo, for files
+// such as those in /etc that were opened without the rights to write them. If sudo needs a
+// password it's asked for here, since sudo reading the terminal itself would race readKeys.
+func cmdSudoWrite(ts *TermState, a exArgs) error {
+	filename := a.arg
+	if filename == "" {
+		filename = ts.buf.Filename
+	}
+	if filename == "" {
+		return fmt.Errorf("no file name")
+	}
+	if ts.buf.BrowseDir != "" && a.arg == "" {
+		return fmt.Errorf("cannot write a directory listing")
+	}
+	if !buffer.IsLocal(filename) {
+		return fmt.Errorf("can only write local files with sudo")
+	}
+	if ts.buf.ReadOnly && !a.bang && filename == ts.buf.Filename {
+		return fmt.Errorf("'readonly' option is set (add ! to override)")
+	}
+	if filename == ts.buf.Filename && ts.buf.ChangedOnDisk() && !ts.buf.NewFile && !a.bang {
+		return fmt.Errorf("%s has changed since it was read (add ! to overwrite)", filename)
+	}
+	if filename == ts.buf.Filename && ts.buf.NotEdited && !a.bang {
+		return fmt.Errorf("%s exists and wasn't read (add ! to overwrite)", filename)
+	}
+
+	ts.doAutocmd("BufWritePre", filename)
+	ts.fixEOL(ts.buf)
+	err := ts.sudoWrite(filename, "")
+	if errors.Is(err, buffer.ErrSudoPassword) && !ts.headless {
+		ts.prompt("[sudo] password: ", "", func(password string) error {
+			return ts.sudoWrite(filename, password)
+		})
+		ts.promptSecret = true
+		return nil
+	}
+	return err
+}
+
+// sudoWrite writes the current buffer to filename with sudo, giving it password if it's needed.
+func (ts *TermState) sudoWrite(filename, password string) error {
+	opts := buffer.WriteOptions{Fsync: ts.opts.fsync, Sudo: true, SudoPassword: password}
+	n, err := ts.buf.WriteFile(filename, opts)
+	if err != nil {
+		return err
+	}
+	ts.written(ts.buf, filename)
+	ts.statusMsg = fmt.Sprintf("%q %dL, %dB written", filename, ts.buf.Len(), n)
+	ts.refreshHex()
+	ts.doAutocmd("BufWritePost", filename)
+	return nil
+}
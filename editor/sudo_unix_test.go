@@ -0,0 +1,108 @@
+//go:build !windows
+
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSudo puts a sudo on PATH which runs commands as the current user once "secret" has been
+// given to sudo -v, or straight away if noPassword.
+const fakeSudo = `#!/bin/sh
+if [ "$1" = -S ]; then
+	read password
+	[ "$password" = secret ] && touch "$SUDO_STAMP" && exit 0
+	echo "sudo: 1 incorrect password attempt" >&2
+	exit 1
+fi
+shift
+if [ ! -e "$SUDO_STAMP" ]; then
+	echo "sudo: a password is required" >&2
+	exit 1
+fi
+exec "$@"
+`
+
+func TestSudoWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		password bool
+		err      bool
+	}{
+		{"SudoWrite", "SudoWrite", false, false},
+		{"w!!", "w!!", false, false},
+		{"w!! to another file", "w!! other.txt", false, false},
+		{"password needed", "w!!", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0700); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+			stamp := filepath.Join(dir, "stamp")
+			t.Setenv("SUDO_STAMP", stamp)
+			if !tt.password {
+				os.WriteFile(stamp, nil, 0600)
+			}
+			t.Chdir(dir)
+
+			ts, err := NewHeadless("f.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts.buf.SetText([]string{"root only"})
+			_, err = ts.RunCommand(tt.command)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if _, err := os.Stat("!"); err == nil {
+				t.Error("wrote a file named !")
+			}
+			want := "f.txt"
+			if tt.command == "w!! other.txt" {
+				want = "other.txt"
+			}
+			data, err := os.ReadFile(want)
+			if tt.err {
+				if err == nil {
+					t.Errorf("%s written without the password", want)
+				}
+				return
+			}
+			if string(data) != "root only\n" {
+				t.Errorf("%s = %q, %v, want \"root only\\n\"", want, data, err)
+			}
+		})
+	}
+}
+
+func TestSudoWritePassword(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("SUDO_STAMP", filepath.Join(dir, "stamp"))
+	t.Chdir(dir)
+
+	ts, err := NewHeadless("f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.buf.SetText([]string{"text"})
+	if err := ts.sudoWrite("f.txt", "wrong"); err == nil {
+		t.Error("wrote with the wrong password")
+	}
+	if err := ts.sudoWrite("f.txt", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	// The password is only given to sudo -v, never written to the file.
+	if data, _ := os.ReadFile("f.txt"); string(data) != "text\n" {
+		t.Errorf("f.txt = %q, want \"text\\n\"", data)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package editor
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/keyan/zi/render"
+	"github.com/keyan/zi/terminal"
+	"golang.org/x/sys/unix"
+)
+
+// suspend stops zi as Ctrl-Z would in a cooked terminal, handing the terminal back to the shell.
+// ISIG is off in raw mode, so the terminal doesn't do this itself. It returns once zi has been
+// continued with SIGCONT, such as by fg.
+func (ts *TermState) suspend() {
+	if ts.tty == nil {
+		return
+	}
+	resumed := make(chan os.Signal, 1)
+	signal.Notify(resumed, unix.SIGCONT)
+	defer signal.Stop(resumed)
+
+	// Leave the shell prompt below the editor, with the cursor visible again.
+	render.MoveCursor(ts.w, int(ts.winSize.Row), 0)
+	fmt.Fprintf(ts.w, "%c%c?25h\r\n", render.EscapeChar, render.EscapeSeqBegin)
+	ts.restoreTitle()
+	ts.setCursorShape(render.CursorDefault)
+	ts.reportFocus(false)
+	ts.w.Flush()
+	terminal.DisableRawMode(int(ts.tty.Fd()), ts.oldTerm)
+
+	// Stop the whole process group, as the terminal would, in case zi was started in a pipeline.
+	if err := unix.Kill(0, unix.SIGTSTP); err != nil {
+		ts.statusMsg = fmt.Sprintf("cannot suspend: %v", err)
+	} else {
+		// The stop happens asynchronously, nothing more can be drawn until it's over.
+		<-resumed
+	}
+	ts.resume()
+}
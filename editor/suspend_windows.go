@@ -0,0 +1,6 @@
+package editor
+
+// suspend would stop zi for job control, which Windows consoles don't have.
+func (ts *TermState) suspend() {
+	ts.statusMsg = "suspend is not supported on Windows"
+}
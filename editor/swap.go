@@ -0,0 +1,213 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// swapHeader starts every swap file. The header lines which follow it are "key value" pairs,
+// then an empty line and the buffer's text.
+const swapHeader = "zi swap file"
+
+// swapKeys is how many keys are typed before swap files are written, if the editor doesn't go
+// idle for updatetime first.
+const swapKeys = 200
+
+// swapFile is the swap file kept for a buffer, holding its text so unwritten changes can be
+// recovered if zi is killed or its connection drops.
+type swapFile struct {
+	path    string
+	changes int // The buffer's Changes when the swap file was last written
+}
+
+// swapInfo is what a swap file records about the editor which wrote it.
+type swapInfo struct {
+	pid      int
+	host     string
+	modified bool // true if the text has unwritten changes
+	lines    []string
+}
+
+// swapPath returns the path of the swap file for filename, a hidden file next to it as in vim.
+func swapPath(filename string) string {
+	dir, base := filepath.Split(absPath(filename))
+	return filepath.Join(dir, "."+base+".swp")
+}
+
+// wantsSwap reports whether b should have a swap file. Huge files would take too long to copy,
+// encrypted buffers would leave their text unencrypted, and files which aren't local have
+// nowhere to put one.
+func (ts *TermState) wantsSwap(b *buffer.Buffer) bool {
+	return ts.opts.swapfile && !ts.headless && !ts.view && b.Filename != "" && b.BrowseDir == "" &&
+		!b.LargeFile && !b.Encrypted() && buffer.IsLocal(b.Filename)
+}
+
+// checkSwap starts a swap file for a newly opened buffer. If one is already there, zi is warned
+// about another editor using the file, or asked whether to recover the changes it holds.
+func (ts *TermState) checkSwap(b *buffer.Buffer) {
+	if !ts.wantsSwap(b) {
+		return
+	}
+	path := swapPath(b.Filename)
+	info, err := readSwap(path)
+	if err != nil {
+		ts.startSwap(b, path)
+		return
+	}
+
+	host, _ := os.Hostname()
+	if info.host == host && info.pid != os.Getpid() && processRunning(info.pid) {
+		ts.statusMsg = fmt.Sprintf("%s is also being edited by zi (pid %d), changes may be lost", b.Filename, info.pid)
+		return
+	}
+	if !info.modified {
+		ts.startSwap(b, path)
+		return
+	}
+	ts.prompt("Swap file has unsaved changes, (r)ecover or (d)elete? ", "", func(answer string) error {
+		switch answer {
+		case "r":
+			b.SetText(info.lines)
+			b.Modified = true
+			if b == ts.buf {
+				ts.setCursor(ts.cursorY, ts.cursorX)
+			}
+			ts.statusMsg = fmt.Sprintf("recovered from %s, write the file to keep the changes", path)
+		case "d":
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		default:
+			// Leave the swap file for later, without starting one that would overwrite it.
+			return nil
+		}
+		ts.startSwap(b, path)
+		return nil
+	})
+}
+
+// startSwap writes b's swap file for the first time, so other editors opening the file know
+// it's in use.
+func (ts *TermState) startSwap(b *buffer.Buffer, path string) {
+	ts.swaps[b] = &swapFile{path: path, changes: -1}
+	if err := ts.writeSwap(b); err != nil {
+		ts.logger.Printf("swap file: %v", err)
+		delete(ts.swaps, b)
+	}
+}
+
+// writeSwap writes b's swap file, if it has one. The text is written to a temporary file first,
+// so a crash while writing doesn't lose what was there.
+func (ts *TermState) writeSwap(b *buffer.Buffer) error {
+	sf := ts.swaps[b]
+	if sf == nil {
+		return nil
+	}
+	if !ts.wantsSwap(b) {
+		ts.removeSwap(b)
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(sf.path), ".zi-swap-*")
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "%s\npid %d\nhost %s\nfile %s\nmodified %t\n\n", swapHeader, os.Getpid(), host, absPath(b.Filename), b.Modified)
+	for i := 0; i < b.Len(); i++ {
+		w.WriteString(b.Line(i))
+		w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), sf.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	sf.changes = b.Changes()
+	return nil
+}
+
+// swapsPending reports whether any buffer has changed since its swap file was written.
+func (ts *TermState) swapsPending() bool {
+	for b, sf := range ts.swaps {
+		if sf.changes != b.Changes() || ts.swapKeys >= swapKeys {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSwaps writes the swap files of buffers which have changed since they were last written.
+func (ts *TermState) syncSwaps() {
+	ts.swapKeys = 0
+	for b, sf := range ts.swaps {
+		if sf.changes == b.Changes() {
+			continue
+		}
+		if err := ts.writeSwap(b); err != nil {
+			ts.logger.Printf("swap file: %v", err)
+		}
+	}
+}
+
+// swapIdle returns a channel which fires once the editor has been idle for updatetime with
+// swap files to write, or nil if there are none.
+func (ts *TermState) swapIdle() <-chan time.Time {
+	if !ts.swapsPending() || ts.opts.updatetime <= 0 {
+		return nil
+	}
+	return time.After(time.Duration(ts.opts.updatetime) * time.Millisecond)
+}
+
+// removeSwap deletes b's swap file, once it's closed or zi exits normally.
+func (ts *TermState) removeSwap(b *buffer.Buffer) {
+	if sf := ts.swaps[b]; sf != nil {
+		os.Remove(sf.path)
+		delete(ts.swaps, b)
+	}
+}
+
+// readSwap reads a swap file written by writeSwap.
+func readSwap(path string) (swapInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return swapInfo{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<30)
+	if !scanner.Scan() || scanner.Text() != swapHeader {
+		return swapInfo{}, fmt.Errorf("%s: not a zi swap file", path)
+	}
+	var info swapInfo
+	for scanner.Scan() && scanner.Text() != "" {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "pid":
+			info.pid, _ = strconv.Atoi(value)
+		case "host":
+			info.host = value
+		case "modified":
+			info.modified = value == "true"
+		}
+	}
+	info.lines = make([]string, 0)
+	for scanner.Scan() {
+		info.lines = append(info.lines, scanner.Text())
+	}
+	return info, scanner.Err()
+}
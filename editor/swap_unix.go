@@ -0,0 +1,12 @@
+//go:build !windows
+
+package editor
+
+import "golang.org/x/sys/unix"
+
+// processRunning reports whether a process with pid exists, to tell whether the editor which
+// wrote a swap file is still running.
+func processRunning(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || err == unix.EPERM
+}
@@ -0,0 +1,15 @@
+package editor
+
+import "golang.org/x/sys/windows"
+
+// processRunning reports whether a process with pid exists, to tell whether the editor which
+// wrote a swap file is still running.
+func processRunning(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	return windows.GetExitCodeProcess(h, &code) == nil && code == 259 // STILL_ACTIVE
+}
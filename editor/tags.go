@@ -0,0 +1,285 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tag is a definition listed in a tags file, as written by ctags.
+type tag struct {
+	name    string
+	file    string // Relative to the current directory, or absolute
+	address string // A line number, or a /pattern/ or ?pattern? matching the line
+}
+
+// isKeywordByte reports whether c can be part of an identifier.
+func isKeywordByte(c byte) bool {
+	return isLetter(c) || c >= '0' && c <= '9' || c == '_' || c >= 0x80
+}
+
+// keywordAt returns where the identifier at or after column x of line starts and ends, the same
+// if there's none.
+func keywordAt(line string, x int) (int, int) {
+	for x < len(line) && !isKeywordByte(line[x]) {
+		x++
+	}
+	start, end := x, x
+	for start > 0 && isKeywordByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isKeywordByte(line[end]) {
+		end++
+	}
+	return start, end
+}
+
+// keywordUnderCursor returns the identifier under or after the cursor.
+func (ts *TermState) keywordUnderCursor() (string, error) {
+	if ts.cursorY < ts.buf.Len() {
+		line := ts.buf.Line(ts.cursorY)
+		if start, end := keywordAt(line, ts.cursorX); start < end {
+			return line[start:end], nil
+		}
+	}
+	return "", fmt.Errorf("no identifier under cursor")
+}
+
+// tagFiles returns the tags files named by the tags option that exist. Names starting with ./
+// are in the current file's directory, and a name ending in ; is looked for in each directory
+// above too, the nearest first.
+func (ts *TermState) tagFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if abs := absPath(path); !seen[abs] {
+			if _, err := os.Stat(path); err == nil {
+				seen[abs] = true
+				files = append(files, path)
+			}
+		}
+	}
+	for _, name := range optionFiles(ts.opts.tags) {
+		upward := strings.HasSuffix(name, ";")
+		name = strings.TrimSuffix(name, ";")
+		if strings.HasPrefix(name, "./") && ts.buf.Filename != "" {
+			name = filepath.Join(filepath.Dir(ts.buf.Filename), name)
+		}
+		add(name)
+		if !upward {
+			continue
+		}
+		dir, base := filepath.Dir(absPath(name)), filepath.Base(name)
+		for parent := filepath.Dir(dir); parent != dir; dir, parent = parent, filepath.Dir(parent) {
+			add(filepath.Join(parent, base))
+		}
+	}
+	return files
+}
+
+// readTags returns the tags called name in the tags file at path.
+func readTags(path, name string) ([]tag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var tags []tag
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, name+"\t") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		file := fields[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		tags = append(tags, tag{name: name, file: file, address: tagAddress(fields[2])})
+	}
+	return tags, scanner.Err()
+}
+
+// tagAddress returns the address at the start of the rest of a tags file line, without the
+// extension fields after it.
+func tagAddress(rest string) string {
+	if rest != "" && (rest[0] == '/' || rest[0] == '?') {
+		for i := 1; i < len(rest); i++ {
+			switch rest[i] {
+			case '\\':
+				i++
+			case rest[0]:
+				return rest[:i+1]
+			}
+		}
+		return rest
+	}
+	if i := strings.IndexAny(rest, ";\t"); i >= 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+// findTags returns the tags called name in the tags files, those in the current file first.
+func (ts *TermState) findTags(name string) ([]tag, error) {
+	files := ts.tagFiles()
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no tags file")
+	}
+	var here, others []tag
+	for _, f := range files {
+		tags, err := readTags(f, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			if ts.buf.Filename != "" && absPath(t.file) == absPath(ts.buf.Filename) {
+				here = append(here, t)
+			} else {
+				others = append(others, t)
+			}
+		}
+	}
+	if len(here)+len(others) == 0 {
+		return nil, fmt.Errorf("tag not found: %s", name)
+	}
+	return append(here, others...), nil
+}
+
+// tagLine returns the row of lines at address, or -1 if it isn't found.
+func tagLine(lines []string, address string) int {
+	if n, err := strconv.Atoi(address); err == nil {
+		return n - 1
+	}
+	if len(address) < 2 {
+		return -1
+	}
+	// Patterns are literal text, apart from ^ and $ anchoring them to the start and end of the line.
+	pattern := address[1 : len(address)-1]
+	start := strings.HasPrefix(pattern, "^")
+	end := strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`)
+	pattern = strings.TrimPrefix(pattern, "^")
+	if end {
+		pattern = pattern[:len(pattern)-1]
+	}
+	pattern = strings.NewReplacer(`\/`, "/", `\?`, "?", `\\`, `\`, `\$`, "$").Replace(pattern)
+	for i, line := range lines {
+		switch {
+		case start && end && line == pattern,
+			start && !end && strings.HasPrefix(line, pattern),
+			!start && end && strings.HasSuffix(line, pattern),
+			!start && !end && strings.Contains(line, pattern):
+			return i
+		}
+	}
+	return -1
+}
+
+// jumpToTag opens the file of t with the cursor on its name, pushing where the cursor was onto
+// the tag stack for Ctrl-T.
+func (ts *TermState) jumpToTag(t tag) error {
+	from := fileMark{Filename: absPath(ts.buf.Filename), Row: ts.cursorY, Col: ts.cursorX}
+	ts.pushJump()
+	if err := ts.openFile(t.file); err != nil {
+		return err
+	}
+	if ts.buf.Filename != "" && from.Filename != "" {
+		ts.tagStack = append(ts.tagStack, from)
+	}
+	row := tagLine(ts.buf.Lines(0, ts.buf.Len()), t.address)
+	if row < 0 {
+		// The file has changed since the tags were made, so look for the name instead.
+		for i := 0; i < ts.buf.Len() && row < 0; i++ {
+			if strings.Contains(ts.buf.Line(i), t.name) {
+				row = i
+			}
+		}
+		if row < 0 {
+			return fmt.Errorf("tag %s not found in %s", t.name, t.file)
+		}
+		ts.statusMsg = fmt.Sprintf("tag %s moved, found by name", t.name)
+	}
+	col := strings.Index(ts.buf.Line(row), t.name)
+	if col < 0 {
+		col = 0
+	}
+	ts.setCursor(row, col)
+	return nil
+}
+
+// jumpToTagNamed jumps to the first tag called name, saying how many others there are.
+func (ts *TermState) jumpToTagNamed(name string) error {
+	tags, err := ts.findTags(name)
+	if err != nil {
+		return err
+	}
+	if err := ts.jumpToTag(tags[0]); err != nil {
+		return err
+	}
+	if len(tags) > 1 && ts.statusMsg == "" {
+		ts.statusMsg = fmt.Sprintf("tag 1 of %d, see :tselect", len(tags))
+	}
+	return nil
+}
+
+// followTag is Ctrl-], jumping to the definition of the identifier under the cursor.
+func (ts *TermState) followTag() error {
+	name, err := ts.keywordUnderCursor()
+	if err != nil {
+		return err
+	}
+	return ts.jumpToTagNamed(name)
+}
+
+// popTag is Ctrl-T, going back to where the last tag was jumped to from.
+func (ts *TermState) popTag() error {
+	if len(ts.tagStack) == 0 {
+		return fmt.Errorf("at bottom of tag stack")
+	}
+	m := ts.tagStack[len(ts.tagStack)-1]
+	ts.tagStack = ts.tagStack[:len(ts.tagStack)-1]
+	if err := ts.openFile(m.Filename); err != nil {
+		return err
+	}
+	ts.setCursor(m.Row, m.Col)
+	return nil
+}
+
+// cmdTag is :tag name, jumping to the definition of name.
+func cmdTag(ts *TermState, a exArgs) error {
+	if a.arg == "" {
+		return fmt.Errorf("no tag name")
+	}
+	return ts.jumpToTagNamed(a.arg)
+}
+
+// cmdTselect is :tselect [name], listing the definitions of name, or the identifier under the
+// cursor, in a picker to jump to one.
+func cmdTselect(ts *TermState, a exArgs) error {
+	name := a.arg
+	if name == "" {
+		var err error
+		if name, err = ts.keywordUnderCursor(); err != nil {
+			return err
+		}
+	}
+	tags, err := ts.findTags(name)
+	if err != nil {
+		return err
+	}
+	items := make([]pickerItem, 0, len(tags))
+	for _, t := range tags {
+		t := t
+		label := fmt.Sprintf("%s  %s", t.file, strings.Trim(t.address, "/?^$"))
+		items = append(items, pickerItem{label, func() error { return ts.jumpToTag(t) }})
+	}
+	return ts.openPicker("Tags for "+name, items)
+}
@@ -0,0 +1,132 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/keyan/zi/render"
+)
+
+// textSpan is a part of a line, from byte start up to end, drawn with an escape code.
+type textSpan struct {
+	start, end int
+	style      string
+}
+
+// rowSpans returns how the text of row is styled when drawn, with matched brackets, merge
+// conflicts, misspelled words, rainbow brackets and commit message highlighting. Where they
+// overlap, the first wins.
+func (ts *TermState) rowSpans(row int) []textSpan {
+	var spans []textSpan
+	for _, more := range [][]textSpan{ts.parenSpans(row), ts.conflictSpans(row), ts.spellSpans(row),
+		ts.rainbowSpans(row), ts.commitMessageSpans(row)} {
+		for _, s := range more {
+			if !overlaps(spans, s) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+// overlaps reports whether s overlaps any of spans.
+func overlaps(spans []textSpan, s textSpan) bool {
+	for _, other := range spans {
+		if s.start < other.end && other.start < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// displayChar returns how the character r, n bytes at the start of text, is drawn. Control
+// characters are shown as ^X, and in binary mode bytes that aren't UTF-8 as <xx>, so they can't
+// be taken as escape sequences by the terminal.
+func (ts *TermState) displayChar(text string, r rune, n int) string {
+	switch {
+	case r == utf8.RuneError && n == 1 && ts.buf.Binary:
+		return fmt.Sprintf("<%02x>", text[0])
+	case (r < ' ' && r != '\t') || r == 0x7f:
+		return "^" + string(rune(r^0x40))
+	default:
+		return text[:n]
+	}
+}
+
+// charCols returns the length in bytes of the character at the start of text, and how many
+// columns it's drawn in.
+func (ts *TermState) charCols(text string) (n, cols int) {
+	r, n := utf8.DecodeRuneInString(text)
+	if s := ts.displayChar(text, r, n); s != text[:n] {
+		return n, len(s)
+	}
+	return n, 1
+}
+
+// textCols returns how many columns text is drawn in.
+func (ts *TermState) textCols(text string) int {
+	cols := 0
+	for i := 0; i < len(text); {
+		n, c := ts.charCols(text[i:])
+		i += n
+		cols += c
+	}
+	return cols
+}
+
+// writeText draws up to width columns of a line of buffer text from byte start, making any URLs
+// in it hyperlinks. Each of spans, which are sorted and don't overlap, is drawn in its style.
+func (ts *TermState) writeText(text string, start, width int, spans []textSpan) {
+	var links [][]int
+	if ts.tty != nil && ts.opts.hyperlinks && !ts.buf.LargeFile {
+		links = findURLs(text)
+	}
+	// Links and spans which end before start aren't drawn, those running into it are.
+	for len(links) > 0 && links[0][1] <= start {
+		links = links[1:]
+	}
+	for len(spans) > 0 && spans[0].end <= start {
+		spans = spans[1:]
+	}
+	inLink, inSpan := false, false
+	for i, col := start, 0; i < len(text); {
+		if len(spans) > 0 && !inSpan && spans[0].start <= i {
+			ts.w.WriteString(spans[0].style)
+			inSpan = true
+		}
+		if len(links) > 0 && !inLink && links[0][0] <= i {
+			render.Hyperlink(ts.w, text[links[0][0]:links[0][1]])
+			inLink = true
+		}
+		r, n := utf8.DecodeRuneInString(text[i:])
+		s := ts.displayChar(text[i:], r, n)
+		cols := 1
+		if s != text[i:i+n] {
+			cols = len(s)
+		}
+		if col+cols > width {
+			break
+		}
+		ts.w.WriteString(s)
+		col += cols
+		i += n
+		if len(links) > 0 && i == links[0][1] {
+			render.Hyperlink(ts.w, "")
+			inLink = false
+			links = links[1:]
+		}
+		if len(spans) > 0 && i == spans[0].end {
+			ts.w.WriteString(render.ColorCode(render.Reset))
+			inSpan = false
+			spans = spans[1:]
+		}
+	}
+	if inSpan {
+		ts.w.WriteString(render.ColorCode(render.Reset))
+	}
+	if inLink {
+		render.Hyperlink(ts.w, "")
+	}
+}
@@ -0,0 +1,124 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timer calls a function on the main loop after a delay, and optionally repeatedly after that.
+type timer struct {
+	id       int
+	interval time.Duration
+	repeat   bool
+	desc     string // Shown by :timers, e.g. the command a config timer runs
+	done     chan struct{}
+}
+
+// startTimer calls fn on the main loop once interval has passed, and every interval after that if
+// repeat is set, until the timer is stopped.
+func (ts *TermState) startTimer(interval time.Duration, repeat bool, desc string, fn func()) *timer {
+	ts.lastTimerID++
+	t := &timer{id: ts.lastTimerID, interval: interval, repeat: repeat, desc: desc, done: make(chan struct{})}
+	ts.timers[t.id] = t
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+			ts.events <- func() {
+				// The timer may have been stopped while this was queued.
+				if ts.timers[t.id] != t {
+					return
+				}
+				if !t.repeat {
+					delete(ts.timers, t.id)
+				}
+				fn()
+			}
+			if !repeat {
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// stopTimer stops t, if it hasn't already fired or been stopped.
+func (ts *TermState) stopTimer(t *timer) {
+	if t == nil || ts.timers[t.id] != t {
+		return
+	}
+	delete(ts.timers, t.id)
+	close(t.done)
+}
+
+// cmdTimer runs an ex command after a number of milliseconds, or every that many milliseconds
+// with a bang, e.g. :timer! 60000 wall.
+func cmdTimer(ts *TermState, a exArgs) error {
+	fields := strings.SplitN(a.arg, " ", 2)
+	ms, err := strconv.Atoi(fields[0])
+	if err != nil || ms <= 0 || len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		return fmt.Errorf("usage: timer[!] {ms} {command}")
+	}
+	command := strings.TrimSpace(fields[1])
+
+	t := ts.startTimer(time.Duration(ms)*time.Millisecond, a.bang, command, func() {
+		if err := ts.runCommand(command); err != nil {
+			ts.statusMsg = err.Error()
+		}
+	})
+	ts.statusMsg = fmt.Sprintf("timer %d started", t.id)
+	return nil
+}
+
+// cmdTimers lists the running timers.
+func cmdTimers(ts *TermState, a exArgs) error {
+	if len(ts.timers) == 0 {
+		return fmt.Errorf("no running timers")
+	}
+	ids := make([]int, 0, len(ts.timers))
+	for id := range ts.timers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		t := ts.timers[id]
+		every := "after"
+		if t.repeat {
+			every = "every"
+		}
+		lines = append(lines, fmt.Sprintf("%3d %s %-8v %s", t.id, every, t.interval, t.desc))
+	}
+	ts.msgLines = lines
+	return nil
+}
+
+// cmdTimerStop stops the timer with the given id, or all timers with a bang.
+func cmdTimerStop(ts *TermState, a exArgs) error {
+	if a.bang {
+		for _, t := range ts.timers {
+			ts.stopTimer(t)
+		}
+		return nil
+	}
+	id, err := strconv.Atoi(a.arg)
+	if err != nil {
+		return fmt.Errorf("usage: timerstop {id}")
+	}
+	t, ok := ts.timers[id]
+	if !ok {
+		return fmt.Errorf("no timer %d", id)
+	}
+	ts.stopTimer(t)
+	return nil
+}
@@ -0,0 +1,55 @@
+package editor
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/keyan/zi/render"
+)
+
+// titleString returns the terminal title for the current buffer, "name — zi" with [+] if it's
+// modified.
+func (ts *TermState) titleString() string {
+	name := "[No Name]"
+	if ts.buf.Filename != "" {
+		name = filepath.Base(ts.buf.Filename)
+	}
+	if ts.buf.Modified {
+		name += " [+]"
+	}
+	// Control characters in a filename would end the escape sequence early.
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, name)
+	return name + " — zi"
+}
+
+// updateTitle sets the terminal title if the buffer or its modified state changed. The first time
+// the original title is saved, so restoreTitle can put it back.
+func (ts *TermState) updateTitle() {
+	if ts.tty == nil || !ts.opts.title {
+		ts.restoreTitle()
+		return
+	}
+	title := ts.titleString()
+	if title == ts.title {
+		return
+	}
+	if ts.title == "" {
+		render.PushTitle(ts.w)
+	}
+	render.SetTitle(ts.w, title)
+	ts.title = title
+}
+
+// restoreTitle puts back the title the terminal had before zi set it.
+func (ts *TermState) restoreTitle() {
+	if ts.title == "" {
+		return
+	}
+	render.PopTitle(ts.w)
+	ts.title = ""
+}
@@ -0,0 +1,55 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// undoLimits returns the bounds on each buffer's undo history set by the undo options.
+func (ts *TermState) undoLimits() buffer.UndoLimits {
+	return buffer.UndoLimits{Levels: ts.opts.undolevels, Memory: ts.opts.undomem << 20}
+}
+
+// endUndoStep ends the current buffer's undo step once a command has finished, so everything it
+// changed is undone together. Changes made by a whole visit to insert mode make one step. It
+// reports when history had to be dropped to stay within undomem.
+func (ts *TermState) endUndoStep() {
+	dropped, lost := ts.buf.EndUndoStep(ts.undoLimits())
+	switch {
+	case lost:
+		ts.statusMsg = "change too large for undomem, it can't be undone"
+	case dropped == 1:
+		ts.statusMsg = "undo history over undomem, dropped the oldest change"
+	case dropped > 1:
+		ts.statusMsg = fmt.Sprintf("undo history over undomem, dropped the %d oldest changes", dropped)
+	}
+}
+
+// undo reverses the last change to the current buffer, or with redo repeats the last change
+// undone, moving the cursor to where it happened.
+func (ts *TermState) undo(redo bool) error {
+	if err := ts.buf.CheckEditable(); err != nil {
+		return err
+	}
+	step := ts.buf.Undo
+	if redo {
+		step = ts.buf.Redo
+	}
+	row, err := step()
+	if err != nil {
+		return err
+	}
+	ts.setCursor(row, ts.cursorX)
+	return nil
+}
+
+// cmdUndo is :undo, the same as u in normal mode.
+func cmdUndo(ts *TermState, a exArgs) error {
+	return ts.undo(false)
+}
+
+// cmdRedo is :redo, the same as Ctrl-R in normal mode.
+func cmdRedo(ts *TermState, a exArgs) error {
+	return ts.undo(true)
+}
@@ -0,0 +1,259 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasmCallTimeout stops a plugin which loops forever from freezing the editor.
+const wasmCallTimeout = time.Second
+
+// wasmPlugin is a WebAssembly module loaded with :wasm. Plugins are sandboxed: they can only see
+// the current buffer through the host functions below, and get no filesystem, environment or
+// clock unless granted when loaded. There is no network access.
+//
+// The host module "zi" provides, with strings passed as a pointer and length in guest memory:
+//
+//	line_count() i32
+//	get_line(row, ptr, size i32) i32      copies up to size bytes of a line, returns its length or -1
+//	set_line(row, ptr, len i32) i32       returns 0, or -1 if row is out of range
+//	insert_line(row, ptr, len i32) i32    inserts before row, or appends if row is line_count()
+//	delete_line(row i32) i32
+//	cursor_row() i32
+//	cursor_col() i32
+//	set_cursor(row, col i32)
+//	message(ptr, len i32)                 shows a message in the status bar
+//	register_command(ptr, len i32) i32    defines a user command, returning its id or -1
+//	register_key(key i32) i32             maps a normal mode key, returning 0 or -1
+//	command_args(ptr, size i32) i32       copies the running command's arguments, returns their length
+//
+// Plugins export zi_init(), called once loaded to register commands and keys, and zi_command(id,
+// bang i32) and zi_key(key i32), called when they're used. Rows and columns are 0-indexed.
+type wasmPlugin struct {
+	path     string
+	grants   []string
+	runtime  wazero.Runtime
+	mod      api.Module
+	commands uint64 // Number of commands registered, the next command's id
+	args     string // Arguments to the command being run, for command_args
+}
+
+// wasmModuleConfig sandboxes a plugin, giving it only what grants allow. Grants are ro=DIR and
+// rw=DIR to mount a directory at the same path in the guest, env to see the environment, and time
+// for a real clock.
+func wasmModuleConfig(grants []string) (wazero.ModuleConfig, error) {
+	cfg := wazero.NewModuleConfig().WithStartFunctions("_initialize")
+	fs := wazero.NewFSConfig()
+	for _, g := range grants {
+		kind, dir, _ := strings.Cut(g, "=")
+		switch kind {
+		case "ro", "rw":
+			if dir == "" {
+				return nil, fmt.Errorf("%s needs a directory, e.g. %s=/tmp", kind, kind)
+			}
+			abs := absPath(dir)
+			if kind == "ro" {
+				fs = fs.WithReadOnlyDirMount(abs, abs)
+			} else {
+				fs = fs.WithDirMount(abs, abs)
+			}
+		case "env":
+			for _, kv := range os.Environ() {
+				k, v, _ := strings.Cut(kv, "=")
+				cfg = cfg.WithEnv(k, v)
+			}
+		case "time":
+			cfg = cfg.WithSysWalltime().WithSysNanotime().WithSysNanosleep()
+		default:
+			return nil, fmt.Errorf("unknown grant: %s", g)
+		}
+	}
+	return cfg.WithFSConfig(fs), nil
+}
+
+// loadWasmPlugin instantiates the plugin at path with the given grants and calls its zi_init.
+func (ts *TermState) loadWasmPlugin(path string, grants []string) error {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := wasmModuleConfig(grants)
+	if err != nil {
+		return err
+	}
+	// Anything the plugin prints goes to the log.
+	cfg = cfg.WithStdout(ts.logger.Writer()).WithStderr(ts.logger.Writer()).WithName(filepath.Base(path))
+
+	// Instantiating runs the module's _initialize, so it's limited like any other call.
+	ctx, cancel := context.WithTimeout(context.Background(), wasmCallTimeout)
+	defer cancel()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	p := &wasmPlugin{path: path, grants: grants, runtime: r}
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(context.Background())
+		return err
+	}
+	if _, err := ts.wasmHostModule(p).Instantiate(ctx); err != nil {
+		r.Close(context.Background())
+		return err
+	}
+	if p.mod, err = r.InstantiateWithConfig(ctx, code, cfg); err != nil {
+		r.Close(context.Background())
+		return fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+
+	// A plugin which fails to initialize leaves behind none of the commands or keys it registered.
+	commands, keymaps := maps.Clone(ts.userCommands), maps.Clone(ts.keymaps)
+	if err := ts.callWasm(p, "zi_init"); err != nil {
+		ts.userCommands, ts.keymaps = commands, keymaps
+		r.Close(context.Background())
+		return err
+	}
+	ts.wasmPlugins = append(ts.wasmPlugins, p)
+	return nil
+}
+
+// callWasm calls an exported function of p, if it exists, giving up after wasmCallTimeout.
+func (ts *TermState) callWasm(p *wasmPlugin, name string, params ...uint64) error {
+	fn := p.mod.ExportedFunction(name)
+	if fn == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wasmCallTimeout)
+	defer cancel()
+	if _, err := fn.Call(ctx, params...); err != nil {
+		return fmt.Errorf("%s: %s: %v", filepath.Base(p.path), name, err)
+	}
+	return nil
+}
+
+// readWasmString reads a string from guest memory.
+func readWasmString(m api.Module, ptr, n uint32) (string, bool) {
+	b, ok := m.Memory().Read(ptr, n)
+	return string(b), ok
+}
+
+// writeWasmString copies as much of s as fits in size bytes of guest memory, returning the length
+// of s so the guest can retry with a larger buffer.
+func writeWasmString(m api.Module, s string, ptr, size uint32) int32 {
+	n := uint32(len(s))
+	if n > size {
+		n = size
+	}
+	if !m.Memory().Write(ptr, []byte(s[:n])) {
+		return -1
+	}
+	return int32(len(s))
+}
+
+// wasmHostModule builds the "zi" module of host functions for p.
+func (ts *TermState) wasmHostModule(p *wasmPlugin) wazero.HostModuleBuilder {
+	b := p.runtime.NewHostModuleBuilder("zi")
+	export := func(name string, fn interface{}) {
+		b = b.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+	validRow := func(row int32) bool { return row >= 0 && int(row) < ts.buf.Len() }
+
+	export("line_count", func() int32 {
+		return int32(ts.buf.Len())
+	})
+	export("get_line", func(ctx context.Context, m api.Module, row int32, ptr, size uint32) int32 {
+		if !validRow(row) {
+			return -1
+		}
+		return writeWasmString(m, ts.buf.Line(int(row)), ptr, size)
+	})
+	export("set_line", func(ctx context.Context, m api.Module, row int32, ptr, n uint32) int32 {
+		line, ok := readWasmString(m, ptr, n)
+		if !ok || !validRow(row) || ts.setLines(int(row), int(row)+1, []string{line}) != nil {
+			return -1
+		}
+		return 0
+	})
+	export("insert_line", func(ctx context.Context, m api.Module, row int32, ptr, n uint32) int32 {
+		line, ok := readWasmString(m, ptr, n)
+		if !ok || row < 0 || ts.setLines(int(row), int(row), []string{line}) != nil {
+			return -1
+		}
+		return 0
+	})
+	export("delete_line", func(row int32) int32 {
+		if !validRow(row) || ts.setLines(int(row), int(row)+1, nil) != nil {
+			return -1
+		}
+		return 0
+	})
+	export("cursor_row", func() int32 { return int32(ts.cursorY) })
+	export("cursor_col", func() int32 { return int32(ts.cursorX) })
+	export("set_cursor", func(row, col int32) { ts.setCursor(int(row), int(col)) })
+	export("message", func(ctx context.Context, m api.Module, ptr, n uint32) {
+		if msg, ok := readWasmString(m, ptr, n); ok {
+			ts.statusMsg = msg
+		}
+	})
+	export("register_command", func(ctx context.Context, m api.Module, ptr, n uint32) int32 {
+		name, ok := readWasmString(m, ptr, n)
+		if !ok {
+			return -1
+		}
+		id := p.commands
+		err := ts.defineCommand(name, func(ts *TermState, a exArgs) error {
+			p.args = a.arg
+			bang := uint64(0)
+			if a.bang {
+				bang = 1
+			}
+			return ts.callWasm(p, "zi_command", id, bang)
+		})
+		if err != nil {
+			return -1
+		}
+		p.commands++
+		return int32(id)
+	})
+	export("register_key", func(key int32) int32 {
+		if key <= 0 || key > 127 {
+			return -1
+		}
+		ts.keymaps[byte(key)] = func() {
+			if err := ts.callWasm(p, "zi_key", uint64(key)); err != nil {
+				ts.statusMsg = err.Error()
+			}
+		}
+		return 0
+	})
+	export("command_args", func(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+		return writeWasmString(m, p.args, ptr, size)
+	})
+	return b
+}
+
+// cmdWasm loads a WebAssembly plugin, :wasm {file} [grant ...], or lists the loaded plugins.
+func cmdWasm(ts *TermState, a exArgs) error {
+	fields := strings.Fields(a.arg)
+	if len(fields) > 0 {
+		return ts.loadWasmPlugin(fields[0], fields[1:])
+	}
+	if len(ts.wasmPlugins) == 0 {
+		return fmt.Errorf("no wasm plugins loaded")
+	}
+	lines := make([]string, 0, len(ts.wasmPlugins))
+	for _, p := range ts.wasmPlugins {
+		grants := "no grants"
+		if len(p.grants) > 0 {
+			grants = strings.Join(p.grants, " ")
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s)", p.path, grants))
+	}
+	ts.msgLines = lines
+	return nil
+}
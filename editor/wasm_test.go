@@ -0,0 +1,88 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wasmSection encodes a section of a WebAssembly module. Sections in these tests are short enough
+// for their size to fit in a byte.
+func wasmSection(id byte, contents ...byte) []byte {
+	return append([]byte{id, byte(len(contents))}, contents...)
+}
+
+// wasmName encodes a name for an import or export.
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// wasmModule returns a module with the given types and imports, defining one function of type
+// funcType whose body is code. Function index is exported as export.
+func wasmModule(types, imports []byte, funcType byte, export string, index byte, code ...byte) []byte {
+	mod := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	mod = append(mod, wasmSection(1, types...)...)
+	if imports != nil {
+		mod = append(mod, wasmSection(2, imports...)...)
+	}
+	mod = append(mod, wasmSection(3, 0x01, funcType)...)
+	mod = append(mod, wasmSection(7, append(append([]byte{0x01}, wasmName(export)...), 0x00, index)...)...)
+	body := append([]byte{0x00}, append(code, 0x0b)...) // No locals
+	return append(mod, wasmSection(10, append([]byte{0x01, byte(len(body))}, body...)...)...)
+}
+
+// keyPlugin returns a plugin whose zi_init maps K, then traps if fail.
+func keyPlugin(fail bool) []byte {
+	// Types are (i32)->i32 for register_key and ()->() for zi_init.
+	types := []byte{0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x00, 0x00}
+	imports := append(append([]byte{0x01}, wasmName("zi")...), wasmName("register_key")...)
+	imports = append(imports, 0x00, 0x00)
+	code := []byte{0x41, 0xcb, 0x00, 0x10, 0x00, 0x1a} // i32.const 'K', call 0, drop
+	if fail {
+		code = append(code, 0x00) // unreachable
+	}
+	return wasmModule(types, imports, 0x01, "zi_init", 0x01, code...)
+}
+
+func TestLoadWasmPlugin(t *testing.T) {
+	// _initialize loops forever: loop, br 0, end.
+	loop := wasmModule([]byte{0x01, 0x60, 0x00, 0x00}, nil, 0x00, "_initialize", 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b)
+	tests := []struct {
+		name string
+		code []byte
+		err  bool
+	}{
+		{"loaded", keyPlugin(false), false},
+		{"zi_init fails", keyPlugin(true), true},
+		{"_initialize never returns", loop, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plugin.wasm")
+			if err := os.WriteFile(path, tt.code, 0600); err != nil {
+				t.Fatal(err)
+			}
+			ts, err := NewHeadless()
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			_, err = ts.RunCommand("wasm " + path)
+			if (err != nil) != tt.err {
+				t.Fatalf("wasm error = %v, want error %v", err, tt.err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*wasmCallTimeout {
+				t.Errorf("loading took %v", elapsed)
+			}
+			_, mapped := ts.keymaps['K']
+			if loaded := len(ts.wasmPlugins) == 1; loaded != !tt.err || mapped != !tt.err {
+				t.Errorf("plugin loaded %v, K mapped %v, want %v", loaded, mapped, !tt.err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "plugin.wasm") {
+				t.Errorf("error %q doesn't name the plugin", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/keyan/zi/buffer"
+)
+
+// watchInterval is how often open files are checked for changes by other programs.
+const watchInterval = 2 * time.Second
+
+// checkFiles looks for open files changed by another program since they were read or written.
+// With autoread, buffers without changes of their own are reloaded. For the rest, the user is
+// asked whether to reload or keep their version, one buffer at a time; writing over the file is
+// refused until they've chosen.
+func (ts *TermState) checkFiles() {
+	// Don't take over the command line while it's in use.
+	if ts.mode == commandMode {
+		return
+	}
+	for _, b := range ts.buffers {
+		if !b.ChangedOnDisk() {
+			continue
+		}
+		if !b.Modified && ts.opts.autoread {
+			err := ts.reloadBuffer(b)
+			if os.IsNotExist(err) {
+				ts.statusMsg = fmt.Sprintf("%s was removed", b.Filename)
+				b.RecordDiskState()
+				continue
+			}
+			if err != nil {
+				ts.statusMsg = fmt.Sprintf("%s changed on disk: %v", b.Filename, err)
+				b.RecordDiskState()
+				continue
+			}
+			ts.statusMsg = fmt.Sprintf("%s changed on disk, reloaded", b.Filename)
+			continue
+		}
+		ts.promptChanged(b)
+		return
+	}
+}
+
+// promptChanged asks whether to reload b, whose file has changed on disk, or keep its text.
+func (ts *TermState) promptChanged(b *buffer.Buffer) {
+	label := fmt.Sprintf("%s changed on disk, (r)eload or (k)eep yours? ", b.Filename)
+	ts.prompt(label, "", func(answer string) error {
+		if answer == "r" {
+			return ts.reloadBuffer(b)
+		}
+		// Keeping them allows overwriting the other version.
+		b.RecordDiskState()
+		return nil
+	})
+}
+
+// cmdChecktime is :checktime, checking open files for changes now rather than waiting for the
+// next check, or when watchfiles is off.
+func cmdChecktime(ts *TermState, a exArgs) error {
+	ts.checkFiles()
+	return nil
+}
+
+// reloadBuffer reads b's file again, replacing its text and discarding any changes.
+func (ts *TermState) reloadBuffer(b *buffer.Buffer) error {
+	if b.Encrypted() {
+		return fmt.Errorf("encrypted files can't be reloaded, open them again")
+	}
+	text, layout, err := ts.opener()(b.Filename)
+	if err != nil {
+		return err
+	}
+	b.SetStorage(text)
+	b.Layout = layout
+	b.MarkUnmodified()
+	b.NewFile = false
+	b.NotEdited = false
+	b.RecordDiskState()
+	ts.loadInBackground(b)
+	if b == ts.buf {
+		ts.setCursor(ts.cursorY, ts.cursorX)
+	}
+	if err := ts.writeSwap(b); err != nil {
+		ts.logger.Printf("swap file: %v", err)
+	}
+	return nil
+}
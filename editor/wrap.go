@@ -0,0 +1,90 @@
+package editor
+
+// wrapStarts returns the byte offsets in line where each of the screen rows it's drawn on start,
+// which is just 0 unless the wrap option is on and the line is wider than width. With linebreak
+// rows end after the last space that fits, unless a word fills the whole row.
+func (ts *TermState) wrapStarts(line string, width int) []int {
+	starts := []int{0}
+	if !ts.opts.wrap || width < 1 {
+		return starts
+	}
+	brk := 0 // Where the row can be broken at a space, 0 if it can't
+	for i, col := 0, 0; i < len(line); {
+		n, cols := ts.charCols(line[i:])
+		if col+cols > width && col > 0 {
+			start := i
+			if ts.opts.linebreak && brk > starts[len(starts)-1] {
+				start = brk
+			}
+			starts = append(starts, start)
+			col, brk = ts.textCols(line[start:i]), 0
+		}
+		col += cols
+		i += n
+		if line[i-n] == ' ' || line[i-n] == '\t' {
+			brk = i
+		}
+	}
+	return starts
+}
+
+// wrapPart returns where part of line starts when it's wrapped to width, and how many columns of
+// it are drawn on that screen row.
+func (ts *TermState) wrapPart(line string, part, width int) (int, int) {
+	starts := ts.wrapStarts(line, width)
+	if part+1 < len(starts) {
+		return starts[part], ts.textCols(line[starts[part]:starts[part+1]])
+	}
+	return starts[part], width
+}
+
+// rowHeight returns how many screen rows buffer row is drawn on, including any :Gdiff filler
+// rows.
+func (ts *TermState) rowHeight(row int) int {
+	if row >= ts.buf.Len() {
+		return 1
+	}
+	if _, ok := ts.closedFold(row); ok {
+		return 1
+	}
+	height := 1
+	if ts.opts.wrap {
+		_, width := ts.textArea()
+		height = len(ts.wrapStarts(ts.buf.Line(row), width))
+	}
+	above, below := ts.diffFillers(row)
+	return above + height + below
+}
+
+// nextScreenRow returns the buffer row and which of its wrapped parts is drawn on the screen row
+// below part of row.
+func (ts *TermState) nextScreenRow(row, part int) (int, int) {
+	if part+1 < ts.rowHeight(row) {
+		return row, part + 1
+	}
+	return ts.nextRow(row), 0
+}
+
+// cursorPos returns which wrapped part of its row the cursor is on, and its column in it.
+func (ts *TermState) cursorPos() (part, col int) {
+	if ts.cursorY >= ts.buf.Len() {
+		return 0, ts.cursorX
+	}
+	line := ts.buf.Line(ts.cursorY)
+	x := ts.cursorX
+	if x > len(line) {
+		x = len(line)
+	}
+	_, width := ts.textArea()
+	starts := ts.wrapStarts(line, width)
+	for part+1 < len(starts) && starts[part+1] <= x {
+		part++
+	}
+	col = ts.textCols(line[starts[part]:x])
+	// After the end of a full row, in insert mode, the cursor goes to the start of the next.
+	if ts.opts.wrap && col >= width && width > 0 {
+		part, col = part+1, 0
+	}
+	above, _ := ts.diffFillers(ts.cursorY)
+	return above + part, col
+}
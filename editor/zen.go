@@ -0,0 +1,32 @@
+package editor
+
+// zenState is what :Zen changed, to be put back when it's turned off.
+type zenState struct {
+	wrap     bool
+	explorer bool
+}
+
+// zenMargin returns the columns left blank on each side of the text in zen mode, to center it.
+func (ts *TermState) zenMargin() int {
+	avail := int(ts.winSize.Col) + 1 - ts.explorerWidth() - ts.variablesWidth()
+	if avail <= ts.opts.zenwidth {
+		return 0
+	}
+	return (avail - ts.opts.zenwidth) / 2
+}
+
+// cmdZen is :Zen, toggling a distraction-free view for writing: the text is wrapped in a column
+// zenwidth wide in the middle of the screen, without line numbers, signs, the explorer or the
+// status bar, which only shows the command line and messages.
+func cmdZen(ts *TermState, a exArgs) error {
+	if z := ts.zen; z != nil {
+		ts.zen = nil
+		ts.opts.wrap = z.wrap
+		ts.explorer.visible = z.explorer
+		return nil
+	}
+	ts.zen = &zenState{wrap: ts.opts.wrap, explorer: ts.explorer.visible}
+	ts.opts.wrap = true
+	ts.explorer.visible, ts.explorer.focused = false, false
+	return nil
+}
@@ -0,0 +1,10 @@
+module github.com/keyan/zi
+
+go 1.26.0
+
+require (
+	github.com/tetratelabs/wazero v1.12.0
+	github.com/yuin/gopher-lua v1.1.2
+	golang.org/x/sys v0.48.0
+	golang.org/x/term v0.46.0
+)
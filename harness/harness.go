@@ -0,0 +1,157 @@
+//go:build linux || darwin || freebsd
+
+// Package harness runs zi inside a pseudo-terminal, so tests can type keys into it and check what
+// it draws, exercising raw mode and rendering exactly as a user's terminal would.
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/keyan/zi/input"
+	"github.com/keyan/zi/render"
+	"golang.org/x/sys/unix"
+)
+
+// Session is a running zi and the screen it has drawn so far.
+type Session struct {
+	cmd    *exec.Cmd
+	pty    *os.File
+	done   chan struct{} // Closed once zi has exited and all its output has been read
+	mu     sync.Mutex
+	screen *render.Screen
+	last   time.Time // When output was last read
+}
+
+// Start runs bin with args in dir, on a pseudo-terminal of the given size.
+func Start(bin string, args []string, dir string, rows, cols int) (*Session, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, fmt.Errorf("opening pty: %v", err)
+	}
+	defer slave.Close()
+	ws := &unix.Winsize{Row: uint16(rows), Col: uint16(cols)}
+	if err := unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, ws); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	cmd := exec.Command(bin, args...)
+	cmd.Dir = dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	// The pty becomes the controlling terminal of a new session, as it would be in a terminal emulator.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	s := &Session{
+		cmd:    cmd,
+		pty:    master,
+		done:   make(chan struct{}),
+		screen: render.NewScreen(rows, cols),
+		last:   time.Now(),
+	}
+	go s.readOutput()
+	return s, nil
+}
+
+// readOutput draws everything zi writes onto the screen, until the pty is closed.
+func (s *Session) readOutput() {
+	defer close(s.done)
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.pty.Read(buf)
+		s.mu.Lock()
+		s.screen.Write(buf[:n])
+		s.last = time.Now()
+		s.mu.Unlock()
+		// Answer device attributes queries as a plain VT220 would, so zi doesn't wait for a reply.
+		if bytes.Contains(buf[:n], []byte("\x1b[c")) {
+			s.pty.WriteString("\x1b[?62c")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send types keys, exactly as given.
+func (s *Session) Send(keys string) error {
+	_, err := s.pty.WriteString(keys)
+	return err
+}
+
+// SendScript types keys written as for zi --script, including any <Sleep> pauses.
+func (s *Session) SendScript(src string) error {
+	steps, err := input.ParseScript(src)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		time.Sleep(step.Sleep)
+		if err := s.Send(string(step.Keys)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Screen returns the text on each row of the screen.
+func (s *Session) Screen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.screen.Lines()
+}
+
+// Cursor returns the 0-indexed row and column of the cursor.
+func (s *Session) Cursor() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.screen.Cursor()
+}
+
+// WaitIdle waits until nothing has been drawn for d, so the screen has settled after typing.
+func (s *Session) WaitIdle(d, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		idle := time.Since(s.last)
+		s.mu.Unlock()
+		if idle >= d {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("screen still changing after %v", timeout)
+}
+
+// WaitFor waits until text appears anywhere on the screen.
+func (s *Session) WaitFor(text string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, line := range s.Screen() {
+			if strings.Contains(line, text) {
+				return nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("%q not on screen after %v", text, timeout)
+}
+
+// Close kills zi if it's still running and releases the pty.
+func (s *Session) Close() error {
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	err := s.pty.Close()
+	<-s.done
+	return err
+}
@@ -0,0 +1,29 @@
+package harness
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a new pseudo-terminal, returning its master and slave ends.
+func openPTY() (*os.File, *os.File, error) {
+	// posix_openpt is a system call on FreeBSD, and grantpt and unlockpt have nothing to do.
+	r, _, errno := unix.Syscall(unix.SYS_POSIX_OPENPT, uintptr(unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC), 0, 0)
+	if errno != 0 {
+		return nil, nil, errno
+	}
+	master := os.NewFile(r, "/dev/ptmx")
+	n, err := unix.IoctlGetInt(int(r), unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
@@ -0,0 +1,42 @@
+// Package input names keys and replays key scripts.
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ctrl returns the byte value of a key if it were pressed with CTRL.
+func Ctrl(char byte) byte {
+	// CTRL + <some key> outputs that byte with bits 5-7 cleared.
+	return char & 0x1f
+}
+
+// keyNames are the keys which can be written as <Name> in mappings.
+var keyNames = map[string]byte{
+	"space": ' ',
+	"cr":    '\r',
+	"enter": '\r',
+	"tab":   '\t',
+	"bs":    127,
+	"lt":    '<',
+	"esc":   '\x1b',
+}
+
+// ParseKey parses a single key, either a character or a name such as <CR> or <C-k>.
+func ParseKey(s string) (byte, error) {
+	if len(s) == 1 {
+		return s[0], nil
+	}
+	if !strings.HasPrefix(s, "<") || !strings.HasSuffix(s, ">") {
+		return 0, fmt.Errorf("bad key: %s", s)
+	}
+	name := strings.ToLower(s[1 : len(s)-1])
+	if b, ok := keyNames[name]; ok {
+		return b, nil
+	}
+	if strings.HasPrefix(name, "c-") && len(name) == 3 {
+		return Ctrl(name[2]), nil
+	}
+	return 0, fmt.Errorf("bad key: %s", s)
+}
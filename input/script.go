@@ -0,0 +1,106 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Step is either keys to send or a pause before the next step.
+type Step struct {
+	Keys  []byte
+	Sleep time.Duration
+}
+
+// Script is an io.Reader of keys recorded in a --script file. Keys are written as typed, with
+// <Name> for special keys as in mappings, such as <Esc>, <CR> or <C-w>, and <Sleep 200ms> to
+// pause. Newlines are ignored so scripts can be split over lines, and lines starting with '#' are
+// comments.
+type Script struct {
+	Steps []Step
+	Then  io.Reader // Read from once the script has finished, if not nil
+	End   func()    // Called when the script finishes
+}
+
+// ParseScript parses a --script file.
+func ParseScript(src string) ([]Step, error) {
+	var steps []Step
+	var keys []byte
+	for n, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for len(line) > 0 {
+			if line[0] != '<' {
+				keys, line = append(keys, line[0]), line[1:]
+				continue
+			}
+			end := strings.IndexByte(line, '>')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated key: %s", n+1, line)
+			}
+			name := line[:end+1]
+			line = line[end+1:]
+
+			if lower := strings.ToLower(name); strings.HasPrefix(lower, "<sleep ") {
+				sleep, err := time.ParseDuration(strings.TrimSpace(lower[7:end]))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", n+1, err)
+				}
+				steps = append(steps, Step{Keys: keys}, Step{Sleep: sleep})
+				keys = nil
+				continue
+			}
+			key, err := ParseKey(name)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return append(steps, Step{Keys: keys}), nil
+}
+
+// LoadScript reads and parses a --script file.
+func LoadScript(path string) ([]Step, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := ParseScript(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return steps, nil
+}
+
+func (s *Script) Read(p []byte) (int, error) {
+	for len(s.Steps) > 0 {
+		step := &s.Steps[0]
+		if step.Sleep > 0 {
+			// Keys are read in their own goroutine, so sleeping doesn't hold up anything else.
+			time.Sleep(step.Sleep)
+			s.Steps = s.Steps[1:]
+			continue
+		}
+		if len(step.Keys) == 0 {
+			s.Steps = s.Steps[1:]
+			continue
+		}
+		n := copy(p, step.Keys)
+		step.Keys = step.Keys[n:]
+		return n, nil
+	}
+
+	if s.End != nil {
+		end := s.End
+		s.End = nil
+		end()
+	}
+	if s.Then != nil {
+		return s.Then.Read(p)
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,78 @@
+package render
+
+import "bufio"
+
+// Grid double buffers the terminal. Each frame is drawn to a back Screen by writing to the grid,
+// then Flush compares it with the front Screen, what the terminal shows, and only writes the
+// cells that changed.
+type Grid struct {
+	front, back *Screen
+	clear       bool // The terminal's contents are unknown, so it's cleared on the next Flush
+}
+
+// NewGrid returns a grid for a terminal of the given size, which is redrawn in full first.
+func NewGrid(rows, cols int) *Grid {
+	return &Grid{front: NewScreen(rows, cols), back: NewScreen(rows, cols), clear: true}
+}
+
+// Write draws to the next frame.
+func (g *Grid) Write(p []byte) (int, error) {
+	return g.back.Write(p)
+}
+
+// Invalidate makes the next Flush redraw everything, for when something else has drawn on the
+// terminal.
+func (g *Grid) Invalidate() {
+	g.clear = true
+}
+
+// Flush writes the changes from the last frame to w and starts a new, blank frame. The cursor
+// is left wherever the last change was written.
+func (g *Grid) Flush(w *bufio.Writer) {
+	if g.clear {
+		ClearScreen(w)
+		g.front.eraseDisplay()
+		g.clear = false
+	}
+
+	// The style is always reset after a flush.
+	var style Style
+	// Where the terminal's cursor is, or -1 if it needs moving before the next write.
+	row, col := -1, -1
+	for r := range g.back.cells {
+		for c, cell := range g.back.cells[r] {
+			if g.front.cells[r][c] == cell {
+				continue
+			}
+			if r != row || c != col {
+				MoveCursor(w, r, c)
+				row, col = r, c
+			}
+			if cell.Style.Link != style.Link {
+				Hyperlink(w, cell.Style.Link)
+				style.Link = cell.Style.Link
+			}
+			if cell.Style != style {
+				w.WriteString(cell.Style.Code())
+				style = cell.Style
+			}
+			w.WriteRune(cell.Ch)
+			col++
+			// Writing the last column leaves the cursor waiting to wrap, so always move after.
+			if col == g.back.cols {
+				row, col = -1, -1
+			}
+		}
+	}
+	if style.Link != "" {
+		Hyperlink(w, "")
+		style.Link = ""
+	}
+	if style != (Style{}) {
+		w.WriteString(Style{}.Code())
+	}
+
+	g.front, g.back = g.back, g.front
+	g.back.eraseDisplay()
+	g.back.row, g.back.col, g.back.style, g.back.wrapNext = 0, 0, Style{}, false
+}
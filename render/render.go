@@ -0,0 +1,118 @@
+// Package render writes VT100 escape sequences to draw on the terminal.
+package render
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+)
+
+// Color is an SGR parameter, setting a color or text style.
+type Color int
+
+const (
+	// ANSI escape code, 27 in decimal.
+	EscapeChar = '\x1b'
+	// All ANSI escape sequences start with this char.
+	EscapeSeqBegin = '['
+
+	// Colors
+	Reset     Color = 0
+	Bold      Color = 1
+	Faint     Color = 2
+	Underline Color = 4
+	Inverted  Color = 7
+	FgRed     Color = 31
+	FgGreen   Color = 32
+	FgYellow  Color = 33
+	FgBlue    Color = 34
+	FgMagenta Color = 35
+	FgCyan    Color = 36
+	BgRed     Color = 41
+	BgBlue    Color = 44
+	BgCyan    Color = 46
+)
+
+// CursorShape is a DECSCUSR cursor style.
+type CursorShape int
+
+const (
+	CursorDefault   CursorShape = 0 // Whatever the terminal is configured to use
+	CursorBlock     CursorShape = 2
+	CursorUnderline CursorShape = 4
+	CursorBar       CursorShape = 6
+)
+
+// ColorCode returns an escape code string starting a color sequence.
+func ColorCode(c Color) string {
+	return fmt.Sprintf("%c%c%dm", EscapeChar, EscapeSeqBegin, c)
+}
+
+// MoveCursor moves the cursor to a 0-indexed row and column.
+func MoveCursor(w *bufio.Writer, row, col int) {
+	fmt.Fprintf(w, "%c%c%d;%dH", EscapeChar, EscapeSeqBegin, row+1, col+1)
+}
+
+// BeginSync starts a synchronized update (DEC mode 2026), the terminal holds off showing
+// anything written until EndSync so a frame is never seen half drawn. Terminals without
+// support ignore it.
+func BeginSync(w *bufio.Writer) {
+	fmt.Fprintf(w, "%c%c?2026h", EscapeChar, EscapeSeqBegin)
+}
+
+// EndSync finishes a synchronized update started by BeginSync.
+func EndSync(w *bufio.Writer) {
+	fmt.Fprintf(w, "%c%c?2026l", EscapeChar, EscapeSeqBegin)
+}
+
+// SetCursorShape changes how the cursor is drawn (DECSCUSR). Terminals without support ignore it.
+func SetCursorShape(w *bufio.Writer, shape CursorShape) {
+	fmt.Fprintf(w, "%c%c%d q", EscapeChar, EscapeSeqBegin, shape)
+}
+
+// SetTitle sets the terminal window and icon title (OSC 0).
+func SetTitle(w *bufio.Writer, title string) {
+	fmt.Fprintf(w, "%c]0;%s\a", EscapeChar, title)
+}
+
+// PushTitle saves the terminal's title on its title stack (XTWINOPS 22), to be put back with
+// PopTitle.
+func PushTitle(w *bufio.Writer) {
+	fmt.Fprintf(w, "%c%c22;0t", EscapeChar, EscapeSeqBegin)
+}
+
+// PopTitle restores the title last saved by PushTitle.
+func PopTitle(w *bufio.Writer) {
+	fmt.Fprintf(w, "%c%c23;0t", EscapeChar, EscapeSeqBegin)
+}
+
+// ReportFocus turns focus reporting (DEC mode 1004) on or off. While on, the terminal sends
+// ESC [ I when its window gains focus and ESC [ O when it loses it.
+func ReportFocus(w *bufio.Writer, on bool) {
+	if on {
+		fmt.Fprintf(w, "%c%c?1004h", EscapeChar, EscapeSeqBegin)
+	} else {
+		fmt.Fprintf(w, "%c%c?1004l", EscapeChar, EscapeSeqBegin)
+	}
+}
+
+// CopyToClipboard asks the terminal to put text on the system clipboard (OSC 52). Terminals
+// without support, or with it turned off, ignore it.
+func CopyToClipboard(w *bufio.Writer, text string) {
+	fmt.Fprintf(w, "%c]52;c;%s\a", EscapeChar, base64.StdEncoding.EncodeToString([]byte(text)))
+}
+
+// Hyperlink makes the text written after it a link to url (OSC 8), until another Hyperlink.
+// An empty url ends the link.
+func Hyperlink(w *bufio.Writer, url string) {
+	fmt.Fprintf(w, "%c]8;;%s\a", EscapeChar, url)
+}
+
+// ClearScreen clears the entire terminal display, but doesn't flush the writer.
+func ClearScreen(w *bufio.Writer) {
+	// "Cursor Position" to top left.
+	fmt.Fprintf(w, "%c%cH", EscapeChar, EscapeSeqBegin)
+
+	// "Erase in Display", Ps == 2 indicates all of the display should be erased.
+	fmt.Fprintf(w, "%c%c2J", EscapeChar, EscapeSeqBegin)
+}
@@ -0,0 +1,277 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Style is how a cell is drawn, as set by SGR and OSC 8 escape sequences. The zero Style is the
+// terminal's default.
+type Style struct {
+	Bold, Faint, Underline, Inverted bool
+	Fg, Bg                           Color  // 0 for the default color
+	Link                             string // Target of an OSC 8 hyperlink, "" for none
+}
+
+// Code returns the escape sequence that draws in style, whatever style was in use before. The
+// link isn't included, see Hyperlink.
+func (st Style) Code() string {
+	params := []string{"0"}
+	add := func(on bool, c Color) {
+		if on {
+			params = append(params, strconv.Itoa(int(c)))
+		}
+	}
+	add(st.Bold, Bold)
+	add(st.Faint, Faint)
+	add(st.Underline, Underline)
+	add(st.Inverted, Inverted)
+	add(st.Fg != 0, st.Fg)
+	add(st.Bg != 0, st.Bg)
+	return fmt.Sprintf("%c%c%sm", EscapeChar, EscapeSeqBegin, strings.Join(params, ";"))
+}
+
+// Cell is one character on the screen.
+type Cell struct {
+	Ch    rune
+	Style Style
+}
+
+var blank = Cell{Ch: ' '}
+
+// Screen is a grid of characters updated by writing the same output as would be sent to
+// the terminal. Only the escape sequences zi uses are understood, others are ignored.
+type Screen struct {
+	cells      [][]Cell
+	style      Style // Used for characters written from now on
+	row, col   int
+	wrapNext   bool   // The last column was just written, the next character wraps
+	pending    []byte // Incomplete escape sequence or UTF-8 character from the last write
+	rows, cols int
+}
+
+// NewScreen returns a blank screen of the given size.
+func NewScreen(rows, cols int) *Screen {
+	s := &Screen{rows: rows, cols: cols}
+	s.eraseDisplay()
+	return s
+}
+
+func (s *Screen) eraseDisplay() {
+	s.cells = make([][]Cell, s.rows)
+	for i := range s.cells {
+		s.cells[i] = blankRow(s.cols)
+	}
+}
+
+func blankRow(cols int) []Cell {
+	row := make([]Cell, cols)
+	for i := range row {
+		row[i] = blank
+	}
+	return row
+}
+
+func (s *Screen) Write(p []byte) (int, error) {
+	data := append(s.pending, p...)
+	s.pending = nil
+	for len(data) > 0 {
+		n := s.consume(data)
+		if n == 0 {
+			s.pending = append([]byte(nil), data...)
+			break
+		}
+		data = data[n:]
+	}
+	return len(p), nil
+}
+
+// consume handles the control sequence or character at the start of data, returning how many
+// bytes it used or 0 if data ends part way through.
+func (s *Screen) consume(data []byte) int {
+	switch data[0] {
+	case EscapeChar:
+		if len(data) < 2 {
+			return 0
+		}
+		if data[1] == ']' {
+			// Operating system commands end with BEL or ST, ESC \.
+			for i := 2; i < len(data); i++ {
+				if data[i] == '\a' {
+					s.osc(string(data[2:i]))
+					return i + 1
+				}
+				if data[i] == EscapeChar && i+1 < len(data) && data[i+1] == '\\' {
+					s.osc(string(data[2:i]))
+					return i + 2
+				}
+			}
+			return 0
+		}
+		if data[1] != EscapeSeqBegin {
+			return 2
+		}
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				s.csi(string(data[2:i]), data[i])
+				return i + 1
+			}
+		}
+		return 0
+	case '\r':
+		s.col, s.wrapNext = 0, false
+		return 1
+	case '\n':
+		s.lineFeed()
+		return 1
+	}
+
+	if !utf8.FullRune(data) {
+		return 0
+	}
+	r, n := utf8.DecodeRune(data)
+	if r >= ' ' {
+		s.put(r)
+	}
+	return n
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrapNext {
+		s.col, s.wrapNext = 0, false
+		s.lineFeed()
+	}
+	s.cells[s.row][s.col] = Cell{Ch: r, Style: s.style}
+	if s.col == s.cols-1 {
+		s.wrapNext = true
+	} else {
+		s.col++
+	}
+}
+
+func (s *Screen) lineFeed() {
+	s.wrapNext = false
+	if s.row < s.rows-1 {
+		s.row++
+		return
+	}
+	copy(s.cells, s.cells[1:])
+	s.cells[s.rows-1] = blankRow(s.cols)
+}
+
+// csi handles a "Control Sequence Introducer" sequence, ESC [ params final.
+func (s *Screen) csi(params string, final byte) {
+	switch final {
+	case 'H':
+		row, col := 1, 1
+		if params != "" {
+			parts := strings.SplitN(params, ";", 2)
+			row, _ = strconv.Atoi(parts[0])
+			if len(parts) > 1 {
+				col, _ = strconv.Atoi(parts[1])
+			}
+		}
+		s.row = clamp(row-1, 0, s.rows-1)
+		s.col = clamp(col-1, 0, s.cols-1)
+		s.wrapNext = false
+	case 'J':
+		if params == "2" {
+			s.eraseDisplay()
+		}
+	case 'K':
+		// Erase to the end of the line by default, 1 erases to the cursor and 2 the whole line.
+		from, to := s.col, s.cols-1
+		switch params {
+		case "1":
+			from, to = 0, s.col
+		case "2":
+			from = 0
+		}
+		for c := from; c <= to; c++ {
+			s.cells[s.row][c] = blank
+		}
+	case 'm':
+		s.sgr(params)
+	}
+}
+
+// osc handles an "Operating System Command". Only hyperlinks change the screen, others such as
+// setting the title are ignored.
+func (s *Screen) osc(cmd string) {
+	// ESC ] 8 ; params ; uri, where an empty uri ends the link.
+	fields := strings.SplitN(cmd, ";", 3)
+	if len(fields) == 3 && fields[0] == "8" {
+		s.style.Link = fields[2]
+	}
+}
+
+// sgr handles "Select Graphic Rendition", setting the style of following characters.
+func (s *Screen) sgr(params string) {
+	for _, p := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(p)
+		switch c := Color(n); {
+		case c == Reset:
+			s.style = Style{Link: s.style.Link}
+		case c == Bold:
+			s.style.Bold = true
+		case c == Faint:
+			s.style.Faint = true
+		case c == Underline:
+			s.style.Underline = true
+		case c == Inverted:
+			s.style.Inverted = true
+		case n == 22:
+			s.style.Bold, s.style.Faint = false, false
+		case n == 24:
+			s.style.Underline = false
+		case n == 27:
+			s.style.Inverted = false
+		case n >= 30 && n <= 37, n >= 90 && n <= 97:
+			s.style.Fg = c
+		case n == 39:
+			s.style.Fg = 0
+		case n >= 40 && n <= 47, n >= 100 && n <= 107:
+			s.style.Bg = c
+		case n == 49:
+			s.style.Bg = 0
+		}
+	}
+}
+
+func clamp(n, lo, hi int) int {
+	if n < lo {
+		return lo
+	}
+	if n > hi {
+		return hi
+	}
+	return n
+}
+
+// Lines returns the text on each row of the screen, without trailing spaces.
+func (s *Screen) Lines() []string {
+	lines := make([]string, len(s.cells))
+	for i, line := range s.cells {
+		var sb strings.Builder
+		for _, c := range line {
+			sb.WriteRune(c.Ch)
+		}
+		lines[i] = strings.TrimRight(sb.String(), " ")
+	}
+	return lines
+}
+
+// Cursor returns the 0-indexed row and column of the cursor.
+func (s *Screen) Cursor() (int, int) {
+	return s.row, s.col
+}
+
+// Dump writes the screen as plain text, without trailing spaces.
+func (s *Screen) Dump(w io.Writer) {
+	for _, line := range s.Lines() {
+		fmt.Fprintln(w, line)
+	}
+}
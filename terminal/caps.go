@@ -0,0 +1,87 @@
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Caps are the optional features a terminal supports, so escape sequences for them are only sent
+// where they'll work.
+// Only features zi has a use for are asked about: it draws with the 16 basic colors and doesn't
+// turn on mouse reporting or bracketed paste.
+type Caps struct {
+	FocusEvents bool // Focus reporting, mode 1004
+	SyncOutput  bool // Synchronized output, mode 2026
+}
+
+// Private modes asked about with DECRQM.
+const (
+	modeFocusEvents = 1004
+	modeSyncOutput  = 2026
+)
+
+// WriteCapsQuery asks the terminal whether each private mode in Caps is supported (DECRQM),
+// followed by its primary device attributes (DA1). Every terminal answers DA1, so its reply
+// marks the end of the replies, see ParseCapsReplies.
+func WriteCapsQuery(w io.Writer) {
+	for _, mode := range []int{modeFocusEvents, modeSyncOutput} {
+		fmt.Fprintf(w, "\x1b[?%d$p", mode)
+	}
+	io.WriteString(w, "\x1b[c")
+}
+
+// ParseCapsReplies sets the features in caps which the terminal's replies to WriteCapsQuery,
+// read so far into data, say are supported. Anything else in data, such as keys typed at the
+// same time, is returned in rest. done reports whether all the replies have been read.
+func ParseCapsReplies(data []byte, caps *Caps) (rest []byte, done bool) {
+	for i := 0; i < len(data); {
+		if !strings.HasPrefix(string(data[i:]), "\x1b[?") {
+			rest = append(rest, data[i])
+			i++
+			continue
+		}
+		// Parameters and intermediate bytes run up to the final byte.
+		j := i + 3
+		for j < len(data) && (data[j] < 0x40 || data[j] > 0x7e) {
+			j++
+		}
+		if j == len(data) {
+			// The rest of the reply hasn't been read yet.
+			return rest, false
+		}
+		params := string(data[i+3 : j])
+		switch data[j] {
+		case 'c':
+			done = true
+		case 'y':
+			caps.setMode(strings.TrimSuffix(params, "$"))
+		default:
+			rest = append(rest, data[i:j+1]...)
+		}
+		i = j + 1
+	}
+	return rest, done
+}
+
+// setMode handles a DECRQM reply, "mode;value". The mode can be used if it's set or reset (1 or
+// 2) or permanently set (3), but not if it's permanently reset (4) or not recognised (0).
+func (c *Caps) setMode(params string) {
+	mode, value, ok := strings.Cut(params, ";")
+	if !ok {
+		return
+	}
+	m, err1 := strconv.Atoi(mode)
+	v, err2 := strconv.Atoi(value)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	supported := v >= 1 && v <= 3
+	switch m {
+	case modeFocusEvents:
+		c.FocusEvents = supported
+	case modeSyncOutput:
+		c.SyncOutput = supported
+	}
+}
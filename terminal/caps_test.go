@@ -0,0 +1,29 @@
+package terminal
+
+import "testing"
+
+func TestParseCapsReplies(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Caps
+		rest string
+		done bool
+	}{
+		{"all supported", "\x1b[?1004;2$y\x1b[?2026;1$y\x1b[?62;22c", Caps{FocusEvents: true, SyncOutput: true}, "", true},
+		{"not recognised", "\x1b[?1004;0$y\x1b[?2026;4$y\x1b[?62c", Caps{}, "", true},
+		{"keys typed meanwhile", "ab\x1b[?1004;2$yc\x1b[?62c", Caps{FocusEvents: true}, "abc", true},
+		{"reply cut short", "x\x1b[?2026;", Caps{}, "x", false},
+		{"no device attributes yet", "\x1b[?2026;2$y", Caps{SyncOutput: true}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var caps Caps
+			rest, done := ParseCapsReplies([]byte(tt.data), &caps)
+			if caps != tt.want || string(rest) != tt.rest || done != tt.done {
+				t.Errorf("ParseCapsReplies(%q) = %+v, %q, %v, want %+v, %q, %v",
+					tt.data, caps, rest, done, tt.want, tt.rest, tt.done)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package terminal puts the terminal into raw mode, so keys can be read as they're pressed. Raw
+// mode itself comes from golang.org/x/term, this adds what zi needs on top of it, such as VT
+// output on Windows and resize notifications.
+package terminal
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Size is the number of rows and columns in the terminal.
+type Size struct {
+	Row, Col uint16
+}
+
+// State is the terminal's settings from before EnableRawMode.
+type State struct {
+	term *term.State
+	out  uint32 // Console output mode, only used on Windows
+}
+
+// EnableRawMode puts fd into raw mode and returns the previous state of the terminal. Reads block
+// until at least one byte is available, with no timeout, and Ctrl-C, Ctrl-Z and friends are read
+// as keys rather than sending signals.
+func EnableRawMode(fd int) (*State, error) {
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	st := &State{term: old}
+	if err := enableVTOutput(st); err != nil {
+		_ = term.Restore(fd, old)
+		return nil, err
+	}
+	return st, nil
+}
+
+// DisableRawMode resets the terminal to the original state so that any special flags are cleared.
+func DisableRawMode(fd int, old *State) {
+	restoreOutput(old)
+	_ = term.Restore(fd, old.term)
+}
+
+// GetSize returns the size of the terminal fd refers to.
+func GetSize(fd int) (*Size, error) {
+	cols, rows, err := term.GetSize(sizeFd(fd))
+	if err != nil {
+		return nil, err
+	}
+	return &Size{Row: uint16(rows), Col: uint16(cols)}, nil
+}
+
+// TTY returns the file keypresses should be read from. Normally this is Stdin, but when content
+// is piped into zi the controlling terminal is opened directly instead.
+func TTY() (*os.File, error) {
+	if IsTerminal(os.Stdin) {
+		return os.Stdin, nil
+	}
+	return os.OpenFile(ttyPath, os.O_RDWR, 0)
+}
+
+// IsTerminal reports whether f refers to a terminal device.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// ttyPath is the controlling terminal, opened by TTY.
+const ttyPath = "/dev/tty"
+
+// enableVTOutput does nothing, unix terminals always interpret escape sequences.
+func enableVTOutput(st *State) error {
+	return nil
+}
+
+func restoreOutput(st *State) {}
+
+// sizeFd returns the file to ask for the size of the terminal fd refers to, which is fd itself.
+func sizeFd(fd int) int {
+	return fd
+}
+
+// WatchResize returns a channel which receives a value whenever the terminal fd refers to is
+// resized, on SIGWINCH.
+func WatchResize(fd int) <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, unix.SIGWINCH)
+	resized := make(chan struct{}, 1)
+	go func() {
+		for range sigs {
+			select {
+			case resized <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return resized
+}
@@ -0,0 +1,58 @@
+package terminal
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// ttyPath is the console's input, opened by TTY.
+const ttyPath = "CONIN$"
+
+// resizePoll is how often the console size is checked, Windows has no signal for it.
+const resizePoll = 250 * time.Millisecond
+
+// enableVTOutput switches the console written to by Stdout into VT output, so the same escape
+// sequences work as on a unix terminal. The previous mode is kept in st.
+func enableVTOutput(st *State) error {
+	out := windows.Handle(os.Stdout.Fd())
+	if err := windows.GetConsoleMode(out, &st.out); err != nil {
+		return err
+	}
+	// As with OPOST off on unix, \n doesn't imply \r.
+	mode := st.out | windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING | windows.DISABLE_NEWLINE_AUTO_RETURN
+	return windows.SetConsoleMode(out, mode)
+}
+
+func restoreOutput(st *State) {
+	_ = windows.SetConsoleMode(windows.Handle(os.Stdout.Fd()), st.out)
+}
+
+// sizeFd returns the file to ask for the size of the console. The input handle fd can't be asked
+// for its size, so the console written to by Stdout is used instead.
+func sizeFd(fd int) int {
+	return int(os.Stdout.Fd())
+}
+
+// WatchResize returns a channel which receives a value whenever the console is resized. The
+// size is polled, since resizes are only otherwise reported as console input records, which
+// aren't read in VT input mode.
+func WatchResize(fd int) <-chan struct{} {
+	resized := make(chan struct{}, 1)
+	go func() {
+		last, _ := GetSize(fd)
+		for range time.Tick(resizePoll) {
+			size, err := GetSize(fd)
+			if err != nil || (last != nil && *size == *last) {
+				continue
+			}
+			last = size
+			select {
+			case resized <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return resized
+}